@@ -0,0 +1,10 @@
+package daemon
+
+import (
+	"strings"
+)
+
+// isAbstractSocket 是否为抽象命名空间的unix socket，地址以@开头，不在文件系统中创建文件
+func isAbstractSocket(address string) bool {
+	return strings.HasPrefix(address, "@")
+}
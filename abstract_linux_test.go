@@ -0,0 +1,77 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+)
+
+func TestAbstractSockets(t *testing.T) {
+	name := fmt.Sprintf("@daemon-test-%d", os.Getpid())
+	object := Default().SetControlSocket(name + "-control").SetListeners(
+		ListenerSpec{Name: "app", Network: "unix", Address: name},
+	)
+	if err := object.serveControl(); nil != err {
+		t.Fatal(err)
+	}
+	if _, err := QueryControl(name+"-control", StatusRequest); nil != err {
+		t.Fatal(err)
+	}
+	object.closeControl()
+
+	specs, lnFiles, err := object.listen(object.listenerSpecs)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if name != specs[0].Address {
+		t.Fatal(specs[0].Address)
+	}
+	ln, err := net.FileListener(lnFiles["app"])
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conn, err := net.Dial("unix", name)
+	if nil != err {
+		t.Fatal(err)
+	}
+	conn.Close()
+	lnFiles["app"].Close()
+	for _, path := range []string{name, name + "-control"} {
+		if _, err = os.Stat(path); !os.IsNotExist(err) {
+			t.Fatal(path, err)
+		}
+	}
+}
+
+func TestCheckControlPeer(t *testing.T) {
+	name := fmt.Sprintf("@daemon-test-peer-%d", os.Getpid())
+	ln, err := net.Listen("unix", name)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	client, err := net.Dial("unix", name)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	conn, err := ln.Accept()
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err = checkControlPeer(conn); nil != err {
+		t.Fatal(err)
+	}
+
+	// 取不到内核凭证的连接一律拒绝
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+	if err = checkControlPeer(local); !errors.Is(err, ErrPeerCredentials) {
+		t.Fatal(err)
+	}
+}
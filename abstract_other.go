@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package daemon
+
+// isAbstractSocket 只有Linux支持抽象命名空间，@开头的地址按普通路径处理
+func isAbstractSocket(address string) bool {
+	return false
+}
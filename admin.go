@@ -0,0 +1,104 @@
+package daemon
+
+import (
+	"encoding/json"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/golang/glog"
+)
+
+// SetAdmin 设置守护进程自身的管理HTTP侦听，不传给子进程；network为tcp或unix
+func (object *Daemon) SetAdmin(network, address string) *Daemon {
+	object.adminNetwork = network
+	object.adminAddress = address
+	return object
+}
+
+// SetAdminDebug 在管理侦听上开启/debug/pprof/与/debug/vars，用于诊断守护进程自身
+// 的协程泄漏与锁竞争，默认关闭
+func (object *Daemon) SetAdminDebug(enablePprof, enableExpvar bool) *Daemon {
+	object.adminPprof = enablePprof
+	object.adminExpvar = enableExpvar
+	return object
+}
+
+// HandleAdmin 在管理侦听上注册处理函数
+func (object *Daemon) HandleAdmin(pattern string, handler http.Handler) *Daemon {
+	if nil == object.adminMux {
+		object.adminMux = http.NewServeMux()
+	}
+	object.adminMux.Handle(pattern, handler)
+	return object
+}
+
+// AdminAddr 管理侦听的实际地址，未开启时为nil
+func (object *Daemon) AdminAddr() net.Addr {
+	object.RLock()
+	defer object.RUnlock()
+	if nil == object.adminLn {
+		return nil
+	}
+	return object.adminLn.Addr()
+}
+
+// serveAdmin 开启管理侦听，返回关闭函数
+func (object *Daemon) serveAdmin() (closeFn func(), err error) {
+	closeFn = func() {}
+	if 0 >= len(object.adminAddress) {
+		return
+	}
+	removeSocketFile(object.adminNetwork, object.adminAddress)
+	var ln net.Listener
+	if ln, err = net.Listen(object.adminNetwork, object.adminAddress); nil != err {
+		return
+	}
+	mux := object.adminMux
+	if nil == mux {
+		mux = http.NewServeMux()
+	}
+	if object.adminPprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	if object.adminExpvar {
+		mux.HandleFunc("/debug/vars", object.serveVars)
+	}
+	if 0 < object.procStats.interval {
+		mux.HandleFunc("/metrics", object.serveMetrics)
+	}
+	object.handleHealthz(mux)
+	object.Lock()
+	object.adminLn = ln
+	object.Unlock()
+
+	srv := &http.Server{Handler: mux}
+	go func() {
+		if e := srv.Serve(ln); nil != e && http.ErrServerClosed != e {
+			glog.Error(e)
+		}
+	}()
+	closeFn = func() {
+		srv.Close()
+		removeSocketFile(object.adminNetwork, object.adminAddress)
+	}
+	return
+}
+
+// serveVars 全局expvar变量，另附守护进程状态
+func (object *Daemon) serveVars(w http.ResponseWriter, r *http.Request) {
+	vars := make(map[string]json.RawMessage)
+	expvar.Do(func(kv expvar.KeyValue) {
+		vars[kv.Key] = json.RawMessage(kv.Value.String())
+	})
+	if raw, err := json.Marshal(object.Status()); nil == err {
+		vars["daemon"] = raw
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(vars)
+}
@@ -0,0 +1,125 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestAdminDebug(t *testing.T) {
+	object, signalCh, doneCh := startFakeParent(t, withSetup(func(object *Daemon) {
+		object.SetAdmin("tcp", "127.0.0.1:0").SetAdminDebug(true, true)
+	}))
+	base := "http://" + object.AdminAddr().String()
+
+	rsp, err := http.Get(base + "/debug/vars")
+	if nil != err {
+		t.Fatal(err)
+	}
+	var vars map[string]json.RawMessage
+	err = json.NewDecoder(rsp.Body).Decode(&vars)
+	rsp.Body.Close()
+	if _, ok := vars["memstats"]; nil != err || !ok {
+		t.Fatal(err, vars)
+	}
+	var status Status
+	if err = json.Unmarshal(vars["daemon"], &status); nil != err || StatusRunning != status.Phase {
+		t.Fatal(err, status)
+	}
+
+	if rsp, err = http.Get(base + "/debug/pprof/goroutine?debug=1"); nil != err {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	if http.StatusOK != rsp.StatusCode || 0 >= len(body) {
+		t.Fatal(rsp.Status)
+	}
+
+	signalCh <- syscall.SIGTERM
+	if err = <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+	if _, err = http.Get(base + "/debug/vars"); nil == err {
+		t.Fatal("admin listener not closed")
+	}
+}
+
+func TestAdminHealthz(t *testing.T) {
+	var silent int32
+	object, signalCh, doneCh := startFakeParent(t, withChild(func(xCmdObj *XCmd, args []string) error {
+		// 准备好后持续发送心跳，silent置位时暂停
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		go func() {
+			ticker := time.NewTicker(10 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stopCh:
+					return
+				case <-ticker.C:
+					if 0 == atomic.LoadInt32(&silent) {
+						xCmdObj.ChildWriteStream(StreamHeartbeat, []byte{0})
+					}
+				}
+			}
+		}()
+		return fakeChild(xCmdObj, args)
+	}), withSetup(func(object *Daemon) {
+		object.SetAdmin("tcp", "127.0.0.1:0").
+			SetLivenessTimeout(100 * time.Millisecond).
+			SetReadyTimeout(100 * time.Millisecond).
+			SetDrainTimeout(100 * time.Millisecond)
+	}))
+	healthz := func() (int, string) {
+		rsp, err := http.Get("http://" + object.AdminAddr().String() + "/healthz")
+		if nil != err {
+			t.Fatal(err)
+		}
+		defer rsp.Body.Close()
+		body, _ := ioutil.ReadAll(rsp.Body)
+		return rsp.StatusCode, string(body)
+	}
+	unhealthy := func(reason string) func() bool {
+		return func() bool {
+			code, body := healthz()
+			return http.StatusServiceUnavailable == code && strings.Contains(body, reason)
+		}
+	}
+
+	if code, body := healthz(); http.StatusOK != code {
+		t.Fatal(code, body)
+	}
+
+	// 心跳中断
+	atomic.StoreInt32(&silent, 1)
+	waitFor(t, unhealthy("heartbeat missing"))
+	atomic.StoreInt32(&silent, 0)
+	waitFor(t, func() bool { code, _ := healthz(); return http.StatusOK == code })
+
+	// 更新超过期限
+	object.setPhase(StatusUpgrading)
+	if code, body := healthz(); http.StatusOK != code {
+		t.Fatal(code, body)
+	}
+	waitFor(t, unhealthy("upgrade exceeded"))
+
+	// 重启次数用尽
+	object.setPhase(StatusFailed)
+	waitFor(t, unhealthy(ErrRestartBudgetExhausted.Error()))
+	object.setPhase(StatusRunning)
+
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,30 @@
+package daemon
+
+// SetCPUAffinity 把每个工作进程的子进程绑定到perWorker个CPU：
+// 第i个工作进程使用父进程可用CPU中从i*perWorker起的perWorker个，超出时回绕，
+// 提升对延迟敏感的网络服务的缓存局部性。子进程启动时绑定自身的全部线程，
+// 目前仅支持Linux，其他平台忽略；0为不绑定
+func (object *Daemon) SetCPUAffinity(perWorker int) *Daemon {
+	object.cpusPerWorker = perWorker
+	return object
+}
+
+// workerCPUs 工作进程绑定的CPU，不绑定时为nil
+func (object *Daemon) workerCPUs() []int {
+	if 0 >= object.cpusPerWorker {
+		return nil
+	}
+	available := availableCPUs()
+	if 0 >= len(available) {
+		return nil
+	}
+	perWorker := object.cpusPerWorker
+	if perWorker > len(available) {
+		perWorker = len(available)
+	}
+	cpus := make([]int, 0, perWorker)
+	for i := 0; i < perWorker; i++ {
+		cpus = append(cpus, available[(object.workerIndex*perWorker+i)%len(available)])
+	}
+	return cpus
+}
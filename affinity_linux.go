@@ -0,0 +1,45 @@
+package daemon
+
+import (
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// availableCPUs 当前进程可用的CPU，受taskset与cgroup cpuset限制
+func availableCPUs() (cpus []int) {
+	var set unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &set); nil != err {
+		return
+	}
+	for i := 0; i < len(set)*64; i++ {
+		if set.IsSet(i) {
+			cpus = append(cpus, i)
+		}
+	}
+	return
+}
+
+// pinCPUs 把当前进程已有的全部线程绑定到cpus，之后创建的线程继承绑定
+func pinCPUs(cpus []int) error {
+	var set unix.CPUSet
+	for _, cpu := range cpus {
+		set.Set(cpu)
+	}
+	entries, err := os.ReadDir("/proc/self/task")
+	if nil != err {
+		return unix.SchedSetaffinity(0, &set)
+	}
+	for _, entry := range entries {
+		tid, e := strconv.Atoi(entry.Name())
+		if nil != e {
+			continue
+		}
+		// 线程可能已退出
+		if e = unix.SchedSetaffinity(tid, &set); nil != e && unix.ESRCH != e {
+			return e
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package daemon
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestCPUAffinity(t *testing.T) {
+	available := availableCPUs()
+	if 0 >= len(available) {
+		t.Fatal("no cpus")
+	}
+	object := Default()
+	if cpus := object.workerCPUs(); nil != cpus {
+		t.Fatal(cpus)
+	}
+	object.SetCPUAffinity(1)
+	for index := 0; index < 2*len(available); index++ {
+		object.workerIndex = index
+		if cpus := object.workerCPUs(); !reflect.DeepEqual([]int{available[index%len(available)]}, cpus) {
+			t.Fatal(index, cpus)
+		}
+	}
+	object.SetCPUAffinity(len(available) + 1)
+	if cpus := object.workerCPUs(); len(available) != len(cpus) {
+		t.Fatal(cpus)
+	}
+
+	// 绑定后恢复
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer pinCPUs(available)
+	if err := pinCPUs(available[:1]); nil != err {
+		t.Fatal(err)
+	}
+	var set unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &set); nil != err || 1 != set.Count() || !set.IsSet(available[0]) {
+		t.Fatal(set, err)
+	}
+}
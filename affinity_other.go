@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package daemon
+
+// availableCPUs 不支持
+func availableCPUs() []int {
+	return nil
+}
+
+// pinCPUs 不支持
+func pinCPUs(cpus []int) error {
+	return nil
+}
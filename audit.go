@@ -0,0 +1,125 @@
+package daemon
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// 审计动作
+const (
+	AuditStart          = "start"           // 守护进程启动
+	AuditSpawn          = "spawn"           // 派生子进程
+	AuditKill           = "kill"            // 强杀子进程
+	AuditSignal         = "signal"          // 收到信号
+	AuditUpgrade        = "upgrade"         // 开始更新
+	AuditUpgradeRefused = "upgrade_refused" // 拒绝更新
+	AuditUpgradeDone    = "upgrade_done"    // 更新完成
+	AuditRollback       = "rollback"        // 更新失败，保留旧子进程
+	AuditRestart        = "restart"         // 子进程意外退出后重启
+	AuditScale          = "scale"           // 调整工作进程数
+	AuditStop           = "stop"            // 停服
+	AuditExit           = "exit"            // 守护进程退出
+)
+
+// AuditRecord 守护进程自身动作的审计记录，每行一条JSON
+type AuditRecord struct {
+	Time        time.Time         `json:"time"`                     // 时间
+	Action      string            `json:"action"`                   // 动作
+	Correlation string            `json:"correlation_id,omitempty"` // 同一次启动、更新、重启或停服的关联ID
+	Pid         int               `json:"pid"`                      // 守护进程ID
+	ChildPid    int               `json:"child_pid,omitempty"`      // 相关子进程ID
+	Worker      int               `json:"worker"`                   // 子进程序号
+	Generation  uint64            `json:"generation,omitempty"`     // 子进程代数
+	Fields      map[string]string `json:"fields,omitempty"`         // 附加字段
+}
+
+// auditLog 审计日志，工作进程与主守护进程共用
+type auditLog struct {
+	sink        *logRotator  // 审计文件
+	correlation atomic.Value // 当前操作的关联ID
+}
+
+// SetAuditLog 设置审计日志，记录派生、信号、强杀、更新决策与回退等动作，
+// 独立于应用日志；超过maxSize字节时轮转，保留maxBackups个旧文件
+func (object *Daemon) SetAuditLog(path string, maxSize int64, maxBackups int) *Daemon {
+	object.audit = &auditLog{
+		sink: &logRotator{
+			path:       path,
+			maxSize:    maxSize,
+			maxBackups: maxBackups,
+		},
+	}
+	return object
+}
+
+// beginOperation 开始新的操作，之后的审计记录使用新的关联ID
+func (object *Daemon) beginOperation() string {
+	if nil == object.audit {
+		return ""
+	}
+	raw := make([]byte, 8)
+	rand.Read(raw)
+	id := hex.EncodeToString(raw)
+	object.audit.correlation.Store(id)
+	return id
+}
+
+// auditAction 写一条审计记录，xCmdObj可为空
+func (object *Daemon) auditAction(action string, xCmdObj *XCmd, fields map[string]string) {
+	if nil == object.audit {
+		return
+	}
+	record := AuditRecord{
+		Time:   time.Now(),
+		Action: action,
+		Pid:    os.Getpid(),
+		Worker: object.workerIndex,
+		Fields: fields,
+	}
+	if id, ok := object.audit.correlation.Load().(string); ok {
+		record.Correlation = id
+	}
+	if nil != xCmdObj {
+		record.ChildPid = xCmdObj.Pid()
+		record.Worker = xCmdObj.worker.Index
+		record.Generation = xCmdObj.worker.Generation
+	}
+	line, err := json.Marshal(record)
+	if nil != err {
+		glog.Error(err)
+		return
+	}
+	if _, err = object.audit.sink.Write(append(line, '\n')); nil != err {
+		glog.Error(err)
+	}
+}
+
+// killChild 强杀子进程并记录原因
+func (object *Daemon) killChild(xCmdObj *XCmd, reason string) error {
+	object.auditAction(AuditKill, xCmdObj, map[string]string{"reason": reason})
+	return xCmdObj.Kill()
+}
+
+// ReadAudit 读取审计日志
+func ReadAudit(path string) (records []AuditRecord, err error) {
+	var f *os.File
+	if f, err = os.Open(path); nil != err {
+		return
+	}
+	defer f.Close()
+	decoder := json.NewDecoder(f)
+	for decoder.More() {
+		var record AuditRecord
+		if err = decoder.Decode(&record); nil != err {
+			return
+		}
+		records = append(records, record)
+	}
+	return
+}
@@ -0,0 +1,85 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	object, signalCh, doneCh := startFakeParent(t, withSetup(func(object *Daemon) {
+		object.SetAuditLog(path, 0, 0)
+	}))
+	if err := object.Upgrade(); nil != err {
+		t.Fatal(err)
+	}
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+
+	records, err := ReadAudit(path)
+	if nil != err {
+		t.Fatal(err)
+	}
+	var actions []string
+	correlations := make(map[string]string)
+	for _, record := range records {
+		if 0 >= len(record.Correlation) || os.Getpid() != record.Pid {
+			t.Fatal(record)
+		}
+		actions = append(actions, record.Action)
+		if _, ok := correlations[record.Action]; !ok {
+			correlations[record.Action] = record.Correlation
+		}
+	}
+	expected := []string{AuditStart, AuditSpawn, AuditUpgrade, AuditSpawn, AuditKill,
+		AuditUpgradeDone, AuditSignal, AuditStop, AuditKill, AuditExit}
+	if len(expected) != len(actions) {
+		t.Fatal(actions)
+	}
+	for i := range expected {
+		if expected[i] != actions[i] {
+			t.Fatal(actions)
+		}
+	}
+	// 同一次更新的记录关联ID相同
+	if correlations[AuditUpgrade] != correlations[AuditUpgradeDone] ||
+		correlations[AuditStart] == correlations[AuditUpgrade] {
+		t.Fatal(correlations)
+	}
+}
+
+func TestAuditScaleRefused(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	object, signalCh, doneCh := startFakeParent(t, withSetup(func(object *Daemon) {
+		object.SetAuditLog(path, 0, 0)
+	}))
+	// 更新进行中时拒绝的调整不记审计
+	atomic.StoreInt32(&object.upgrading, 1)
+	if err := object.SetWorkers(2); !errors.Is(err, ErrUpgradeInProgress) {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&object.upgrading, 0)
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+
+	records, err := ReadAudit(path)
+	if nil != err {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		if AuditScale == record.Action {
+			t.Fatal(record)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package daemon
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// AutoscalePolicy 按子进程上报的负载自动调整工作进程数，
+// 负载为每个子进程自行定义的指标，如进行中的请求数、队列长度
+type AutoscalePolicy struct {
+	Min            int           // 最少工作进程数
+	Max            int           // 最多工作进程数
+	ScaleUpAbove   float64       // 平均负载高于该值时加一个工作进程
+	ScaleDownBelow float64       // 平均负载低于该值时减一个工作进程
+	Interval       time.Duration // 检查间隔
+	Cooldown       time.Duration // 两次调整的最小间隔
+}
+
+// decide 按平均负载计算目标工作进程数
+func (object *AutoscalePolicy) decide(average float64, workers int) int {
+	switch {
+	case average > object.ScaleUpAbove && workers < object.Max:
+		return workers + 1
+	case average < object.ScaleDownBelow && workers > object.Min:
+		return workers - 1
+	case workers < object.Min:
+		return object.Min
+	case workers > object.Max:
+		return object.Max
+	}
+	return workers
+}
+
+// SetAutoscale 设置自动扩缩容策略，子进程通过Registry.ReportLoad上报负载
+func (object *Daemon) SetAutoscale(policy AutoscalePolicy) *Daemon {
+	object.autoscale = &policy
+	return object
+}
+
+// ReportLoad 向父进程上报负载，前台运行时忽略
+func (object *Registry) ReportLoad(load float64) error {
+	if nil == object.parent {
+		return nil
+	}
+	raw := NewBuffer(8).WriteUint64(math.Float64bits(load))
+	return object.parent.ChildWriteStream(StreamLoad, raw.Slice(raw.ReadableBytes()))
+}
+
+// setLoad 记录子进程上报的负载
+func (object *XCmd) setLoad(raw []byte) {
+	bits, err := NewBuffer(0).WriteBytes(raw).TryReadUint64()
+	if nil != err {
+		glog.Error(err)
+		return
+	}
+	atomic.StoreUint64(&object.load, bits)
+	atomic.StoreInt32(&object.loadSet, 1)
+}
+
+// averageLoad 已上报负载的子进程的平均负载
+func (object *Daemon) averageLoad() (average float64, ok bool) {
+	object.RLock()
+	children := object.children()
+	object.RUnlock()
+	var sum float64
+	var reported int
+	for _, child := range children {
+		if 1 == atomic.LoadInt32(&child.loadSet) {
+			sum += math.Float64frombits(atomic.LoadUint64(&child.load))
+			reported++
+		}
+	}
+	if 0 >= reported {
+		return
+	}
+	return sum / float64(reported), true
+}
+
+// autoscaleOnce 检查一次负载，需要时调整工作进程数
+func (object *Daemon) autoscaleOnce() error {
+	if time.Since(object.lastScale) < object.autoscale.Cooldown || object.IsUpgrading() {
+		return nil
+	}
+	average, ok := object.averageLoad()
+	if !ok {
+		return nil
+	}
+	workers := object.Workers()
+	target := object.autoscale.decide(average, workers)
+	if target == workers {
+		return nil
+	}
+	glog.Infof("autoscale workers %d -> %d, average load %.2f", workers, target, average)
+	object.lastScale = time.Now()
+	return object.SetWorkers(target)
+}
+
+// watchAutoscale 定期检查负载
+func (object *Daemon) watchAutoscale(exitCh chan interface{}) {
+	if nil != object.autoscale && 0 < object.autoscale.Interval {
+		go object.every(object.autoscale.Interval, exitCh, object.autoscaleOnce)
+	}
+}
@@ -0,0 +1,47 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import "testing"
+
+func TestAutoscalePolicy(t *testing.T) {
+	policy := &AutoscalePolicy{Min: 1, Max: 3, ScaleUpAbove: 100, ScaleDownBelow: 10}
+	for _, c := range []struct {
+		average float64
+		workers int
+		target  int
+	}{
+		{150, 1, 2},
+		{150, 3, 3},
+		{5, 2, 1},
+		{5, 1, 1},
+		{50, 2, 2},
+		{50, 5, 3},
+	} {
+		if target := policy.decide(c.average, c.workers); c.target != target {
+			t.Fatal(c, target)
+		}
+	}
+}
+
+func TestReportLoad(t *testing.T) {
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		registry := newRegistry(nil)
+		registry.parent = xCmdObj
+		xCmdObj.ChildWrite([]byte(ReadyOK))
+		registry.ReportLoad(42.5)
+		return fakeChild(xCmdObj, args)
+	})
+	if _, ok := object.averageLoad(); ok {
+		t.Fatal("no child should report load")
+	}
+	if ok, err := object.replaceChildProcess(nil); !ok || nil != err {
+		t.Fatal(ok, err)
+	}
+	waitFor(t, func() bool {
+		average, ok := object.averageLoad()
+		return ok && 42.5 == average
+	})
+	stopFakeDaemon(t, object)
+}
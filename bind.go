@@ -0,0 +1,43 @@
+package daemon
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// BindRetry 启动时端口被占用的重试策略，如上一个守护进程或外部进程尚未释放端口；
+// 只重试EADDRINUSE，其他错误立即失败
+type BindRetry struct {
+	Attempts   int           // 最多尝试次数，不大于1时不重试
+	Backoff    time.Duration // 首次重试间隔，之后每次翻倍，默认100ms
+	MaxBackoff time.Duration // 重试间隔上限，默认5s
+}
+
+// SetBindRetry 设置端口被占用时的重试策略，默认不重试；Windows下由子进程独占绑定，只在交接期内重试
+func (object *Daemon) SetBindRetry(retry BindRetry) *Daemon {
+	if 0 >= retry.Backoff {
+		retry.Backoff = 100 * time.Millisecond
+	}
+	if 0 >= retry.MaxBackoff {
+		retry.MaxBackoff = 5 * time.Second
+	}
+	object.bindRetry = retry
+	return object
+}
+
+// bind 绑定一个侦听，端口被占用时按策略重试
+func (object BindRetry) bind(spec ListenerSpec, bind func() error) (err error) {
+	backoff := object.Backoff
+	for attempt := 1; ; attempt++ {
+		if err = bind(); nil == err || !addrInUse(err) || attempt >= object.Attempts {
+			return
+		}
+		glog.Warningf("listener %s(%s) address in use, retry in %v (%d/%d)",
+			spec.Name, spec.Address, backoff, attempt, object.Attempts)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > object.MaxBackoff {
+			backoff = object.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,58 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestBindFailure(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	sock := filepath.Join(t.TempDir(), "admin.sock")
+	object := Default().SetBindRetry(BindRetry{Attempts: 2, Backoff: 10 * time.Millisecond})
+	_, lnFiles, err := object.listen([]ListenerSpec{
+		{Name: "web", Network: "tcp", Address: "127.0.0.1:0"},
+		{Name: "api", Network: "tcp", Address: busy.Addr().String()},
+		{Name: "admin", Network: "unix", Address: sock},
+		{Name: "bad", Network: "tcp", Address: "127.0.0.1:-1"},
+	})
+	var bindErr *BindError
+	if nil != lnFiles || !errors.As(err, &bindErr) || !errors.Is(err, ErrPortBind) || !errors.Is(err, syscall.EADDRINUSE) {
+		t.Fatal(lnFiles, err)
+	}
+	if 2 != len(bindErr.Failures) || "api" != bindErr.Failures[0].Name || "bad" != bindErr.Failures[1].Name {
+		t.Fatal(err)
+	}
+	// 已绑定的unix socket文件被删除
+	if _, e := os.Stat(sock); !os.IsNotExist(e) {
+		t.Fatal(e)
+	}
+}
+
+func TestBindRetry(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	address := busy.Addr().String()
+	time.AfterFunc(50*time.Millisecond, func() {
+		busy.Close()
+	})
+	object := Default().SetBindRetry(BindRetry{Attempts: 20, Backoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+	_, lnFiles, err := object.listen([]ListenerSpec{{Name: "web", Network: "tcp", Address: address}})
+	if nil != err {
+		t.Fatal(err)
+	}
+	lnFiles["web"].Close()
+}
@@ -0,0 +1,75 @@
+package daemon
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// UpgradeTimeouts 替换子进程各阶段的超时，<=0表示不限
+type UpgradeTimeouts struct {
+	Spawn    time.Duration // 派生子进程，含加载机密、下发证书与机密
+	Ready    time.Duration // 等待新子进程准备好，同SetReadyTimeout
+	Drain    time.Duration // 等待旧子进程排空，同SetDrainTimeout
+	Exit     time.Duration // 强杀后等待旧子进程退出，超时后不再等待
+	Deadline time.Duration // 整个更新的期限，含协商、暂存与全部工作进程的替换
+}
+
+// SetUpgradeTimeouts 设置各阶段的超时：Spawn、Ready、Drain、Exit对每次替换子进程生效，含意外退出后的重启；
+// Deadline只约束更新，到期时尚未切换的子进程放弃替换，旧子进程继续服务，
+// 错误的Kind为ErrUpgradeDeadline，Phase为超出期限时所处的阶段。
+// 新子进程准备好后即切换，排空与退出不受Deadline约束
+func (object *Daemon) SetUpgradeTimeouts(timeouts UpgradeTimeouts) *Daemon {
+	object.spawnTimeout = timeouts.Spawn
+	object.readyTimeout = timeouts.Ready
+	object.drainTimeout = timeouts.Drain
+	object.exitTimeout = timeouts.Exit
+	object.deployDeadline = timeouts.Deadline
+	return object
+}
+
+// upgradeContext 更新的上下文，超过期限时以ErrUpgradeDeadline取消
+func (object *Daemon) upgradeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if 0 >= object.deployDeadline {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, object.deployDeadline, ErrUpgradeDeadline)
+}
+
+// withUpgrade ctx同时随更新的上下文取消，保留取消原因
+func withUpgrade(ctx, upgradeCtx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(upgradeCtx, func() {
+		cancel(context.Cause(upgradeCtx))
+	})
+	return ctx, func() {
+		stop()
+		cancel(nil)
+	}
+}
+
+// spawnPhaseContext 派生阶段的上下文，停服时中止，受派生超时与更新期限约束
+func (object *Daemon) spawnPhaseContext(upgradeCtx context.Context) (context.Context, context.CancelFunc) {
+	base, cancelBase := timeoutContext(object.spawnContext(), object.spawnTimeout)
+	ctx, cancel := withUpgrade(base, upgradeCtx)
+	return ctx, func() {
+		cancel()
+		cancelBase()
+	}
+}
+
+// waitExited 等待强杀后的子进程退出，最长exitTimeout
+func (object *Daemon) waitExited(child *XCmd) {
+	if 0 >= object.exitTimeout {
+		<-child.exited
+		return
+	}
+	timer := time.NewTimer(object.exitTimeout)
+	defer timer.Stop()
+	select {
+	case <-child.exited:
+	case <-timer.C:
+		glog.Error(newLifecycleError(PhaseExit, child.Pid(), ErrExitTimeout, nil))
+	}
+}
@@ -0,0 +1,144 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// blockingSecrets 直到ctx结束才返回的机密来源
+type blockingSecrets struct{}
+
+func (blockingSecrets) Secrets(ctx context.Context) (map[string][]byte, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestSpawnTimeout(t *testing.T) {
+	object, runner := newFakeDaemon(fakeChild)
+	object.SetUpgradeTimeouts(UpgradeTimeouts{Spawn: 50 * time.Millisecond, Ready: time.Minute}).
+		AddSecretProvider(blockingSecrets{})
+	_, err := object.replaceChildProcess(nil)
+	var lifecycleErr *LifecycleError
+	if !errors.Is(err, ErrSpawnTimeout) || !errors.As(err, &lifecycleErr) || PhaseSpawn != lifecycleErr.Phase {
+		t.Fatal(err)
+	}
+	if 0 != runner.Spawned() {
+		t.Fatal(runner.Spawned())
+	}
+}
+
+func TestUpgradeDeadline(t *testing.T) {
+	var spawned int32
+	object, signalCh, doneCh := startFakeParent(t, withChild(func(xCmdObj *XCmd, args []string) error {
+		if 1 < atomic.AddInt32(&spawned, 1) {
+			// 新子进程迟迟不准备好
+			return xCmdObj.ChildRead(func(raw []byte) bool { return nil != raw })
+		}
+		return fakeChild(xCmdObj, args)
+	}), withSetup(func(object *Daemon) {
+		object.SetUpgradeTimeouts(UpgradeTimeouts{
+			Ready:    time.Minute,
+			Drain:    time.Second,
+			Exit:     time.Second,
+			Deadline: 100 * time.Millisecond,
+		})
+	}))
+	pid := object.currentChild().Pid()
+
+	// 超出期限放弃替换，报告所处的阶段，旧子进程继续服务
+	start := time.Now()
+	err := object.Upgrade()
+	var lifecycleErr *LifecycleError
+	if !errors.Is(err, ErrUpgradeDeadline) || !errors.As(err, &lifecycleErr) || PhaseReady != lifecycleErr.Phase {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Fatal("deadline not enforced", time.Since(start))
+	}
+	if pid != object.currentChild().Pid() || StatusRunning != object.Status().Phase {
+		t.Fatal(object.currentChild().Pid(), object.Status())
+	}
+
+	signalCh <- syscall.SIGTERM
+	if err = <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+}
+
+// blockingAfterFirst 首次立即返回，之后直到ctx结束才返回的机密来源
+type blockingAfterFirst struct {
+	calls int32
+}
+
+func (object *blockingAfterFirst) Secrets(ctx context.Context) (map[string][]byte, error) {
+	if 1 == atomic.AddInt32(&object.calls, 1) {
+		return map[string][]byte{}, nil
+	}
+	return blockingSecrets{}.Secrets(ctx)
+}
+
+func TestPhaseTimeoutRollback(t *testing.T) {
+	for _, c := range []struct {
+		phase string
+		kind  error
+	}{
+		{PhaseSpawn, ErrSpawnTimeout},
+		{PhaseReady, ErrReadyTimeout},
+	} {
+		var spawned int32
+		history := filepath.Join(t.TempDir(), "history")
+		eventCh := make(chan Event, 1)
+		object, signalCh, doneCh := startFakeParent(t, withChild(func(xCmdObj *XCmd, args []string) error {
+			if PhaseReady == c.phase && 1 < atomic.AddInt32(&spawned, 1) {
+				// 新子进程迟迟不准备好
+				return xCmdObj.ChildRead(func(raw []byte) bool { return nil != raw })
+			}
+			return fakeChild(xCmdObj, args)
+		}), withSetup(func(object *Daemon) {
+			object.SetHistoryFile(history)
+			timeouts := UpgradeTimeouts{Ready: time.Minute, Drain: time.Second, Exit: time.Second}
+			if PhaseSpawn == c.phase {
+				timeouts.Spawn = 100 * time.Millisecond
+				object.AddSecretProvider(&blockingAfterFirst{})
+			} else {
+				timeouts.Ready = 100 * time.Millisecond
+			}
+			object.SetUpgradeTimeouts(timeouts)
+			object.OnEvent(func(event Event) {
+				if EventUpgradeFailed == event.Type {
+					eventCh <- event
+				}
+			})
+		}))
+		pid := object.currentChild().Pid()
+
+		// 超时的阶段与期限一样放弃替换，旧子进程继续服务
+		err := object.ForceUpgrade()
+		if !errors.Is(err, c.kind) || c.phase != failedPhase(err) {
+			t.Fatal(c.phase, err)
+		}
+		if pid != object.currentChild().Pid() || 1 != atomic.LoadInt32(&object.running) {
+			t.Fatal(c.phase, object.Status())
+		}
+		if event := <-eventCh; c.phase != event.Phase {
+			t.Fatal(c.phase, event)
+		}
+		records, err := ReadHistory(history)
+		if nil != err || 1 != len(records) || c.phase != records[0].Phase {
+			t.Fatal(c.phase, records, err)
+		}
+
+		signalCh <- syscall.SIGTERM
+		if err = <-doneCh; nil != err {
+			t.Fatal(c.phase, err)
+		}
+	}
+}
@@ -1,6 +1,14 @@
 package daemon
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// minReadSize ReadFrom每次读取前至少预留的空间
+const minReadSize = 512
 
 // buffer 缓冲区
 type buffer struct {
@@ -18,20 +26,30 @@ func NewBuffer(capacity int) *buffer {
 	}
 }
 
-// growth 增长
+// growth 增长，保证写索引之后至少有needSize字节可写
 func (object *buffer) growth(needSize int) *buffer {
-	if object.writeIndex+needSize > cap(object.Internal) {
+	required := object.writeIndex + needSize
+	if required > cap(object.Internal) {
 		size := 2 * cap(object.Internal)
-		if 0 == size {
-			size = needSize
+		if size < required {
+			size = required
 		}
 		copied := make([]byte, size)
-		copy(copied, object.Internal)
+		copy(copied, object.Internal[:object.writeIndex])
 		object.Internal = copied
 	}
 	return object
 }
 
+// Reset 清空缓冲区，保留存储
+func (object *buffer) Reset() *buffer {
+	object.readIndex = 0
+	object.writeIndex = 0
+	object.markedReadIndex = 0
+	object.markedWriteIndex = 0
+	return object
+}
+
 // IsEmpty 是否为空
 func (object *buffer) IsEmpty() bool {
 	return object.readIndex == object.writeIndex
@@ -123,6 +141,337 @@ func (object *buffer) ReadUint32() (v uint32) {
 	return
 }
 
+// WriteUint8 写Uint8
+func (object *buffer) WriteUint8(v uint8) *buffer {
+	object.growth(1)
+	object.Internal[object.writeIndex] = v
+	object.writeIndex++
+	return object
+}
+
+// ReadUint8 读Uint8
+func (object *buffer) ReadUint8() (v uint8) {
+	v = object.Internal[object.readIndex]
+	object.readIndex++
+	return
+}
+
+// WriteUint16 写Uint16
+func (object *buffer) WriteUint16(v uint16) *buffer {
+	object.growth(2)
+	binary.BigEndian.PutUint16(object.Internal[object.writeIndex:], v)
+	object.writeIndex += 2
+	return object
+}
+
+// ReadUint16 读Uint16
+func (object *buffer) ReadUint16() (v uint16) {
+	v = binary.BigEndian.Uint16(object.Internal[object.readIndex:])
+	object.readIndex += 2
+	return
+}
+
+// WriteUint64 写Uint64
+func (object *buffer) WriteUint64(v uint64) *buffer {
+	object.growth(8)
+	binary.BigEndian.PutUint64(object.Internal[object.writeIndex:], v)
+	object.writeIndex += 8
+	return object
+}
+
+// ReadUint64 读Uint64
+func (object *buffer) ReadUint64() (v uint64) {
+	v = binary.BigEndian.Uint64(object.Internal[object.readIndex:])
+	object.readIndex += 8
+	return
+}
+
+// WriteInt8 写Int8
+func (object *buffer) WriteInt8(v int8) *buffer {
+	return object.WriteUint8(uint8(v))
+}
+
+// ReadInt8 读Int8
+func (object *buffer) ReadInt8() int8 {
+	return int8(object.ReadUint8())
+}
+
+// WriteInt16 写Int16
+func (object *buffer) WriteInt16(v int16) *buffer {
+	return object.WriteUint16(uint16(v))
+}
+
+// ReadInt16 读Int16
+func (object *buffer) ReadInt16() int16 {
+	return int16(object.ReadUint16())
+}
+
+// WriteInt32 写Int32
+func (object *buffer) WriteInt32(v int32) *buffer {
+	return object.WriteUint32(uint32(v))
+}
+
+// ReadInt32 读Int32
+func (object *buffer) ReadInt32() int32 {
+	return int32(object.ReadUint32())
+}
+
+// WriteInt64 写Int64
+func (object *buffer) WriteInt64(v int64) *buffer {
+	return object.WriteUint64(uint64(v))
+}
+
+// ReadInt64 读Int64
+func (object *buffer) ReadInt64() int64 {
+	return int64(object.ReadUint64())
+}
+
+// WriteUvarint 写变长无符号整数
+func (object *buffer) WriteUvarint(v uint64) *buffer {
+	object.growth(binary.MaxVarintLen64)
+	object.writeIndex += binary.PutUvarint(object.Internal[object.writeIndex:], v)
+	return object
+}
+
+// ReadUvarint 读变长无符号整数
+func (object *buffer) ReadUvarint() (v uint64) {
+	var n int
+	v, n = binary.Uvarint(object.Internal[object.readIndex:object.writeIndex])
+	object.readIndex += n
+	return
+}
+
+// WriteVarint 写变长有符号整数
+func (object *buffer) WriteVarint(v int64) *buffer {
+	object.growth(binary.MaxVarintLen64)
+	object.writeIndex += binary.PutVarint(object.Internal[object.writeIndex:], v)
+	return object
+}
+
+// ReadVarint 读变长有符号整数
+func (object *buffer) ReadVarint() (v int64) {
+	var n int
+	v, n = binary.Varint(object.Internal[object.readIndex:object.writeIndex])
+	object.readIndex += n
+	return
+}
+
+// WriteLengthBytes 写带长度前缀的字节，长度为Uvarint
+func (object *buffer) WriteLengthBytes(bytes []byte) *buffer {
+	return object.WriteUvarint(uint64(len(bytes))).WriteBytes(bytes)
+}
+
+// ReadLengthBytes 读带长度前缀的字节，返回的切片为副本
+func (object *buffer) ReadLengthBytes() (bytes []byte) {
+	size := int(object.ReadUvarint())
+	bytes = make([]byte, size)
+	copy(bytes, object.Slice(size))
+	object.readIndex += size
+	return
+}
+
+// WriteString 写带长度前缀的字符串
+func (object *buffer) WriteString(s string) *buffer {
+	return object.WriteLengthBytes([]byte(s))
+}
+
+// ReadString 读带长度前缀的字符串
+func (object *buffer) ReadString() string {
+	return string(object.ReadLengthBytes())
+}
+
+// Peek 查看size字节，不移动读索引
+func (object *buffer) Peek(size int) []byte {
+	return object.Slice(size)
+}
+
+// PeekUint8 查看Uint8，不移动读索引
+func (object *buffer) PeekUint8() uint8 {
+	return object.Internal[object.readIndex]
+}
+
+// PeekUint16 查看Uint16，不移动读索引
+func (object *buffer) PeekUint16() uint16 {
+	return binary.BigEndian.Uint16(object.Internal[object.readIndex:])
+}
+
+// PeekUint32 查看Uint32，不移动读索引
+func (object *buffer) PeekUint32() uint32 {
+	return binary.BigEndian.Uint32(object.Internal[object.readIndex:])
+}
+
+// PeekUint64 查看Uint64，不移动读索引
+func (object *buffer) PeekUint64() uint64 {
+	return binary.BigEndian.Uint64(object.Internal[object.readIndex:])
+}
+
+// checkReadable 检查可读字节数，不足时返回ErrBufferUnderflow
+func (object *buffer) checkReadable(size int) error {
+	if 0 > size || size > object.ReadableBytes() {
+		return fmt.Errorf("%w: need %d, readable %d", ErrBufferUnderflow, size, object.ReadableBytes())
+	}
+	return nil
+}
+
+// ReadN 读取n字节，返回的切片引用内部存储，不足时不移动读索引
+func (object *buffer) ReadN(n int) (bytes []byte, err error) {
+	if err = object.checkReadable(n); nil != err {
+		return
+	}
+	bytes = object.Slice(n)
+	object.readIndex += n
+	return
+}
+
+// TryReadUint8 读Uint8，不足时返回错误
+func (object *buffer) TryReadUint8() (v uint8, err error) {
+	if err = object.checkReadable(1); nil == err {
+		v = object.ReadUint8()
+	}
+	return
+}
+
+// TryReadUint16 读Uint16，不足时返回错误
+func (object *buffer) TryReadUint16() (v uint16, err error) {
+	if err = object.checkReadable(2); nil == err {
+		v = object.ReadUint16()
+	}
+	return
+}
+
+// TryReadUint32 读Uint32，不足时返回错误
+func (object *buffer) TryReadUint32() (v uint32, err error) {
+	if err = object.checkReadable(4); nil == err {
+		v = object.ReadUint32()
+	}
+	return
+}
+
+// TryReadUint64 读Uint64，不足时返回错误
+func (object *buffer) TryReadUint64() (v uint64, err error) {
+	if err = object.checkReadable(8); nil == err {
+		v = object.ReadUint64()
+	}
+	return
+}
+
+// TryReadUvarint 读变长无符号整数，不完整或溢出时返回错误
+func (object *buffer) TryReadUvarint() (v uint64, err error) {
+	var n int
+	if v, n = binary.Uvarint(object.Internal[object.readIndex:object.writeIndex]); 0 >= n {
+		err = fmt.Errorf("%w: bad uvarint", ErrBufferUnderflow)
+		return
+	}
+	object.readIndex += n
+	return
+}
+
+// TryReadVarint 读变长有符号整数，不完整或溢出时返回错误
+func (object *buffer) TryReadVarint() (v int64, err error) {
+	var n int
+	if v, n = binary.Varint(object.Internal[object.readIndex:object.writeIndex]); 0 >= n {
+		err = fmt.Errorf("%w: bad varint", ErrBufferUnderflow)
+		return
+	}
+	object.readIndex += n
+	return
+}
+
+// TryReadLengthBytes 读带长度前缀的字节，不足时恢复读索引并返回错误
+func (object *buffer) TryReadLengthBytes() (bytes []byte, err error) {
+	readIndex := object.readIndex
+	var size uint64
+	if size, err = object.TryReadUvarint(); nil != err {
+		return
+	}
+	if uint64(object.ReadableBytes()) < size {
+		object.readIndex = readIndex
+		err = fmt.Errorf("%w: need %d, readable %d", ErrBufferUnderflow, size, object.ReadableBytes())
+		return
+	}
+	bytes = make([]byte, size)
+	copy(bytes, object.Slice(int(size)))
+	object.readIndex += int(size)
+	return
+}
+
+// TryReadString 读带长度前缀的字符串，不足时恢复读索引并返回错误
+func (object *buffer) TryReadString() (s string, err error) {
+	var bytes []byte
+	if bytes, err = object.TryReadLengthBytes(); nil == err {
+		s = string(bytes)
+	}
+	return
+}
+
+// Skip 跳过size字节
+func (object *buffer) Skip(size int) *buffer {
+	object.readIndex += size
+	return object
+}
+
+// Read 实现io.Reader，无可读数据时返回io.EOF
+func (object *buffer) Read(p []byte) (n int, err error) {
+	if object.IsEmpty() {
+		if 0 < len(p) {
+			err = io.EOF
+		}
+		return
+	}
+	n = copy(p, object.Internal[object.readIndex:object.writeIndex])
+	object.readIndex += n
+	return
+}
+
+// Write 实现io.Writer
+func (object *buffer) Write(p []byte) (n int, err error) {
+	object.WriteBytes(p)
+	n = len(p)
+	return
+}
+
+// ReadOnce 从r读取一次到可写空间，空间不足时扩容
+func (object *buffer) ReadOnce(r io.Reader) (n int, err error) {
+	if minReadSize > object.WriteableBytes() {
+		object.growth(minReadSize)
+	}
+	n, err = r.Read(object.Internal[object.writeIndex:])
+	if 0 < n {
+		object.writeIndex += n
+	}
+	return
+}
+
+// ReadFrom 实现io.ReaderFrom，读到io.EOF为止
+func (object *buffer) ReadFrom(r io.Reader) (n int64, err error) {
+	var m int
+	for {
+		m, err = object.ReadOnce(r)
+		n += int64(m)
+		if io.EOF == err {
+			err = nil
+			return
+		}
+		if nil != err {
+			return
+		}
+	}
+}
+
+// reserve 确保可容纳size字节的未读数据
+func (object *buffer) reserve(size int) {
+	object.DiscardReadBytes()
+	if size > object.ReadableBytes() {
+		object.growth(size - object.ReadableBytes())
+	}
+}
+
+// consume 消费size字节并丢弃已读数据
+func (object *buffer) consume(size int) {
+	object.Skip(size)
+	object.DiscardReadBytes()
+}
+
 // DiscardReadBytes 丢弃已读的数据
 func (object *buffer) DiscardReadBytes() *buffer {
 	copy(object.Internal, object.Internal[object.readIndex:object.writeIndex])
@@ -130,3 +479,32 @@ func (object *buffer) DiscardReadBytes() *buffer {
 	object.readIndex = 0
 	return object
 }
+
+// 缓冲区池
+const (
+	pooledBufferSize    = 1 << 16 // 池中缓冲区的初始容量
+	maxPooledBufferSize = 1 << 20 // 超过该容量的缓冲区不归还，避免长期占用大块内存
+)
+
+// bufferPool 缓冲区池，减少高频收发时的分配
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return NewBuffer(pooledBufferSize)
+	},
+}
+
+// getBuffer 从池中获取至少可写入capacity字节的空缓冲区
+func getBuffer(capacity int) *buffer {
+	object := bufferPool.Get().(*buffer)
+	object.Reset()
+	object.growth(capacity)
+	return object
+}
+
+// putBuffer 归还缓冲区
+func putBuffer(object *buffer) {
+	if maxPooledBufferSize < cap(object.Internal) {
+		return
+	}
+	bufferPool.Put(object)
+}
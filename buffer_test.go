@@ -0,0 +1,138 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestBufferPrimitives(t *testing.T) {
+	object := NewBuffer(4)
+	object.WriteUint8(0xab).
+		WriteUint16(0xabcd).
+		WriteUint32(0xdeadbeef).
+		WriteUint64(math.MaxUint64 - 1).
+		WriteInt8(-8).
+		WriteInt16(-16).
+		WriteInt32(-32).
+		WriteInt64(math.MinInt64).
+		WriteUvarint(300).
+		WriteVarint(-300).
+		WriteString("hello").
+		WriteLengthBytes([]byte{1, 2, 3})
+
+	if 0xab != object.PeekUint8() || 0xab != object.ReadUint8() {
+		t.Fatal("uint8")
+	}
+	if 0xabcd != object.PeekUint16() || 0xabcd != object.ReadUint16() {
+		t.Fatal("uint16")
+	}
+	if 0xdeadbeef != object.PeekUint32() || 0xdeadbeef != object.ReadUint32() {
+		t.Fatal("uint32")
+	}
+	if math.MaxUint64-1 != object.PeekUint64() || math.MaxUint64-1 != object.ReadUint64() {
+		t.Fatal("uint64")
+	}
+	if -8 != object.ReadInt8() || -16 != object.ReadInt16() || -32 != object.ReadInt32() || math.MinInt64 != object.ReadInt64() {
+		t.Fatal("signed")
+	}
+	if 300 != object.ReadUvarint() || -300 != object.ReadVarint() {
+		t.Fatal("varint")
+	}
+	if "hello" != object.ReadString() || !bytes.Equal([]byte{1, 2, 3}, object.ReadLengthBytes()) {
+		t.Fatal("length prefixed")
+	}
+	if !object.IsEmpty() {
+		t.Fatal(object.ReadableBytes())
+	}
+}
+
+func TestBufferIO(t *testing.T) {
+	object := NewBuffer(8)
+	raw := bytes.Repeat([]byte("0123456789"), 1000)
+	if n, err := io.Copy(object, io.LimitReader(bytes.NewReader(raw), int64(len(raw)))); nil != err || int64(len(raw)) != n {
+		t.Fatal(n, err)
+	}
+	var out bytes.Buffer
+	if n, err := io.Copy(&out, object); nil != err || int64(len(raw)) != n || !bytes.Equal(raw, out.Bytes()) {
+		t.Fatal(n, err)
+	}
+
+	// 配合标准库编解码
+	type message struct {
+		Name string
+	}
+	if err := json.NewEncoder(object).Encode(message{Name: "web"}); nil != err {
+		t.Fatal(err)
+	}
+	var got message
+	if err := json.NewDecoder(object).Decode(&got); nil != err || "web" != got.Name {
+		t.Fatal(err, got)
+	}
+	binary.Write(object, binary.BigEndian, uint32(7))
+	var v uint32
+	if err := binary.Read(object, binary.BigEndian, &v); nil != err || 7 != v {
+		t.Fatal(err, v)
+	}
+}
+
+func TestBufferBoundsChecked(t *testing.T) {
+	object := NewBuffer(16)
+	object.WriteUint16(1)
+	if _, err := object.TryReadUint32(); !errors.Is(err, ErrBufferUnderflow) {
+		t.Fatal(err)
+	}
+	if _, err := object.ReadN(3); !errors.Is(err, ErrBufferUnderflow) {
+		t.Fatal(err)
+	}
+	if v, err := object.TryReadUint16(); nil != err || 1 != v {
+		t.Fatal(v, err)
+	}
+	if _, err := object.TryReadUint8(); !errors.Is(err, ErrBufferUnderflow) {
+		t.Fatal(err)
+	}
+
+	// 长度前缀声明的长度超过可读数据，读索引不变
+	object.WriteUvarint(10).WriteBytes([]byte("abc"))
+	readIndex := object.GetReadIndex()
+	if _, err := object.TryReadString(); !errors.Is(err, ErrBufferUnderflow) || readIndex != object.GetReadIndex() {
+		t.Fatal(err)
+	}
+	if raw, err := object.ReadN(4); nil != err || "\x0aabc" != string(raw) {
+		t.Fatal(raw, err)
+	}
+	if _, err := object.TryReadUvarint(); !errors.Is(err, ErrBufferUnderflow) {
+		t.Fatal(err)
+	}
+}
+
+func TestBufferGrowth(t *testing.T) {
+	// 一次写入远大于容量的数据，不能被截断
+	object := NewBuffer(8 << 10)
+	object.WriteBytes([]byte("head"))
+	raw := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+	object.WriteBytes(raw)
+	if 4+len(raw) != object.ReadableBytes() || !bytes.Equal(raw, object.Peek(4 + len(raw))[4:]) {
+		t.Fatal(object.ReadableBytes())
+	}
+
+	// 零容量缓冲区
+	object = NewBuffer(0)
+	object.WriteUint64(1).WriteBytes(raw[:100])
+	if 108 != object.ReadableBytes() || 1 != object.ReadUint64() {
+		t.Fatal(object.ReadableBytes())
+	}
+
+	// io.Copy优先使用WriterTo，整块写入
+	object = NewBuffer(8)
+	if n, err := io.Copy(object, bytes.NewReader(raw)); nil != err || int64(len(raw)) != n {
+		t.Fatal(n, err)
+	}
+	if !bytes.Equal(raw, object.Slice(object.ReadableBytes())) {
+		t.Fatal(object.ReadableBytes())
+	}
+}
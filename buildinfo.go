@@ -0,0 +1,125 @@
+package daemon
+
+import (
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// ForceUpgradeRequest 强制更新，可执行文件未变化时也替换子进程
+const ForceUpgradeRequest = "ForceUpgrade"
+
+// BuildInfo 子进程在ReadyOK中上报的构建信息
+type BuildInfo struct {
+	Path      string `json:"path,omitempty"`       // 主模块路径
+	Version   string `json:"version,omitempty"`    // 主模块版本
+	Revision  string `json:"revision,omitempty"`   // VCS提交
+	Time      string `json:"time,omitempty"`       // VCS提交时间
+	Modified  bool   `json:"modified,omitempty"`   // 工作区是否有未提交的修改
+	GoVersion string `json:"go_version,omitempty"` // 编译器版本
+	Checksum  string `json:"checksum,omitempty"`   // 可执行文件SHA-256
+}
+
+// ReadBuildInfo 当前进程的构建信息
+func ReadBuildInfo() (info BuildInfo) {
+	if _, sum, err := binaryChecksum(); nil == err {
+		info.Checksum = sum
+	}
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	info.Path = buildInfo.Main.Path
+	info.Version = buildInfo.Main.Version
+	info.GoVersion = buildInfo.GoVersion
+	for _, setting := range buildInfo.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.Time = setting.Value
+		case "vcs.modified":
+			info.Modified = "true" == setting.Value
+		}
+	}
+	return
+}
+
+// readyMessage 带构建信息的ReadyOK
+func readyMessage() []byte {
+	raw, err := json.Marshal(ReadBuildInfo())
+	if nil != err {
+		return []byte(ReadyOK)
+	}
+	return []byte(ReadyOK + " " + string(raw))
+}
+
+// parseReady 解析ReadyOK，外部命令可只回执ReadyOK，此时构建信息为空
+func parseReady(request string) (info *BuildInfo, ok bool) {
+	if ReadyOK == request {
+		ok = true
+		return
+	}
+	if !strings.HasPrefix(request, ReadyOK+" ") {
+		return
+	}
+	ok = true
+	info = &BuildInfo{}
+	if err := json.Unmarshal([]byte(request[len(ReadyOK)+1:]), info); nil != err {
+		glog.Error(err)
+		info = nil
+	}
+	return
+}
+
+// ChildBuild 主工作进程上报的构建信息，未上报时为空
+func (object *Daemon) ChildBuild() *BuildInfo {
+	child := object.currentChild()
+	if nil == child {
+		return nil
+	}
+	return child.build
+}
+
+// ForceUpgrade 同Upgrade，可执行文件未变化时也替换子进程
+func (object *Daemon) ForceUpgrade() error {
+	return object.execCommand(ForceUpgradeRequest)
+}
+
+// isUpgradeAction 是否为更新指令
+func isUpgradeAction(action string) bool {
+	return UpgradeRequest == action || ForceUpgradeRequest == action
+}
+
+// childBinary 新子进程的可执行文件
+func (object *Daemon) childBinary() (path string, err error) {
+	path = object.command
+	if 0 >= len(path) && 0 < len(object.origArgs) {
+		path = object.origArgs[0]
+	}
+	if !strings.ContainsRune(path, filepath.Separator) {
+		path, err = exec.LookPath(path)
+	}
+	return
+}
+
+// checkNewBinary 可执行文件与运行中子进程上报的一致时拒绝更新
+func (object *Daemon) checkNewBinary() error {
+	child := object.currentChild()
+	if nil == child || nil == child.build || 0 >= len(child.build.Checksum) {
+		return nil
+	}
+	path, err := object.childBinary()
+	if nil != err {
+		return nil
+	}
+	var sum string
+	if sum, err = fileChecksum(path); nil != err || sum != child.build.Checksum {
+		return nil
+	}
+	return newLifecycleError(PhaseUpgrade, child.Pid(), ErrSameBinary, nil)
+}
@@ -0,0 +1,66 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestParseReady(t *testing.T) {
+	if info, ok := parseReady(ReadyOK); !ok || nil != info {
+		t.Fatal(info, ok)
+	}
+	if _, ok := parseReady(ReadyError); ok {
+		t.Fatal("ReadyError parsed as ok")
+	}
+	info, ok := parseReady(string(readyMessage()))
+	if !ok || nil == info || 64 != len(info.Checksum) || 0 >= len(info.GoVersion) {
+		t.Fatal(info, ok)
+	}
+}
+
+func TestUpgradeSameBinary(t *testing.T) {
+	exe, err := os.Executable()
+	if nil != err {
+		t.Fatal(err)
+	}
+	object, signalCh, doneCh := startFakeParent(t, withChild(func(xCmdObj *XCmd, args []string) error {
+		if err := xCmdObj.ChildWrite(readyMessage()); nil != err {
+			return err
+		}
+		if err := xCmdObj.ChildRead(func(raw []byte) bool {
+			return nil != raw && ExitRequest != string(raw)
+		}); nil != err {
+			return err
+		}
+		return xCmdObj.ChildWrite([]byte(ExitReply))
+	}), withSetup(func(object *Daemon) {
+		object.origArgs = []string{exe}
+	}))
+	if build := object.ChildBuild(); nil == build || 64 != len(build.Checksum) {
+		t.Fatal(build)
+	}
+
+	// 可执行文件未变化，拒绝更新且守护进程继续运行
+	if err = object.Upgrade(); !errors.Is(err, ErrSameBinary) {
+		t.Fatal(err)
+	}
+	if 1 != object.Status().Generation {
+		t.Fatal(object.Status())
+	}
+	if err = object.ForceUpgrade(); nil != err {
+		t.Fatal(err)
+	}
+	if 2 != object.Status().Generation {
+		t.Fatal(object.Status())
+	}
+
+	signalCh <- syscall.SIGTERM
+	if err = <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,145 @@
+package daemon
+
+import (
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// 总线操作
+const (
+	busSubscribe   uint8 = 1 // 订阅主题
+	busUnsubscribe uint8 = 2 // 取消订阅
+	busPublish     uint8 = 3 // 发布，父进程转发给订阅者时沿用
+)
+
+// encodeBusMessage 编码总线消息：op(1) | topic | payload
+func encodeBusMessage(op uint8, topic string, payload []byte) []byte {
+	buf := NewBuffer(0).WriteUint8(op).WriteString(topic).WriteLengthBytes(payload)
+	return buf.Slice(buf.ReadableBytes())
+}
+
+// decodeBusMessage 解码总线消息
+func decodeBusMessage(raw []byte) (op uint8, topic string, payload []byte, err error) {
+	buf := NewBuffer(0).WriteBytes(raw)
+	if op, err = buf.TryReadUint8(); nil != err {
+		return
+	}
+	if topic, err = buf.TryReadString(); nil != err {
+		return
+	}
+	payload, err = buf.TryReadLengthBytes()
+	return
+}
+
+// bus 父进程的消息代理，按主题把子进程发布的消息转发给订阅的子进程
+type bus struct {
+	sync.Mutex
+	topics map[string]map[*XCmd]bool // 主题对应的订阅者
+}
+
+// handle 处理子进程发来的总线消息
+func (object *bus) handle(from *XCmd, raw []byte) {
+	op, topic, payload, err := decodeBusMessage(raw)
+	if nil != err {
+		glog.Error(err)
+		return
+	}
+
+	object.Lock()
+	switch op {
+	case busSubscribe:
+		if nil == object.topics {
+			object.topics = make(map[string]map[*XCmd]bool)
+		}
+		if nil == object.topics[topic] {
+			object.topics[topic] = make(map[*XCmd]bool)
+		}
+		object.topics[topic][from] = true
+		object.Unlock()
+		return
+	case busUnsubscribe:
+		delete(object.topics[topic], from)
+		object.Unlock()
+		return
+	}
+	subscribers := make([]*XCmd, 0, len(object.topics[topic]))
+	for child := range object.topics[topic] {
+		subscribers = append(subscribers, child)
+	}
+	object.Unlock()
+
+	// 转发给订阅者，写入不持锁
+	forward := encodeBusMessage(busPublish, topic, payload)
+	for _, child := range subscribers {
+		if err := child.ParentWriteStream(StreamBus, forward); nil != err {
+			glog.Errorf("bus forward to child %d: %v", child.Pid(), err)
+		}
+	}
+}
+
+// remove 子进程退出后移除其订阅
+func (object *bus) remove(child *XCmd) {
+	object.Lock()
+	defer object.Unlock()
+	for topic, subscribers := range object.topics {
+		if delete(subscribers, child); 0 >= len(subscribers) {
+			delete(object.topics, topic)
+		}
+	}
+}
+
+// Publish 向主题发布消息，由父进程转发给订阅该主题的子进程(含自己)；
+// 前台运行时直接投递给本进程的订阅者
+func (object *Registry) Publish(topic string, msg []byte) error {
+	raw := encodeBusMessage(busPublish, topic, msg)
+	if nil == object.parent {
+		object.deliverTopic(raw)
+		return nil
+	}
+	return object.parent.ChildWriteStream(StreamBus, raw)
+}
+
+// SubscribeTopic 订阅主题，handler在读协程中调用，不应长时间阻塞；msg为独立的副本，handler可以保留
+func (object *Registry) SubscribeTopic(topic string, handler func(msg []byte)) error {
+	object.Lock()
+	if nil == object.topics {
+		object.topics = make(map[string][]func(msg []byte))
+	}
+	first := 0 >= len(object.topics[topic])
+	object.topics[topic] = append(object.topics[topic], handler)
+	object.Unlock()
+	if first && nil != object.parent {
+		return object.parent.ChildWriteStream(StreamBus, encodeBusMessage(busSubscribe, topic, nil))
+	}
+	return nil
+}
+
+// UnsubscribeTopic 取消主题的全部订阅
+func (object *Registry) UnsubscribeTopic(topic string) error {
+	object.Lock()
+	delete(object.topics, topic)
+	object.Unlock()
+	if nil != object.parent {
+		return object.parent.ChildWriteStream(StreamBus, encodeBusMessage(busUnsubscribe, topic, nil))
+	}
+	return nil
+}
+
+// deliverTopic 分发父进程转发的主题消息
+func (object *Registry) deliverTopic(raw []byte) {
+	_, topic, payload, err := decodeBusMessage(raw)
+	if nil != err {
+		glog.Error(err)
+		return
+	}
+	object.Lock()
+	handlers := make([]func(msg []byte), len(object.topics[topic]))
+	copy(handlers, object.topics[topic])
+	object.Unlock()
+	// 读缓冲区在回调后复用，交给handler的是副本
+	payload = append([]byte(nil), payload...)
+	for _, handler := range handlers {
+		handler(payload)
+	}
+}
@@ -0,0 +1,67 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import "testing"
+
+func TestBus(t *testing.T) {
+	received := make(chan string, 1)
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		registry := newRegistry(nil)
+		registry.parent = xCmdObj
+		registry.SubscribeTopic("cache", func(msg []byte) {
+			received <- string(msg)
+		})
+		xCmdObj.ChildWrite([]byte(ReadyOK))
+		registry.Publish("cache", []byte("invalidate"))
+		registry.Publish("other", []byte("ignored"))
+		xCmdObj.ChildReadStreams(func(stream uint32, raw []byte) bool {
+			if StreamBus == stream {
+				registry.deliverTopic(raw)
+				return true
+			}
+			return StreamControl != stream || (nil != raw && ExitRequest != string(raw))
+		})
+		return xCmdObj.ChildWrite([]byte(ExitReply))
+	})
+	if ok, err := object.replaceChildProcess(nil); !ok || nil != err {
+		t.Fatal(ok, err)
+	}
+	if msg := <-received; "invalidate" != msg {
+		t.Fatal(msg)
+	}
+	stopFakeDaemon(t, object)
+	object.xCmdObj.Close()
+	waitFor(t, func() bool {
+		object.bus.Lock()
+		defer object.bus.Unlock()
+		return 0 == len(object.bus.topics)
+	})
+
+	// 前台运行时直接投递
+	registry := newRegistry(nil)
+	registry.SubscribeTopic("local", func(msg []byte) {
+		received <- string(msg)
+	})
+	registry.Publish("local", []byte("hello"))
+	if msg := <-received; "hello" != msg {
+		t.Fatal(msg)
+	}
+}
+
+func TestDeliverTopicRetainsPayload(t *testing.T) {
+	registry := newRegistry(nil)
+	var kept [][]byte
+	registry.SubscribeTopic("cache", func(msg []byte) {
+		kept = append(kept, msg)
+	})
+	// 模拟复用的读缓冲区
+	raw := encodeBusMessage(busPublish, "cache", []byte("AAAA"))
+	registry.deliverTopic(raw)
+	copy(raw, encodeBusMessage(busPublish, "cache", []byte("BBBB")))
+	registry.deliverTopic(raw)
+	if 2 != len(kept) || "AAAA" != string(kept[0]) || "BBBB" != string(kept[1]) {
+		t.Fatal(kept)
+	}
+}
@@ -0,0 +1,81 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runUpgradeCheck 校验新程序能否启动：在当前进程派生子进程，侦听换成临时的地址，
+// 子进程完成初始化与准备好条件后平滑退出，不触碰运行中的守护进程及其PID文件、状态与审计
+func (object *Daemon) runUpgradeCheck() (build *BuildInfo, err error) {
+	if err = object.checkVerifyPeer(); nil != err {
+		return
+	}
+	var dir string
+	if dir, err = os.MkdirTemp("", "daemon-check-"); nil != err {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// 只保留子进程的启动与退出，不写审计、不发事件
+	object.audit = nil
+	object.eventHandlers = nil
+	object.dryRun = true
+	object.appArgs = stripFlag(object.appArgs, "check")
+	object.listenerSpecs = throwawayListeners(object.listenerSpecs, dir)
+
+	var specs []ListenerSpec
+	var lnFiles map[string]*os.File
+	if specs, lnFiles, err = object.listen(object.listenerSpecs); nil != err {
+		return
+	}
+	object.listenerSpecs = specs
+	defer func() {
+		for _, f := range lnFiles {
+			f.Close()
+		}
+	}()
+	object.lnFiles = lnFiles
+	if _, err = object.replaceChildProcess(lnFiles); nil != err {
+		return
+	}
+	build = object.currentChild().build
+	object.stopChild(context.Background(), "upgrade check")
+	object.wg.Wait()
+	return
+}
+
+// throwawayListeners 把侦听换成临时的地址：网络侦听使用同一主机的随机端口，unix侦听放在dir下
+func throwawayListeners(specs []ListenerSpec, dir string) []ListenerSpec {
+	throwaway := make([]ListenerSpec, 0, len(specs))
+	for _, spec := range specs {
+		if strings.HasPrefix(spec.Network, "unix") {
+			spec.Address = filepath.Join(dir, spec.Name+".sock")
+		} else if host, _, err := net.SplitHostPort(spec.Address); nil == err {
+			spec.Address = net.JoinHostPort(host, "0")
+		} else {
+			spec.Address = ":0"
+		}
+		throwaway = append(throwaway, spec)
+	}
+	return throwaway
+}
+
+// DryRun 是否为更新前的启动校验：侦听为临时地址，准备好后即退出，
+// 业务逻辑可据此跳过对外部的副作用，如定时任务、消费队列
+func (object *Registry) DryRun() bool {
+	return object.dryRun
+}
+
+// upgradeCheckResult 启动校验的结论
+func upgradeCheckResult(build *BuildInfo) string {
+	if nil == build {
+		return "upgrade check ok"
+	}
+	return fmt.Sprintf("upgrade check ok, version: %s revision: %s checksum: %s",
+		build.Version, build.Revision, build.Checksum)
+}
@@ -0,0 +1,108 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpgradeCheck(t *testing.T) {
+	dir := t.TempDir()
+	// 运行中的守护进程占用的端口
+	serving, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer serving.Close()
+
+	var meta bootstrapMeta
+	ready := ReadyOK
+	object := New("child", "upgrade", "bootstrap_args",
+		filepath.Join(dir, "logs"),
+		filepath.Join(dir, "pid")).
+		SetAuditLog(filepath.Join(dir, "audit.jsonl"), 0, 0).
+		SetListeners(
+			ListenerSpec{Name: "web", Network: "tcp", Address: serving.Addr().String()},
+			ListenerSpec{Name: "admin", Network: "unix", Address: filepath.Join(dir, "admin.sock")},
+		).
+		SetProcessRunner(NewFakeRunner(func(xCmdObj *XCmd, args []string) error {
+			for _, arg := range args {
+				if raw, ok := strings.CutPrefix(arg, "--bootstrap_args="); ok {
+					meta, _ = parseBootstrapMeta(raw)
+				}
+				if "--check" == arg {
+					return errors.New("check flag passed to child")
+				}
+			}
+			if ReadyOK != ready {
+				return xCmdObj.ChildWrite([]byte(ready))
+			}
+			return fakeChild(xCmdObj, args)
+		}))
+	object.origArgs = []string{"app"}
+	if _, err = object.parseCommandLine([]string{"upgrade", "--check", "config.yaml"}); nil != err {
+		t.Fatal(err)
+	}
+
+	if _, err = object.runUpgradeCheck(); nil != err {
+		t.Fatal(err)
+	}
+	if !meta.DryRun || 2 != len(meta.Listeners) {
+		t.Fatal(meta)
+	}
+	for _, info := range meta.Listeners {
+		if serving.Addr().String() == info.Address || filepath.Join(dir, "admin.sock") == info.Address {
+			t.Fatal(info)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(dir, "audit.jsonl")); !os.IsNotExist(err) {
+		t.Fatal("audit written by check", err)
+	}
+
+	// 新程序无法准备好
+	ready = ReadyError
+	if _, err = object.runUpgradeCheck(); !errors.Is(err, ErrChildNotReady) {
+		t.Fatal(err)
+	}
+}
+
+func TestThrowawayListeners(t *testing.T) {
+	specs := throwawayListeners([]ListenerSpec{
+		{Name: "web", Network: "tcp", Address: "0.0.0.0:80"},
+		{Name: "dns", Network: "udp6", Address: "[::1]:53"},
+		{Name: "any", Network: "tcp", Address: "bogus"},
+		{Name: "sock", Network: "unixpacket", Address: "/run/app.sock"},
+	}, "/tmp/check")
+	for i, want := range []string{"0.0.0.0:0", "[::1]:0", ":0", "/tmp/check/sock.sock"} {
+		if want != specs[i].Address {
+			t.Fatal(i, specs[i])
+		}
+	}
+}
+
+func TestUpgradeCheckError(t *testing.T) {
+	dir := t.TempDir()
+	object := New("child", "upgrade", "bootstrap_args",
+		filepath.Join(dir, "logs"),
+		filepath.Join(dir, "pid")).
+		SetListeners(ListenerSpec{Name: "web", Network: "tcp", Address: "127.0.0.1:0"}).
+		SetProcessRunner(NewFakeRunner(func(xCmdObj *XCmd, args []string) error {
+			return xCmdObj.ChildWrite([]byte(ReadyError))
+		}))
+	object.origArgs = []string{"app"}
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{"app", "upgrade", "--check"}
+
+	// 校验失败返回错误，不退出进程
+	err := object.Run(func(registry *Registry, ready chan bool, exitCh chan interface{}) {})
+	if !errors.Is(err, ErrUpgradeCheck) || !errors.Is(err, ErrChildNotReady) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,120 @@
+package daemon
+
+import (
+	"log"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// ChildLogical 使用Child句柄的业务逻辑，返回即退出
+type ChildLogical func(child *Child)
+
+// Child 子进程中业务逻辑使用的句柄，代替裸的准备好通道与退出通道
+type Child struct {
+	registry  *Registry     // 注册表
+	ready     chan bool     // 准备好通道
+	readyOnce sync.Once     // 只回执一次
+	done      chan struct{} // 父进程要求退出时关闭
+	stop      chan struct{} // 业务逻辑返回时关闭
+	logger    *log.Logger   // 经父进程转发的日志
+}
+
+// newChild 包装注册表与通道，exitCh关闭时关闭Done
+func newChild(registry *Registry, ready chan bool, exitCh chan interface{}) *Child {
+	object := &Child{
+		registry: registry,
+		ready:    ready,
+		done:     make(chan struct{}),
+		stop:     make(chan struct{}),
+		logger:   log.New(registry.LogWriter(), "", 0),
+	}
+	go func() {
+		select {
+		case <-exitCh:
+			close(object.done)
+		case <-object.stop:
+		}
+	}()
+	return object
+}
+
+// RegistryLogical 转换为注册表形式的业务逻辑，用于Supervisor.Register、RunInlineListeners等
+func (logical ChildLogical) RegistryLogical() RegistryLogical {
+	return func(registry *Registry, ready chan bool, exitCh chan interface{}) {
+		child := newChild(registry, ready, exitCh)
+		defer child.finish()
+		logical(child)
+	}
+}
+
+// RunChild 按SetListeners设置的侦听引导，业务逻辑通过Child句柄交互
+func (object *Daemon) RunChild(logical ChildLogical) error {
+	return object.Run(logical.RegistryLogical())
+}
+
+// Registry 注册表，获取继承的侦听、上报准备好条件等
+func (object *Child) Registry() *Registry {
+	return object.registry
+}
+
+// Ready 回执准备好，之后需等待全部准备好条件；只有首次Ready或Fail有效
+func (object *Child) Ready() {
+	object.readyOnce.Do(func() {
+		object.ready <- true
+	})
+}
+
+// Fail 回执启动失败，父进程报告GateApplication条件失败及原因；只有首次Ready或Fail有效
+func (object *Child) Fail(err error) {
+	object.readyOnce.Do(func() {
+		glog.Error(err)
+		object.registry.FailGate(GateApplication, err)
+		object.ready <- false
+	})
+}
+
+// Done 父进程要求退出时关闭，侦听已按排空顺序关闭
+func (object *Child) Done() <-chan struct{} {
+	return object.done
+}
+
+// Send 向父进程发送消息，父进程通过Daemon.OnChildMessage接收；前台运行时返回ErrNotRunning
+func (object *Child) Send(msg []byte) error {
+	if nil == object.registry.parent {
+		return ErrNotRunning
+	}
+	return object.registry.parent.ChildWriteStream(StreamMessage, msg)
+}
+
+// Logger 经父进程转发的INFO日志，前台运行时写入glog
+func (object *Child) Logger() *log.Logger {
+	return object.logger
+}
+
+// finish 业务逻辑返回，未回执时视为启动失败
+func (object *Child) finish() {
+	object.readyOnce.Do(func() {
+		glog.Error("logical returned before ready")
+		object.ready <- false
+	})
+	close(object.stop)
+}
+
+// ChildMessageHandler 子进程经Child.Send发送的消息的处理函数
+type ChildMessageHandler func(worker WorkerInfo, msg []byte)
+
+// OnChildMessage 添加子进程消息的处理函数，在分发协程中调用，不应阻塞；
+// 每个处理函数得到独立的副本，可以保留或修改
+func (object *Daemon) OnChildMessage(handler ChildMessageHandler) *Daemon {
+	object.messageHandlers = append(object.messageHandlers, handler)
+	return object
+}
+
+// childMessage 分发子进程发送的消息
+func (object *Daemon) childMessage(xCmdObj *XCmd, msg []byte) {
+	// 读缓冲区在回调后复用
+	for _, handler := range object.messageHandlers {
+		handler(xCmdObj.worker, append([]byte(nil), msg...))
+	}
+}
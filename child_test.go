@@ -0,0 +1,103 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestChildHandle(t *testing.T) {
+	ready := make(chan bool, 1)
+	exitCh := make(chan interface{}, 1)
+	registry := newRegistry(nil)
+	child := newChild(registry, ready, exitCh)
+	child.Ready()
+	child.Fail(errors.New("too late"))
+	if !<-ready || 0 != len(registry.Gates()) {
+		t.Fatal(registry.Gates())
+	}
+	if err := child.Send([]byte("hi")); !errors.Is(err, ErrNotRunning) {
+		t.Fatal(err)
+	}
+	select {
+	case <-child.Done():
+		t.Fatal("done before exit")
+	default:
+	}
+	close(exitCh)
+	<-child.Done()
+
+	// 未回执就返回视为启动失败
+	ready = make(chan bool, 1)
+	ChildLogical(func(child *Child) {}).RegistryLogical()(newRegistry(nil), ready, make(chan interface{}))
+	if <-ready {
+		t.Fatal("ready after return")
+	}
+	ready = make(chan bool, 1)
+	registry = newRegistry(nil)
+	ChildLogical(func(child *Child) {
+		child.Fail(errors.New("no database"))
+	}).RegistryLogical()(registry, ready, make(chan interface{}))
+	if gates := registry.Gates(); <-ready || 1 != len(gates) || GateApplication != gates[0].Name || "no database" != gates[0].Error {
+		t.Fatal(gates)
+	}
+}
+
+func TestChildMessage(t *testing.T) {
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		if err := xCmdObj.ChildWrite([]byte(ReadyOK)); nil != err {
+			return err
+		}
+		registry := newRegistry(nil)
+		registry.parent = xCmdObj
+		child := newChild(registry, make(chan bool, 1), make(chan interface{}))
+		if err := child.Send([]byte("cache warmed")); nil != err {
+			return err
+		}
+		return fakeChild(xCmdObj, args)
+	})
+	received := make(chan string, 1)
+	object.OnChildMessage(func(worker WorkerInfo, msg []byte) {
+		received <- string(msg)
+	})
+	if ok, err := object.replaceChildProcess(nil); !ok || nil != err {
+		t.Fatal(ok, err)
+	}
+	defer stopFakeDaemon(t, object)
+	if msg := <-received; "cache warmed" != msg {
+		t.Fatal(msg)
+	}
+}
+
+func TestChildMessageRetained(t *testing.T) {
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		if err := xCmdObj.ChildWrite([]byte(ReadyOK)); nil != err {
+			return err
+		}
+		registry := newRegistry(nil)
+		registry.parent = xCmdObj
+		child := newChild(registry, make(chan bool, 1), make(chan interface{}))
+		for _, msg := range []string{"AAAA", "BBBB"} {
+			if err := child.Send([]byte(msg)); nil != err {
+				return err
+			}
+		}
+		return fakeChild(xCmdObj, args)
+	})
+	// 前一个处理函数修改消息不影响后一个，保留的消息不被覆盖
+	received := make(chan []byte, 2)
+	object.OnChildMessage(func(worker WorkerInfo, msg []byte) {
+		copy(msg, "XXXX")
+	}).OnChildMessage(func(worker WorkerInfo, msg []byte) {
+		received <- msg
+	})
+	if ok, err := object.replaceChildProcess(nil); !ok || nil != err {
+		t.Fatal(ok, err)
+	}
+	defer stopFakeDaemon(t, object)
+	if first, second := <-received, <-received; "AAAA" != string(first) || "BBBB" != string(second) {
+		t.Fatal(string(first), string(second))
+	}
+}
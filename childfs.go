@@ -0,0 +1,53 @@
+package daemon
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// SetChroot 子进程在exec前chroot到root，程序路径与Dir均相对于新的根目录解析；
+// 继承的侦听与管道不受影响，需root权限，Windows下由Start返回错误
+func (object *XCmd) SetChroot(root string) *XCmd {
+	if 0 >= len(root) || nil == object.Cmd {
+		return object
+	}
+	if err := setChroot(object.Cmd, root); nil != err && nil == object.startErr {
+		object.startErr = err
+	}
+	return object
+}
+
+// SetChildDir 子进程的工作目录、umask与chroot，与启动守护进程时所在的目录无关：
+// workDir为空时继承父进程的工作目录，umask小于0时继承，chroot为空时不切换根目录；
+// umask经引导参数传给子进程，在运行业务逻辑前设置，不修改父进程的umask，Windows下忽略。
+// 开启chroot时程序须位于新的根目录下，可通过SetCommand指定其中的路径
+func (object *Daemon) SetChildDir(workDir string, umask int, chroot string) *Daemon {
+	object.childDir = workDir
+	object.childUmask = umask
+	object.childChroot = chroot
+	return object
+}
+
+// applyChildDir 设置子进程的工作目录与chroot
+func (object *Daemon) applyChildDir(xCmdObj *XCmd) {
+	if 0 < len(object.childDir) {
+		// 相对路径的程序在子进程的工作目录下解析，先转为绝对路径
+		if 0 >= len(object.childChroot) && !filepath.IsAbs(xCmdObj.Path) &&
+			strings.ContainsRune(xCmdObj.Path, filepath.Separator) {
+			if path, err := filepath.Abs(xCmdObj.Path); nil == err {
+				xCmdObj.Path = path
+			}
+		}
+		xCmdObj.Dir = object.childDir
+	}
+	xCmdObj.SetChroot(object.childChroot)
+}
+
+// bootstrapUmask 引导参数中子进程的umask，继承时为nil
+func (object *Daemon) bootstrapUmask() *int {
+	if 0 > object.childUmask {
+		return nil
+	}
+	umask := object.childUmask
+	return &umask
+}
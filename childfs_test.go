@@ -0,0 +1,101 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+func TestChildDir(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "child.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\npwd\n"), 0755); nil != err {
+		t.Fatal(err)
+	}
+	workDir := filepath.Join(dir, "work")
+	if err := os.Mkdir(workDir, 0755); nil != err {
+		t.Fatal(err)
+	}
+	// 相对路径的程序相对于父进程的工作目录
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); nil != err {
+		t.Fatal(err)
+	}
+
+	xCmdObj, err := NewXCmd("./child.sh")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer xCmdObj.Close()
+	object := Default().SetChildDir(workDir, 0027, "")
+	object.applyChildDir(xCmdObj)
+	var out bytes.Buffer
+	xCmdObj.Stdout = &out
+	if err = xCmdObj.Start(); nil != err {
+		t.Fatal(err)
+	}
+	if err = xCmdObj.Wait(); nil != err {
+		t.Fatal(err)
+	}
+	lines := strings.Fields(out.String())
+	if real, _ := filepath.EvalSymlinks(workDir); 1 != len(lines) || real != lines[0] {
+		t.Fatal(out.String())
+	}
+	// umask经引导参数传给子进程
+	if umask := object.bootstrapUmask(); nil == umask || 0027 != *umask {
+		t.Fatal(umask)
+	}
+
+	// chroot只设置，不实际切换
+	xCmdObj, err = NewXCmd("/bin/true")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer xCmdObj.Close()
+	object = Default().SetChildDir("", -1, dir)
+	object.applyChildDir(xCmdObj)
+	if dir != xCmdObj.SysProcAttr.Chroot || nil != object.bootstrapUmask() || 0 < len(xCmdObj.Dir) {
+		t.Fatal(xCmdObj.SysProcAttr, object.bootstrapUmask(), xCmdObj.Dir)
+	}
+}
+
+func TestChildUmask(t *testing.T) {
+	var lock sync.Mutex
+	var umask *int
+	object, signalCh, doneCh := startFakeParent(t, withChild(func(xCmdObj *XCmd, args []string) error {
+		meta, _ := parseBootstrapMeta(strings.TrimPrefix(args[len(args)-1], "--bootstrap_args="))
+		lock.Lock()
+		umask = meta.Umask
+		lock.Unlock()
+		return fakeChild(xCmdObj, args)
+	}), withSetup(func(object *Daemon) {
+		object.SetChildDir("", 0027, "")
+	}))
+	// 派生时不修改父进程的umask
+	old := syscall.Umask(0022)
+	defer syscall.Umask(old)
+	if err := object.Upgrade(); nil != err {
+		t.Fatal(err)
+	}
+	if mask := syscall.Umask(0022); 0022 != mask {
+		t.Fatal(mask)
+	}
+	lock.Lock()
+	if nil == umask || 0027 != *umask {
+		t.Fatal(umask)
+	}
+	lock.Unlock()
+
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+}
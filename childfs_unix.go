@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setUmask 子进程设置自身的umask
+func setUmask(umask int) {
+	syscall.Umask(umask)
+}
+
+// setChroot 设置exec前chroot的目录
+func setChroot(cmd *exec.Cmd, root string) error {
+	if nil == cmd.SysProcAttr {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Chroot = root
+	return nil
+}
@@ -0,0 +1,15 @@
+package daemon
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// setUmask Windows没有umask，忽略
+func setUmask(umask int) {
+}
+
+// setChroot 不支持
+func setChroot(cmd *exec.Cmd, root string) error {
+	return errors.New("daemon: chroot not supported on windows")
+}
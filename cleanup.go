@@ -0,0 +1,45 @@
+package daemon
+
+import (
+	"os"
+	"sync/atomic"
+)
+
+// cleanupParent 守护进程退出时的清理，所有退出路径都经过这里：
+// 停止仍在运行的工作进程与子进程、写入最终状态、分发EventDaemonStopped、
+// 关闭侦听文件、删除unix socket与PID文件
+func (object *Daemon) cleanupParent(err error) {
+	// 停服流程之外的退出路径也停止全部子进程，其退出不作为意外退出上报
+	ctx, cancel := object.terminationContext()
+	atomic.StoreInt32(&object.killedFlag, 1)
+	object.abortSpawn(ErrSpawnAborted)
+	object.stopWorkers(ctx)
+	object.stopChild(ctx, "daemon exit")
+	cancel()
+
+	object.setStatus(func(status *Status) {
+		status.Phase = StatusStopped
+		if nil != err {
+			status.LastError = err.Error()
+		}
+	})
+	event := Event{Type: EventDaemonStopped, Pid: os.Getpid()}
+	fields := map[string]string{}
+	if nil != err {
+		event.Error = err.Error()
+		fields["error"] = err.Error()
+	}
+	object.emit(event)
+	object.auditAction(AuditExit, nil, fields)
+
+	// 关闭侦听
+	for name, f := range object.lnFiles {
+		f.Close()
+		delete(object.lnFiles, name)
+	}
+	for _, spec := range object.listenerSpecs {
+		removeSocketFile(spec.Network, spec.Address)
+	}
+
+	object.releasePIDFile()
+}
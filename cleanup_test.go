@@ -0,0 +1,79 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+)
+
+func TestParentExitCleanup(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "web.sock")
+	stopped := int32(0)
+	object, signalCh, doneCh := startFakeParent(t, withSetup(func(object *Daemon) {
+		object.SetListeners(ListenerSpec{Name: "web", Network: "unix", Address: sock}).
+			OnEvent(func(event Event) {
+				if EventDaemonStopped == event.Type {
+					atomic.AddInt32(&stopped, 1)
+				}
+			})
+	}))
+	if _, err := os.Stat(object.pidFile); nil != err {
+		t.Fatal(err)
+	}
+	lnFile := object.lnFiles["web"]
+
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(object.pidFile); !os.IsNotExist(err) {
+		t.Fatal("pid file left", err)
+	}
+	if _, err := os.Stat(sock); !os.IsNotExist(err) {
+		t.Fatal("unix socket left", err)
+	}
+	if _, err := lnFile.Stat(); nil == err {
+		t.Fatal("listener file not closed")
+	}
+	if 1 != atomic.LoadInt32(&stopped) || StatusStopped != object.Status().Phase {
+		t.Fatal(stopped, object.Status())
+	}
+}
+
+func TestParentErrorExitStopsChildren(t *testing.T) {
+	dir := t.TempDir()
+	var alive, crashed int32
+	object := New("child", "upgrade", "bootstrap_args",
+		filepath.Join(dir, "logs"),
+		filepath.Join(dir, "pid")).
+		SetProcessRunner(NewFakeRunner(func(xCmdObj *XCmd, args []string) error {
+			atomic.AddInt32(&alive, 1)
+			defer atomic.AddInt32(&alive, -1)
+			return fakeChild(xCmdObj, args)
+		})).
+		// 子进程启动后开启控制socket失败，不经停服流程退出
+		SetControlSocket(filepath.Join(dir, "missing", "control.sock")).
+		OnEvent(func(event Event) {
+			if EventChildCrashed == event.Type {
+				atomic.AddInt32(&crashed, 1)
+			}
+		})
+	object.origArgs = []string{"app"}
+	if err := object.SetWorkers(2); nil != err {
+		t.Fatal(err)
+	}
+	if err := object.runAsParent(make(chan os.Signal, 1)); nil == err {
+		t.Fatal("control socket error expected")
+	}
+	if n := atomic.LoadInt32(&alive); 0 != n {
+		t.Fatal(n, "children left running")
+	}
+	if 0 != atomic.LoadInt32(&crashed) {
+		t.Fatal("child exit reported as crash")
+	}
+}
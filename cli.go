@@ -0,0 +1,392 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// StatusRequest 经控制socket查询状态，不经过主循环
+const StatusRequest = "status"
+
+// HealthRequest 经控制socket查询健康状况，与/healthz一致，不经过主循环
+const HealthRequest = "health"
+
+// 子命令，子进程与更新分别使用New传入的childCmd、upgradeCmd
+const (
+	CommandRun       = "run"         // 启动守护进程，未指定子命令时的默认值
+	CommandStatus    = "status"      // 输出运行中守护进程的状态
+	CommandStop      = "stop"        // 平滑停服
+	CommandReload    = "reload"      // 通知重载
+	CommandRestart   = "restart"     // 停服后重新启动
+	CommandInstall   = "install"     // 安装为系统服务
+	CommandUninstall = "uninstall"   // 卸载系统服务
+	CommandService   = "service"     // 由服务管理器启动
+	CommandHealth    = "healthcheck" // 检查运行中守护进程的健康状况，不健康时以1退出
+	commandHelp      = "help"        // 列出子命令
+)
+
+// cliOptions 命令行解析结果
+type cliOptions struct {
+	command           string // 子命令
+	rebootTimes       int    // 最大重启次数
+	rebootTimesSet    bool   // 显式指定了最大重启次数
+	bootstrapArgs     string // 子进程的引导参数
+	supervisedService string // 子进程要运行的被监督服务
+	systemd           bool   // 安装为systemd单元
+	launchd           bool   // 安装为launchd守护进程
+	daemonize         bool   // 脱离控制终端
+	noDaemon          bool   // 不派生子进程，前台运行业务逻辑
+	check             bool   // 更新前只校验新程序能否启动
+	deploy            Deploy // 更新附带的部署信息
+}
+
+// SetLegacyFlags 使用旧的布尔参数（--child、--upgrade、--install等）代替子命令，兼容已有的部署脚本；
+// 未开启时首个参数为子命令，旧版本父进程以--child派生的子进程仍能识别
+func (object *Daemon) SetLegacyFlags(legacy bool) *Daemon {
+	object.legacyFlags = legacy
+	return object
+}
+
+// parseCommandLine 解析命令行，daemon的参数不注册到flag.CommandLine，不污染业务逻辑的帮助信息
+func (object *Daemon) parseCommandLine(args []string) (opts cliOptions, err error) {
+	if object.legacyFlags {
+		return object.parseLegacyFlags(args)
+	}
+	opts.command = CommandRun
+	if 0 < len(args) && !strings.HasPrefix(args[0], "-") {
+		opts.command, args = args[0], args[1:]
+	} else if hasFlag(args, object.childCmd) {
+		// 旧版本父进程派生的子进程
+		return object.parseLegacyFlags(args)
+	}
+
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0])+" "+opts.command, flag.ContinueOnError)
+	switch opts.command {
+	case object.childCmd:
+		fs.StringVar(&opts.bootstrapArgs, object.bootstrapArgs, "", "bootstrap args")
+		fs.StringVar(&opts.supervisedService, supervisedServiceFlag, "", "supervised service to run in child")
+		opts.runFlags(fs)
+	case CommandRun, CommandRestart, CommandService:
+		opts.runFlags(fs)
+	case CommandInstall:
+		opts.runFlags(fs)
+		opts.managerFlags(fs)
+	case CommandUninstall:
+		opts.managerFlags(fs)
+	case object.upgradeCmd:
+		fs.BoolVar(&opts.check, "check", false, "only verify the new binary boots, the running daemon is untouched")
+		fs.StringVar(&opts.deploy.ID, "deploy_id", "", "deploy ID attached to the upgrade")
+		fs.StringVar(&opts.deploy.Revision, "deploy_revision", "", "revision attached to the upgrade, such as the git SHA")
+		fs.StringVar(&opts.deploy.Operator, "deploy_operator", "", "operator attached to the upgrade")
+	case CommandStatus, CommandStop, CommandReload, CommandHealth:
+	case commandHelp:
+		object.printCommands()
+		err = flag.ErrHelp
+		return
+	default:
+		object.printCommands()
+		err = fmt.Errorf("daemon: unknown command %q", opts.command)
+		return
+	}
+
+	// 业务逻辑自身的参数，如glog的-v，在各子命令下都可用
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		if nil == fs.Lookup(f.Name) {
+			fs.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	var positional []string
+	if positional, err = parseInterleaved(fs, args); nil != err {
+		return
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if "reboot_times" == f.Name {
+			opts.rebootTimesSet = true
+		}
+	})
+	// 其余位置参数留给业务逻辑通过flag.Args获取
+	flag.CommandLine.Parse(append([]string{"--"}, positional...))
+
+	object.appArgs = args
+	return
+}
+
+// parseLegacyFlags 旧的布尔参数，注册在flag.CommandLine
+func (object *Daemon) parseLegacyFlags(args []string) (opts cliOptions, err error) {
+	runInChild := flag.Bool(object.childCmd, false, "run in child")
+	runUpgrade := flag.Bool(object.upgradeCmd, false, "run upgrade")
+	flag.StringVar(&opts.bootstrapArgs, object.bootstrapArgs, "", "bootstrap args")
+	flag.StringVar(&opts.supervisedService, supervisedServiceFlag, "", "supervised service to run in child")
+	install := flag.Bool(CommandInstall, false, "install as system service")
+	uninstall := flag.Bool(CommandUninstall, false, "uninstall system service")
+	runService := flag.Bool(CommandService, false, "run as system service")
+	runStatus := flag.Bool(CommandStatus, false, "print status of the running daemon")
+	runStop := flag.Bool(CommandStop, false, "stop the running daemon gracefully")
+	runReload := flag.Bool(CommandReload, false, "reload the running daemon")
+	runRestart := flag.Bool(CommandRestart, false, "stop the running daemon and start again")
+	opts.runFlags(flag.CommandLine)
+	opts.managerFlags(flag.CommandLine)
+	if err = flag.CommandLine.Parse(args); nil != err {
+		return
+	}
+	opts.rebootTimesSet = flagPassed("reboot_times")
+
+	// 多个同时指定时按原有的优先级
+	opts.command = CommandRun
+	for _, candidate := range []struct {
+		set     bool
+		command string
+	}{
+		{*runInChild, object.childCmd},
+		{*runUpgrade, object.upgradeCmd},
+		{*runStatus, CommandStatus},
+		{*runStop, CommandStop},
+		{*runReload, CommandReload},
+		{*runRestart, CommandRestart},
+		{*install, CommandInstall},
+		{*uninstall, CommandUninstall},
+		{*runService, CommandService},
+	} {
+		if candidate.set {
+			opts.command = candidate.command
+			break
+		}
+	}
+	return
+}
+
+// runFlags 启动守护进程相关的参数
+func (object *cliOptions) runFlags(fs *flag.FlagSet) {
+	fs.IntVar(&object.rebootTimes, "reboot_times", 3, "max reboot times of the child")
+	fs.BoolVar(&object.daemonize, "daemonize", false, "detach from the controlling terminal")
+	fs.BoolVar(&object.noDaemon, "no_daemon", false, "run logical in process without forking")
+}
+
+// managerFlags 选择服务管理器的参数
+func (object *cliOptions) managerFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&object.systemd, "systemd", false, "install as systemd unit")
+	fs.BoolVar(&object.launchd, "launchd", false, "install as launchd daemon")
+}
+
+// printCommands 列出子命令，子进程命令不列出
+func (object *Daemon) printCommands() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s <command> [flags]\n\nCommands:\n", filepath.Base(os.Args[0]))
+	for _, command := range [][2]string{
+		{CommandRun, "start the daemon (default)"},
+		{object.upgradeCmd, "upgrade the running daemon"},
+		{CommandStatus, "print status of the running daemon"},
+		{CommandHealth, "exit 1 unless the running daemon is healthy"},
+		{CommandStop, "stop the running daemon gracefully"},
+		{CommandReload, "reload the running daemon"},
+		{CommandRestart, "stop the running daemon and start again"},
+		{CommandInstall, "install as system service"},
+		{CommandUninstall, "uninstall system service"},
+		{CommandService, "run as system service"},
+	} {
+		fmt.Fprintf(out, "  %-12s %s\n", command[0], command[1])
+	}
+	fmt.Fprintf(out, "\nRun '%s <command> -h' for the flags of a command.\n", filepath.Base(os.Args[0]))
+}
+
+// parseInterleaved 解析参数，允许参数与位置参数交错，返回位置参数
+func parseInterleaved(fs *flag.FlagSet, args []string) (positional []string, err error) {
+	for {
+		if err = fs.Parse(args); nil != err {
+			return
+		}
+		rest := fs.Args()
+		// --之后的全部为位置参数
+		if n := len(args) - len(rest); 0 < n && "--" == args[n-1] {
+			positional = append(positional, rest...)
+			return
+		}
+		if 0 >= len(rest) {
+			return
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// hasFlag 参数中是否有指定的布尔参数
+func hasFlag(args []string, name string) bool {
+	return len(stripFlag(args, name)) != len(args)
+}
+
+// childArgs 派生子进程的参数，旧参数方式追加--child，子命令方式为child及启动时的参数
+func (object *Daemon) childArgs() (args []string) {
+	if object.legacyFlags || 0 >= len(object.origArgs) {
+		args = append(args, object.origArgs...)
+		args = append(args, "--"+object.childCmd)
+	} else {
+		args = append(args, object.origArgs[0], object.childCmd)
+		args = append(args, object.appArgs...)
+	}
+	return append(args, object.childExtraArgs...)
+}
+
+// readPID 读取PID文件中的守护进程ID
+func (object *Daemon) readPID() (pid int, err error) {
+	var raw []byte
+	if raw, err = ioutil.ReadFile(object.pidFile); nil != err {
+		return
+	}
+	pid, err = strconv.Atoi(strings.TrimSpace(string(raw)))
+	return
+}
+
+// daemonRunning PID文件被其他守护进程锁定即在运行
+func (object *Daemon) daemonRunning() bool {
+	f, err := os.OpenFile(object.pidFile, os.O_RDWR, 0)
+	if nil != err {
+		return false
+	}
+	defer f.Close()
+	return nil != lockFile(f)
+}
+
+// QueryStatus 查询运行中守护进程的状态：优先经控制socket，其次读取状态文件，
+// 都未配置时只有PID与阶段；未运行时返回ErrNotRunning
+func (object *Daemon) QueryStatus() (status Status, err error) {
+	if !object.daemonRunning() {
+		return Status{Phase: StatusStopped}, ErrNotRunning
+	}
+	if 0 < len(object.controlSocket) {
+		var result string
+		if result, err = QueryControl(object.controlSocket, StatusRequest); nil == err {
+			err = json.Unmarshal([]byte(result), &status)
+			return
+		}
+		var opErr *net.OpError
+		if !errors.As(err, &opErr) {
+			return
+		}
+		// 控制socket不可用时退回状态文件
+		err = nil
+	}
+	if 0 < len(object.status.path) {
+		return ReadStatus(object.status.path)
+	}
+	if status.Pid, err = object.readPID(); nil != err {
+		return
+	}
+	status.Phase = StatusRunning
+	return
+}
+
+// sendAction 向运行中的守护进程发送指令：配置了控制socket时经socket发送并返回结果，
+// 否则发送映射到该指令的信号，Windows下经控制管道
+func (object *Daemon) sendAction(action string) (err error) {
+	if 0 < len(object.controlSocket) {
+		if err = SendControl(object.controlSocket, action); nil == err {
+			return
+		}
+		var opErr *net.OpError
+		if !errors.As(err, &opErr) {
+			return
+		}
+	}
+	var pid int
+	if pid, err = object.readPID(); nil != err {
+		return
+	}
+	err = notifyDaemon(pid, action, object.signalFor(action))
+	return
+}
+
+// runStatus 输出运行中守护进程的状态JSON
+func (object *Daemon) runStatus() (err error) {
+	status, err := object.QueryStatus()
+	raw, e := json.MarshalIndent(status, "", "  ")
+	if nil != e {
+		return e
+	}
+	fmt.Println(string(raw))
+	return
+}
+
+// runHealthcheck 检查运行中守护进程的健康状况：配置了控制socket时与/healthz一致，
+// 否则只检查阶段，可直接用作Dockerfile的HEALTHCHECK，镜像中无需curl/wget
+func (object *Daemon) runHealthcheck() (err error) {
+	if !object.daemonRunning() {
+		return ErrNotRunning
+	}
+	if 0 < len(object.controlSocket) {
+		_, err = QueryControl(object.controlSocket, HealthRequest)
+		return
+	}
+	var status Status
+	if status, err = object.QueryStatus(); nil != err {
+		return
+	}
+	if StatusRunning != status.Phase {
+		err = fmt.Errorf("daemon %s", status.Phase)
+	}
+	return
+}
+
+// runStop 平滑停服，等待守护进程释放PID文件
+func (object *Daemon) runStop() (err error) {
+	if !object.daemonRunning() {
+		return ErrNotRunning
+	}
+	glog.Info("stop daemon")
+	if err = object.sendAction(ExitRequest); nil != err {
+		return
+	}
+	deadline := time.Now().Add(object.readyTimeout + object.drainTimeout + 5*time.Second)
+	for object.daemonRunning() {
+		if time.Now().After(deadline) {
+			return newLifecycleError(PhaseDrain, 0, ErrDrainTimeout, errors.New("pid file still locked"))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	glog.Info("daemon stopped")
+	return
+}
+
+// runReload 通知守护进程重载
+func (object *Daemon) runReload() (err error) {
+	if !object.daemonRunning() {
+		return ErrNotRunning
+	}
+	glog.Info("reload daemon")
+	err = object.sendAction(ReloadRequest)
+	return
+}
+
+// runRestart 停止运行中的守护进程，未运行时直接启动
+func (object *Daemon) runRestart() (err error) {
+	if err = object.runStop(); errors.Is(err, ErrNotRunning) {
+		err = nil
+	}
+	return
+}
+
+// stripFlag 去掉参数中的布尔命令行参数，如--restart，避免新守护进程再次执行
+func stripFlag(args []string, name string) []string {
+	stripped := make([]string, 0, len(args))
+	for _, arg := range args {
+		flagName := strings.TrimLeft(arg, "-")
+		if i := strings.Index(flagName, "="); 0 <= i {
+			flagName = flagName[:i]
+		}
+		if strings.HasPrefix(arg, "-") && name == flagName {
+			continue
+		}
+		stripped = append(stripped, arg)
+	}
+	return stripped
+}
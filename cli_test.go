@@ -0,0 +1,114 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestManageRunningDaemon(t *testing.T) {
+	control := filepath.Join(t.TempDir(), "control.sock")
+	var cli *Daemon
+	object, _, doneCh := startFakeParent(t, withSetup(func(object *Daemon) {
+		object.SetControlSocket(control)
+
+		// 模拟命令行管理的另一个实例
+		cli = New("child", "upgrade", "bootstrap_args", object.bootstrapLogDir, object.pidFile).
+			SetControlSocket(control)
+		if _, err := cli.QueryStatus(); !errors.Is(err, ErrNotRunning) {
+			t.Fatal(err)
+		}
+	}))
+
+	status, err := cli.QueryStatus()
+	if nil != err || os.Getpid() != status.Pid || StatusRunning != status.Phase || 0 == status.ChildPid {
+		t.Fatal(status, err)
+	}
+	if err = cli.runHealthcheck(); nil != err {
+		t.Fatal(err)
+	}
+	object.setPhase(StatusFailed)
+	if err = cli.runHealthcheck(); nil == err || ErrRestartBudgetExhausted.Error() != err.Error() {
+		t.Fatal(err)
+	}
+	object.setPhase(StatusRunning)
+	if err = cli.runReload(); nil != err {
+		t.Fatal(err)
+	}
+	if err = cli.runStop(); nil != err {
+		t.Fatal(err)
+	}
+	if err = <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+	if cli.daemonRunning() {
+		t.Fatal("pid file still locked")
+	}
+	if err = cli.runHealthcheck(); !errors.Is(err, ErrNotRunning) {
+		t.Fatal(err)
+	}
+}
+
+func TestParseCommandLine(t *testing.T) {
+	object := Default()
+	opts, err := object.parseCommandLine([]string{"restart", "--reboot_times=5", "config.yaml", "--daemonize"})
+	if nil != err || CommandRestart != opts.command || !opts.rebootTimesSet || 5 != opts.rebootTimes || !opts.daemonize {
+		t.Fatal(opts, err)
+	}
+	object.origArgs = []string{"app", CommandRun}
+	args := object.childArgs()
+	if !reflect.DeepEqual([]string{"app", "child", "--reboot_times=5", "config.yaml", "--daemonize"}, args) {
+		t.Fatal(args)
+	}
+
+	// 未指定子命令时运行，子进程接受父进程的参数
+	if opts, err = object.parseCommandLine([]string{"--no_daemon"}); nil != err || CommandRun != opts.command || !opts.noDaemon {
+		t.Fatal(opts, err)
+	}
+	if opts, err = object.parseCommandLine(args[1:]); nil != err || "child" != opts.command {
+		t.Fatal(opts, err)
+	}
+	if _, err = object.parseCommandLine([]string{"stop", "--daemonize"}); nil == err {
+		t.Fatal("run flag accepted by stop")
+	}
+	if opts, err = object.parseCommandLine([]string{"healthcheck"}); nil != err || CommandHealth != opts.command {
+		t.Fatal(opts, err)
+	}
+	if _, err = object.parseCommandLine([]string{"bogus"}); nil == err {
+		t.Fatal("unknown command accepted")
+	}
+
+	object.SetLegacyFlags(true)
+	object.origArgs = []string{"app", "--reboot_times=5"}
+	if args = object.childArgs(); !reflect.DeepEqual([]string{"app", "--reboot_times=5", "--child"}, args) {
+		t.Fatal(args)
+	}
+}
+
+func TestStripFlag(t *testing.T) {
+	args := stripFlag([]string{"app", "--restart", "-restart=true", "--restarts=2", "restart"}, "restart")
+	if !reflect.DeepEqual([]string{"app", "--restarts=2", "restart"}, args) {
+		t.Fatal(args)
+	}
+}
+
+func TestHealthcheckError(t *testing.T) {
+	dir := t.TempDir()
+	object := New("child", "upgrade", "bootstrap_args",
+		filepath.Join(dir, "logs"),
+		filepath.Join(dir, "pid"))
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{"app", "healthcheck"}
+
+	// 未运行时返回错误，不退出进程
+	err := object.Run(func(registry *Registry, ready chan bool, exitCh chan interface{}) {})
+	if !errors.Is(err, ErrNotRunning) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,91 @@
+package daemon
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// 内置压缩算法
+const (
+	CodecNone   byte = 0 // 不压缩
+	CodecFlate  byte = 1 // deflate，压缩率高
+	CodecSnappy byte = 2 // snappy块格式，速度快，大状态交接时推荐
+)
+
+// Codec 压缩算法
+type Codec interface {
+	Compress(raw []byte) ([]byte, error)                // 压缩
+	Decompress(raw []byte, maxSize int) ([]byte, error) // 解压，结果超过maxSize时报错
+}
+
+// codecs 已注册的压缩算法
+var (
+	codecsLock sync.RWMutex
+	codecs     = map[byte]Codec{
+		CodecFlate:  flateCodec{},
+		CodecSnappy: snappyCodec{},
+	}
+)
+
+// RegisterCodec 注册压缩算法，父子进程需注册相同的算法，可用于接入zstd等；
+// 0与内置算法的id保留，返回ErrCodecReserved
+func RegisterCodec(id byte, codec Codec) error {
+	switch id {
+	case CodecNone, CodecFlate, CodecSnappy:
+		return fmt.Errorf("%w: %d", ErrCodecReserved, id)
+	}
+	codecsLock.Lock()
+	defer codecsLock.Unlock()
+	codecs[id] = codec
+	return nil
+}
+
+// getCodec 获取压缩算法
+func getCodec(id byte) (codec Codec, err error) {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+	var ok bool
+	if codec, ok = codecs[id]; !ok {
+		err = fmt.Errorf("%w: unknown codec %d", ErrFrame, id)
+	}
+	return
+}
+
+// flateCodec deflate压缩
+type flateCodec struct{}
+
+// Compress 压缩
+func (flateCodec) Compress(raw []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if nil != err {
+		return nil, err
+	}
+	if _, err = w.Write(raw); nil != err {
+		return nil, err
+	}
+	if err = w.Close(); nil != err {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress 解压
+func (flateCodec) Decompress(raw []byte, maxSize int) ([]byte, error) {
+	var r io.Reader = flate.NewReader(bytes.NewReader(raw))
+	if 0 < maxSize {
+		r = io.LimitReader(r, int64(maxSize)+1)
+	}
+	decompressed, err := ioutil.ReadAll(r)
+	if nil != err {
+		return nil, fmt.Errorf("%w: %w", ErrFrame, err)
+	}
+	if 0 < maxSize && len(decompressed) > maxSize {
+		return nil, fmt.Errorf("%w: decompressed size exceeds %d", ErrFrame, maxSize)
+	}
+	return decompressed, nil
+}
@@ -0,0 +1,71 @@
+package daemon
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestSnappyCodec(t *testing.T) {
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(random)
+	inputs := [][]byte{
+		nil,
+		[]byte("a"),
+		[]byte("abcd"),
+		bytes.Repeat([]byte("a"), 1000),
+		bytes.Repeat([]byte("state handoff "), 10000),
+		random,
+		append(bytes.Repeat([]byte("x"), 70000), random[:70000]...),
+	}
+	for i, raw := range inputs {
+		compressed, err := snappyCodec{}.Compress(raw)
+		if nil != err {
+			t.Fatal(i, err)
+		}
+		got, err := snappyCodec{}.Decompress(compressed, len(raw))
+		if nil != err || !bytes.Equal(raw, got) {
+			t.Fatal(i, err, len(got))
+		}
+		if (3 == i || 4 == i) && len(compressed) >= len(raw)/10 {
+			t.Fatal(i, "not compressed", len(compressed))
+		}
+		if 1 < len(raw) {
+			if _, err = (snappyCodec{}).Decompress(compressed, len(raw)-1); !errors.Is(err, ErrFrame) {
+				t.Fatal(i, err)
+			}
+		}
+	}
+
+	// 越界的长度与偏移
+	for _, corrupt := range [][]byte{
+		{},
+		{200},
+		{3, 8 << 2, 'a'},
+		{4, 0, 'a', 1<<2 | snappyCopy1, 2},
+		{100, 0, 'a', 63<<2 | snappyCopy2, 1, 0},
+		{2, 60 << 2},
+	} {
+		if _, err := (snappyCodec{}).Decompress(corrupt, 0); !errors.Is(err, ErrFrame) {
+			t.Fatal(corrupt, err)
+		}
+	}
+}
+
+func TestRegisterCodec(t *testing.T) {
+	for _, id := range []byte{CodecNone, CodecFlate, CodecSnappy} {
+		if err := RegisterCodec(id, flateCodec{}); !errors.Is(err, ErrCodecReserved) {
+			t.Fatal(id, err)
+		}
+	}
+	if codec, _ := getCodec(CodecSnappy); (snappyCodec{}) != codec {
+		t.Fatal(codec)
+	}
+	if err := RegisterCodec(200, flateCodec{}); nil != err {
+		t.Fatal(err)
+	}
+	if _, err := getCodec(200); nil != err {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,129 @@
+package daemon
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+)
+
+// 手动确认模式下控制socket的指令，不经过主循环
+const (
+	ConfirmRequest = "confirm" // 放行等待确认的切换，排空旧子进程
+	AbortRequest   = "abort"   // 放弃等待确认的切换，强杀新子进程，旧子进程继续服务
+)
+
+// confirmState 手动确认模式的状态
+type confirmState struct {
+	sync.Mutex
+	enabled bool      // 开启手动确认
+	pending chan bool // 等待确认的切换，true为放行，没有时为nil
+}
+
+// confirmKey 更新上下文中需要手动确认的标记
+type confirmKey struct{}
+
+// SetManualConfirm 开启手动确认模式：更新时新子进程准备好后暂停，旧子进程继续服务，
+// 直到经控制socket发送confirm或调用ConfirmUpgrade才排空旧子进程，abort或AbortUpgrade放弃本次更新；
+// 只有主工作进程的切换需要确认，确认后其他工作进程依次自动更新。等待受更新期限约束，停服时放弃
+func (object *Daemon) SetManualConfirm(enable bool) *Daemon {
+	object.confirm.enabled = enable
+	return object
+}
+
+// ConfirmUpgrade 放行等待确认的切换，没有时返回ErrNoPendingUpgrade
+func (object *Daemon) ConfirmUpgrade() error {
+	return object.resolveConfirm(true)
+}
+
+// AbortUpgrade 放弃等待确认的切换，没有时返回ErrNoPendingUpgrade
+func (object *Daemon) AbortUpgrade() error {
+	return object.resolveConfirm(false)
+}
+
+// resolveConfirm 回复等待确认的切换
+func (object *Daemon) resolveConfirm(confirmed bool) error {
+	object.confirm.Lock()
+	defer object.confirm.Unlock()
+	if nil == object.confirm.pending {
+		return ErrNoPendingUpgrade
+	}
+	select {
+	case object.confirm.pending <- confirmed:
+	default:
+		// 已有回复
+	}
+	return nil
+}
+
+// withConfirm 按设置标记本次更新需要手动确认
+func (object *Daemon) withConfirm(ctx context.Context) context.Context {
+	if !object.confirm.enabled {
+		return ctx
+	}
+	return context.WithValue(ctx, confirmKey{}, true)
+}
+
+// needsConfirm 本次切换是否需要手动确认：更新中替换主工作进程的旧子进程时才需要
+func (object *Daemon) needsConfirm(ctx context.Context) bool {
+	required, _ := ctx.Value(confirmKey{}).(bool)
+	return required && nil == object.primary && nil != object.xCmdObj
+}
+
+// awaitConfirm 新子进程准备好后等待手动确认，调用方需持有写锁；等待期间释放写锁，
+// 旧子进程照常被选中与收发消息，回复后重新持锁完成切换或强杀；
+// 放弃时强杀新子进程并等待其退出，旧子进程不受影响
+func (object *Daemon) awaitConfirm(traceCtx context.Context, xCmdObj *XCmd) (err error) {
+	ctx, cancel := withUpgrade(object.spawnContext(), traceCtx)
+	defer cancel()
+	decision := make(chan bool, 1)
+	object.confirm.Lock()
+	object.confirm.pending = decision
+	object.confirm.Unlock()
+	object.setStatus(func(status *Status) {
+		status.AwaitingConfirm = xCmdObj.Pid()
+	})
+	glog.Infof("child: %d ready, awaiting confirmation to drain child: %d", xCmdObj.Pid(), object.xCmdObj.Pid())
+	object.emit(Event{
+		Type:   EventAwaitingConfirm,
+		Pid:    xCmdObj.Pid(),
+		Worker: xCmdObj.worker,
+	})
+
+	object.Unlock()
+	select {
+	case confirmed := <-decision:
+		if !confirmed {
+			err = newLifecycleError(PhaseUpgrade, xCmdObj.Pid(), ErrUpgradeAborted, nil)
+		}
+	case <-ctx.Done():
+		err = newLifecycleError(PhaseUpgrade, xCmdObj.Pid(), ErrUpgradeAborted, context.Cause(ctx))
+	}
+	object.Lock()
+	if nil == err && 0 != atomic.LoadInt32(&object.killedFlag) {
+		// 确认与停服同时到达，以停服为准
+		err = newLifecycleError(PhaseUpgrade, xCmdObj.Pid(), ErrUpgradeAborted, ErrSpawnAborted)
+	}
+	object.confirm.Lock()
+	object.confirm.pending = nil
+	object.confirm.Unlock()
+	object.setStatus(func(status *Status) {
+		status.AwaitingConfirm = 0
+	})
+	if nil == err {
+		glog.Infof("child: %d confirmed", xCmdObj.Pid())
+		return
+	}
+
+	// 按更新退出处理，不触发重启
+	glog.Warningf("child: %d not confirmed: %v", xCmdObj.Pid(), err)
+	atomic.StoreInt32(&xCmdObj.replaced, 1)
+	object.killChild(xCmdObj, "upgrade aborted")
+	object.wg.Add(1)
+	go object.waitChild(xCmdObj)
+	object.waitExited(xCmdObj)
+	object.bus.remove(xCmdObj)
+	xCmdObj.Close()
+	return
+}
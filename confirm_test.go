@@ -0,0 +1,87 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestManualConfirm(t *testing.T) {
+	awaiting := make(chan Event, 2)
+	object, signalCh, doneCh := startFakeParent(t, withSetup(func(object *Daemon) {
+		object.SetControlSocket(filepath.Join(t.TempDir(), "control.sock")).
+			SetManualConfirm(true).
+			OnEvent(func(event Event) {
+				if EventAwaitingConfirm == event.Type {
+					awaiting <- event
+				}
+			})
+		if err := object.ConfirmUpgrade(); !errors.Is(err, ErrNoPendingUpgrade) {
+			t.Fatal(err)
+		}
+	}), withReady(func(object *Daemon) bool {
+		return nil != object.currentChild() && 1 == atomic.LoadInt32(&object.running)
+	}))
+	pid := object.currentChild().Pid()
+
+	// 放弃切换，新子进程被强杀，旧子进程继续服务
+	upgradeCh := make(chan error, 1)
+	go func() {
+		upgradeCh <- object.Upgrade()
+	}()
+	event := <-awaiting
+	// 等待确认期间不占用写锁
+	broadcastCh := make(chan error, 1)
+	go func() {
+		broadcastCh <- object.Broadcast([]byte("ping"))
+	}()
+	select {
+	case err := <-broadcastCh:
+		if nil != err {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("broadcast blocked while awaiting confirmation")
+	}
+	if status := object.Status(); event.Pid != status.AwaitingConfirm || pid != status.ChildPid {
+		t.Fatal(event, status)
+	}
+	if err := SendControl(object.controlSocket, AbortRequest); nil != err {
+		t.Fatal(err)
+	}
+	if err := <-upgradeCh; !errors.Is(err, ErrUpgradeAborted) {
+		t.Fatal(err)
+	}
+	if status := object.Status(); 0 != status.AwaitingConfirm || pid != object.currentChild().Pid() {
+		t.Fatal(status)
+	}
+
+	// 确认后排空旧子进程
+	go func() {
+		upgradeCh <- object.Upgrade()
+	}()
+	event = <-awaiting
+	if pid != object.currentChild().Pid() {
+		t.Fatal("drained before confirmation")
+	}
+	if err := SendControl(object.controlSocket, ConfirmRequest); nil != err {
+		t.Fatal(err)
+	}
+	if err := <-upgradeCh; nil != err {
+		t.Fatal(err)
+	}
+	if event.Pid != object.currentChild().Pid() {
+		t.Fatal(event.Pid, object.currentChild().Pid())
+	}
+
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,90 @@
+package daemon
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// drainReportInterval 子进程排空期间上报连接数的间隔
+const drainReportInterval = 100 * time.Millisecond
+
+// 子进程被跟踪的连接
+var (
+	activeConns      int64 // 活跃连接数
+	trackedListeners int32 // 被跟踪的侦听数
+)
+
+// TrackedListener 统计活跃连接的侦听，子进程排空期间连接数上报给父进程，
+// 父进程等到连接全部关闭或超时后再结束旧子进程
+type TrackedListener struct {
+	net.Listener
+}
+
+// TrackListener 包装侦听以跟踪连接
+func TrackListener(ln net.Listener) *TrackedListener {
+	atomic.AddInt32(&trackedListeners, 1)
+	return &TrackedListener{Listener: ln}
+}
+
+// Accept 接受连接并计数
+func (object *TrackedListener) Accept() (net.Conn, error) {
+	conn, err := object.Listener.Accept()
+	if nil != err {
+		return nil, err
+	}
+	atomic.AddInt64(&activeConns, 1)
+	return &trackedConn{Conn: conn}, nil
+}
+
+// ActiveConnections 被跟踪的活跃连接数
+func ActiveConnections() int64 {
+	return atomic.LoadInt64(&activeConns)
+}
+
+// trackedConn 关闭时减少计数
+type trackedConn struct {
+	net.Conn
+	once sync.Once
+}
+
+// Close 关闭连接
+func (object *trackedConn) Close() error {
+	object.once.Do(func() {
+		atomic.AddInt64(&activeConns, -1)
+	})
+	return object.Conn.Close()
+}
+
+// ReportDrainProgress 排空期间向父进程上报进度说明，如"flushing 3 queues"，
+// 父进程以EventDrainProgress事件发布，前台运行时忽略
+func (object *Registry) ReportDrainProgress(message string) error {
+	if nil == object.parent {
+		return nil
+	}
+	return object.parent.ChildWriteStream(StreamProgress, []byte(message))
+}
+
+// reportDrain 子进程排空期间定期上报连接数，doneCh关闭后停止
+func (object *Daemon) reportDrain(doneCh chan struct{}) {
+	if 0 >= atomic.LoadInt32(&trackedListeners) {
+		return
+	}
+	ticker := time.NewTicker(drainReportInterval)
+	defer ticker.Stop()
+	for {
+		raw := NewBuffer(8).WriteUint64(uint64(ActiveConnections()))
+		if err := object.xCmdObj.ChildWriteStream(StreamDrain, raw.Slice(raw.ReadableBytes())); nil != err {
+			glog.Error(err)
+			return
+		}
+		select {
+		case <-doneCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
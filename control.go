@@ -0,0 +1,191 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// command 控制指令
+type command struct {
+	action  string     // 指令
+	replyCh chan error // 执行结果，可为空
+	source  string     // 指令来源，记录在更新历史中
+	signal  bool       // 由信号触发
+	deploy  *Deploy    // 更新附带的部署信息
+}
+
+// reply 回复执行结果
+func (object *command) reply(err error) {
+	if nil != object.replyCh {
+		object.replyCh <- err
+	}
+}
+
+// postCommand 投递指令，不等待结果
+func (object *Daemon) postCommand(action, source string) {
+	object.controlCh <- &command{action: action, source: source}
+}
+
+// execCommand 投递指令并等待结果
+func (object *Daemon) execCommand(action string) error {
+	return object.execCommandFrom(action, "api")
+}
+
+// execCommandFrom 投递指定来源的指令并等待结果，主循环在投递或回复前退出时返回ErrNotRunning
+func (object *Daemon) execCommandFrom(action, source string) error {
+	if 0 == atomic.LoadInt32(&object.running) {
+		return newLifecycleError(action, 0, ErrNotRunning, nil)
+	}
+	loopDone := object.loopDone
+	replyCh := make(chan error, 1)
+	select {
+	case object.controlCh <- &command{action: action, replyCh: replyCh, source: source}:
+	case <-loopDone:
+		return newLifecycleError(action, 0, ErrNotRunning, nil)
+	}
+	select {
+	case err := <-replyCh:
+		return err
+	case <-loopDone:
+	}
+	// 退出前可能已回复
+	select {
+	case err := <-replyCh:
+		return err
+	default:
+		return newLifecycleError(action, 0, ErrNotRunning, nil)
+	}
+}
+
+// Upgrade 在守护进程内发起更新，返回更新结果；
+// 已有更新进行中时返回ErrUpgradeInProgress
+func (object *Daemon) Upgrade() error {
+	return object.execCommand(UpgradeRequest)
+}
+
+// IsUpgrading 是否有更新进行中
+func (object *Daemon) IsUpgrading() bool {
+	return 1 == atomic.LoadInt32(&object.upgrading)
+}
+
+// controlRequestSize 控制指令的最大长度
+const controlRequestSize = 512
+
+// controlReadTimeout 读取控制指令的期限，避免不发送指令的连接一直占用
+const controlReadTimeout = 5 * time.Second
+
+// SetControlSocket 设置控制socket路径，可发送Exit、Upgrade、Workers:n等指令，
+// 每个连接一条指令，回复OK或ERR及原因；Linux下以@开头时使用抽象命名空间，不创建文件，
+// 按对端凭证只接受与守护进程同一用户或root的连接；
+// Windows下使用控制管道
+func (object *Daemon) SetControlSocket(path string) *Daemon {
+	object.controlSocket = path
+	return object
+}
+
+// handleControl 处理控制socket上的一条指令
+func (object *Daemon) handleControl(conn net.Conn) {
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(controlReadTimeout))
+	line, err := bufio.NewReader(io.LimitReader(conn, controlRequestSize)).ReadString('\n')
+	if nil != err && io.EOF != err {
+		glog.Error(err)
+		return
+	}
+	action := strings.TrimSpace(line)
+	reply := "OK\n"
+	if HistoryRequest == action || StatusRequest == action {
+		// 查询不经过主循环
+		var raw []byte
+		if HistoryRequest == action {
+			raw, err = object.historyJSON()
+		} else {
+			raw, err = json.Marshal(object.Status())
+		}
+		if nil == err {
+			reply = fmt.Sprintf("OK %s\n", raw)
+		}
+	} else if HealthRequest == action {
+		err = object.Health()
+	} else if ConfirmRequest == action {
+		err = object.ConfirmUpgrade()
+	} else if AbortRequest == action {
+		err = object.AbortUpgrade()
+	} else {
+		err = object.execCommandFrom(action, "control socket")
+	}
+	if nil != err {
+		reply = fmt.Sprintf("ERR %v\n", err)
+	}
+	conn.Write([]byte(reply))
+}
+
+// closeControl 关闭控制socket
+func (object *Daemon) closeControl() {
+	if nil != object.controlLn {
+		object.controlLn.Close()
+		object.controlLn = nil
+		removeSocketFile("unix", object.controlSocket)
+	}
+}
+
+// SendControl 经控制socket向运行中的守护进程发送指令，返回执行结果
+func SendControl(path, action string) error {
+	_, err := QueryControl(path, action)
+	return err
+}
+
+// QueryControl 经控制socket发送指令，返回OK之后的内容，如history的JSON
+func QueryControl(path, action string) (result string, err error) {
+	var conn net.Conn
+	if conn, err = net.Dial("unix", path); nil != err {
+		return
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte(action + "\n")); nil != err {
+		return
+	}
+	var reply string
+	if reply, err = bufio.NewReader(conn).ReadString('\n'); nil != err && io.EOF != err {
+		return
+	}
+	err = nil
+	if reply = strings.TrimSpace(reply); !strings.HasPrefix(reply, "OK") {
+		err = errors.New(strings.TrimPrefix(reply, "ERR "))
+		return
+	}
+	result = strings.TrimSpace(strings.TrimPrefix(reply, "OK"))
+	return
+}
+
+// SetUpgradeCooldown 更新结束后cooldown内忽略信号触发的更新，部署工具连发信号时只更新一次；
+// 更新进行中的重复请求总是被合并，均以EventUpgradeSkipped事件报告。控制socket与Upgrade调用不受冷却期限制
+func (object *Daemon) SetUpgradeCooldown(cooldown time.Duration) *Daemon {
+	object.upgradeCooldown = cooldown
+	return object
+}
+
+// skipUpgrade 忽略重复的更新请求
+func (object *Daemon) skipUpgrade(cmd *command, reason string) {
+	glog.Warningf("upgrade request from %s skipped: %s", cmd.source, reason)
+	object.auditAction(AuditUpgradeRefused, nil, map[string]string{
+		"source": cmd.source,
+		"reason": reason,
+	})
+	child := object.currentChild()
+	event := Event{Type: EventUpgradeSkipped, Reason: reason}
+	if nil != child {
+		event.Pid = child.Pid()
+		event.Worker = child.worker
+	}
+	object.emit(event)
+}
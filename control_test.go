@@ -0,0 +1,31 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestControlSocketMode(t *testing.T) {
+	// 守护进程化后的umask为0
+	old := syscall.Umask(0)
+	defer syscall.Umask(old)
+	object := Default().SetControlSocket(filepath.Join(t.TempDir(), "control.sock"))
+	if err := object.serveControl(); nil != err {
+		t.Fatal(err)
+	}
+	defer object.closeControl()
+	var stat syscall.Stat_t
+	if err := syscall.Stat(object.controlSocket, &stat); nil != err {
+		t.Fatal(err)
+	}
+	if mode := stat.Mode & 0777; 0600 != mode {
+		t.Fatalf("control socket mode %o", mode)
+	}
+	if _, err := QueryControl(object.controlSocket, StatusRequest); nil != err {
+		t.Fatal(err)
+	}
+}
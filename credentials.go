@@ -0,0 +1,49 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// SendCredentials 子进程向父进程证明身份，需在其他消息之前调用；
+// 只有Linux下的socketpair传输由内核担保凭证，其他传输返回ErrTransport
+func (object *XCmd) SendCredentials() error {
+	if nil == object.conn || !socketCredentials {
+		return fmt.Errorf("%w: peer credentials need socketpair transport on linux", ErrTransport)
+	}
+	return sendSocketCredentials(object.conn)
+}
+
+// VerifyPeer 父进程校验子进程凭证，pid须为所派生的子进程，uid须与当前进程一致。
+// 凭证须由内核担保，子进程自报的pid无法证明身份，且在独立的PID命名空间中总是1，
+// 因此传输不携带内核凭证时直接失败
+func (object *XCmd) VerifyPeer(ctx context.Context) (err error) {
+	if nil == object.conn || !socketCredentials {
+		return fmt.Errorf("%w: transport carries no kernel credentials", ErrPeerCredentials)
+	}
+	var pid, uid int
+	if pid, uid, err = readSocketCredentials(ctx, object.conn); nil != err {
+		return
+	}
+	if object.Pid() != pid || os.Getuid() != uid {
+		err = fmt.Errorf("%w: pid %d uid %d, expected pid %d uid %d",
+			ErrPeerCredentials, pid, uid, object.Pid(), os.Getuid())
+	}
+	return
+}
+
+// checkVerifyPeer 启用对端校验时须能取得内核凭证，否则每次派生都会失败，在派生前拒绝；
+// 自定义的ProcessRunner自行决定传输方式，只校验平台
+func (object *Daemon) checkVerifyPeer() error {
+	if !object.verifyPeer {
+		return nil
+	}
+	if !socketCredentials {
+		return fmt.Errorf("%w: peer verification needs kernel credentials on linux", ErrTransport)
+	}
+	if runner, ok := object.runner.(execRunner); ok && TransportSocketpair != runner.transport {
+		return fmt.Errorf("%w: peer verification needs socketpair transport", ErrTransport)
+	}
+	return nil
+}
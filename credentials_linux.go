@@ -0,0 +1,102 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// socketCredentials Linux下由内核通过SCM_CREDENTIALS担保对端凭证
+const socketCredentials = true
+
+// credentialsMarker 携带凭证的单字节消息
+const credentialsMarker = 'C'
+
+// setPassCred 开启接收凭证
+func setPassCred(conn *net.UnixConn) (err error) {
+	var raw syscall.RawConn
+	if raw, err = conn.SyscallConn(); nil != err {
+		return
+	}
+	if e := raw.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_PASSCRED, 1)
+	}); nil != e {
+		err = e
+	}
+	return
+}
+
+// sendSocketCredentials 发送带凭证的消息，内核校验pid/uid的真实性
+func sendSocketCredentials(conn *net.UnixConn) (err error) {
+	oob := syscall.UnixCredentials(&syscall.Ucred{
+		Pid: int32(os.Getpid()),
+		Uid: uint32(os.Getuid()),
+		Gid: uint32(os.Getgid()),
+	})
+	_, _, err = conn.WriteMsgUnix([]byte{credentialsMarker}, oob, nil)
+	return
+}
+
+// readSocketCredentials 读取对端凭证，只消费凭证消息本身
+func readSocketCredentials(ctx context.Context, conn *net.UnixConn) (pid, uid int, err error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetReadDeadline(deadline)
+		defer conn.SetReadDeadline(time.Time{})
+	}
+	buf := make([]byte, 1)
+	oob := make([]byte, syscall.CmsgSpace(syscall.SizeofUcred))
+	var n, oobn int
+	if n, oobn, _, _, err = conn.ReadMsgUnix(buf, oob); nil != err {
+		if nil != ctx.Err() {
+			err = ctx.Err()
+		}
+		return
+	}
+	if 1 != n || credentialsMarker != buf[0] {
+		err = fmt.Errorf("%w: unexpected message", ErrPeerCredentials)
+		return
+	}
+	var messages []syscall.SocketControlMessage
+	if messages, err = syscall.ParseSocketControlMessage(oob[:oobn]); nil != err {
+		return
+	}
+	for i := range messages {
+		var cred *syscall.Ucred
+		if cred, err = syscall.ParseUnixCredentials(&messages[i]); nil == err {
+			pid, uid = int(cred.Pid), int(cred.Uid)
+			return
+		}
+	}
+	err = fmt.Errorf("%w: no credentials received", ErrPeerCredentials)
+	return
+}
+
+// checkControlPeer 校验控制socket的对端，只接受与当前进程同一用户或root；
+// 抽象命名空间的socket没有文件权限，任何用户都能连接
+func checkControlPeer(conn net.Conn) (err error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return fmt.Errorf("%w: control connection is not a unix socket", ErrPeerCredentials)
+	}
+	var raw syscall.RawConn
+	if raw, err = unixConn.SyscallConn(); nil != err {
+		return
+	}
+	var cred *syscall.Ucred
+	if e := raw.Control(func(fd uintptr) {
+		cred, err = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); nil != e {
+		err = e
+	}
+	if nil != err {
+		return
+	}
+	if uid := int(cred.Uid); 0 != uid && os.Getuid() != uid {
+		err = fmt.Errorf("%w: control peer pid %d uid %d, expected uid %d",
+			ErrPeerCredentials, cred.Pid, uid, os.Getuid())
+	}
+	return
+}
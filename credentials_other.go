@@ -0,0 +1,33 @@
+//go:build !linux
+// +build !linux
+
+package daemon
+
+import (
+	"context"
+	"net"
+)
+
+// socketCredentials 非Linux平台不能由内核担保凭证，VerifyPeer总是失败
+const socketCredentials = false
+
+// setPassCred 不支持
+func setPassCred(conn *net.UnixConn) error {
+	return nil
+}
+
+// sendSocketCredentials 不支持
+func sendSocketCredentials(conn *net.UnixConn) error {
+	return ErrTransport
+}
+
+// readSocketCredentials 不支持
+func readSocketCredentials(ctx context.Context, conn *net.UnixConn) (pid, uid int, err error) {
+	err = ErrTransport
+	return
+}
+
+// checkControlPeer 非Linux下没有抽象命名空间，由socket文件权限限制对端
+func checkControlPeer(conn net.Conn) error {
+	return nil
+}
@@ -1,62 +1,180 @@
 package daemon
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
 	"sync"
 	"sync/atomic"
-	"syscall"
+	"time"
 
 	"github.com/golang/glog"
 )
 
 // 响应
 const (
-	ReadyOK     = "ReadyOK"
-	ReadyError  = "ReadyError"
-	ExitRequest = "Exit"
-	ExitReply   = ExitRequest
+	ReadyOK        = "ReadyOK"
+	ReadyError     = "ReadyError"
+	ExitRequest    = "Exit"
+	ExitReply      = ExitRequest
+	UpgradeRequest = "Upgrade"
 )
 
-// panicOnError 错误崩溃
-func panicOnError(err error) {
-	if nil != err {
-		panic(err)
-	}
-}
-
 // Daemon 守护进程
 type Daemon struct {
 	sync.RWMutex
-	rebootTimes     int            // 最大重启次数
-	upgradeFlag     int32          // 正常更新标志
-	killedFlag      int32          // 正常停服标志
-	origArgs        []string       // 程序原始运行参数
-	wg              sync.WaitGroup // 等待组
-	xCmdObj         *XCmd          // 扩展Cmd
-	childCmd        string         // 运行子进程命令 --child
-	upgradeCmd      string         // 更新命名 --upgrade
-	bootstrapArgs   string         // 引导参数 --bootstrap_args
-	bootstrapLogDir string         // 引导日志
-	pidFile         string         // PID文件
-	tcpPorts        map[string]int // 业务逻辑层需要用的端口
+	rebootTimes       int32                   // 剩余的重启次数，崩溃时由waitChild递减，原子访问
+	upgrading         int32                   // 更新进行中
+	killedFlag        int32                   // 正常停服标志
+	origArgs          []string                // 程序原始运行参数
+	appArgs           []string                // 子命令之后的参数，派生子进程时原样传递
+	childExtraArgs    []string                // 额外传给子进程的参数
+	legacyFlags       bool                    // 使用旧的布尔参数代替子命令
+	wg                sync.WaitGroup          // 等待组
+	xCmdObj           *XCmd                   // 扩展Cmd
+	childCmd          string                  // 运行子进程命令 child
+	upgradeCmd        string                  // 更新命名 upgrade
+	bootstrapArgs     string                  // 引导参数 --bootstrap_args
+	bootstrapLogDir   string                  // 引导日志
+	pidFile           string                  // PID文件
+	pidFileHandle     *os.File                // 持有锁的PID文件
+	serviceName       string                  // 系统服务名
+	serviceManager    string                  // 服务管理器 systemd/launchd
+	daemonize         bool                    // 是否脱离终端运行
+	workDir           string                  // 脱离终端后的工作目录
+	umask             int                     // 脱离终端后的umask
+	daemonLogFile     string                  // 脱离终端后标准流重定向的日志文件
+	listenerSpecs     []ListenerSpec          // 业务逻辑层需要用的侦听
+	controlCh         chan *command           // 控制指令
+	running           int32                   // 守护进程是否在运行
+	loopDone          chan struct{}           // 主循环退出后关闭
+	runner            ProcessRunner           // 进程运行器
+	readyTimeout      time.Duration           // 等待子进程准备好的超时
+	startupGrace      time.Duration           // 启动宽限期，期间只检查心跳
+	heartbeatTimeout  time.Duration           // 宽限期内心跳的最大间隔
+	drainTimeout      time.Duration           // 等待子进程安全退出的超时
+	maxMessageSize    int                     // 父子进程通信的最大消息长度
+	checksum          bool                    // 父子进程通信附带校验和
+	codecID           byte                    // 父子进程通信的压缩算法
+	compressAbove     int                     // 超过该长度的消息才压缩
+	transport         Transport               // 父子进程通信的传输方式
+	verifyPeer        bool                    // 信任子进程消息前校验对端凭证
+	tlsSource         TLSSource               // 证书来源，由父进程管理
+	tlsInterval       time.Duration           // 证书重载间隔
+	tlsCert           *tls.Certificate        // 最近一次加载的证书
+	tlsMaterial       []byte                  // 下发给子进程的证书与票据密钥
+	ticketKeys        [][32]byte              // 会话票据密钥，最新的在前
+	ticketRotation    time.Duration           // 票据密钥轮换间隔
+	tlsStore          *tlsStore               // 子进程收到的证书
+	supervised        bool                    // 由Supervisor监督，控制通道与服务管理器通知不由单个服务负责
+	command           string                  // 外部程序路径，为空时重新执行自身
+	commandArgs       []string                // 外部程序参数
+	commandEnv        []string                // 外部程序环境变量，为空时继承父进程
+	envFilter         func(string) bool       // 继承环境变量的过滤器
+	envOverrides      []string                // 额外设置的环境变量
+	workerIndex       int                     // 工作进程序号
+	generation        uint64                  // 已派生的子进程代数
+	bus               *bus                    // 子进程间发布订阅的代理
+	logSink           *logRotator             // 子进程转发日志的汇总文件
+	audit             *auditLog               // 审计日志，未设置时为nil
+	workerCount       int                     // 期望的工作进程数
+	workers           []*Daemon               // 序号1起的其他工作进程，各自守护一个子进程
+	workersLock       sync.Mutex              // 保护workers
+	primary           *Daemon                 // 工作进程所属的主Daemon，主Daemon为nil
+	lnFiles           map[string]*os.File     // 父进程侦听的文件，扩容时传给新子进程
+	bindRetry         BindRetry               // 端口被占用时的重试策略
+	listenerControls  listenerControls        // 侦听名->绑定前的控制函数
+	listenerSet       listenerSetState        // 重载时侦听集合的变化
+	controlSocket     string                  // 控制socket路径，为空时不开启
+	controlLn         net.Listener            // 控制socket
+	autoscale         *AutoscalePolicy        // 自动扩缩容策略
+	procStats         procStatsState          // 子进程资源采样
+	fdLeak            *FdLeakPolicy           // 描述符泄漏告警，未设置时为nil
+	confirm           confirmState            // 手动确认模式
+	deploy            deployState             // 更新附带的部署信息
+	balance           Balance                 // 父进程接受的连接的分发方式
+	nextChild         uint32                  // 轮询分发的计数
+	status            statusState             // 状态文件
+	history           historyState            // 更新历史
+	eventHandlers     []func(event Event)     // 生命周期事件处理函数
+	messageHandlers   []ChildMessageHandler   // 子进程消息的处理函数
+	webhooks          *webhooks               // 进行中的事件回调
+	tracer            Tracer                  // 追踪器，未设置时为nil
+	adminNetwork      string                  // 管理侦听网络
+	adminAddress      string                  // 管理侦听地址，为空时不开启
+	adminPprof        bool                    // 管理侦听上开启pprof
+	adminExpvar       bool                    // 管理侦听上开启expvar
+	adminMux          *http.ServeMux          // 管理侦听的路由
+	adminLn           net.Listener            // 管理侦听
+	exhaustedPolicy   ExhaustedPolicy         // 重启次数用尽后的策略
+	exhaustedExitCode int                     // ExhaustedExit的退出码
+	exhaustedCh       chan int                // 重启次数用尽的工作进程序号
+	crashCh           chan *Daemon            // 子进程意外退出待重启的工作进程，由主循环处理
+	forwardQuit       bool                    // 把SIGQUIT转发给子进程
+	spawnCtx          context.Context         // 派生子进程的上下文
+	abortSpawn        context.CancelCauseFunc // 停服时中止进行中的启动
+	signalActions     map[os.Signal]string    // 信号->控制指令
+	lastScale         time.Time               // 上次自动扩缩容的时间
+	healthProbe       *HealthProbe            // 父进程对子进程的健康探测
+	prepareTimeout    time.Duration           // 更新前与旧子进程协商的超时，0为不协商
+	livenessTimeout   time.Duration           // 子进程准备好后心跳的最大间隔，0为不检查
+	preStopDelay      time.Duration           // 停服时开始排空前的等待
+	terminationGrace  time.Duration           // 停服的总时限，0为不限
+	namespaces        Namespaces              // 子进程新建的命名空间
+	childDir          string                  // 子进程的工作目录，为空时继承
+	childUmask        int                     // 子进程的umask，小于0时继承
+	childChroot       string                  // 子进程exec前chroot的目录，为空时不切换
+	cpusPerWorker     int                     // 每个工作进程绑定的CPU数，0为不绑定
+	secretProviders   []SecretProvider        // 机密来源，派生子进程前依次调用
+	preflights        []preflight             // 派生子进程前的检查
+	spawnTimeout      time.Duration           // 派生子进程的超时，0为不限
+	exitTimeout       time.Duration           // 强杀后等待旧子进程退出的超时，0为不限
+	deployDeadline    time.Duration           // 整个更新的期限，0为不限
+	sharedSegments    []sharedSegment         // 子进程继承的共享内存
+	extraFiles        []extraFile             // 子进程继承的其他文件
+	staging           *Staging                // 蓝绿更新的设置，为空时不暂存
+	lastLaunch        *Launch                 // 最近一次成功启动的子进程环境
+	secretEnv         []string                // 作为机密的环境变量，不传给子进程
+	encryption        bool                    // 父子进程通信认证加密
+	upgradeCooldown   time.Duration           // 更新结束后忽略信号触发的更新的时长
+	dryRun            bool                    // 更新前的启动校验，子进程准备好后即退出
+	current           atomic.Pointer[XCmd]    // 当前子进程，供不持锁的协程读取
 }
 
 // New 工厂方法
 func New(childCmd, upgradeCmd, bootstrapArgs, bootstrapLogDir, pidFile string) *Daemon {
+	spawnCtx, abortSpawn := context.WithCancelCause(context.Background())
 	return &Daemon{
-		rebootTimes:     3,
-		childCmd:        childCmd,
-		upgradeCmd:      upgradeCmd,
-		bootstrapArgs:   bootstrapArgs,
-		bootstrapLogDir: bootstrapLogDir,
-		pidFile:         pidFile,
+		spawnCtx:          spawnCtx,
+		abortSpawn:        abortSpawn,
+		rebootTimes:       3,
+		childCmd:          childCmd,
+		upgradeCmd:        upgradeCmd,
+		bootstrapArgs:     bootstrapArgs,
+		bootstrapLogDir:   bootstrapLogDir,
+		pidFile:           pidFile,
+		controlCh:         make(chan *command, 1),
+		runner:            execRunner{},
+		readyTimeout:      time.Minute,
+		webhooks:          &webhooks{},
+		exhaustedExitCode: -1,
+		childUmask:        -1,
+		exhaustedCh:       make(chan int, 1),
+		crashCh:           make(chan *Daemon, 1),
+		drainTimeout:      30 * time.Second,
+		maxMessageSize:    DefaultMaxMessageSize,
+		bus:               &bus{},
+		workerCount:       1,
+		signalActions:     defaultSignalActions(),
 	}
 }
 
@@ -69,194 +187,744 @@ func Default() *Daemon {
 		"daemonPID")
 }
 
+// SetServiceName 设置系统服务名，默认为可执行文件名
+func (object *Daemon) SetServiceName(serviceName string) *Daemon {
+	object.serviceName = serviceName
+	return object
+}
+
+// SetProcessRunner 设置进程运行器，测试时可替换为FakeRunner
+func (object *Daemon) SetProcessRunner(runner ProcessRunner) *Daemon {
+	object.runner = runner
+	return object
+}
+
+// SetCommand 设置守护外部程序而非重新执行自身，外部程序需遵循fd传递约定：
+// fd 3、4为通信管道(socketpair时为fd 3)，侦听fd与名字通过--bootstrap_args传入，
+// 准备好后回执ReadyOK；不会追加--child参数，env为空时继承父进程环境变量
+func (object *Daemon) SetCommand(path string, args []string, env []string) *Daemon {
+	object.command = path
+	object.commandArgs = args
+	object.commandEnv = env
+	return object
+}
+
+// SetRebootTimes 设置子进程意外退出后的最大重启次数，命令行--reboot_times优先
+func (object *Daemon) SetRebootTimes(rebootTimes int) *Daemon {
+	atomic.StoreInt32(&object.rebootTimes, int32(rebootTimes))
+	return object
+}
+
+// SetReadyTimeout 设置等待子进程准备好的超时，0表示不超时
+func (object *Daemon) SetReadyTimeout(readyTimeout time.Duration) *Daemon {
+	object.readyTimeout = readyTimeout
+	return object
+}
+
+// SetDrainTimeout 设置等待子进程安全退出的超时，0表示不超时
+func (object *Daemon) SetDrainTimeout(drainTimeout time.Duration) *Daemon {
+	object.drainTimeout = drainTimeout
+	return object
+}
+
+// SetMaxMessageSize 设置父子进程通信的最大消息长度，父子进程使用同一配置
+func (object *Daemon) SetMaxMessageSize(maxMessageSize int) *Daemon {
+	object.maxMessageSize = maxMessageSize
+	return object
+}
+
+// SetChecksum 设置父子进程通信是否附带CRC32校验和
+func (object *Daemon) SetChecksum(checksum bool) *Daemon {
+	object.checksum = checksum
+	return object
+}
+
+// SetCompression 设置父子进程通信压缩超过threshold字节的消息，用于大状态交接
+func (object *Daemon) SetCompression(codecID byte, threshold int) *Daemon {
+	object.codecID = codecID
+	object.compressAbove = threshold
+	return object
+}
+
+// SetTransport 设置父子进程通信的传输方式，子进程按继承的fd类型自动识别；
+// 自定义的ProcessRunner自行决定传输方式
+func (object *Daemon) SetTransport(transport Transport) *Daemon {
+	object.transport = transport
+	if runner, ok := object.runner.(execRunner); ok {
+		runner.transport = transport
+		object.runner = runner
+	}
+	return object
+}
+
+// SetVerifyPeer 设置信任子进程消息前校验对端pid/uid，父子进程使用同一配置；
+// 凭证由内核担保，须在Linux下使用socketpair传输，否则启动时返回ErrTransport
+func (object *Daemon) SetVerifyPeer(verifyPeer bool) *Daemon {
+	object.verifyPeer = verifyPeer
+	return object
+}
+
+// SetTLS 设置由父进程管理证书，ListenerSpec.TLS为真的侦听在子进程中返回TLS侦听；
+// 每隔interval重载一次，证书变化时下发给子进程，0表示只在启动与更新时加载
+func (object *Daemon) SetTLS(source TLSSource, interval time.Duration) *Daemon {
+	object.tlsSource = source
+	object.tlsInterval = interval
+	return object
+}
+
+// SetTicketKeyRotation 设置由父进程每隔interval轮换TLS会话票据密钥并下发给子进程，
+// 保留最近几个密钥用于解密，会话恢复跨更新与多个子进程有效；父子进程使用同一配置
+func (object *Daemon) SetTicketKeyRotation(interval time.Duration) *Daemon {
+	object.ticketRotation = interval
+	return object
+}
+
+// SetListeners 设置业务逻辑层需要用的侦听，配合Run使用
+func (object *Daemon) SetListeners(specs ...ListenerSpec) *Daemon {
+	object.listenerSpecs = specs
+	return object
+}
+
+// timeoutContext 超时上下文，0表示不超时
+func timeoutContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if 0 >= timeout {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, timeout)
+}
+
+// SetDaemonize 设置脱离终端运行，适用于未由systemd等托管的环境
+func (object *Daemon) SetDaemonize(workDir string, umask int, logFile string) *Daemon {
+	object.daemonize = true
+	object.workDir = workDir
+	object.umask = umask
+	object.daemonLogFile = logFile
+	return object
+}
+
 // spawnChildProcess 生成孩子进程
-func (object *Daemon) spawnChildProcess(tcpLnFiles map[string]*os.File) (xCmdObj *XCmd, err error) {
+func (object *Daemon) spawnChildProcess(ctx context.Context, lnFiles map[string]*os.File) (xCmdObj *XCmd, err error) {
 	// 构建启动参数
-	args := make([]string, len(object.origArgs))
-	copy(args, object.origArgs)
-	args = append(args, "--"+object.childCmd)
+	var args []string
+	if 0 < len(object.command) {
+		args = append([]string{object.command}, object.commandArgs...)
+	} else {
+		args = object.childArgs()
+	}
 
 	// 构建XCmd
-	xCmdObj = NewXCmd(args[0], args[1:]...)
+	if xCmdObj, err = object.runner.Command(args[0], args[1:]...); nil != err {
+		return
+	}
+	xCmdObj.SetMaxMessageSize(object.maxMessageSize).
+		SetChecksum(object.checksum).
+		SetCompression(object.codecID, object.compressAbove).
+		SetNamespaces(object.namespaces)
+	object.applyChildDir(xCmdObj)
+
+	// 子进程身份
+	object.generation++
+	worker := WorkerInfo{Index: object.workerIndex, Generation: object.generation}
+	xCmdObj.Env = worker.env(object.childEnv())
+	xCmdObj.worker = worker
+	xCmdObj.SetGeneration(worker.Generation)
 
 	// 赋值标准流
 	xCmdObj.Stdin = os.Stdin
 	xCmdObj.Stdout = os.Stdout
 	xCmdObj.Stderr = os.Stderr
 
+	// 加载机密，失败时不启动
+	var secrets []byte
+	if secrets, err = object.loadSecrets(ctx); nil != err {
+		xCmdObj.Close()
+		xCmdObj = nil
+		return
+	}
+	defer wipe(secrets)
+
+	// 通信密钥，fd在侦听之前
+	var keyFd int
+	if object.encryption {
+		var key []byte
+		if key, keyFd, err = passPipeKey(xCmdObj); nil == err {
+			err = xCmdObj.SetEncryption(key, true)
+			wipe(key)
+		}
+		if nil != err {
+			xCmdObj.Close()
+			xCmdObj = nil
+			return
+		}
+	}
+
 	// 填入fd
-	tcpLnFds := make(map[string]int)
-	for k, f := range tcpLnFiles {
-		tcpLnFds[k] = xCmdObj.AddFile(f).NextFd()
+	infos := object.passListeners(xCmdObj, lnFiles)
+	var handoffFd int
+	if object.acceptInParent() {
+		if handoffFd, err = newHandoff(xCmdObj); nil != err {
+			xCmdObj.Close()
+			xCmdObj = nil
+			return
+		}
+	}
+	object.passExtraFiles(xCmdObj)
+	if err = object.passSharedMemory(xCmdObj); nil != err {
+		xCmdObj.Close()
+		xCmdObj = nil
+		return
 	}
 
 	// 写入启动参数
+	xCmdObj.deploy = object.deployInfo()
 	var raw []byte
-	raw, err = json.Marshal(tcpLnFds)
-	panicOnError(err)
+	if raw, err = json.Marshal(bootstrapMeta{
+		Listeners:  infos,
+		Worker:     worker,
+		Handoff:    handoffFd,
+		Heartbeat:  object.heartbeatInterval(),
+		Liveness:   object.livenessInterval(),
+		PrivateTmp: 0 != object.namespaces&NamespaceMount,
+		CPUs:       object.workerCPUs(),
+		Secrets:    nil != secrets,
+		Key:        keyFd,
+		DryRun:     object.dryRun,
+		Fds:        xCmdObj.fdSlots,
+		Deploy:     xCmdObj.deploy,
+		Umask:      object.bootstrapUmask(),
+	}); nil != err {
+		xCmdObj.Close()
+		xCmdObj = nil
+		return
+	}
 	xCmdObj.Args = append(xCmdObj.Args,
 		fmt.Sprintf("--%s=%s", object.bootstrapArgs, string(raw)))
 
 	// 启动子进程
 	if err = xCmdObj.Start(); nil != err {
-		glog.Error(err)
+		xCmdObj.Close()
+		xCmdObj = nil
 		return
 	}
+	object.auditAction(AuditSpawn, xCmdObj, map[string]string{"binary": args[0]})
+
+	// 下发证书，子进程构建侦听前读取
+	material := object.tlsMaterial
+	if nil != object.primary {
+		material = object.primary.tlsMaterial
+	}
+	if nil != material {
+		if err = xCmdObj.ParentWriteStreamContext(ctx, StreamTLS, material); nil != err {
+			object.killChild(xCmdObj, "push tls failed")
+			xCmdObj.Close()
+			xCmdObj = nil
+			return
+		}
+	}
+
+	// 下发机密，子进程读取证书后读取
+	if nil != secrets {
+		if err = xCmdObj.ParentWriteStreamContext(ctx, StreamSecret, secrets); nil != err {
+			object.killChild(xCmdObj, "push secrets failed")
+			xCmdObj.Close()
+			xCmdObj = nil
+			return
+		}
+	}
 
 	return
 }
 
 // replaceChildProcess 重启子进程
-func (object *Daemon) replaceChildProcess(tcpLnFiles map[string]*os.File) (ok bool, err error) {
+func (object *Daemon) replaceChildProcess(lnFiles map[string]*os.File) (ok bool, err error) {
+	return object.replaceChildProcessContext(context.Background(), lnFiles)
+}
+
+// replaceChildProcessContext 重启子进程，traceCtx携带更新的追踪片段
+func (object *Daemon) replaceChildProcessContext(traceCtx context.Context, lnFiles map[string]*os.File) (ok bool, err error) {
 	object.Lock()
 	defer object.Unlock()
 
+	if err = object.runPreflight(); nil != err {
+		return
+	}
+
 	var newXCmdObj *XCmd
-	newXCmdObj, err = object.spawnChildProcess(tcpLnFiles)
+	_, spawnSpan := object.startSpan(traceCtx, SpanSpawn)
+	spawnCtx, cancelSpawn := object.spawnPhaseContext(traceCtx)
+	newXCmdObj, err = object.spawnChildProcess(spawnCtx, lnFiles)
 	if nil != err {
-		glog.Error(err)
+		if errors.Is(context.Cause(spawnCtx), ErrUpgradeDeadline) {
+			err = newLifecycleError(PhaseSpawn, 0, ErrUpgradeDeadline, err)
+		} else if errors.Is(context.Cause(spawnCtx), context.DeadlineExceeded) {
+			err = newLifecycleError(PhaseSpawn, 0, ErrSpawnTimeout, err)
+		} else {
+			err = newLifecycleError(PhaseSpawn, 0, ErrSpawn, err)
+		}
+		cancelSpawn()
+		spawnSpan.End(err)
 		return
 	}
+	cancelSpawn()
+	newXCmdObj.exited = make(chan struct{})
+	// 独占的侦听由旧子进程释放后新子进程才能绑定，启动失败或放弃切换时旧子进程重新绑定
+	if old := object.xCmdObj; object.releaseListeners(old) {
+		defer func() {
+			if !ok {
+				object.reacquireListeners(old)
+			}
+		}()
+	}
+	setChildAttributes(spawnSpan, newXCmdObj)
+	spawnSpan.End(nil)
+	launch := object.newLaunch(newXCmdObj)
 
 	// 等待子进程启动成功
 	ok = false
-	if err = newXCmdObj.ParentRead(func(raw []byte) bool {
+	_, readySpan := object.startSpan(traceCtx, SpanReady)
+	setChildAttributes(readySpan, newXCmdObj)
+	defer func() {
+		if nil != readySpan {
+			readySpan.End(err)
+		}
+	}()
+	ctx, beat, cancel := object.readyContext()
+	defer cancel()
+	ctx, cancelUpgrade := withUpgrade(ctx, traceCtx)
+	defer cancelUpgrade()
+	if object.verifyPeer {
+		if err = newXCmdObj.VerifyPeer(ctx); nil != err {
+			err = newLifecycleError(PhaseReady, newXCmdObj.Pid(), ErrPeerCredentials, err)
+			object.reapChild(newXCmdObj, "peer credentials mismatch")
+			newXCmdObj = nil
+			return
+		}
+	}
+	newXCmdObj.gates = newReadiness()
+	if err = newXCmdObj.ParentReadStreamsContext(ctx, func(stream uint32, raw []byte) bool {
+		if StreamHeartbeat == stream {
+			beat()
+			return true
+		}
+		if StreamGate == stream {
+			newXCmdObj.gates.apply(raw)
+			return true
+		}
+		// 业务逻辑准备好前的订阅
+		if StreamBus == stream {
+			object.bus.handle(newXCmdObj, raw)
+			return true
+		}
+		if StreamLog == stream {
+			object.forwardLog(newXCmdObj, raw)
+			return true
+		}
+		if StreamControl != stream {
+			return true
+		}
 		request := string(raw)
-		switch request {
-		case ReadyOK:
-			glog.Info("child ready ok")
-			ok = true
-			return false
-
-		case ReadyError:
+		if ReadyError == request {
 			glog.Error("child ready error")
 			return false
-
-		default:
+		}
+		var build *BuildInfo
+		if build, ok = parseReady(request); !ok {
 			return true
 		}
+		if newXCmdObj.build = build; nil != build {
+			glog.Infof("child ready ok, version: %s revision: %s checksum: %s",
+				build.Version, build.Revision, build.Checksum)
+		} else {
+			glog.Info("child ready ok")
+		}
+		return false
 	}); nil != err {
 		glog.Error(err)
 	}
 
-	// 启动子进程失败
+	// 启动子进程失败，报告未通过的准备好条件
 	if !ok {
-		newXCmdObj.Close()
+		err = newXCmdObj.gates.err(err)
+		reason := "child not ready"
+		if cause := context.Cause(ctx); errors.Is(cause, ErrSpawnAborted) {
+			// 停服中止启动
+			err = newLifecycleError(PhaseReady, newXCmdObj.Pid(), ErrSpawnAborted, err)
+			reason = "spawn aborted"
+		} else if errors.Is(cause, ErrUpgradeDeadline) {
+			// 超出更新期限，放弃替换
+			err = newLifecycleError(PhaseReady, newXCmdObj.Pid(), ErrUpgradeDeadline, err)
+			reason = "upgrade deadline exceeded"
+		} else if errors.Is(cause, ErrHeartbeatTimeout) {
+			// 宽限期内心跳中断，视为卡死
+			err = newLifecycleError(PhaseReady, newXCmdObj.Pid(), ErrHeartbeatTimeout, err)
+			reason = "startup heartbeat timeout"
+		} else if errors.Is(err, context.DeadlineExceeded) {
+			// 子进程无响应
+			err = newLifecycleError(PhaseReady, newXCmdObj.Pid(), ErrReadyTimeout, err)
+			reason = "ready timeout"
+		} else {
+			err = newLifecycleError(PhaseReady, newXCmdObj.Pid(), ErrChildNotReady, err)
+		}
+		object.reportLaunch(newXCmdObj, launch)
+		object.bus.remove(newXCmdObj)
+		// 回执失败的子进程也强杀并回收，不等它自行退出
+		object.reapChild(newXCmdObj, reason)
 		newXCmdObj = nil
 		return
 	}
 
+	// 分发新子进程发来的消息
+	object.dispatchChild(newXCmdObj)
+	if nil != newXCmdObj.build {
+		readySpan.SetAttribute(AttrBinaryHash, newXCmdObj.build.Checksum)
+	}
+	readySpan.End(nil)
+	readySpan = nil
+	object.launchSucceeded(launch)
+	if object.needsConfirm(traceCtx) {
+		if err = object.awaitConfirm(traceCtx, newXCmdObj); nil != err {
+			ok = false
+			newXCmdObj = nil
+			return
+		}
+	}
+
 	if nil != object.xCmdObj {
 		glog.Info("notify old child exit")
+		// 标记旧子进程为正常更新退出
+		atomic.StoreInt32(&object.xCmdObj.replaced, 1)
 		// 发送停止指令
-		if err = object.waitChildSafeExit(); nil != err {
-			glog.Error(err)
+		_, drainSpan := object.startSpan(traceCtx, SpanDrain)
+		setChildAttributes(drainSpan, object.xCmdObj)
+		e := object.waitChildSafeExit(context.WithoutCancel(traceCtx))
+		if nil != e {
+			glog.Error(e)
 		}
-		object.xCmdObj.Process.Kill()
-		object.wg.Wait()
+		drainSpan.End(e)
+		_, exitSpan := object.startSpan(traceCtx, SpanOldExit)
+		setChildAttributes(exitSpan, object.xCmdObj)
+		object.killChild(object.xCmdObj, "replaced by new child")
+		object.waitExited(object.xCmdObj)
+		exitSpan.End(nil)
 		glog.Info("notify old child exit")
 		object.xCmdObj.Close()
-		object.xCmdObj = nil
+		object.setChild(nil)
 	}
 
 	glog.Infof("wait new child")
-	object.xCmdObj = newXCmdObj
+	object.setChild(newXCmdObj)
 	object.wg.Add(1)
-	go func() {
-		defer object.wg.Done()
+	go object.waitChild(newXCmdObj)
+	return
+}
 
-		if err = object.xCmdObj.Wait(); nil != err {
-			glog.Error(err)
-		}
-		if atomic.CompareAndSwapInt32(&object.upgradeFlag, 1, 0) {
-			// 正常更新流程
-			glog.Infof("child: %d done", object.xCmdObj.Process.Pid)
-			return
-		}
+// setChild 替换当前子进程，调用方需持有写锁
+func (object *Daemon) setChild(xCmdObj *XCmd) {
+	object.xCmdObj = xCmdObj
+	object.current.Store(xCmdObj)
+}
 
-		if 0 == atomic.LoadInt32(&object.killedFlag) {
-			// 最大失败重试，直接退出
-			object.rebootTimes--
-			glog.Errorf("child: %d done unexpected, reboot times countdown: %d",
-				object.xCmdObj.Process.Pid,
-				object.rebootTimes)
-			if 0 > object.rebootTimes {
-				os.Exit(-1)
-				return
-			}
+// currentChild 当前子进程，不需要持锁，可能为nil
+func (object *Daemon) currentChild() *XCmd {
+	return object.current.Load()
+}
 
-			object.xCmdObj.Process.Release()
-			object.xCmdObj.Close()
-			object.xCmdObj = nil
-			object.replaceChildProcess(tcpLnFiles)
-		} else {
-			glog.Infof("child: %d done", object.xCmdObj.Process.Pid)
-		}
-	}()
-	return
+// waitChild 等待子进程退出，只处理传入的子进程，意外退出时按重启次数通知主循环重启
+func (object *Daemon) waitChild(child *XCmd) {
+	defer object.wg.Done()
+	defer close(child.exited)
+
+	err := child.Wait()
+	if nil != err {
+		glog.Error(err)
+	}
+	exit := newExitInfo(child, err)
+	event := Event{
+		Type:   EventChildExited,
+		Pid:    exit.Pid,
+		Worker: child.worker,
+		Reason: ExitCrash,
+		Exit:   exit,
+	}
+	if 0 != atomic.LoadInt32(&child.replaced) {
+		// 正常更新流程
+		glog.Infof("child: %d done", child.Pid())
+		event.Reason = ExitUpgrade
+		object.emit(event)
+		return
+	}
+	if 0 != atomic.LoadInt32(&object.killedFlag) {
+		event.Reason = ExitStop
+	}
+	object.setStatus(func(status *Status) {
+		status.LastExit = exit
+	})
+	object.emit(event)
+
+	if 0 != atomic.LoadInt32(&object.killedFlag) {
+		glog.Infof("child: %d done", child.Pid())
+		return
+	}
+	event.Type = EventChildCrashed
+	object.emit(event)
+	// 最大失败重试，直接退出
+	rebootTimes := atomic.AddInt32(&object.rebootTimes, -1)
+	object.beginOperation()
+	object.auditAction(AuditRestart, child, map[string]string{
+		"exit_code":    strconv.Itoa(exit.ExitCode),
+		"signal":       exit.Signal,
+		"reboot_times": strconv.Itoa(int(rebootTimes)),
+	})
+	glog.Errorf("child: %d done unexpected, reboot times countdown: %d",
+		child.Pid(),
+		rebootTimes)
+	object.setStatus(func(status *Status) {
+		status.Phase = StatusRestarting
+		status.Restarts++
+		status.LastError = fmt.Sprintf("child %d exited unexpectedly", child.Pid())
+	})
+	child.Release()
+	child.Close()
+
+	// 只清除仍为当前子进程的自己
+	object.Lock()
+	if child == object.xCmdObj {
+		object.setChild(nil)
+	}
+	object.Unlock()
+	if 0 > rebootTimes {
+		// 重启次数用尽，由主循环按策略处理
+		object.emit(Event{
+			Type:   EventRestartBudgetExhausted,
+			Pid:    exit.Pid,
+			Worker: child.worker,
+			Exit:   exit,
+		})
+		object.notifyExhausted()
+		return
+	}
+	object.notifyCrashed()
 }
 
-// waitChildSafeExit 等待子进程安全退出
-func (object *Daemon) waitChildSafeExit() (err error) {
+// drainProgress 发布排空中的子进程的进度
+func (object *Daemon) drainProgress(reason string) {
+	object.emit(Event{
+		Type:   EventDrainProgress,
+		Pid:    object.xCmdObj.Pid(),
+		Worker: object.xCmdObj.worker,
+		Reason: reason,
+	})
+}
+
+// waitChildSafeExit 等待子进程安全退出，最长等待drainTimeout，ctx结束时提前返回；
+// 等待期间子进程上报的连接数变化和进度说明以EventDrainProgress事件发布
+func (object *Daemon) waitChildSafeExit(ctx context.Context) (err error) {
 	if nil != object.xCmdObj {
-		if err = object.xCmdObj.ParentWrite([]byte(ExitRequest)); nil != err {
+		ctx, cancel := timeoutContext(ctx, object.drainTimeout)
+		defer cancel()
+		defer func() {
+			if errors.Is(err, context.DeadlineExceeded) {
+				err = newLifecycleError(PhaseDrain, object.xCmdObj.Pid(), ErrDrainTimeout, err)
+			}
+		}()
+
+		// 通信丢失时只能以信号请求退出
+		if object.xCmdObj.IPCLost() {
+			return object.signalSafeExit(ctx, object.xCmdObj)
+		}
+		defer object.xCmdObj.readEvents()()
+		if err = object.xCmdObj.ParentWriteContext(ctx, []byte(ExitRequest)); nil != err {
 			return
 		}
-		err = object.xCmdObj.ParentRead(func(raw []byte) bool {
-			if nil == raw || 0 >= len(raw) {
+		var lastCount uint64
+		for {
+			var message streamMessage
+			var ok bool
+			select {
+			case <-ctx.Done():
+				err = ctx.Err()
+				return
+			case message, ok = <-object.xCmdObj.events:
+			}
+			if !ok {
+				if object.xCmdObj.IPCLost() {
+					return object.signalSafeExit(ctx, object.xCmdObj)
+				}
 				glog.Info("child request nil")
-				return false
+				return
 			}
-			request := string(raw)
-			switch request {
-			case ExitReply:
+			if StreamDrain == message.stream {
+				// 被跟踪的连接全部关闭即视为排空
+				count, e := NewBuffer(0).WriteBytes(message.data).TryReadUint64()
+				if nil != e {
+					continue
+				}
+				glog.Infof("child: %d draining, %d connections", object.xCmdObj.Pid(), count)
+				if 0 >= count {
+					return
+				}
+				if lastCount != count {
+					lastCount = count
+					object.drainProgress(fmt.Sprintf("draining %d connections", count))
+				}
+				continue
+			}
+			if StreamProgress == message.stream {
+				glog.Infof("child: %d draining, %s", object.xCmdObj.Pid(), message.data)
+				object.drainProgress(string(message.data))
+				continue
+			}
+			if StreamControl == message.stream && ExitReply == string(message.data) {
 				glog.Info("child request exit")
-				return false
+				return
 			}
-			return true
-		})
+		}
 	}
 	return
 }
 
 // runAsChild 运行于子程序
-func (object *Daemon) runAsChild(bootstrapArgs *string,
-	logical func(tcpFds map[string]int,
-		ready chan bool, /*准备好通道*/
-		exit /*退出*/ chan interface{}), // 业务逻辑
-) {
+func (object *Daemon) runAsChild(bootstrapArgs *string, logical RegistryLogical) (err error) {
 	// 检查运行参数
 	if nil == bootstrapArgs || 0 >= len(*bootstrapArgs) {
-		glog.Error("bootstrap argument is empty")
+		err = errors.New("bootstrap argument is empty")
 		return
 	}
 
 	// 获取通信对象
-	object.xCmdObj = XCmdFromFd(3, 4)
+	if object.xCmdObj, err = childXCmd(); nil != err {
+		return
+	}
+	object.xCmdObj.SetMaxMessageSize(object.maxMessageSize).
+		SetChecksum(object.checksum).
+		SetCompression(object.codecID, object.compressAbove)
 	defer object.xCmdObj.Close()
 
-	// 解析fd
-	tcpFds := make(map[string]int)
-	panicOnError(json.Unmarshal([]byte(*bootstrapArgs), &tcpFds))
+	// 解析侦听与子进程身份，开启加密时先读取通信密钥
+	var meta bootstrapMeta
+	if meta, err = parseBootstrapMeta(*bootstrapArgs); nil != err {
+		object.xCmdObj.ChildWrite([]byte(ReadyError))
+		return
+	}
+	meta.resolveFds()
+	if 0 < meta.Key {
+		var key []byte
+		if key, err = readPipeKey(meta.Key); nil == err {
+			err = object.xCmdObj.SetEncryption(key, false)
+			wipe(key)
+		}
+		if nil != err {
+			return
+		}
+	}
+	if object.verifyPeer {
+		if err = object.xCmdObj.SendCredentials(); nil != err {
+			return
+		}
+	}
+	object.xCmdObj.SetGeneration(meta.Worker.Generation)
+	if nil != meta.Umask {
+		setUmask(*meta.Umask)
+	}
+	if 0 < len(meta.CPUs) {
+		if err = pinCPUs(meta.CPUs); nil != err {
+			glog.Warningf("pin cpus %v: %v", meta.CPUs, err)
+			err = nil
+		}
+	}
+	if meta.PrivateTmp {
+		if err = mountPrivateTmp(); nil != err {
+			object.xCmdObj.ChildWrite([]byte(ReadyError))
+			return
+		}
+	}
+	var infos []ListenerInfo
+	var sockets map[string]io.Closer
+	if infos, sockets, err = object.childListeners(meta.Listeners); nil != err {
+		object.xCmdObj.ChildWrite([]byte(ReadyError))
+		return
+	}
+	registry := newRegistry(infos)
+	registry.sockets = sockets
+	registry.worker = meta.Worker
+	registry.dryRun = meta.DryRun
+	registry.parent = object.xCmdObj
+	registry.fdSlots = meta.Fds
+	registry.deploy = meta.Deploy
+	if err = verifyListenerFds(infos); nil != err {
+		registry.FailGate(GateListenerFds, err)
+		object.xCmdObj.ChildWrite([]byte(ReadyError))
+		return
+	}
+	if 0 < meta.Handoff {
+		registry.handoff = &handoffReceiver{}
+		if err = registry.handoff.receiveConns(meta.Handoff); nil != err {
+			object.xCmdObj.ChildWrite([]byte(ReadyError))
+			return
+		}
+	}
+	if err = object.receiveTLS(infos); nil != err {
+		object.xCmdObj.ChildWrite([]byte(ReadyError))
+		return
+	}
+	registry.tls = object.tlsStore
+	if meta.Secrets {
+		if registry.secrets, err = object.receiveSecrets(); nil != err {
+			object.xCmdObj.ChildWrite([]byte(ReadyError))
+			return
+		}
+		defer registry.secrets.wipe()
+	}
+
+	// 准备好之前发送心跳
+	stopHeartbeat := object.startHeartbeat(meta.Heartbeat)
+	defer stopHeartbeat()
 
 	// 准备好
 	ready := make(chan bool, 1)
 	// 等待完成
 	exitCh := make(chan interface{}, 1)
+	// 业务逻辑返回
+	doneCh := make(chan struct{})
+	defer close(doneCh)
 	go func() {
-		// 等待准备好
+		// 等待准备好与全部准备好条件
 		ok := <-ready
 		if !ok {
 			glog.Error("logical ready not ok")
+		} else if err := registry.gates.wait(); nil != err {
+			glog.Error(err)
+			ok = false
+		}
+		stopHeartbeat()
+		if !ok {
 			object.xCmdObj.ChildWrite([]byte(ReadyError))
 			return
 		}
 
-		// 回执启动成功
-		object.xCmdObj.ChildWrite([]byte(ReadyOK))
+		// 回执启动成功，附带构建信息，之后按需持续发送心跳直到退出
+		object.xCmdObj.ChildWrite(readyMessage())
+		defer object.startHeartbeat(meta.Liveness)()
 
-		// 等待父进程发起退出命令
-		err := object.xCmdObj.ChildRead(func(raw []byte) bool {
+		// 等待父进程发起退出命令，期间应用下发的证书
+		err := object.xCmdObj.ChildReadStreams(func(stream uint32, raw []byte) bool {
+			if StreamTLS == stream && nil != object.tlsStore {
+				if err := object.tlsStore.update(raw); nil != err {
+					glog.Error(err)
+				}
+				return true
+			}
+			if StreamMessage == stream {
+				registry.publish(raw)
+				return true
+			}
+			if StreamBus == stream {
+				registry.deliverTopic(raw)
+				return true
+			}
+			if StreamControl != stream {
+				return true
+			}
 			if nil == raw || 0 >= len(raw) {
 				// 父进程退了
 				return false
@@ -265,176 +933,647 @@ func (object *Daemon) runAsChild(bootstrapArgs *string,
 			switch request {
 			case ExitRequest:
 				return false
+			case ReloadRequest:
+				go registry.reload()
+			case PrepareUpgradeRequest:
+				go registry.prepareUpgrade()
+			case ReleaseListenersRequest:
+				registry.releaseListeners()
+			case ReacquireListenersRequest:
+				go registry.reacquireListeners()
 			}
 			return true
 		})
 		if nil != err {
 			glog.Error(err)
 		}
+		// 先按声明的顺序关闭侦听，再通知业务逻辑退出
+		registry.drain(true)
 		close(exitCh)
+
+		// 排空期间上报连接数
+		object.reportDrain(doneCh)
+		<-doneCh
 	}()
 
 	// 让业务逻辑在主协程运行
 	// 调用业务逻辑
-	logical(tcpFds, ready, exitCh)
+	logical(registry, ready, exitCh)
+	registry.drain(false)
 
 	// 通知守护进程，可以安全退出
-	object.xCmdObj.ChildWrite([]byte(ExitReply))
+	err = object.xCmdObj.ChildWrite([]byte(ExitReply))
+	return
 }
 
-// runUpgrade 运行更新
-func (object *Daemon) runUpgrade() {
+// runUpgrade 运行更新，信号无法携带部署信息，附带时需配置控制socket
+func (object *Daemon) runUpgrade(deploy Deploy) (err error) {
 	glog.Info("upgrade app")
-
-	// 读取PID
-	raw, err := ioutil.ReadFile(object.pidFile)
-	if nil != err {
-		glog.Error(err)
-		return
+	action := deployAction(UpgradeRequest, &deploy)
+	if UpgradeRequest != action && 0 < len(object.controlSocket) {
+		// 经控制socket发送并等待结果
+		return SendControl(object.controlSocket, action)
 	}
 
+	// 读取PID
 	var pid int
-	if pid, err = strconv.Atoi(string(raw)); nil != err {
-		glog.Error(err)
+	if pid, err = object.readPID(); nil != err {
 		return
 	}
 
-	// 查找进程
-	var p *os.Process
-	if p, err = os.FindProcess(pid); nil != err {
-		glog.Error(err)
-		return
+	// 通知更新，配置了状态文件时等待结果
+	var before Status
+	if 0 < len(object.status.path) {
+		before, _ = ReadStatus(object.status.path)
 	}
-
-	// 通知更新
-	if nil != p {
-		if err = p.Signal(syscall.SIGUSR2); nil != err {
-			glog.Error(err)
-			return
-		}
+	if err = notifyDaemon(pid, action, object.signalFor(UpgradeRequest)); nil != err || 0 >= len(object.status.path) {
+		return
 	}
+	err = object.waitUpgradeResult(before.LastUpgrade)
+	return
 }
 
+// RegistryLogical 业务逻辑，通过注册表获取继承的侦听
+type RegistryLogical func(registry *Registry,
+	ready chan bool, /*准备好通道*/
+	exitCh chan interface{} /*退出通道*/)
+
 // Bootstrap 引导
 func (object *Daemon) Bootstrap(tcpPorts map[string]int, //TCP端口
 	logical func(tcpFds map[string]int,
 		ready chan bool, /*准备好通道*/
 		exitCh chan interface{} /*退出通道*/), // 业务逻辑
 ) (err error) {
-	rebootTimes := flag.Int("reboot_times", 3, "")
-	runInChild := flag.Bool(object.childCmd, false, "run in child")
-	runUpgrade := flag.Bool(object.upgradeCmd, false, "run upgrade")
-	bootstrapArgs := flag.String(object.bootstrapArgs, "", "bootstrap args")
-	flag.Parse()
+	return object.BootstrapListeners(TCPListenerSpecs(tcpPorts), func(registry *Registry,
+		ready chan bool,
+		exitCh chan interface{}) {
+		logical(registry.Fds(), ready, exitCh)
+	})
+}
+
+// Run 按SetListeners设置的侦听引导
+func (object *Daemon) Run(logical RegistryLogical) error {
+	return object.BootstrapListeners(object.listenerSpecs, logical)
+}
 
-	// 等待信号
+// BootstrapListeners 引导，侦听可为tcp/udp/unix等，业务逻辑通过注册表获取
+func (object *Daemon) BootstrapListeners(specs []ListenerSpec, logical RegistryLogical) (err error) {
+	var opts cliOptions
+	if opts, err = object.parseCommandLine(os.Args[1:]); nil != err {
+		if flag.ErrHelp == err {
+			err = nil
+		}
+		return
+	}
+
+	// 等待信号，子进程不转发SIGQUIT，保留默认的协程栈输出
 	signalCh := make(chan os.Signal, 1)
-	signal.Notify(signalCh)
 
 	// 运行业务逻辑
-	if nil != runInChild && *runInChild {
-		object.runAsChild(bootstrapArgs, logical)
+	if object.childCmd == opts.command {
+		signal.Notify(signalCh, object.handledSignals(false)...)
+		if err = object.runAsChild(&opts.bootstrapArgs, logical); nil != err {
+			glog.Error(err)
+		}
 		return
 	}
 
-	// 运行更新程序
-	if nil != runUpgrade && *runUpgrade {
-		object.runUpgrade()
+	// 更新前校验新程序，失败时返回ErrUpgradeCheck，退出码由调用方决定
+	if object.upgradeCmd == opts.command && opts.check {
+		var build *BuildInfo
+		if build, err = object.runUpgradeCheck(); nil != err {
+			err = fmt.Errorf("%w: %w", ErrUpgradeCheck, err)
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+		fmt.Println(upgradeCheckResult(build))
 		return
 	}
 
-	// 解析最大重启次数
-	if nil != rebootTimes {
-		object.rebootTimes = *rebootTimes
+	// 运行更新程序，管理运行中的守护进程
+	if manage, ok := map[string]func() error{
+		object.upgradeCmd: func() error {
+			return object.runUpgrade(opts.deploy)
+		},
+		CommandStatus: object.runStatus,
+		CommandStop:   object.runStop,
+		CommandReload: object.runReload,
+	}[opts.command]; ok {
+		if err = manage(); nil != err {
+			glog.Error(err)
+		}
+		return
+	}
+	if CommandHealth == opts.command {
+		// 返回错误由调用方决定退出码，供容器运行时判断
+		if err = object.runHealthcheck(); nil != err {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return
+	}
+	if CommandRestart == opts.command {
+		if err = object.runRestart(); nil != err {
+			glog.Error(err)
+			return
+		}
 	}
 
-	// 保存原始运行参数
-	object.origArgs = make([]string, len(os.Args))
-	copy(object.origArgs, os.Args)
+	// 前台运行业务逻辑
+	if opts.noDaemon {
+		signal.Notify(signalCh, object.handledSignals(false)...)
+		object.listenerSpecs = specs
+		err = object.runInline(signalCh, logical)
+		return
+	}
+	signal.Notify(signalCh, object.handledSignals(object.forwardQuit)...)
+
+	// 解析最大重启次数，未指定时保留SetRebootTimes的设置
+	if opts.rebootTimesSet {
+		atomic.StoreInt32(&object.rebootTimes, int32(opts.rebootTimes))
+	}
+
+	// 保存原始运行参数，重启后的守护进程不再执行停止
+	if object.legacyFlags {
+		object.origArgs = stripFlag(os.Args, CommandRestart)
+	} else {
+		command := opts.command
+		if CommandRestart == command {
+			command = CommandRun
+		}
+		object.origArgs = append([]string{os.Args[0], command}, object.appArgs...)
+	}
+	object.listenerSpecs = specs
+
+	// 选择服务管理器
+	if opts.systemd {
+		object.serviceManager = ServiceManagerSystemd
+	} else if opts.launchd {
+		object.serviceManager = ServiceManagerLaunchd
+	}
+
+	// 安装系统服务
+	if CommandInstall == opts.command {
+		if err = object.installService(); nil != err {
+			glog.Error(err)
+		}
+		return
+	}
+
+	// 卸载系统服务
+	if CommandUninstall == opts.command {
+		if err = object.uninstallService(); nil != err {
+			glog.Error(err)
+		}
+		return
+	}
+
+	// 以系统服务运行
+	if CommandService == opts.command {
+		err = object.runAsService(signalCh)
+		return
+	}
+
+	// 脱离终端
+	if object.daemonize || opts.daemonize {
+		var detached bool
+		if detached, err = object.detach(); nil != err {
+			glog.Error(err)
+			return
+		}
+		if !detached {
+			return
+		}
+	}
+
+	err = object.runAsParent(signalCh)
+	if errors.Is(err, ErrRestartBudgetExhausted) && ExhaustedExit == object.exhaustedPolicy {
+		// 清理已完成，等待事件回调发送后退出
+		object.webhooks.Wait()
+		glog.Flush()
+		os.Exit(object.exhaustedExitCode)
+	}
+	return
+}
+
+// notify 通知服务管理器，被监督的服务不单独通知
+func (object *Daemon) notify(state string) {
+	if !object.supervised {
+		notifyServiceManager(state)
+	}
+}
+
+// flagPassed 命令行是否显式指定了该参数
+func flagPassed(name string) (passed bool) {
+	flag.Visit(func(f *flag.Flag) {
+		if name == f.Name {
+			passed = true
+		}
+	})
+	return
+}
+
+// runAsParent 运行于守护进程
+func (object *Daemon) runAsParent(signalCh chan os.Signal) (err error) {
+	// 最后关闭，退出清理仍可写审计日志
+	if nil != object.logSink {
+		defer object.logSink.Close()
+	}
+	if nil != object.audit {
+		defer object.audit.sink.Close()
+	}
+	// 返回后不再重启意外退出的子进程
+	defer object.abortSpawn(ErrSpawnAborted)
+
+	if err = object.checkVerifyPeer(); nil != err {
+		return
+	}
 
 	// 写进程PID
-	panicOnError(ioutil.WriteFile(object.pidFile,
-		[]byte(strconv.Itoa(os.Getpid())),
-		0666))
+	if err = object.lockPIDFile(); nil != err {
+		glog.Error(err)
+		return
+	}
+	defer func() {
+		object.cleanupParent(err)
+	}()
+	object.setStatus(func(status *Status) {
+		status.Phase = StatusStarting
+		object.recordBinary(status)
+	})
+	object.beginOperation()
+	object.auditAction(AuditStart, nil, nil)
 
 	// 清空日志文件
 	os.RemoveAll(object.bootstrapLogDir)
 	os.Mkdir(object.bootstrapLogDir, 0777)
 
-	// 侦听端口
-	tcpLnFiles := make(map[string]*os.File)
-	for uniqueName, port := range tcpPorts {
-		var ln *net.TCPListener
-		ln, err = net.ListenTCP("tcp", &net.TCPAddr{
-			IP:   net.ParseIP("0.0.0.0"),
-			Port: port,
-		})
-		if nil != err {
-			glog.Error(err)
-			return
-		}
+	// 侦听端口，保存配置的原样，之后使用实际绑定的地址
+	object.listenerSet.configured = append([]ListenerSpec(nil), object.listenerSpecs...)
+	var specs []ListenerSpec
+	var lnFiles map[string]*os.File
+	if specs, lnFiles, err = object.listen(object.listenerSpecs); nil != err {
+		glog.Error(err)
+		return
+	}
+	object.listenerSpecs, object.lnFiles = specs, lnFiles
+	probeSpec, probing, err := object.probeSpec()
+	if nil != err {
+		glog.Error(err)
+		return
+	}
 
-		var lnFile *os.File
-		lnFile, err = ln.File()
-		if nil != err {
+	// 由父进程接受连接的侦听
+	if object.acceptInParent() {
+		var closeHandoff func()
+		if closeHandoff, err = object.serveHandoff(lnFiles); nil != err {
 			glog.Error(err)
 			return
 		}
+		defer closeHandoff()
+	}
 
-		tcpLnFiles[uniqueName] = lnFile
+	// 加载证书
+	if _, err = object.loadTLS(); nil != err {
+		glog.Error(err)
+		return
 	}
 
-	var ok bool
-	ok, err = object.replaceChildProcess(tcpLnFiles)
-	if !ok {
+	// 子进程崩溃时会递减重启次数，先保存初始值
+	rebootLimit := int(atomic.LoadInt32(&object.rebootTimes))
+	var stopped bool
+	if stopped, err = object.startChild(object, signalCh); nil != err {
+		glog.Error(err)
+		return
+	}
+	if stopped {
+		glog.Info("daemon exited")
 		return
 	}
 
-	if nil != err {
+	// 启动后即可能崩溃重启，读取当时的子进程
+	if firstChild := object.currentChild(); nil != firstChild {
+		defer firstChild.Close()
+	}
+
+	// 启动其他工作进程
+	if 1 < object.workerCount {
+		if e := object.scaleWorkers(object.workerCount); nil != e {
+			glog.Error(e)
+		}
+	}
+
+	// 开启控制通道
+	if !object.supervised {
+		if err = object.serveControl(); nil != err {
+			glog.Error(err)
+			return
+		}
+		defer object.closeControl()
+	}
+
+	// 开启管理侦听
+	var closeAdmin func()
+	if closeAdmin, err = object.serveAdmin(); nil != err {
 		glog.Error(err)
 		return
 	}
+	defer closeAdmin()
 
-	if nil != object.xCmdObj {
-		defer object.xCmdObj.Close()
+	// 通知服务管理器已就绪
+	object.notify(fmt.Sprintf("READY=1\nMAINPID=%d", os.Getpid()))
+	watchExitCh := make(chan interface{})
+	defer close(watchExitCh)
+	var watchdog <-chan time.Time
+	if !object.supervised {
+		var stopWatchdog func()
+		watchdog, stopWatchdog = newWatchdog()
+		defer stopWatchdog()
+	}
+	object.watchTLS(watchExitCh)
+	object.watchAutoscale(watchExitCh)
+	object.watchProcessStats(watchExitCh)
+	if probing {
+		object.watchHealth(probeSpec, watchExitCh)
 	}
 
-	// 等待信号
+	// 主循环退出后等待中的指令不再阻塞
+	loopDone := make(chan struct{})
+	defer close(loopDone)
+	object.loopDone = loopDone
+	atomic.StoreInt32(&object.running, 1)
+	defer atomic.StoreInt32(&object.running, 0)
+	object.setPhase(StatusRunning)
+
+	// 等待信号或控制指令，更新在协程中进行，期间仍响应信号与指令
+	upgradeDoneCh := make(chan error, 1)
+	var upgradeCmd *command
+	// 重启次数用尽后空闲，更新成功时恢复重启次数
+	idle, exhausted := false, false
+	// 上次更新结束的时间，冷却期内忽略信号触发的更新
+	var upgradeDone time.Time
 parentSignalLoop:
-	for s := range signalCh {
-		switch s {
-		case syscall.SIGINT, syscall.SIGTERM:
+	for {
+		cmd := &command{}
+		select {
+		case <-watchdog:
+			notifyServiceManager("WATCHDOG=1")
+			continue
+		case worker := <-object.crashCh:
+			// 启动期间收到退出信号时走停服流程
+			if !object.restartCrashed(worker, signalCh) {
+				continue
+			}
+			cmd.action = ExitRequest
+			cmd.source = "signal during restart"
+		case index := <-object.exhaustedCh:
+			glog.Errorf("worker %d restart budget exhausted", index)
+			if ExhaustedIdle == object.exhaustedPolicy {
+				idle = true
+				object.setStatus(func(status *Status) {
+					status.Phase = StatusFailed
+					status.LastError = ErrRestartBudgetExhausted.Error()
+				})
+				object.notify("STATUS=restart budget exhausted")
+				continue
+			}
+			// 走停服流程清理
+			exhausted = true
+			cmd.action = ExitRequest
+			cmd.source = "restart budget exhausted"
+		case s := <-signalCh:
+			cmd.action = object.signalAction(s)
+			if 0 >= len(cmd.action) && forwardedSignal(s) {
+				// 被监督时其他服务开启转发也会收到，不阻塞主循环，更新期间持有锁
+				if object.forwardQuit {
+					go object.forwardSignal(s)
+				}
+				continue
+			}
+			cmd.source = "signal " + s.String()
+			cmd.signal = true
+			object.auditAction(AuditSignal, nil, map[string]string{"signal": s.String(), "action": cmd.action})
+		case cmd = <-object.controlCh:
+		case err = <-upgradeDoneCh:
+			atomic.StoreInt32(&object.upgrading, 0)
+			upgradeDone = time.Now()
+			action := upgradeCmd.action
+			if isUpgradeAction(action) {
+				object.finishDeploy(nil == err)
+				object.commitListeners(nil == err)
+			}
+			// 先记录结果，调用方返回时状态已是最新
+			object.finishUpgrade(action, err)
+			if nil == err && idle {
+				object.resetRebootTimes(rebootLimit)
+				idle = false
+			}
+			upgradeCmd.reply(err)
+			upgradeCmd = nil
+			// 更新失败时新子进程已回收，旧子进程继续服务，错误只回复给调用方
+			if nil != err {
+				glog.Error(err)
+				err = nil
+			}
+			object.notify("READY=1")
+			continue
+		}
+
+		// 附带部署信息的更新指令
+		action, deploy, e := parseDeployAction(cmd.action)
+		if nil != e {
+			cmd.reply(e)
+			continue
+		}
+		cmd.action, cmd.deploy = action, deploy
+
+		// 侦听集合有变化的重载转为强制更新，新子进程取得新的侦听
+		if ReloadRequest == cmd.action && nil != object.listenerSet.source {
+			if object.IsUpgrading() {
+				cmd.reply(newLifecycleError(PhaseUpgrade, 0, ErrUpgradeInProgress, nil))
+				continue
+			}
+			changed, e := object.changeListeners()
+			if nil != e {
+				glog.Error(e)
+				cmd.reply(e)
+				continue
+			}
+			if changed {
+				cmd.action, cmd.signal = ForceUpgradeRequest, false
+			}
+		}
+
+		switch cmd.action {
+		case ExitRequest:
 			glog.Info("notify child exit")
+			object.beginOperation()
+			object.auditAction(AuditStop, object.currentChild(), map[string]string{"source": cmd.source})
+			object.notify("STOPPING=1")
+			object.setPhase(StatusStopping)
+			stopCtx, cancel := object.terminationContext()
 
-			// 设置主动停服标志
-			atomic.StoreInt32(&object.killedFlag, 1)
-			// 发送停止指令
-			if err = object.waitChildSafeExit(); nil != err {
-				glog.Error(err)
+			// 中止进行中的启动，等待更新结束
+			if object.IsUpgrading() {
+				object.abortSpawn(ErrSpawnAborted)
+				e := <-upgradeDoneCh
+				atomic.StoreInt32(&object.upgrading, 0)
+				object.commitListeners(nil == e)
+				upgradeCmd.reply(e)
+				upgradeCmd = nil
 			}
-			// 发送信号，停止子进程
-			if err = object.xCmdObj.Process.Kill(); nil != err {
-				glog.Error(err)
+
+			// /healthz已返回503，等待摘除流量
+			if !exhausted {
+				object.preStop(stopCtx, signalCh)
 			}
+
+			// 先停止其他工作进程
+			object.stopWorkers(stopCtx)
+
+			// 设置主动停服标志，中止进行中的意外退出重启
+			atomic.StoreInt32(&object.killedFlag, 1)
+			object.abortSpawn(ErrSpawnAborted)
+			// 发送停止指令，超时后强杀子进程
+			object.stopChild(stopCtx, "stop")
 			object.wg.Wait()
+			cancel()
+			cmd.reply(nil)
+			if exhausted {
+				err = newLifecycleError(PhaseRestart, 0, ErrRestartBudgetExhausted, nil)
+			}
 
 			break parentSignalLoop
 
-		case syscall.SIGUSR2:
+		case ReloadRequest:
+			glog.Info("reload")
+			// 下发时持有读锁，不阻塞主循环
+			go func(cmd *command) {
+				cmd.reply(object.reload())
+			}(cmd)
+
+		case RotateLogsRequest:
+			glog.Info("rotate logs")
+			cmd.reply(object.rotateLogs())
+
+		case UpgradeRequest, ForceUpgradeRequest:
 			glog.Infof("notify upgrade app")
 
-			// 设置更新标志
-			if !atomic.CompareAndSwapInt32(&object.upgradeFlag, 0, 1) {
-				return
+			// 连发的信号合并为一次更新，冷却期内的重复信号忽略
+			if cmd.signal && 0 < object.upgradeCooldown && time.Since(upgradeDone) < object.upgradeCooldown {
+				object.skipUpgrade(cmd, "cooldown")
+				continue
+			}
+
+			// 设置更新标志，拒绝并发的更新请求
+			if !atomic.CompareAndSwapInt32(&object.upgrading, 0, 1) {
+				object.skipUpgrade(cmd, "already upgrading")
+				cmd.reply(newLifecycleError(PhaseUpgrade, 0, ErrUpgradeInProgress, nil))
+				continue
 			}
 			// 替换子进程
-			ok, err = object.replaceChildProcess(tcpLnFiles)
-			if nil != err {
-				glog.Error(err)
+			object.notify("RELOADING=1")
+			object.setPhase(StatusUpgrading)
+			upgradeCmd = cmd
+			object.beginDeploy(cmd.deploy)
+			object.beginOperation()
+			object.auditAction(AuditUpgrade, object.currentChild(), map[string]string{
+				"source": cmd.source,
+				"force":  strconv.FormatBool(ForceUpgradeRequest == cmd.action),
+			})
+			go func(source string, force bool) {
+				start := time.Now()
+				ctx, span := object.startSpan(context.Background(), SpanUpgrade)
+				span.SetAttribute(AttrTrigger, source)
+				ctx, cancel := object.upgradeContext(ctx)
+				defer cancel()
+				ctx = object.withConfirm(ctx)
+				if nil != object.tracer {
+					if path, e := object.childBinary(); nil == e {
+						if sum, e := fileChecksum(path); nil == e {
+							span.SetAttribute(AttrBinaryHash, sum)
+						}
+					}
+				}
+				// 更新前的检查未通过时拒绝本次更新
+				refuse := func(e error) {
+					object.auditAction(AuditUpgradeRefused, object.currentChild(), map[string]string{
+						"source": source,
+						"reason": e.Error(),
+					})
+					object.recordUpgrade(source, start, e)
+					span.End(e)
+					upgradeDoneCh <- e
+				}
+				// 可执行文件未变化时拒绝
+				if !force {
+					if e := object.checkNewBinary(); nil != e {
+						refuse(e)
+						return
+					}
+				}
+				// 蓝绿更新先在暂存侦听上检查新程序
+				if e := object.stageUpgrade(ctx); nil != e {
+					refuse(e)
+					return
+				}
+				// 旧子进程可推迟或否决切换
+				if e := object.prepareUpgrade(ctx); nil != e {
+					refuse(e)
+					return
+				}
+				// 新子进程使用最新的证书
+				if _, e := object.loadTLS(); nil != e {
+					glog.Error(e)
+				}
+				_, e := object.replaceChildProcessContext(ctx, object.lnFiles)
+				if nil == e {
+					e = object.upgradeWorkers(ctx)
+				}
+				span.End(e)
+				object.recordUpgrade(source, start, e)
+				if nil != e {
+					object.auditAction(AuditRollback, object.currentChild(), map[string]string{"reason": e.Error()})
+					object.emit(Event{
+						Type:   EventUpgradeFailed,
+						Reason: source,
+						Error:  e.Error(),
+						Phase:  failedPhase(e),
+					})
+				} else {
+					object.auditAction(AuditUpgradeDone, object.currentChild(), map[string]string{
+						"duration": time.Since(start).String(),
+					})
+				}
+				upgradeDoneCh <- e
+			}(cmd.source, ForceUpgradeRequest == cmd.action)
+
+		default:
+			n, ok := parseWorkersAction(cmd.action)
+			if !ok {
+				n, ok = parseWorkersDelta(cmd.action, object.Workers())
+			}
+			if !ok {
+				if 0 < len(cmd.action) {
+					cmd.reply(fmt.Errorf("daemon: unknown command %q", cmd.action))
+				}
+				continue
 			}
-			if !ok || nil != err {
-				break parentSignalLoop
+			// 与更新互斥，被拒绝的调整不记审计
+			if !atomic.CompareAndSwapInt32(&object.upgrading, 0, 1) {
+				cmd.reply(newLifecycleError(PhaseUpgrade, 0, ErrUpgradeInProgress, nil))
+				continue
 			}
+			glog.Infof("scale workers to %d", n)
+			object.beginOperation()
+			object.auditAction(AuditScale, nil, map[string]string{
+				"source":  cmd.source,
+				"workers": strconv.Itoa(n),
+			})
+			object.notify("RELOADING=1")
+			upgradeCmd = cmd
+			go func() {
+				upgradeDoneCh <- object.scaleWorkers(n)
+			}()
 		}
 	}
 
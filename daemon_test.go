@@ -1,11 +1,524 @@
+//go:build !windows
 // +build !windows
 
 package daemon
 
 import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 )
 
+// fakeChild 模拟子进程：回执准备好，收到退出指令后回执退出
+func fakeChild(xCmdObj *XCmd, args []string) error {
+	if err := xCmdObj.ChildWrite([]byte(ReadyOK)); nil != err {
+		return err
+	}
+	if err := xCmdObj.ChildRead(func(raw []byte) bool {
+		return nil != raw && ExitRequest != string(raw)
+	}); nil != err {
+		return err
+	}
+	return xCmdObj.ChildWrite([]byte(ExitReply))
+}
+
+// newFakeDaemon 使用模拟进程运行器的守护进程
+func newFakeDaemon(child func(xCmdObj *XCmd, args []string) error) (*Daemon, *FakeRunner) {
+	runner := NewFakeRunner(child)
+	object := Default().SetProcessRunner(runner)
+	object.origArgs = []string{"app"}
+	return object, runner
+}
+
+// stopFakeDaemon 走安全退出流程
+func stopFakeDaemon(t *testing.T, object *Daemon) {
+	atomic.StoreInt32(&object.killedFlag, 1)
+	if err := object.waitChildSafeExit(context.Background()); nil != err {
+		t.Error(err)
+	}
+	object.xCmdObj.Kill()
+	object.wg.Wait()
+}
+
+// fakeParentOptions 模拟父进程的配置
+type fakeParentOptions struct {
+	child  func(xCmdObj *XCmd, args []string) error
+	runner *FakeRunner
+	setup  []func(object *Daemon)
+	ready  func(object *Daemon) bool
+}
+
+// fakeParentOption 调整模拟父进程的配置
+type fakeParentOption func(opts *fakeParentOptions)
+
+// withChild 模拟子进程的行为，默认为fakeChild
+func withChild(child func(xCmdObj *XCmd, args []string) error) fakeParentOption {
+	return func(opts *fakeParentOptions) {
+		opts.child = child
+	}
+}
+
+// withRunner 使用调用方持有的运行器，便于统计派生次数
+func withRunner(runner *FakeRunner) fakeParentOption {
+	return func(opts *fakeParentOptions) {
+		opts.runner = runner
+	}
+}
+
+// withSetup 运行前配置守护进程，按传入的顺序执行
+func withSetup(setup func(object *Daemon)) fakeParentOption {
+	return func(opts *fakeParentOptions) {
+		opts.setup = append(opts.setup, setup)
+	}
+}
+
+// withReady 父进程运行起来的条件，默认为进入主循环
+func withReady(ready func(object *Daemon) bool) fakeParentOption {
+	return func(opts *fakeParentOptions) {
+		opts.ready = ready
+	}
+}
+
+// startFakeParent 在临时目录中以模拟子进程运行父进程，等待其运行起来，
+// 返回守护进程、信号通道与主循环的返回值通道
+func startFakeParent(t *testing.T, opts ...fakeParentOption) (*Daemon, chan os.Signal, chan error) {
+	options := fakeParentOptions{
+		child: fakeChild,
+		ready: func(object *Daemon) bool {
+			return 1 == atomic.LoadInt32(&object.running)
+		},
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	object, _ := newFakeDaemon(options.child)
+	if nil != options.runner {
+		object.SetProcessRunner(options.runner)
+	}
+	dir := t.TempDir()
+	object.pidFile = filepath.Join(dir, "daemonPID")
+	object.bootstrapLogDir = filepath.Join(dir, "bootstrapLogs")
+	for _, setup := range options.setup {
+		setup(object)
+	}
+
+	signalCh := make(chan os.Signal, 2)
+	doneCh := make(chan error, 1)
+	go func() {
+		doneCh <- object.runAsParent(signalCh)
+	}()
+	waitFor(t, func() bool { return options.ready(object) })
+	return object, signalCh, doneCh
+}
+
+// waitFor 等待条件成立
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
 func TestDaemon(t *testing.T) {
 
 }
+
+func TestDaemonUpgrade(t *testing.T) {
+	object, runner := newFakeDaemon(fakeChild)
+	ok, err := object.replaceChildProcess(nil)
+	if !ok || nil != err {
+		t.Fatal(ok, err)
+	}
+	oldPid := object.xCmdObj.Pid()
+
+	if ok, err = object.replaceChildProcess(nil); !ok || nil != err {
+		t.Fatal(ok, err)
+	}
+	if oldPid == object.xCmdObj.Pid() {
+		t.Fatal("child not replaced")
+	}
+	if 2 != runner.Spawned() {
+		t.Fatal("spawned", runner.Spawned())
+	}
+	stopFakeDaemon(t, object)
+}
+
+func TestDaemonExternalCommand(t *testing.T) {
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		if "/usr/bin/worker" != args[0] || "-v" != args[1] ||
+			!strings.HasPrefix(args[2], "--bootstrap_args=") || 3 != len(args) {
+			return xCmdObj.ChildWrite([]byte(ReadyError))
+		}
+		return fakeChild(xCmdObj, args)
+	})
+	object.SetCommand("/usr/bin/worker", []string{"-v"}, []string{"MODE=worker"})
+	if ok, err := object.replaceChildProcess(nil); !ok || nil != err {
+		t.Fatal(ok, err)
+	}
+	if env := object.xCmdObj.Env; "MODE=worker" != env[0] {
+		t.Fatal(env)
+	}
+	stopFakeDaemon(t, object)
+}
+
+func TestDaemonChildNotReady(t *testing.T) {
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		return xCmdObj.ChildWrite([]byte(ReadyError))
+	})
+	ok, err := object.replaceChildProcess(nil)
+	if ok || !errors.Is(err, ErrChildNotReady) {
+		t.Fatal(ok, err)
+	}
+	if nil != object.xCmdObj {
+		t.Fatal("child should not be kept")
+	}
+}
+
+func TestDaemonCrashRestart(t *testing.T) {
+	spawned := int32(0)
+	runner := NewFakeRunner(func(xCmdObj *XCmd, args []string) error {
+		switch atomic.AddInt32(&spawned, 1) {
+		case 1, 2:
+			xCmdObj.ChildWrite([]byte(ReadyOK))
+			return errors.New("crash")
+		case 3:
+			// 重启失败同样消耗重启次数
+			return xCmdObj.ChildWrite([]byte(ReadyError))
+		}
+		return fakeChild(xCmdObj, args)
+	})
+	object, signalCh, doneCh := startFakeParent(t, withRunner(runner), withSetup(func(object *Daemon) {
+		object.SetRebootTimes(4)
+	}), withReady(func(object *Daemon) bool {
+		return 4 == runner.Spawned() && StatusRunning == object.Status().Phase && nil != object.currentChild()
+	}))
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+	if 1 != atomic.LoadInt32(&object.rebootTimes) {
+		t.Fatal("reboot times", atomic.LoadInt32(&object.rebootTimes))
+	}
+}
+
+func TestDaemonWaitChildAfterUpgrade(t *testing.T) {
+	var lock sync.Mutex
+	var events []Event
+	object, signalCh, doneCh := startFakeParent(t, withSetup(func(object *Daemon) {
+		object.OnEvent(func(event Event) {
+			lock.Lock()
+			events = append(events, event)
+			lock.Unlock()
+		})
+	}))
+
+	// 更新与崩溃重启期间并发读取状态
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go func() {
+		for {
+			select {
+			case <-stopCh:
+				return
+			default:
+				object.Status()
+				object.ChildBuild()
+			}
+		}
+	}()
+
+	oldPid := object.Status().ChildPid
+	if err := object.Upgrade(); nil != err {
+		t.Fatal(err)
+	}
+	newChild := object.currentChild()
+	newPid := newChild.Pid()
+	if oldPid == newPid {
+		t.Fatal(newPid)
+	}
+	newChild.Kill()
+	waitFor(t, func() bool {
+		status := object.Status()
+		return StatusRunning == status.Phase && newPid < status.ChildPid
+	})
+
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+
+	// 旧子进程按更新退出，崩溃只归于新子进程
+	lock.Lock()
+	defer lock.Unlock()
+	reasons := make(map[int]string)
+	for _, event := range events {
+		if EventChildExited == event.Type {
+			reasons[event.Pid] = event.Reason
+		}
+		if EventChildCrashed == event.Type && newPid != event.Pid {
+			t.Fatal(event)
+		}
+	}
+	if ExitUpgrade != reasons[oldPid] || ExitCrash != reasons[newPid] {
+		t.Fatal(reasons)
+	}
+}
+
+func TestLifecycleError(t *testing.T) {
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		return xCmdObj.ChildWrite([]byte(ReadyError))
+	})
+	_, err := object.replaceChildProcess(nil)
+	var lifecycleErr *LifecycleError
+	if !errors.As(err, &lifecycleErr) || PhaseReady != lifecycleErr.Phase || 0 == lifecycleErr.Pid {
+		t.Fatal(err)
+	}
+	if err = object.Upgrade(); !errors.Is(err, ErrNotRunning) {
+		t.Fatal(err)
+	}
+}
+
+func TestDaemonConcurrentUpgrade(t *testing.T) {
+	readyCh := make(chan struct{})
+	spawned := int32(0)
+	object, _, doneCh := startFakeParent(t, withChild(func(xCmdObj *XCmd, args []string) error {
+		if 2 == atomic.AddInt32(&spawned, 1) {
+			// 第一次更新的子进程延迟就绪
+			<-readyCh
+		}
+		return fakeChild(xCmdObj, args)
+	}))
+
+	upgradeCh := make(chan error, 1)
+	go func() {
+		upgradeCh <- object.Upgrade()
+	}()
+	waitFor(t, object.IsUpgrading)
+	if err := object.Upgrade(); !errors.Is(err, ErrUpgradeInProgress) {
+		t.Fatal(err)
+	}
+	close(readyCh)
+	if err := <-upgradeCh; nil != err {
+		t.Fatal(err)
+	}
+	if object.IsUpgrading() {
+		t.Fatal("upgrade not finished")
+	}
+
+	if err := object.execCommand(ExitRequest); nil != err {
+		t.Fatal(err)
+	}
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+}
+
+func TestDaemonFailedUpgradeKeepsServing(t *testing.T) {
+	spawned := int32(0)
+	var crashed int32
+	runner := NewFakeRunner(func(xCmdObj *XCmd, args []string) error {
+		if 2 == atomic.AddInt32(&spawned, 1) {
+			// 新子进程启动失败
+			return xCmdObj.ChildWrite([]byte(ReadyError))
+		}
+		return fakeChild(xCmdObj, args)
+	})
+	object, _, doneCh := startFakeParent(t, withRunner(runner), withSetup(func(object *Daemon) {
+		object.OnEvent(func(event Event) {
+			if EventChildCrashed == event.Type {
+				atomic.AddInt32(&crashed, 1)
+			}
+		})
+	}))
+	pid := object.currentChild().Pid()
+
+	if err := object.ForceUpgrade(); !errors.Is(err, ErrChildNotReady) {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-doneCh:
+		t.Fatal("daemon exited after failed upgrade", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if 1 != atomic.LoadInt32(&object.running) || object.IsUpgrading() || pid != object.currentChild().Pid() {
+		t.Fatal(object.Status())
+	}
+
+	// 之后的更新照常进行
+	if err := object.ForceUpgrade(); nil != err {
+		t.Fatal(err)
+	}
+	if 3 != runner.Spawned() || pid == object.currentChild().Pid() {
+		t.Fatal(runner.Spawned())
+	}
+	if err := object.execCommand(ExitRequest); nil != err {
+		t.Fatal(err)
+	}
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+	if 0 != atomic.LoadInt32(&crashed) {
+		t.Fatal("child exit reported as crash")
+	}
+}
+
+func TestExecCommandLoopExit(t *testing.T) {
+	// 检查运行状态后主循环退出，指令投递不出去
+	object := Default()
+	object.controlCh <- &command{action: "pending"}
+	loopDone := make(chan struct{})
+	object.loopDone = loopDone
+	atomic.StoreInt32(&object.running, 1)
+	close(loopDone)
+	if err := object.Upgrade(); !errors.Is(err, ErrNotRunning) {
+		t.Fatal(err)
+	}
+
+	// 主循环取走指令后未回复即退出
+	object = Default()
+	loopDone = make(chan struct{})
+	object.loopDone = loopDone
+	atomic.StoreInt32(&object.running, 1)
+	go func() {
+		<-object.controlCh
+		close(loopDone)
+	}()
+	if err := object.Reload(); !errors.Is(err, ErrNotRunning) {
+		t.Fatal(err)
+	}
+}
+
+func TestDaemonReadyTimeout(t *testing.T) {
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		// 一直不回执
+		return xCmdObj.ChildRead(func(raw []byte) bool {
+			return nil != raw
+		})
+	})
+	object.SetReadyTimeout(50 * time.Millisecond)
+	ok, err := object.replaceChildProcess(nil)
+	if ok || !errors.Is(err, ErrReadyTimeout) {
+		t.Fatal(ok, err)
+	}
+}
+
+func TestDaemonDrainTimeout(t *testing.T) {
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		xCmdObj.ChildWrite([]byte(ReadyOK))
+		// 收到退出指令后不回执
+		return xCmdObj.ChildRead(func(raw []byte) bool {
+			return nil != raw
+		})
+	})
+	object.SetDrainTimeout(50 * time.Millisecond)
+	if ok, err := object.replaceChildProcess(nil); !ok || nil != err {
+		t.Fatal(ok, err)
+	}
+	atomic.StoreInt32(&object.killedFlag, 1)
+	if err := object.waitChildSafeExit(context.Background()); !errors.Is(err, ErrDrainTimeout) {
+		t.Fatal(err)
+	}
+	object.xCmdObj.Kill()
+	object.wg.Wait()
+}
+
+func TestDaemonConnectionDrain(t *testing.T) {
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		xCmdObj.ChildWrite([]byte(ReadyOK))
+		xCmdObj.ChildRead(func(raw []byte) bool {
+			return nil != raw && ExitRequest != string(raw)
+		})
+		// 上报连接逐步关闭，不回执退出
+		for _, count := range []uint64{2, 1, 0} {
+			raw := NewBuffer(8).WriteUint64(count)
+			xCmdObj.ChildWriteStream(StreamDrain, raw.Slice(raw.ReadableBytes()))
+		}
+		return xCmdObj.ChildRead(func(raw []byte) bool {
+			return nil != raw
+		})
+	})
+	object.SetDrainTimeout(5 * time.Second)
+	if ok, err := object.replaceChildProcess(nil); !ok || nil != err {
+		t.Fatal(ok, err)
+	}
+	atomic.StoreInt32(&object.killedFlag, 1)
+	start := time.Now()
+	if err := object.waitChildSafeExit(context.Background()); nil != err || time.Second < time.Since(start) {
+		t.Fatal(err, time.Since(start))
+	}
+	object.xCmdObj.Kill()
+	object.wg.Wait()
+}
+
+func TestDaemonDrainProgress(t *testing.T) {
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		xCmdObj.ChildWrite([]byte(ReadyOK))
+		xCmdObj.ChildRead(func(raw []byte) bool {
+			return nil != raw && ExitRequest != string(raw)
+		})
+		for _, count := range []uint64{2, 2, 1} {
+			raw := NewBuffer(8).WriteUint64(count)
+			xCmdObj.ChildWriteStream(StreamDrain, raw.Slice(raw.ReadableBytes()))
+		}
+		xCmdObj.ChildWriteStream(StreamProgress, []byte("flushing 3 queues"))
+		return xCmdObj.ChildRead(func(raw []byte) bool {
+			return nil != raw
+		})
+	})
+	var reasons []string
+	object.OnEvent(func(event Event) {
+		if EventDrainProgress == event.Type {
+			reasons = append(reasons, event.Reason)
+		}
+	})
+	object.SetDrainTimeout(5 * time.Second)
+	if ok, err := object.replaceChildProcess(nil); !ok || nil != err {
+		t.Fatal(ok, err)
+	}
+	atomic.StoreInt32(&object.killedFlag, 1)
+
+	// 调用方的期限先于drainTimeout到达
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := object.waitChildSafeExit(ctx); !errors.Is(err, ErrDrainTimeout) || time.Second < time.Since(start) {
+		t.Fatal(err, time.Since(start))
+	}
+	if "draining 2 connections,draining 1 connections,flushing 3 queues" != strings.Join(reasons, ",") {
+		t.Fatal(reasons)
+	}
+	object.xCmdObj.Kill()
+	object.wg.Wait()
+}
+
+func TestTrackListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	tracked := TrackListener(ln)
+	defer tracked.Close()
+	base := ActiveConnections()
+	client, _ := net.Dial("tcp", ln.Addr().String())
+	defer client.Close()
+	conn, err := tracked.Accept()
+	if nil != err || base+1 != ActiveConnections() {
+		t.Fatal(err, ActiveConnections())
+	}
+	conn.Close()
+	conn.Close()
+	if base != ActiveConnections() {
+		t.Fatal(ActiveConnections())
+	}
+}
@@ -0,0 +1,278 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/golang/glog"
+)
+
+// fileSocket 可导出文件的socket
+type fileSocket interface {
+	File() (*os.File, error)
+	Close() error
+}
+
+// listen 父进程按描述侦听，文件交由子进程继承，返回地址改为实际绑定地址的描述副本，不改写传入的描述；
+// 父进程只持有导出的文件，socket随即关闭，不在自身的队列中接受连接。
+// 端口被占用时按SetBindRetry重试，失败时继续尝试其余侦听，返回列出全部失败的BindError，
+// 并关闭已绑定的侦听、删除已创建的unix socket文件
+func (object *Daemon) listen(specs []ListenerSpec) (bound []ListenerSpec, lnFiles map[string]*os.File, err error) {
+	return object.listenRetry(specs, object.bindRetry)
+}
+
+// listenRetry 按指定的重试策略侦听，重载时不重试以免阻塞主循环
+func (object *Daemon) listenRetry(specs []ListenerSpec, retry BindRetry) (bound []ListenerSpec, lnFiles map[string]*os.File, err error) {
+	bound = append([]ListenerSpec(nil), specs...)
+	lnFiles = make(map[string]*os.File)
+	bindErr := &BindError{}
+	for i := range bound {
+		spec := &bound[i]
+		network, address, e := applyFamily(*spec)
+		if nil != e {
+			bindErr.add(*spec, e)
+			continue
+		}
+		spec.Network, spec.Address = network, address
+		var lnFile *os.File
+		if e = retry.bind(*spec, func() (e error) {
+			lnFile, address, e = bindListener(*spec, object.listenerControl(spec.Name))
+			return
+		}); nil != e {
+			bindErr.add(*spec, e)
+			continue
+		}
+		spec.Address = address
+		lnFiles[spec.Name] = lnFile
+	}
+	if err = bindErr.err(); nil == err {
+		return
+	}
+	for _, spec := range bound {
+		f, ok := lnFiles[spec.Name]
+		if !ok {
+			continue
+		}
+		f.Close()
+		removeSocketFile(spec.Network, spec.Address)
+	}
+	bound, lnFiles = nil, nil
+	return
+}
+
+// bindListener 绑定一个侦听，返回导出的文件与实际地址，control非nil时在绑定前调用
+func bindListener(spec ListenerSpec, control ListenerControl) (lnFile *os.File, address string, err error) {
+	var socket fileSocket
+	var addr net.Addr
+	lc := net.ListenConfig{Control: control}
+	if spec.IsPacket() {
+		var conn net.PacketConn
+		if conn, err = lc.ListenPacket(context.Background(), spec.Network, spec.Address); nil != err {
+			return
+		}
+		socket, addr = conn.(fileSocket), conn.LocalAddr()
+	} else {
+		var ln net.Listener
+		if ln, err = lc.Listen(context.Background(), spec.Network, spec.Address); nil != err {
+			return
+		}
+		socket, addr = ln.(fileSocket), ln.Addr()
+		if err = applyListenerOptions(ln, spec.Options); nil != err {
+			ln.Close()
+			return
+		}
+	}
+	lnFile, err = socket.File()
+	releaseSocket(socket)
+	if nil != err {
+		removeSocketFile(spec.Network, spec.Address)
+	}
+	address = addr.String()
+	return
+}
+
+// addrInUse 地址已被占用
+func addrInUse(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE)
+}
+
+// releaseSocket 关闭导出文件后的socket，unix socket的路径留给子进程使用，退出时再删除
+func releaseSocket(socket fileSocket) {
+	if ln, ok := socket.(*net.UnixListener); ok {
+		ln.SetUnlinkOnClose(false)
+	}
+	socket.Close()
+}
+
+// passListeners 传递侦听文件，返回子进程中的侦听描述
+func (object *Daemon) passListeners(xCmdObj *XCmd, lnFiles map[string]*os.File) []ListenerInfo {
+	infos := make([]ListenerInfo, 0, len(object.listenerSpecs))
+	for _, spec := range object.listenerSpecs {
+		if spec.Options.AcceptInParent && !spec.IsPacket() {
+			// 连接由父进程接受后分发
+			infos = append(infos, ListenerInfo{ListenerSpec: spec, Fd: -1})
+			continue
+		}
+		if f, ok := lnFiles[spec.Name]; ok {
+			infos = append(infos, ListenerInfo{
+				ListenerSpec: spec,
+				Fd:           xCmdObj.AddNamedFile(listenerSlot(spec.Name), f),
+				Family:       socketFamily(int(f.Fd())),
+			})
+		}
+	}
+	return infos
+}
+
+// serveControl 开启控制socket，未设置时只由信号驱动
+func (object *Daemon) serveControl() (err error) {
+	if 0 >= len(object.controlSocket) {
+		return
+	}
+	removeSocketFile("unix", object.controlSocket)
+	if object.controlLn, err = net.Listen("unix", object.controlSocket); nil != err {
+		return
+	}
+	// 守护进程化后umask可能为0，socket文件只允许本用户连接
+	if !isAbstractSocket(object.controlSocket) {
+		if err = os.Chmod(object.controlSocket, 0600); nil != err {
+			object.closeControl()
+			return
+		}
+	}
+	go func(ln net.Listener) {
+		for {
+			conn, err := ln.Accept()
+			if nil != err {
+				return
+			}
+			go func(conn net.Conn) {
+				if err := checkControlPeer(conn); nil != err {
+					glog.Warning(err)
+					conn.Write([]byte(fmt.Sprintf("ERR %v\n", err)))
+					conn.Close()
+					return
+				}
+				object.handleControl(conn)
+			}(conn)
+		}
+	}(object.controlLn)
+	return
+}
+
+// defaultSignalActions 默认的信号->控制指令映射
+func defaultSignalActions() map[os.Signal]string {
+	return map[os.Signal]string{
+		syscall.SIGINT:  ExitRequest,
+		syscall.SIGTERM: ExitRequest,
+		syscall.SIGUSR2: UpgradeRequest,
+	}
+}
+
+// forwardedSignals 开启转发时另订阅的信号
+func forwardedSignals() []os.Signal {
+	return []os.Signal{syscall.SIGQUIT}
+}
+
+// forwardedSignal 原样转发给子进程的信号
+func forwardedSignal(s os.Signal) bool {
+	return syscall.SIGQUIT == s
+}
+
+// terminateSignal 请求子进程平滑退出的信号
+func terminateSignal() os.Signal {
+	return syscall.SIGTERM
+}
+
+// notifyDaemon 向守护进程发送映射到指令的信号
+func notifyDaemon(pid int, action string, s os.Signal) (err error) {
+	if nil == s {
+		return fmt.Errorf("%w: %s", ErrNoSignal, action)
+	}
+	var p *os.Process
+	if p, err = os.FindProcess(pid); nil != err {
+		return
+	}
+	err = p.Signal(s)
+	return
+}
+
+// childXCmd 子进程通信对象，fd 3为socket时使用socketpair传输
+func childXCmd() (*XCmd, error) {
+	if isSocket(3) {
+		return XCmdFromSocket(3)
+	}
+	return XCmdFromFd(3, 4), nil
+}
+
+// childListeners 子进程侦听fd，已由父进程传入，不自行绑定
+func (object *Daemon) childListeners(infos []ListenerInfo) ([]ListenerInfo, map[string]io.Closer, error) {
+	return infos, nil, nil
+}
+
+// FileListener 由父进程传入的fd构建Listener
+func FileListener(name string, fd int) (ln net.Listener, err error) {
+	f := os.NewFile(uintptr(fd), name)
+	defer f.Close()
+	ln, err = net.FileListener(f)
+	return
+}
+
+// fileListener 由继承的fd构建面向流的侦听
+func (object *Registry) fileListener(info ListenerInfo) (net.Listener, error) {
+	return FileListener(info.Name, info.Fd)
+}
+
+// dupCloseOnExec 复制fd，副本不被子进程继承
+func dupCloseOnExec(fd int) (dup int, err error) {
+	syscall.ForkLock.RLock()
+	defer syscall.ForkLock.RUnlock()
+	if dup, err = syscall.Dup(fd); nil != err {
+		return -1, os.NewSyscallError("dup", err)
+	}
+	syscall.CloseOnExec(dup)
+	return
+}
+
+// filePacketConn 由继承的fd构建面向报文的侦听
+func (object *Registry) filePacketConn(info ListenerInfo) (conn net.PacketConn, err error) {
+	f := os.NewFile(uintptr(info.Fd), info.Name)
+	defer f.Close()
+	conn, err = net.FilePacketConn(f)
+	return
+}
+
+// inlineListeners 前台模式在当前进程侦听，返回侦听描述，侦听由fd构建
+func (object *Daemon) inlineListeners(specs []ListenerSpec) (infos []ListenerInfo, sockets map[string]io.Closer, err error) {
+	var lnFiles map[string]*os.File
+	if specs, lnFiles, err = object.listen(specs); nil != err {
+		return
+	}
+	// 注册表构建侦听后关闭fd，交给它复制的fd，避免文件回收时重复关闭
+	for _, spec := range specs {
+		f := lnFiles[spec.Name]
+		var fd int
+		if fd, err = dupCloseOnExec(int(f.Fd())); nil != err {
+			break
+		}
+		infos = append(infos, ListenerInfo{ListenerSpec: spec, Fd: fd, Family: socketFamily(fd)})
+	}
+	for _, f := range lnFiles {
+		f.Close()
+	}
+	if nil != err {
+		for _, info := range infos {
+			syscall.Close(info.Fd)
+		}
+		infos = nil
+	}
+	return
+}
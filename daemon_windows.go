@@ -0,0 +1,266 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/golang/glog"
+	"golang.org/x/sys/windows"
+)
+
+// controlPipeName 控制管道名
+func controlPipeName(pid int) string {
+	return fmt.Sprintf(`\\.\pipe\daemon-%d`, pid)
+}
+
+// listen Windows下无法继承侦听，由子进程独占绑定，描述原样返回；独占的侦听只能由一个工作进程持有
+func (object *Daemon) listen(specs []ListenerSpec) ([]ListenerSpec, map[string]*os.File, error) {
+	if 1 < object.workerCount && 0 < len(specs) {
+		return nil, nil, fmt.Errorf("%w: %d workers", ErrExclusiveListeners, object.workerCount)
+	}
+	return append([]ListenerSpec(nil), specs...), make(map[string]*os.File), nil
+}
+
+// listenRetry 父进程不绑定，与listen相同
+func (object *Daemon) listenRetry(specs []ListenerSpec, retry BindRetry) ([]ListenerSpec, map[string]*os.File, error) {
+	return object.listen(specs)
+}
+
+// passListeners 传递侦听描述，子进程自行绑定
+func (object *Daemon) passListeners(xCmdObj *XCmd, lnFiles map[string]*os.File) []ListenerInfo {
+	infos := make([]ListenerInfo, 0, len(object.listenerSpecs))
+	for _, spec := range object.listenerSpecs {
+		infos = append(infos, ListenerInfo{ListenerSpec: spec})
+	}
+	return infos
+}
+
+// controlPipeSDDL 控制管道的安全描述，DACL只允许运行服务的账户与管理员组访问，不继承默认权限
+func controlPipeSDDL() (string, error) {
+	user, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if nil != err {
+		return "", err
+	}
+	return fmt.Sprintf("D:P(A;;GA;;;%s)(A;;GA;;;BA)", user.User.Sid.String()), nil
+}
+
+// controlPipeSecurity 创建控制管道使用的安全属性
+func controlPipeSecurity() (*windows.SecurityAttributes, error) {
+	sddl, err := controlPipeSDDL()
+	if nil != err {
+		return nil, err
+	}
+	sd, err := windows.SecurityDescriptorFromString(sddl)
+	if nil != err {
+		return nil, err
+	}
+	return &windows.SecurityAttributes{
+		Length:             uint32(unsafe.Sizeof(windows.SecurityAttributes{})),
+		SecurityDescriptor: sd,
+	}, nil
+}
+
+// serveControl 开启控制管道，替代Unix下的SIGUSR2，只有服务账户与管理员可以写入
+func (object *Daemon) serveControl() (err error) {
+	var name *uint16
+	if name, err = windows.UTF16PtrFromString(controlPipeName(os.Getpid())); nil != err {
+		return
+	}
+	var sa *windows.SecurityAttributes
+	if sa, err = controlPipeSecurity(); nil != err {
+		return
+	}
+	go func() {
+		for {
+			h, err := windows.CreateNamedPipe(name,
+				windows.PIPE_ACCESS_INBOUND,
+				windows.PIPE_TYPE_BYTE|windows.PIPE_READMODE_BYTE|windows.PIPE_WAIT,
+				windows.PIPE_UNLIMITED_INSTANCES,
+				512,
+				512,
+				0,
+				sa)
+			if nil != err {
+				glog.Error(err)
+				return
+			}
+			if err = windows.ConnectNamedPipe(h, nil); nil != err && windows.ERROR_PIPE_CONNECTED != err {
+				glog.Error(err)
+				windows.CloseHandle(h)
+				continue
+			}
+			f := os.NewFile(uintptr(h), "control")
+			raw, err := ioutil.ReadAll(io.LimitReader(f, 512))
+			windows.DisconnectNamedPipe(h)
+			f.Close()
+			if nil != err {
+				glog.Error(err)
+				continue
+			}
+			object.postCommand(strings.TrimSpace(string(raw)), "control pipe")
+		}
+	}()
+	return
+}
+
+// defaultSignalActions 默认的信号->控制指令映射
+func defaultSignalActions() map[os.Signal]string {
+	return map[os.Signal]string{
+		syscall.SIGINT:  ExitRequest,
+		syscall.SIGTERM: ExitRequest,
+	}
+}
+
+// forwardedSignals Windows下不能向子进程转发信号
+func forwardedSignals() []os.Signal {
+	return nil
+}
+
+// forwardedSignal 原样转发给子进程的信号
+func forwardedSignal(s os.Signal) bool {
+	return false
+}
+
+// terminateSignal Windows下不能向子进程发送平滑退出的信号，只能强杀
+func terminateSignal() os.Signal {
+	return os.Kill
+}
+
+// notifyDaemon 通过控制管道向守护进程发送指令，不使用信号
+func notifyDaemon(pid int, action string, s os.Signal) (err error) {
+	var f *os.File
+	if f, err = os.OpenFile(controlPipeName(pid), os.O_WRONLY, 0); nil != err {
+		return
+	}
+	defer f.Close()
+	_, err = f.Write([]byte(action))
+	return
+}
+
+// childXCmd 子进程通信对象，句柄取自环境变量
+func childXCmd() (*XCmd, error) {
+	var readFd, writeFd int
+	if _, err := fmt.Sscanf(os.Getenv(PipeHandlesEnv), "%d,%d", &readFd, &writeFd); nil != err {
+		return nil, fmt.Errorf("parse %s: %w", PipeHandlesEnv, err)
+	}
+	return XCmdFromFd(readFd, writeFd), nil
+}
+
+// childListeners 子进程以SO_EXCLUSIVEADDRUSE独占绑定端口，其他进程无法抢占；更新时旧子进程收到
+// ReleaseListeners后释放，新子进程在交接期内重试绑定。SetListenerControl设置的控制函数在其后调用。
+// 返回的描述为实际绑定的地址，侦听交由注册表持有
+func (object *Daemon) childListeners(infos []ListenerInfo) ([]ListenerInfo, map[string]io.Closer, error) {
+	// 失败时继续尝试其余侦听，汇总后关闭已绑定的
+	bound := make([]ListenerInfo, 0, len(infos))
+	sockets := make(map[string]io.Closer, len(infos))
+	bindErr := &BindError{}
+	for _, info := range infos {
+		var err error
+		if info.Network, info.Address, err = applyFamily(info.ListenerSpec); nil != err {
+			bindErr.add(info.ListenerSpec, err)
+			continue
+		}
+		info.Family = addressFamily(info.Network, info.Address)
+		var socket io.Closer
+		if socket, err = object.bindExclusive(&info); nil != err {
+			bindErr.add(info.ListenerSpec, err)
+			continue
+		}
+		sockets[info.Name] = socket
+		bound = append(bound, info)
+	}
+	if err := bindErr.err(); nil != err {
+		for _, socket := range sockets {
+			socket.Close()
+		}
+		return nil, nil, err
+	}
+	return bound, sockets, nil
+}
+
+// bindExclusive 独占绑定一个侦听，地址改为实际绑定的地址，重新绑定时沿用
+func (object *Daemon) bindExclusive(info *ListenerInfo) (io.Closer, error) {
+	spec := info.ListenerSpec
+	lc := net.ListenConfig{Control: chainControl(exclusiveAddr, object.listenerControl(spec.Name))}
+	bind := func() (socket io.Closer, err error) {
+		err = handoverRetry.bind(spec, func() (e error) {
+			if spec.IsPacket() {
+				socket, e = lc.ListenPacket(context.Background(), spec.Network, spec.Address)
+				return
+			}
+			var ln net.Listener
+			if ln, e = lc.Listen(context.Background(), spec.Network, spec.Address); nil != e {
+				return
+			}
+			if e = applyListenerOptions(ln, spec.Options); nil != e {
+				ln.Close()
+				return
+			}
+			socket = ln
+			return
+		})
+		return
+	}
+	releasable, err := newReleasableSocket(bind)
+	if nil != err {
+		return nil, err
+	}
+	if rawConn, e := releasable.socket.(syscall.Conn).SyscallConn(); nil == e {
+		rawConn.Control(func(fd uintptr) {
+			info.Fd = int(fd)
+		})
+	}
+	if conn, ok := releasable.socket.(net.PacketConn); ok {
+		spec.Address = conn.LocalAddr().String()
+		info.Address = spec.Address
+		return &releasablePacketConn{releasableSocket: releasable, addr: conn.LocalAddr()}, nil
+	}
+	ln := releasable.socket.(net.Listener)
+	spec.Address = ln.Addr().String()
+	info.Address = spec.Address
+	return &releasableListener{releasableSocket: releasable, addr: ln.Addr()}, nil
+}
+
+// addrInUse 地址已被占用
+func addrInUse(err error) bool {
+	return errors.Is(err, windows.WSAEADDRINUSE)
+}
+
+// fileListener 获取子进程绑定的面向流的侦听
+func (object *Registry) fileListener(info ListenerInfo) (net.Listener, error) {
+	if ln, ok := object.sockets[info.Name].(net.Listener); ok {
+		return ln, nil
+	}
+	return nil, errors.New("listener not found: " + info.Name)
+}
+
+// filePacketConn 获取子进程绑定的面向报文的侦听
+func (object *Registry) filePacketConn(info ListenerInfo) (net.PacketConn, error) {
+	if conn, ok := object.sockets[info.Name].(net.PacketConn); ok {
+		return conn, nil
+	}
+	return nil, errors.New("packet conn not found: " + info.Name)
+}
+
+// FileListener Windows下侦听由子进程独占绑定并交由注册表持有，无法由句柄构建，
+// 应使用BootstrapListeners经Registry.Listener获取
+func FileListener(name string, fd int) (net.Listener, error) {
+	return nil, fmt.Errorf("daemon: listener %s: FileListener is not supported on windows, use Registry.Listener", name)
+}
+
+// inlineListeners 前台模式在当前进程侦听，返回侦听描述
+func (object *Daemon) inlineListeners(specs []ListenerSpec) ([]ListenerInfo, map[string]io.Closer, error) {
+	infos := make([]ListenerInfo, 0, len(specs))
+	for _, spec := range specs {
+		infos = append(infos, ListenerInfo{ListenerSpec: spec})
+	}
+	return object.childListeners(infos)
+}
@@ -0,0 +1,79 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+func TestControlPipeSecurity(t *testing.T) {
+	sa, err := controlPipeSecurity()
+	if nil != err {
+		t.Fatal(err)
+	}
+	control, _, err := sa.SecurityDescriptor.Control()
+	if nil != err || 0 == control&windows.SE_DACL_PROTECTED {
+		t.Fatal(control, err)
+	}
+	dacl, _, err := sa.SecurityDescriptor.DACL()
+	if nil != err || nil == dacl || 2 != dacl.AceCount {
+		t.Fatal(dacl, err)
+	}
+
+	// 只允许当前账户与管理员组
+	user, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if nil != err {
+		t.Fatal(err)
+	}
+	admins, err := windows.CreateWellKnownSid(windows.WinBuiltinAdministratorsSid)
+	if nil != err {
+		t.Fatal(err)
+	}
+	for i, want := range []*windows.SID{user.User.Sid, admins} {
+		var ace *windows.ACCESS_ALLOWED_ACE
+		if err = windows.GetAce(dacl, uint32(i), &ace); nil != err {
+			t.Fatal(err)
+		}
+		sid := (*windows.SID)(unsafe.Pointer(&ace.SidStart))
+		if windows.ACCESS_ALLOWED_ACE_TYPE != ace.Header.AceType || !sid.Equals(want) {
+			t.Fatal(i, sid, ace.Header.AceType)
+		}
+	}
+}
+
+func TestControlPipe(t *testing.T) {
+	dir := t.TempDir()
+	object := New("child", "upgrade", "bootstrap_args",
+		filepath.Join(dir, "logs"),
+		filepath.Join(dir, "pid"))
+	if err := object.serveControl(); nil != err {
+		t.Fatal(err)
+	}
+
+	// 服务账户可以写入控制管道
+	var f *os.File
+	var err error
+	for i := 0; i < 50; i++ {
+		if f, err = os.OpenFile(controlPipeName(os.Getpid()), os.O_WRONLY, 0); nil == err {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if nil != err {
+		t.Fatal(err)
+	}
+	f.Write([]byte(ExitRequest))
+	f.Close()
+	select {
+	case cmd := <-object.controlCh:
+		if ExitRequest != cmd.action {
+			t.Fatal(cmd.action)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no command")
+	}
+}
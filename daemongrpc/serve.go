@@ -0,0 +1,114 @@
+// Package daemongrpc 在守护进程子进程中运行gRPC服务的辅助函数，
+// 负责取回继承的侦听、上报准备好、退出时带超时的GracefulStop与错误传递
+package daemongrpc
+
+import (
+	"daemon"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// DefaultStopTimeout 默认优雅停止超时
+const DefaultStopTimeout = 5 * time.Second
+
+// Server gRPC服务，*grpc.Server满足该接口，
+// 使用接口避免守护进程依赖grpc
+type Server interface {
+	Serve(ln net.Listener) error // 在侦听上提供服务，停止后返回
+	GracefulStop()               // 等待进行中的调用结束后停止
+	Stop()                       // 立即停止
+}
+
+// Serve 按侦听名运行gRPC服务，侦听由d.SetListeners设置；
+// 返回引导错误、取侦听错误或服务异常退出的错误
+func Serve(d *daemon.Daemon, servers map[string]Server) error {
+	group := NewGroup(servers)
+	if err := d.Run(group.Logical); nil != err {
+		return err
+	}
+	return group.Err()
+}
+
+// Group 一组共享准备好与退出通道的gRPC服务
+type Group struct {
+	sync.Mutex
+	servers     map[string]Server // 侦听名对应的服务
+	stopTimeout time.Duration     // 优雅停止超时
+	err         error             // 第一个错误
+}
+
+// NewGroup 工厂方法
+func NewGroup(servers map[string]Server) *Group {
+	return &Group{
+		servers:     servers,
+		stopTimeout: DefaultStopTimeout,
+	}
+}
+
+// SetStopTimeout 设置优雅停止超时，超时后调用Stop；0表示一直等到调用结束
+func (object *Group) SetStopTimeout(stopTimeout time.Duration) *Group {
+	object.stopTimeout = stopTimeout
+	return object
+}
+
+// Err 业务逻辑退出后的第一个错误
+func (object *Group) Err() error {
+	object.Lock()
+	defer object.Unlock()
+	return object.err
+}
+
+// setErr 记录第一个错误
+func (object *Group) setErr(err error) {
+	object.Lock()
+	defer object.Unlock()
+	if nil == object.err {
+		object.err = err
+	}
+}
+
+// Logical 业务逻辑，可直接传给Daemon.Run/BootstrapListeners/RunInlineListeners
+func (object *Group) Logical(registry *daemon.Registry,
+	ready chan bool,
+	exitCh chan interface{}) {
+	serves := make(map[string]func(ln net.Listener) error, len(object.servers))
+	for name, srv := range object.servers {
+		serves[name] = srv.Serve
+	}
+	if err := daemon.ServeGroup(registry, ready, exitCh, serves, object.stop); nil != err {
+		object.setErr(err)
+	}
+}
+
+// stop 优雅停止全部服务，超时后立即停止
+func (object *Group) stop() {
+	var wg sync.WaitGroup
+	for _, srv := range object.servers {
+		wg.Add(1)
+		go func(srv Server) {
+			defer wg.Done()
+			doneCh := make(chan struct{})
+			go func() {
+				srv.GracefulStop()
+				close(doneCh)
+			}()
+			if 0 >= object.stopTimeout {
+				<-doneCh
+				return
+			}
+			timer := time.NewTimer(object.stopTimeout)
+			defer timer.Stop()
+			select {
+			case <-doneCh:
+			case <-timer.C:
+				glog.Error("server GracefulStop timeout")
+				srv.Stop()
+				<-doneCh
+			}
+		}(srv)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,72 @@
+//go:build !windows
+// +build !windows
+
+package daemongrpc
+
+import (
+	"daemon"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeServer GracefulStop一直等到Stop被调用，模拟有未结束的调用
+type fakeServer struct {
+	once    sync.Once
+	serving chan net.Listener
+	stopped chan struct{}
+}
+
+func (object *fakeServer) Serve(ln net.Listener) error {
+	object.serving <- ln
+	<-object.stopped
+	ln.Close()
+	return nil
+}
+
+func (object *fakeServer) GracefulStop() {
+	<-object.stopped
+}
+
+func (object *fakeServer) Stop() {
+	object.once.Do(func() {
+		close(object.stopped)
+	})
+}
+
+func TestGroupStopTimeout(t *testing.T) {
+	srv := &fakeServer{serving: make(chan net.Listener, 1), stopped: make(chan struct{})}
+	group := NewGroup(map[string]Server{"rpc": srv}).SetStopTimeout(100 * time.Millisecond)
+
+	doneCh := make(chan error, 1)
+	go func() {
+		doneCh <- daemon.Default().RunInlineListeners([]daemon.ListenerSpec{
+			{Name: "rpc", Network: "tcp", Address: "127.0.0.1:0"},
+		}, group.Logical)
+	}()
+	ln := <-srv.serving
+	if _, ok := ln.(*daemon.TrackedListener); !ok {
+		t.Fatal(ln)
+	}
+
+	start := time.Now()
+	syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	select {
+	case err := <-doneCh:
+		if nil != err || nil != group.Err() || 100*time.Millisecond > time.Since(start) {
+			t.Fatal(err, group.Err(), time.Since(start))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("group not stopped")
+	}
+}
+
+func TestGroupMissingListener(t *testing.T) {
+	group := NewGroup(map[string]Server{"missing": &fakeServer{}})
+	err := daemon.Default().RunInlineListeners(nil, group.Logical)
+	if nil != err || nil == group.Err() {
+		t.Fatal(err, group.Err())
+	}
+}
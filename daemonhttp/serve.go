@@ -0,0 +1,116 @@
+// Package daemonhttp 在守护进程子进程中运行HTTP服务的辅助函数，
+// 负责取回继承的侦听、上报准备好、退出时优雅关闭与错误传递
+package daemonhttp
+
+import (
+	"context"
+	"daemon"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// DefaultShutdownTimeout 默认优雅关闭超时
+const DefaultShutdownTimeout = 5 * time.Second
+
+// Serve 按侦听名运行HTTP服务，侦听由d.SetListeners设置；
+// 返回引导错误、取侦听错误或服务异常退出的错误
+func Serve(d *daemon.Daemon, handlers map[string]http.Handler) error {
+	servers := make(map[string]*http.Server, len(handlers))
+	for name, handler := range handlers {
+		servers[name] = &http.Server{Handler: handler}
+	}
+	return ServeServers(d, servers)
+}
+
+// ServeServers 同Serve，使用自定义的http.Server
+func ServeServers(d *daemon.Daemon, servers map[string]*http.Server) error {
+	group := NewGroup(servers)
+	if err := d.Run(group.Logical); nil != err {
+		return err
+	}
+	return group.Err()
+}
+
+// Group 一组共享准备好与退出通道的HTTP服务
+type Group struct {
+	sync.Mutex
+	servers         map[string]*http.Server // 侦听名对应的服务
+	shutdownTimeout time.Duration           // 优雅关闭超时
+	err             error                   // 第一个错误
+}
+
+// NewGroup 工厂方法
+func NewGroup(servers map[string]*http.Server) *Group {
+	return &Group{
+		servers:         servers,
+		shutdownTimeout: DefaultShutdownTimeout,
+	}
+}
+
+// SetShutdownTimeout 设置优雅关闭超时，0表示一直等到请求处理完
+func (object *Group) SetShutdownTimeout(shutdownTimeout time.Duration) *Group {
+	object.shutdownTimeout = shutdownTimeout
+	return object
+}
+
+// Err 业务逻辑退出后的第一个错误
+func (object *Group) Err() error {
+	object.Lock()
+	defer object.Unlock()
+	return object.err
+}
+
+// setErr 记录第一个错误
+func (object *Group) setErr(err error) {
+	object.Lock()
+	defer object.Unlock()
+	if nil == object.err {
+		object.err = err
+	}
+}
+
+// Logical 业务逻辑，可直接传给Daemon.Run/BootstrapListeners/RunInlineListeners
+func (object *Group) Logical(registry *daemon.Registry,
+	ready chan bool,
+	exitCh chan interface{}) {
+	serves := make(map[string]func(ln net.Listener) error, len(object.servers))
+	for name, srv := range object.servers {
+		srv := srv
+		serves[name] = func(ln net.Listener) error {
+			if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		}
+	}
+	if err := daemon.ServeGroup(registry, ready, exitCh, serves, object.shutdown); nil != err {
+		object.setErr(err)
+	}
+}
+
+// shutdown 优雅关闭全部服务，超时后强制关闭
+func (object *Group) shutdown() {
+	ctx := context.Background()
+	if 0 < object.shutdownTimeout {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, object.shutdownTimeout)
+		defer cancel()
+	}
+	var wg sync.WaitGroup
+	for _, srv := range object.servers {
+		wg.Add(1)
+		go func(srv *http.Server) {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); nil != err {
+				glog.Error("server Shutdown: ", err)
+				srv.Close()
+			}
+		}(srv)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,69 @@
+//go:build !windows
+// +build !windows
+
+package daemonhttp
+
+import (
+	"daemon"
+	"io/ioutil"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestGroup(t *testing.T) {
+	group := NewGroup(map[string]*http.Server{
+		"web": {Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		})},
+	}).SetShutdownTimeout(time.Second)
+
+	addrCh := make(chan string, 1)
+	doneCh := make(chan error, 1)
+	go func() {
+		doneCh <- daemon.Default().RunInlineListeners([]daemon.ListenerSpec{
+			{Name: "web", Network: "tcp", Address: "127.0.0.1:0"},
+		}, func(registry *daemon.Registry, ready chan bool, exitCh chan interface{}) {
+			info, _ := registry.Info("web")
+			addrCh <- info.Address
+			group.Logical(registry, ready, exitCh)
+		})
+	}()
+
+	addr := <-addrCh
+	var rsp *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		if rsp, err = http.Get("http://" + addr); nil == err {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if nil != err {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	if "ok" != string(body) {
+		t.Fatal(string(body))
+	}
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	select {
+	case err = <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("group not shut down")
+	}
+	if nil != err || nil != group.Err() {
+		t.Fatal(err, group.Err())
+	}
+}
+
+func TestGroupMissingListener(t *testing.T) {
+	group := NewGroup(map[string]*http.Server{"missing": {}})
+	err := daemon.Default().RunInlineListeners(nil, group.Logical)
+	if nil != err || nil == group.Err() {
+		t.Fatal(err, group.Err())
+	}
+}
@@ -0,0 +1,77 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// DaemonizeStageEnv 脱离终端阶段环境变量
+const DaemonizeStageEnv = "DAEMON_DAEMONIZE_STAGE"
+
+// reexec 以指定阶段重新运行自身，标准流重定向到日志
+func (object *Daemon) reexec(stage string, setsid bool) (err error) {
+	var exePath string
+	if exePath, err = os.Executable(); nil != err {
+		return
+	}
+
+	var devNull, logFile *os.File
+	if devNull, err = os.Open(os.DevNull); nil != err {
+		return
+	}
+	defer devNull.Close()
+	logPath := object.daemonLogFile
+	if 0 >= len(logPath) {
+		logPath = os.DevNull
+	}
+	if logFile, err = os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); nil != err {
+		return
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(exePath, object.origArgs[1:]...)
+	cmd.Env = append(os.Environ(), DaemonizeStageEnv+"="+stage)
+	cmd.Stdin = devNull
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: setsid}
+	if err = cmd.Start(); nil != err {
+		return
+	}
+	err = cmd.Process.Release()
+	return
+}
+
+// detach 脱离控制终端，模拟两次fork：
+// 第一次以setsid成为会话首进程，第二次再派生非会话首进程，使其无法重新获得终端。
+// 返回true表示当前进程为最终的守护进程，应继续运行
+func (object *Daemon) detach() (detached bool, err error) {
+	switch os.Getenv(DaemonizeStageEnv) {
+	case "":
+		err = object.reexec("1", true)
+		return
+
+	case "1":
+		err = object.reexec("2", false)
+		return
+	}
+
+	os.Unsetenv(DaemonizeStageEnv)
+	if 0 < len(object.workDir) {
+		if err = os.Chdir(object.workDir); nil != err {
+			return
+		}
+	}
+	syscall.Umask(object.umask)
+
+	// 切换目录后使用可执行文件绝对路径派生子进程
+	if object.origArgs[0], err = os.Executable(); nil != err {
+		return
+	}
+	detached = true
+	return
+}
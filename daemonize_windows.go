@@ -0,0 +1,8 @@
+package daemon
+
+import "errors"
+
+// detach Windows下请以系统服务方式运行
+func (object *Daemon) detach() (bool, error) {
+	return false, errors.New("daemonize not supported on windows, use --install to run as service")
+}
@@ -0,0 +1,234 @@
+// Package daemonotel 把守护进程更新流程的追踪片段以OTLP/HTTP(JSON)导出，
+// 不依赖OpenTelemetry SDK；已使用SDK的应用可自行实现daemon.Tracer适配
+package daemonotel
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"daemon"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// DefaultEndpoint OTLP/HTTP默认的追踪接收地址
+const DefaultEndpoint = "http://localhost:4318/v1/traces"
+
+// Exporter 以OTLP/HTTP导出追踪片段，根片段结束时发送整条追踪
+type Exporter struct {
+	sync.Mutex
+	endpoint    string             // 接收地址
+	serviceName string             // service.name资源属性
+	headers     map[string]string  // 附加请求头
+	client      *http.Client       // HTTP客户端
+	pending     map[string][]*span // 追踪ID对应的已结束片段
+	wg          sync.WaitGroup     // 进行中的发送
+}
+
+// NewExporter 工厂方法，endpoint为空时使用DefaultEndpoint
+func NewExporter(endpoint, serviceName string) *Exporter {
+	if 0 >= len(endpoint) {
+		endpoint = DefaultEndpoint
+	}
+	return &Exporter{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		pending:     make(map[string][]*span),
+	}
+}
+
+// SetHeaders 设置附加请求头，如认证信息
+func (object *Exporter) SetHeaders(headers map[string]string) *Exporter {
+	object.headers = headers
+	return object
+}
+
+// Flush 等待进行中的发送完成
+func (object *Exporter) Flush() {
+	object.wg.Wait()
+}
+
+// spanKey 上下文中当前片段的键
+type spanKey struct{}
+
+// Start 开始片段，实现daemon.Tracer
+func (object *Exporter) Start(ctx context.Context, name string) (context.Context, daemon.Span) {
+	s := &span{
+		exporter:   object,
+		name:       name,
+		spanID:     randomHex(8),
+		start:      time.Now(),
+		attributes: make(map[string]interface{}),
+	}
+	if parent, ok := ctx.Value(spanKey{}).(*span); ok {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		s.traceID = randomHex(16)
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// finish 片段结束，根片段结束时发送整条追踪
+func (object *Exporter) finish(s *span) {
+	object.Lock()
+	spans := append(object.pending[s.traceID], s)
+	if 0 < len(s.parentID) {
+		object.pending[s.traceID] = spans
+		object.Unlock()
+		return
+	}
+	delete(object.pending, s.traceID)
+	object.Unlock()
+
+	object.wg.Add(1)
+	go func() {
+		defer object.wg.Done()
+		if err := object.export(spans); nil != err {
+			glog.Error(err)
+		}
+	}()
+}
+
+// export 发送一条追踪
+func (object *Exporter) export(spans []*span) error {
+	body, err := json.Marshal(object.encode(spans))
+	if nil != err {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, object.endpoint, bytes.NewReader(body))
+	if nil != err {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range object.headers {
+		req.Header.Set(key, value)
+	}
+	rsp, err := object.client.Do(req)
+	if nil != err {
+		return err
+	}
+	rsp.Body.Close()
+	if http.StatusOK > rsp.StatusCode || http.StatusMultipleChoices <= rsp.StatusCode {
+		return fmt.Errorf("daemonotel: export to %s: %s", object.endpoint, rsp.Status)
+	}
+	return nil
+}
+
+// encode 编码为OTLP JSON
+func (object *Exporter) encode(spans []*span) map[string]interface{} {
+	encoded := make([]map[string]interface{}, 0, len(spans))
+	for _, s := range spans {
+		encoded = append(encoded, s.encode())
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": encodeAttributes(map[string]interface{}{"service.name": object.serviceName}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "daemon"},
+						"spans": encoded,
+					},
+				},
+			},
+		},
+	}
+}
+
+// span 追踪片段
+type span struct {
+	sync.Mutex
+	exporter   *Exporter              // 所属导出器
+	name       string                 // 名称
+	traceID    string                 // 追踪ID
+	spanID     string                 // 片段ID
+	parentID   string                 // 父片段ID，根片段为空
+	start      time.Time              // 开始时间
+	end        time.Time              // 结束时间
+	attributes map[string]interface{} // 属性
+	err        error                  // 失败原因
+}
+
+// SetAttribute 设置属性
+func (object *span) SetAttribute(key string, value interface{}) {
+	object.Lock()
+	defer object.Unlock()
+	object.attributes[key] = value
+}
+
+// End 结束
+func (object *span) End(err error) {
+	object.Lock()
+	object.end = time.Now()
+	object.err = err
+	object.Unlock()
+	object.exporter.finish(object)
+}
+
+// encode 编码为OTLP JSON
+func (object *span) encode() map[string]interface{} {
+	object.Lock()
+	defer object.Unlock()
+	status := map[string]interface{}{"code": 1}
+	if nil != object.err {
+		status = map[string]interface{}{"code": 2, "message": object.err.Error()}
+	}
+	encoded := map[string]interface{}{
+		"traceId":           object.traceID,
+		"spanId":            object.spanID,
+		"name":              object.name,
+		"kind":              1,
+		"startTimeUnixNano": strconv.FormatInt(object.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(object.end.UnixNano(), 10),
+		"attributes":        encodeAttributes(object.attributes),
+		"status":            status,
+	}
+	if 0 < len(object.parentID) {
+		encoded["parentSpanId"] = object.parentID
+	}
+	return encoded
+}
+
+// encodeAttributes 编码属性
+func encodeAttributes(attributes map[string]interface{}) []interface{} {
+	encoded := make([]interface{}, 0, len(attributes))
+	for key, value := range attributes {
+		var v map[string]interface{}
+		switch value := value.(type) {
+		case string:
+			v = map[string]interface{}{"stringValue": value}
+		case bool:
+			v = map[string]interface{}{"boolValue": value}
+		case int:
+			v = map[string]interface{}{"intValue": strconv.FormatInt(int64(value), 10)}
+		case int64:
+			v = map[string]interface{}{"intValue": strconv.FormatInt(value, 10)}
+		case uint64:
+			v = map[string]interface{}{"intValue": strconv.FormatUint(value, 10)}
+		case float64:
+			v = map[string]interface{}{"doubleValue": value}
+		default:
+			v = map[string]interface{}{"stringValue": fmt.Sprint(value)}
+		}
+		encoded = append(encoded, map[string]interface{}{"key": key, "value": v})
+	}
+	return encoded
+}
+
+// randomHex n字节随机数的十六进制
+func randomHex(n int) string {
+	raw := make([]byte, n)
+	rand.Read(raw)
+	return hex.EncodeToString(raw)
+}
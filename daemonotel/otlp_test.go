@@ -0,0 +1,52 @@
+package daemonotel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestExporter(t *testing.T) {
+	var lock sync.Mutex
+	var bodies []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); nil != err {
+			t.Error(err)
+		}
+		lock.Lock()
+		bodies = append(bodies, body)
+		lock.Unlock()
+	}))
+	defer srv.Close()
+
+	exporter := NewExporter(srv.URL, "app")
+	ctx, root := exporter.Start(context.Background(), "daemon.upgrade")
+	_, child := exporter.Start(ctx, "daemon.spawn")
+	child.SetAttribute("process.pid", 42)
+	child.End(nil)
+	root.End(errors.New("not ready"))
+	exporter.Flush()
+
+	lock.Lock()
+	defer lock.Unlock()
+	if 1 != len(bodies) {
+		t.Fatal(bodies)
+	}
+	spans := bodies[0]["resourceSpans"].([]interface{})[0].(map[string]interface{})["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	if 2 != len(spans) {
+		t.Fatal(spans)
+	}
+	first, second := spans[0].(map[string]interface{}), spans[1].(map[string]interface{})
+	if "daemon.spawn" != first["name"] || second["spanId"] != first["parentSpanId"] ||
+		first["traceId"] != second["traceId"] {
+		t.Fatal(spans)
+	}
+	if status := second["status"].(map[string]interface{}); 2 != status["code"].(float64) {
+		t.Fatal(status)
+	}
+}
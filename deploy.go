@@ -0,0 +1,99 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// Deploy 更新附带的部署信息，写入事件、状态、更新历史与子进程的引导参数，
+// 子进程通过Registry.Deploy得知自己属于哪次部署
+type Deploy struct {
+	ID       string            `json:"id,omitempty"`       // 部署ID
+	Revision string            `json:"revision,omitempty"` // 代码版本，如git SHA
+	Operator string            `json:"operator,omitempty"` // 操作人
+	Labels   map[string]string `json:"labels,omitempty"`   // 其他信息
+}
+
+// empty 未附带任何信息
+func (object *Deploy) empty() bool {
+	return 0 >= len(object.ID) && 0 >= len(object.Revision) && 0 >= len(object.Operator) && 0 >= len(object.Labels)
+}
+
+// deployState 部署信息的状态
+type deployState struct {
+	sync.Mutex
+	current *Deploy // 当前子进程所属的部署，未附带时为nil
+	pending *Deploy // 进行中的更新附带的部署
+}
+
+// UpgradeDeploy 在守护进程内发起附带部署信息的更新，返回更新结果
+func (object *Daemon) UpgradeDeploy(deploy Deploy) error {
+	return object.execCommand(deployAction(UpgradeRequest, &deploy))
+}
+
+// deployAction 把部署信息附加在更新指令后，格式为Upgrade:{json}，经控制socket发送时不超过512字节
+func deployAction(action string, deploy *Deploy) string {
+	if nil == deploy || deploy.empty() {
+		return action
+	}
+	raw, err := json.Marshal(deploy)
+	if nil != err {
+		glog.Error(err)
+		return action
+	}
+	return action + ":" + string(raw)
+}
+
+// parseDeployAction 拆分更新指令与部署信息，其他指令原样返回
+func parseDeployAction(action string) (string, *Deploy, error) {
+	for _, upgrade := range []string{UpgradeRequest, ForceUpgradeRequest} {
+		if !strings.HasPrefix(action, upgrade+":") {
+			continue
+		}
+		deploy := &Deploy{}
+		if err := json.Unmarshal([]byte(action[len(upgrade)+1:]), deploy); nil != err {
+			return action, nil, fmt.Errorf("daemon: invalid deploy metadata: %w", err)
+		}
+		return upgrade, deploy, nil
+	}
+	return action, nil, nil
+}
+
+// deployInfo 生效的部署：更新中为本次更新附带的，否则为当前子进程所属的；工作进程取主Daemon的
+func (object *Daemon) deployInfo() *Deploy {
+	if nil != object.primary {
+		return object.primary.deployInfo()
+	}
+	object.deploy.Lock()
+	defer object.deploy.Unlock()
+	if nil != object.deploy.pending {
+		return object.deploy.pending
+	}
+	return object.deploy.current
+}
+
+// beginDeploy 开始附带部署信息的更新
+func (object *Daemon) beginDeploy(deploy *Deploy) {
+	object.deploy.Lock()
+	object.deploy.pending = deploy
+	object.deploy.Unlock()
+}
+
+// finishDeploy 更新结束，成功时新子进程属于本次部署
+func (object *Daemon) finishDeploy(ok bool) {
+	object.deploy.Lock()
+	if ok && nil != object.deploy.pending {
+		object.deploy.current = object.deploy.pending
+	}
+	object.deploy.pending = nil
+	object.deploy.Unlock()
+}
+
+// Deploy 子进程所属的部署，父进程未附带时为nil
+func (object *Registry) Deploy() *Deploy {
+	return object.deploy
+}
@@ -0,0 +1,90 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+func TestParseDeployAction(t *testing.T) {
+	deploy := &Deploy{ID: "d-42", Revision: "3f2c1a9", Operator: "alice"}
+	action := deployAction(ForceUpgradeRequest, deploy)
+	if `ForceUpgrade:{"id":"d-42","revision":"3f2c1a9","operator":"alice"}` != action {
+		t.Fatal(action)
+	}
+	if got, parsed, err := parseDeployAction(action); nil != err || ForceUpgradeRequest != got || !reflect.DeepEqual(deploy, parsed) {
+		t.Fatal(got, parsed, err)
+	}
+	if UpgradeRequest != deployAction(UpgradeRequest, &Deploy{}) {
+		t.Fatal("empty deploy attached")
+	}
+	if got, parsed, err := parseDeployAction("Workers:3"); nil != err || "Workers:3" != got || nil != parsed {
+		t.Fatal(got, parsed, err)
+	}
+	if _, _, err := parseDeployAction("Upgrade:{"); nil == err {
+		t.Fatal("invalid metadata accepted")
+	}
+}
+
+func TestUpgradeDeploy(t *testing.T) {
+	var lock sync.Mutex
+	var deploys []*Deploy
+	var events []Event
+	object, signalCh, doneCh := startFakeParent(t, withChild(func(xCmdObj *XCmd, args []string) error {
+		meta, _ := parseBootstrapMeta(strings.TrimPrefix(args[len(args)-1], "--bootstrap_args="))
+		lock.Lock()
+		deploys = append(deploys, meta.Deploy)
+		lock.Unlock()
+		return fakeChild(xCmdObj, args)
+	}), withSetup(func(object *Daemon) {
+		object.SetHistoryFile(filepath.Join(t.TempDir(), "history")).
+			OnEvent(func(event Event) {
+				if EventChildExited == event.Type {
+					events = append(events, event)
+				}
+			})
+	}))
+	if nil != object.Status().Deploy {
+		t.Fatal(object.Status().Deploy)
+	}
+
+	deploy := Deploy{ID: "d-42", Revision: "3f2c1a9", Operator: "alice"}
+	if err := object.UpgradeDeploy(deploy); nil != err {
+		t.Fatal(err)
+	}
+	if status := object.Status(); !reflect.DeepEqual(&deploy, status.Deploy) {
+		t.Fatal(status.Deploy)
+	}
+	lock.Lock()
+	if 2 != len(deploys) || nil != deploys[0] || !reflect.DeepEqual(&deploy, deploys[1]) {
+		t.Fatal(deploys)
+	}
+	lock.Unlock()
+	records, err := ReadHistory(object.history.path)
+	if nil != err || 1 != len(records) || !reflect.DeepEqual(&deploy, records[0].Deploy) {
+		t.Fatal(records, err)
+	}
+	// 更新中替换下来的旧子进程的退出事件带本次部署
+	if 1 != len(events) || !reflect.DeepEqual(&deploy, events[0].Deploy) {
+		t.Fatal(events)
+	}
+
+	// 未附带部署信息的更新沿用当前的
+	if err := object.Upgrade(); nil != err {
+		t.Fatal(err)
+	}
+	if status := object.Status(); !reflect.DeepEqual(&deploy, status.Deploy) {
+		t.Fatal(status.Deploy)
+	}
+
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,106 @@
+package daemon
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// drainOrder 侦听的排空顺序
+type drainOrder struct {
+	order int           // 顺序
+	grace time.Duration // 关闭后等待的时间
+}
+
+// drainStage 同一顺序的侦听
+type drainStage struct {
+	order int           // 顺序
+	names []string      // 侦听名
+	grace time.Duration // 关闭后等待的时间，取该批侦听中最长的
+}
+
+// SetDrainOrder 声明侦听的排空顺序，子进程收到退出指令时按序关闭侦听：
+// order<0的侦听在关闭exitCh之前按从小到大分批关闭，每批关闭后等待grace，让已接受的连接处理完，
+// 如先停止对外的侦听；order>0的侦听在业务逻辑返回后才按从小到大关闭，如内部管理侦听；
+// 0为默认，由业务逻辑在exitCh关闭后自行关闭。只作用于经Listener、PacketConn获取的侦听，
+// 被提前关闭的侦听Accept返回错误，业务逻辑应视为正常退出
+func (object *Registry) SetDrainOrder(name string, order int, grace time.Duration) {
+	object.Lock()
+	defer object.Unlock()
+	if nil == object.drainOrders {
+		object.drainOrders = make(map[string]drainOrder)
+	}
+	if 0 == order {
+		delete(object.drainOrders, name)
+		return
+	}
+	object.drainOrders[name] = drainOrder{order: order, grace: grace}
+}
+
+// drainStages 按顺序分批，before为真时返回order<0的批次，否则返回order>0的批次
+func (object *Registry) drainStages(before bool) (stages []drainStage) {
+	object.Lock()
+	defer object.Unlock()
+	index := make(map[int]int)
+	for name, drain := range object.drainOrders {
+		if before != (0 > drain.order) {
+			continue
+		}
+		i, ok := index[drain.order]
+		if !ok {
+			i = len(stages)
+			index[drain.order] = i
+			stages = append(stages, drainStage{order: drain.order})
+		}
+		stages[i].names = append(stages[i].names, name)
+		if stages[i].grace < drain.grace {
+			stages[i].grace = drain.grace
+		}
+	}
+	sort.Slice(stages, func(i, j int) bool {
+		return stages[i].order < stages[j].order
+	})
+	for _, stage := range stages {
+		sort.Strings(stage.names)
+	}
+	return
+}
+
+// closeListener 关闭已获取的侦听，未获取时忽略
+func (object *Registry) closeListener(name string) {
+	object.Lock()
+	var closer io.Closer
+	if ln := object.listeners[name]; nil != ln {
+		closer = ln
+	} else if conn := object.packetConns[name]; nil != conn {
+		closer = conn
+	}
+	object.Unlock()
+	if nil == closer {
+		return
+	}
+	if err := closer.Close(); nil != err {
+		glog.Error(err)
+	}
+}
+
+// drain 按批关闭侦听，before为真时关闭exitCh之前的批次，否则关闭业务逻辑返回之后的批次
+func (object *Registry) drain(before bool) {
+	for _, stage := range object.drainStages(before) {
+		for _, name := range stage.names {
+			object.closeListener(name)
+		}
+		progress := fmt.Sprintf("closed listeners %s", strings.Join(stage.names, ","))
+		glog.Info(progress)
+		if err := object.ReportDrainProgress(progress); nil != err {
+			glog.Error(err)
+		}
+		if before && 0 < stage.grace {
+			time.Sleep(stage.grace)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package daemon
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// orderedListener 记录关闭顺序的侦听
+type orderedListener struct {
+	net.Listener
+	name   string
+	closed *[]string
+}
+
+// Close 关闭侦听并记录
+func (object *orderedListener) Close() error {
+	*object.closed = append(*object.closed, object.name)
+	return object.Listener.Close()
+}
+
+func TestDrainOrder(t *testing.T) {
+	var closed []string
+	registry := newRegistry(nil)
+	for _, name := range []string{"public", "grpc", "internal", "admin", "metrics"} {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if nil != err {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		registry.listeners[name] = &orderedListener{Listener: ln, name: name, closed: &closed}
+	}
+	registry.SetDrainOrder("public", -2, 20*time.Millisecond)
+	registry.SetDrainOrder("grpc", -2, 0)
+	registry.SetDrainOrder("internal", -1, 0)
+	registry.SetDrainOrder("admin", 2, 0)
+	registry.SetDrainOrder("metrics", 1, 0)
+	registry.SetDrainOrder("unknown", -1, 0)
+
+	start := time.Now()
+	registry.drain(true)
+	if "grpc,public,internal" != strings.Join(closed, ",") {
+		t.Fatal(closed)
+	}
+	if 20*time.Millisecond > time.Since(start) {
+		t.Fatal(time.Since(start))
+	}
+
+	// 管理侦听在业务逻辑返回前仍可接受连接
+	conn, err := net.Dial("tcp", registry.listeners["admin"].Addr().String())
+	if nil != err {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	registry.drain(false)
+	if "grpc,public,internal,metrics,admin" != strings.Join(closed, ",") {
+		t.Fatal(closed)
+	}
+
+	// 恢复默认后不再由注册表关闭
+	registry.SetDrainOrder("admin", 0, 0)
+	if stages := registry.drainStages(false); 1 != len(stages) || "metrics" != stages[0].names[0] {
+		t.Fatal(stages)
+	}
+}
@@ -0,0 +1,132 @@
+package daemon
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// pipeKeySize 派生子进程时生成的通信密钥长度
+const pipeKeySize = 32
+
+// 两个方向各自派生的密钥
+const (
+	pipeKeyParentToChild = "daemon pipe parent to child"
+	pipeKeyChildToParent = "daemon pipe child to parent"
+)
+
+// SetEncryption 父子进程通信使用AES-256-GCM认证加密，适用于传输经过共享位置的多租户主机：
+// 每次派生生成新的密钥，经只有子进程继承的管道传递，不出现在参数与环境变量中；
+// 帧头作为附加数据一并认证，帧序号只增不减以拒绝重放，开启后不接受未加密的帧
+func (object *Daemon) SetEncryption(encryption bool) *Daemon {
+	object.encryption = encryption
+	return object
+}
+
+// SetEncryption 以key派生两个方向的密钥，加密之后读写的帧；parent区分本端为父进程或子进程
+func (object *XCmd) SetEncryption(key []byte, parent bool) (err error) {
+	var parentToChild, childToParent cipher.AEAD
+	if parentToChild, err = newPipeAEAD(key, pipeKeyParentToChild); nil != err {
+		return
+	}
+	if childToParent, err = newPipeAEAD(key, pipeKeyChildToParent); nil != err {
+		return
+	}
+	if parent {
+		object.writePipe.SetEncryption(parentToChild)
+		object.readPipe.SetEncryption(childToParent)
+	} else {
+		object.writePipe.SetEncryption(childToParent)
+		object.readPipe.SetEncryption(parentToChild)
+	}
+	return
+}
+
+// newPipeAEAD 由主密钥按用途派生AES-256-GCM
+func newPipeAEAD(key []byte, info string) (aead cipher.AEAD, err error) {
+	var derived []byte
+	if derived, err = hkdf.Key(sha256.New, key, nil, info, 32); nil != err {
+		return
+	}
+	var block cipher.Block
+	if block, err = aes.NewCipher(derived); nil != err {
+		return
+	}
+	return cipher.NewGCM(block)
+}
+
+// passPipeKey 生成通信密钥，写入只有子进程继承的管道，返回密钥与子进程端的fd
+func passPipeKey(xCmdObj *XCmd) (key []byte, fd int, err error) {
+	key = make([]byte, pipeKeySize)
+	if _, err = rand.Read(key); nil != err {
+		return
+	}
+	var r, w *os.File
+	if r, w, err = os.Pipe(); nil != err {
+		return
+	}
+	_, err = w.Write(key)
+	w.Close()
+	if nil != err {
+		r.Close()
+		return
+	}
+	// 读端随子进程的管道一起在启动后关闭
+	fd = xCmdObj.AddNamedFile(fdSlotPipeKey, r)
+	xCmdObj.childPipes = append(xCmdObj.childPipes, r)
+	return
+}
+
+// readPipeKey 子进程从继承的fd读取通信密钥
+func readPipeKey(fd int) (key []byte, err error) {
+	f := os.NewFile(uintptr(fd), "pipeKey")
+	if nil == f {
+		err = fmt.Errorf("%w: invalid key fd %d", ErrFrame, fd)
+		return
+	}
+	defer f.Close()
+	key = make([]byte, pipeKeySize)
+	_, err = io.ReadFull(f, key)
+	return
+}
+
+// pipeNonce 由帧序号构建nonce
+func pipeNonce(aead cipher.AEAD, seq uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], seq)
+	return nonce
+}
+
+// sealFrame 加密负载，输出序号与密文，ad为帧头
+func sealFrame(aead cipher.AEAD, seq uint64, ad, raw []byte) []byte {
+	sealed := make([]byte, 8, 8+len(raw)+aead.Overhead())
+	binary.BigEndian.PutUint64(sealed, seq)
+	return aead.Seal(sealed, pipeNonce(aead, seq), raw, ad)
+}
+
+// openFrame 解密负载，序号须大于last
+func openFrame(aead cipher.AEAD, last uint64, ad, sealed []byte) (raw []byte, seq uint64, err error) {
+	if 8+aead.Overhead() > len(sealed) {
+		err = fmt.Errorf("%w: encrypted payload too short", ErrFrame)
+		return
+	}
+	if seq = binary.BigEndian.Uint64(sealed); seq <= last {
+		err = fmt.Errorf("%w: replayed frame %d, last %d", ErrFrame, seq, last)
+		return
+	}
+	if raw, err = aead.Open(nil, pipeNonce(aead, seq), sealed[8:], ad); nil != err {
+		err = fmt.Errorf("%w: %v", ErrFrame, err)
+	}
+	return
+}
+
+// sealedSize 加密后负载的长度
+func sealedSize(aead cipher.AEAD, size int) int {
+	return 8 + size + aead.Overhead()
+}
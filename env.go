@@ -0,0 +1,64 @@
+package daemon
+
+import (
+	"os"
+	"strings"
+)
+
+// SetEnv 设置子进程环境变量，覆盖继承的同名变量
+func (object *Daemon) SetEnv(key, value string) *Daemon {
+	object.envOverrides = setEnv(object.envOverrides, key, value)
+	return object
+}
+
+// SetEnvFilter 设置继承环境变量的过滤器，返回假的变量不传给子进程；
+// 为空时继承全部，SetEnv设置的变量不受过滤器影响
+func (object *Daemon) SetEnvFilter(filter func(key string) bool) *Daemon {
+	object.envFilter = filter
+	return object
+}
+
+// childEnv 子进程环境变量，返回nil表示原样继承父进程
+func (object *Daemon) childEnv() []string {
+	base := object.commandEnv
+	if nil == base {
+		if nil == object.envFilter && 0 >= len(object.envOverrides) && !object.hasSecretEnv() {
+			return nil
+		}
+		base = os.Environ()
+	}
+
+	env := make([]string, 0, len(base)+len(object.envOverrides))
+	for _, kv := range base {
+		if object.isSecretEnv(envKey(kv)) {
+			continue
+		}
+		if nil == object.envFilter || object.envFilter(envKey(kv)) {
+			env = append(env, kv)
+		}
+	}
+	for _, kv := range object.envOverrides {
+		env = setEnv(env, envKey(kv), kv[len(envKey(kv))+1:])
+	}
+	return env
+}
+
+// envKey 环境变量名
+func envKey(kv string) string {
+	if i := strings.IndexByte(kv, '='); 0 <= i {
+		return kv[:i]
+	}
+	return kv
+}
+
+// setEnv 设置变量，已存在时原地替换
+func setEnv(env []string, key, value string) []string {
+	kv := key + "=" + value
+	for i := range env {
+		if key == envKey(env[i]) {
+			env[i] = kv
+			return env
+		}
+	}
+	return append(env, kv)
+}
@@ -0,0 +1,24 @@
+package daemon
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChildEnv(t *testing.T) {
+	object := Default()
+	if nil != object.childEnv() {
+		t.Fatal("env should be inherited")
+	}
+
+	object.SetCommand("/usr/bin/worker", nil, []string{"PATH=/bin", "SECRET=x", "COLOR=blue"}).
+		SetEnvFilter(func(key string) bool {
+			return !strings.HasPrefix(key, "SECRET")
+		}).
+		SetEnv("COLOR", "green").
+		SetEnv("SECRETS_FILE", "/run/secrets")
+	env := strings.Join(object.childEnv(), " ")
+	if "PATH=/bin COLOR=green SECRETS_FILE=/run/secrets" != env {
+		t.Fatal(env)
+	}
+}
@@ -0,0 +1,153 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 错误类型，使用errors.Is判断，底层原因可通过errors.As获取
+var (
+	ErrPortBind               = errors.New("daemon: port bind failed")
+	ErrPIDFileLocked          = errors.New("daemon: pid file locked by another process")
+	ErrChildNotReady          = errors.New("daemon: child not ready")
+	ErrReadyTimeout           = errors.New("daemon: child ready timeout")
+	ErrSpawn                  = errors.New("daemon: spawn child failed")
+	ErrDrainTimeout           = errors.New("daemon: child drain timeout")
+	ErrPipeClosed             = errors.New("daemon: XPipe closed")
+	ErrUpgradeInProgress      = errors.New("daemon: upgrade in progress")
+	ErrNotRunning             = errors.New("daemon: daemon not running")
+	ErrFrame                  = errors.New("daemon: invalid XPipe frame")
+	ErrFrameChecksum          = errors.New("daemon: XPipe frame checksum mismatch")
+	ErrCodecReserved          = errors.New("daemon: codec id reserved")
+	ErrStreamOpened           = errors.New("daemon: XPipe stream already opened")
+	ErrTransport              = errors.New("daemon: transport not supported")
+	ErrPeerCredentials        = errors.New("daemon: peer credentials mismatch")
+	ErrBufferUnderflow        = errors.New("daemon: buffer underflow")
+	ErrUnknownService         = errors.New("daemon: unknown supervised service")
+	ErrUnknownWorker          = errors.New("daemon: unknown worker")
+	ErrUpgradeFailed          = errors.New("daemon: upgrade failed")
+	ErrSameBinary             = errors.New("daemon: binary unchanged, use ForceUpgrade")
+	ErrHeartbeatTimeout       = errors.New("daemon: child heartbeat timeout")
+	ErrRestartBudgetExhausted = errors.New("daemon: restart budget exhausted")
+	ErrNoHistory              = errors.New("daemon: upgrade history file not set")
+	ErrSpawnAborted           = errors.New("daemon: spawn aborted by shutdown")
+	ErrHealthProbe            = errors.New("daemon: health probe failed")
+	ErrUpgradeVetoed          = errors.New("daemon: upgrade vetoed by child")
+	ErrNoSignal               = errors.New("daemon: no signal mapped to action")
+	ErrNamespaces             = errors.New("daemon: namespaces not supported on this platform")
+	ErrSecrets                = errors.New("daemon: secrets unavailable")
+	ErrStagingFailed          = errors.New("daemon: staging check failed")
+	ErrUpgradeDeadline        = errors.New("daemon: upgrade deadline exceeded")
+	ErrSpawnTimeout           = errors.New("daemon: spawn timeout")
+	ErrExitTimeout            = errors.New("daemon: old child exit timeout")
+	ErrSharedMemory           = errors.New("daemon: shared memory unavailable")
+	ErrRingFull               = errors.New("daemon: shared ring full")
+	ErrRingCorrupt            = errors.New("daemon: shared ring corrupt")
+	ErrUpgradeAborted         = errors.New("daemon: upgrade aborted")
+	ErrNoPendingUpgrade       = errors.New("daemon: no upgrade awaiting confirmation")
+	ErrChildNotReaped         = errors.New("daemon: child not reaped")
+	ErrProcessStats           = errors.New("daemon: process stats unavailable")
+	ErrPreflight              = errors.New("daemon: pre-flight check failed")
+	ErrUpgradeCheck           = errors.New("daemon: upgrade check failed")
+	ErrExclusiveListeners     = errors.New("daemon: windows listeners are bound exclusively by one worker")
+)
+
+// 生命周期阶段
+const (
+	PhaseSpawn     = "spawn"
+	PhaseReady     = "ready"
+	PhaseDrain     = "drain"
+	PhaseUpgrade   = "upgrade"
+	PhaseRestart   = "restart"
+	PhasePreflight = "preflight"
+	PhasePrepare   = "prepare"
+	PhaseExit      = "exit"
+)
+
+// LifecycleError 生命周期错误，Kind为上面的哨兵错误，Cause为底层原因
+type LifecycleError struct {
+	Phase string // 阶段
+	Pid   int    // 子进程ID，未启动时为0
+	Kind  error  // 哨兵错误
+	Cause error  // 底层原因，可为空
+}
+
+// newLifecycleError 工厂方法
+func newLifecycleError(phase string, pid int, kind, cause error) *LifecycleError {
+	return &LifecycleError{
+		Phase: phase,
+		Pid:   pid,
+		Kind:  kind,
+		Cause: cause,
+	}
+}
+
+// Error 错误描述
+func (object *LifecycleError) Error() string {
+	msg := fmt.Sprintf("%s(pid %d): %v", object.Phase, object.Pid, object.Kind)
+	if nil != object.Cause {
+		msg += ": " + object.Cause.Error()
+	}
+	return msg
+}
+
+// Unwrap 同时展开哨兵错误与底层原因
+func (object *LifecycleError) Unwrap() []error {
+	if nil == object.Cause {
+		return []error{object.Kind}
+	}
+	return []error{object.Kind, object.Cause}
+}
+
+// failedPhase 生命周期错误所处的阶段，其他错误为空
+func failedPhase(err error) string {
+	var lifecycleErr *LifecycleError
+	if errors.As(err, &lifecycleErr) {
+		return lifecycleErr.Phase
+	}
+	return ""
+}
+
+// BindFailure 单个侦听的绑定失败
+type BindFailure struct {
+	Name    string // 侦听名
+	Address string // 侦听地址
+	Err     error  // 失败原因
+}
+
+// BindError 侦听绑定失败的汇总，列出全部失败的侦听，errors.Is可判断ErrPortBind与各自的原因
+type BindError struct {
+	Failures []BindFailure // 失败的侦听，按描述的顺序
+}
+
+// add 记录一个失败的侦听
+func (object *BindError) add(spec ListenerSpec, err error) {
+	object.Failures = append(object.Failures, BindFailure{Name: spec.Name, Address: spec.Address, Err: err})
+}
+
+// err 有失败时返回自身
+func (object *BindError) err() error {
+	if 0 >= len(object.Failures) {
+		return nil
+	}
+	return object
+}
+
+// Error 错误描述
+func (object *BindError) Error() string {
+	failures := make([]string, 0, len(object.Failures))
+	for _, failure := range object.Failures {
+		failures = append(failures, fmt.Sprintf("%s(%s): %v", failure.Name, failure.Address, failure.Err))
+	}
+	return fmt.Sprintf("%v: %s", ErrPortBind, strings.Join(failures, "; "))
+}
+
+// Unwrap 展开哨兵错误与各侦听的失败原因
+func (object *BindError) Unwrap() []error {
+	errs := []error{ErrPortBind}
+	for _, failure := range object.Failures {
+		errs = append(errs, failure.Err)
+	}
+	return errs
+}
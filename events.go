@@ -0,0 +1,122 @@
+package daemon
+
+import (
+	"os"
+	"time"
+)
+
+// 生命周期事件类型
+const (
+	EventChildExited            = "child_exited"             // 子进程退出
+	EventChildCrashed           = "child_crashed"            // 子进程意外退出
+	EventUpgradeFailed          = "upgrade_failed"           // 更新失败
+	EventRestartBudgetExhausted = "restart_budget_exhausted" // 重启次数用尽
+	EventDaemonStopped          = "daemon_stopped"           // 守护进程退出
+	EventHealthFailed           = "health_failed"            // 健康探测连续失败
+	EventHealthRecovered        = "health_recovered"         // 健康探测恢复
+	EventDrainProgress          = "drain_progress"           // 子进程排空进度，Reason为进度说明
+	EventRestartRequested       = "restart_requested"        // 子进程请求替换自己，Reason为原因
+	EventUpgradeSkipped         = "upgrade_skipped"          // 重复的更新请求被忽略，Reason为原因
+	EventIPCLost                = "ipc_lost"                 // 子进程断开了通信管道但仍在运行，降级为只用信号控制
+	EventStagingFailed          = "staging_failed"           // 蓝绿更新中暂存的子进程未通过检查
+	EventPreflightFailed        = "preflight_failed"         // 派生前的检查失败，Reason为检查名称
+	EventAwaitingConfirm        = "awaiting_confirm"         // 新子进程已准备好，等待手动确认后排空旧子进程
+	EventFdLeak                 = "fd_leak"                  // 子进程的描述符数持续增长并超过阈值，Reason为描述符数
+	EventListenersChanged       = "listeners_changed"        // 重载后侦听集合的变化已随更新生效，Reason为增删的侦听名
+)
+
+// 子进程退出原因
+const (
+	ExitUpgrade = "upgrade" // 被新子进程替换
+	ExitStop    = "stop"    // 守护进程停服
+	ExitCrash   = "crash"   // 意外退出
+)
+
+// Event 生命周期事件
+type Event struct {
+	Type   string     `json:"type"`             // 事件类型
+	Time   time.Time  `json:"time"`             // 发生时间
+	Pid    int        `json:"pid,omitempty"`    // 子进程ID
+	Worker WorkerInfo `json:"worker"`           // 子进程身份
+	Reason string     `json:"reason,omitempty"` // 原因，如子进程退出原因
+	Exit   *ExitInfo  `json:"exit,omitempty"`   // 子进程退出详情
+	Error  string     `json:"error,omitempty"`  // 错误
+	Phase  string     `json:"phase,omitempty"`  // 更新失败时所处的阶段
+	Deploy *Deploy    `json:"deploy,omitempty"` // 生效的部署，更新中为本次更新附带的
+}
+
+// ExitInfo 子进程退出详情，取自os.ProcessState
+type ExitInfo struct {
+	Pid        int           `json:"pid"`              // 子进程ID
+	ExitCode   int           `json:"exit_code"`        // 退出码，被信号终止或未知时为-1
+	Signal     string        `json:"signal,omitempty"` // 终止子进程的信号
+	UserTime   time.Duration `json:"user_time"`        // 用户态CPU时间
+	SystemTime time.Duration `json:"system_time"`      // 内核态CPU时间
+	MaxRSS     int64         `json:"max_rss"`          // 最大常驻内存，字节
+	Error      string        `json:"error,omitempty"`  // Wait返回的错误
+	ExitedAt   time.Time     `json:"exited_at"`        // 退出时间
+}
+
+// processStater 可取得退出状态的进程
+type processStater interface {
+	ProcessState() *os.ProcessState
+}
+
+// ProcessState 退出状态
+func (object *execProcess) ProcessState() *os.ProcessState {
+	return object.cmd.ProcessState
+}
+
+// ProcessState 子进程退出状态，进程未退出或运行器不支持时为nil
+func (object *XCmd) ProcessState() *os.ProcessState {
+	if stater, ok := object.proc.(processStater); ok {
+		return stater.ProcessState()
+	}
+	return nil
+}
+
+// newExitInfo 汇总子进程退出详情
+func newExitInfo(xCmdObj *XCmd, err error) *ExitInfo {
+	info := &ExitInfo{
+		Pid:      xCmdObj.Pid(),
+		ExitCode: -1,
+		ExitedAt: time.Now(),
+	}
+	if nil != err {
+		info.Error = err.Error()
+	}
+	state := xCmdObj.ProcessState()
+	if nil == state {
+		if nil == err {
+			info.ExitCode = 0
+		}
+		return info
+	}
+	info.ExitCode = state.ExitCode()
+	info.UserTime = state.UserTime()
+	info.SystemTime = state.SystemTime()
+	info.fillSys(state)
+	return info
+}
+
+// OnEvent 添加生命周期事件处理函数，在守护进程的协程中同步调用，不应阻塞
+func (object *Daemon) OnEvent(handler func(event Event)) *Daemon {
+	object.eventHandlers = append(object.eventHandlers, handler)
+	return object
+}
+
+// emit 分发事件，工作进程共用主守护进程的处理函数
+func (object *Daemon) emit(event Event) {
+	if 0 == len(event.Type) {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if nil == event.Deploy {
+		event.Deploy = object.deployInfo()
+	}
+	for _, handler := range object.eventHandlers {
+		handler(event)
+	}
+}
@@ -0,0 +1,60 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"os/exec"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+func TestExitInfo(t *testing.T) {
+	xCmdObj := &XCmd{proc: &execProcess{cmd: exec.Command("sh", "-c", "exit 3")}}
+	if err := xCmdObj.Start(); nil != err {
+		t.Fatal(err)
+	}
+	info := newExitInfo(xCmdObj, xCmdObj.Wait())
+	if 3 != info.ExitCode || 0 < len(info.Signal) || 0 >= info.MaxRSS || 0 >= len(info.Error) {
+		t.Fatal(info)
+	}
+
+	xCmdObj = &XCmd{proc: &execProcess{cmd: exec.Command("sh", "-c", "kill -TERM $$")}}
+	if err := xCmdObj.Start(); nil != err {
+		t.Fatal(err)
+	}
+	if info = newExitInfo(xCmdObj, xCmdObj.Wait()); -1 != info.ExitCode || "terminated" != info.Signal {
+		t.Fatal(info)
+	}
+}
+
+func TestChildExitedEvents(t *testing.T) {
+	var lock sync.Mutex
+	var reasons []string
+	object, signalCh, doneCh := startFakeParent(t, withSetup(func(object *Daemon) {
+		object.OnEvent(func(event Event) {
+			lock.Lock()
+			defer lock.Unlock()
+			if EventChildExited == event.Type && nil != event.Exit && event.Pid == event.Exit.Pid {
+				reasons = append(reasons, event.Reason)
+			}
+		})
+	}))
+	if err := object.Upgrade(); nil != err {
+		t.Fatal(err)
+	}
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if 2 != len(reasons) || ExitUpgrade != reasons[0] || ExitStop != reasons[1] {
+		t.Fatal(reasons)
+	}
+	if exit := object.Status().LastExit; nil == exit || 0 != exit.ExitCode {
+		t.Fatal(exit)
+	}
+}
@@ -0,0 +1,32 @@
+package daemon
+
+import (
+	"github.com/golang/glog"
+)
+
+// Windows下子进程以SO_EXCLUSIVEADDRUSE独占绑定侦听，其他进程无法抢占端口，新旧子进程也不能同时绑定；
+// 更新时父进程在新子进程启动后通知旧子进程释放侦听，新子进程在交接期内重试绑定，
+// 启动失败时再通知旧子进程重新绑定。释放期间旧子进程的Accept阻塞，新连接被拒绝
+const (
+	ReleaseListenersRequest   = "ReleaseListeners"   // 父进程通知旧子进程释放独占的侦听
+	ReacquireListenersRequest = "ReacquireListeners" // 新子进程启动失败，父进程通知旧子进程重新绑定
+)
+
+// releaseListeners 通知旧子进程释放独占绑定的侦听，返回是否已通知
+func (object *Daemon) releaseListeners(old *XCmd) bool {
+	if !exclusiveListeners || nil == old || 0 >= len(object.listenerSpecs) {
+		return false
+	}
+	if err := old.ParentWrite([]byte(ReleaseListenersRequest)); nil != err {
+		glog.Errorf("child: %d release listeners: %v", old.Pid(), err)
+		return false
+	}
+	return true
+}
+
+// reacquireListeners 新子进程启动失败，通知旧子进程重新绑定释放的侦听
+func (object *Daemon) reacquireListeners(old *XCmd) {
+	if err := old.ParentWrite([]byte(ReacquireListenersRequest)); nil != err {
+		glog.Errorf("child: %d reacquire listeners: %v", old.Pid(), err)
+	}
+}
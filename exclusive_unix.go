@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+// exclusiveListeners Unix下子进程继承父进程绑定的侦听，新旧子进程共享同一socket，无需交接
+const exclusiveListeners = false
+
+// releaseListeners 侦听由父进程持有，不释放
+func (object *Registry) releaseListeners() {
+}
+
+// reacquireListeners 侦听由父进程持有，不重新绑定
+func (object *Registry) reacquireListeners() {
+}
@@ -0,0 +1,236 @@
+package daemon
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// exclusiveListeners Windows下无法继承侦听，子进程独占绑定，更新时需要交接
+const exclusiveListeners = true
+
+// soExclusiveAddrUse SO_EXCLUSIVEADDRUSE，syscall包未定义，取值为~SO_REUSEADDR
+const soExclusiveAddrUse = ^syscall.SO_REUSEADDR
+
+// handoverRetry 交接期间旧子进程尚未释放端口时的重试策略
+var handoverRetry = BindRetry{
+	Attempts:   50,
+	Backoff:    10 * time.Millisecond,
+	MaxBackoff: 200 * time.Millisecond,
+}
+
+// errReleased 侦听已释放给新子进程
+var errReleased = errors.New("daemon: listener released for handover")
+
+// exclusiveAddr 绑定前设置SO_EXCLUSIVEADDRUSE，其他进程无法以SO_REUSEADDR抢占端口
+func exclusiveAddr(network, address string, c syscall.RawConn) error {
+	var opErr error
+	if err := c.Control(func(fd uintptr) {
+		opErr = syscall.SetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, soExclusiveAddrUse, 1)
+	}); nil != err {
+		return err
+	}
+	return opErr
+}
+
+// releasableSocket 可在交接时释放、失败时重新绑定的socket，释放期间读取阻塞到重新绑定或关闭
+type releasableSocket struct {
+	sync.Mutex
+	bind   func() (io.Closer, error) // 绑定socket，交接期内重试
+	socket io.Closer                 // 当前的socket，释放后为nil
+	bound  chan struct{}             // 释放后重新绑定或关闭时关闭
+	closed bool
+}
+
+// newReleasableSocket 绑定socket
+func newReleasableSocket(bind func() (io.Closer, error)) (*releasableSocket, error) {
+	socket, err := bind()
+	if nil != err {
+		return nil, err
+	}
+	return &releasableSocket{bind: bind, socket: socket, bound: make(chan struct{})}, nil
+}
+
+// acquire 取当前的socket，释放期间等待重新绑定；prev为上次出错的socket，仍为当前的socket时返回其错误
+func (object *releasableSocket) acquire(prev io.Closer, prevErr error) (io.Closer, error) {
+	for {
+		object.Lock()
+		socket, bound, closed := object.socket, object.bound, object.closed
+		object.Unlock()
+		if closed {
+			if nil != prevErr {
+				return nil, prevErr
+			}
+			return nil, net.ErrClosed
+		}
+		if nil != socket && socket == prev {
+			return nil, prevErr
+		}
+		if nil != socket {
+			return socket, nil
+		}
+		<-bound
+	}
+}
+
+// release 释放socket，新子进程随即可以绑定
+func (object *releasableSocket) release() {
+	object.Lock()
+	defer object.Unlock()
+	if object.closed || nil == object.socket {
+		return
+	}
+	object.socket.Close()
+	object.socket = nil
+	object.bound = make(chan struct{})
+}
+
+// reacquire 重新绑定释放的socket
+func (object *releasableSocket) reacquire() error {
+	object.Lock()
+	defer object.Unlock()
+	if object.closed || nil != object.socket {
+		return nil
+	}
+	socket, err := object.bind()
+	if nil != err {
+		return err
+	}
+	object.socket = socket
+	close(object.bound)
+	return nil
+}
+
+// Close 关闭socket，唤醒等待重新绑定的读取
+func (object *releasableSocket) Close() error {
+	object.Lock()
+	defer object.Unlock()
+	if object.closed {
+		return net.ErrClosed
+	}
+	object.closed = true
+	if nil == object.socket {
+		close(object.bound)
+		return nil
+	}
+	return object.socket.Close()
+}
+
+// releasableListener 可交接的面向流的侦听
+type releasableListener struct {
+	*releasableSocket
+	addr net.Addr
+}
+
+// Accept 接受连接，释放期间阻塞到重新绑定
+func (object *releasableListener) Accept() (conn net.Conn, err error) {
+	var socket io.Closer
+	for {
+		if socket, err = object.acquire(socket, err); nil != err {
+			return
+		}
+		if conn, err = socket.(net.Listener).Accept(); nil == err {
+			return
+		}
+	}
+}
+
+// Addr 绑定的地址
+func (object *releasableListener) Addr() net.Addr {
+	return object.addr
+}
+
+// releasablePacketConn 可交接的面向报文的侦听，读写期限只作用于当前的socket
+type releasablePacketConn struct {
+	*releasableSocket
+	addr net.Addr
+}
+
+// ReadFrom 读取报文，释放期间阻塞到重新绑定
+func (object *releasablePacketConn) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
+	var socket io.Closer
+	for {
+		if socket, err = object.acquire(socket, err); nil != err {
+			return
+		}
+		if n, addr, err = socket.(net.PacketConn).ReadFrom(p); nil == err {
+			return
+		}
+	}
+}
+
+// current 当前的socket，释放期间返回errReleased
+func (object *releasablePacketConn) current() (net.PacketConn, error) {
+	object.Lock()
+	defer object.Unlock()
+	if object.closed {
+		return nil, net.ErrClosed
+	}
+	if nil == object.socket {
+		return nil, errReleased
+	}
+	return object.socket.(net.PacketConn), nil
+}
+
+// WriteTo 发送报文，释放期间返回errReleased
+func (object *releasablePacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	conn, err := object.current()
+	if nil != err {
+		return 0, err
+	}
+	return conn.WriteTo(p, addr)
+}
+
+// LocalAddr 绑定的地址
+func (object *releasablePacketConn) LocalAddr() net.Addr {
+	return object.addr
+}
+
+// SetDeadline 设置当前socket的读写期限
+func (object *releasablePacketConn) SetDeadline(t time.Time) error {
+	conn, err := object.current()
+	if nil != err {
+		return err
+	}
+	return conn.SetDeadline(t)
+}
+
+// SetReadDeadline 设置当前socket的读期限
+func (object *releasablePacketConn) SetReadDeadline(t time.Time) error {
+	conn, err := object.current()
+	if nil != err {
+		return err
+	}
+	return conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline 设置当前socket的写期限
+func (object *releasablePacketConn) SetWriteDeadline(t time.Time) error {
+	conn, err := object.current()
+	if nil != err {
+		return err
+	}
+	return conn.SetWriteDeadline(t)
+}
+
+// releaseListeners 释放独占绑定的侦听，交给新子进程；sockets绑定后不再改变，无需持锁
+func (object *Registry) releaseListeners() {
+	for _, socket := range object.sockets {
+		socket.(interface{ release() }).release()
+	}
+	glog.Info("listeners released for handover")
+}
+
+// reacquireListeners 新子进程启动失败，重新绑定释放的侦听
+func (object *Registry) reacquireListeners() {
+	for name, socket := range object.sockets {
+		if err := socket.(interface{ reacquire() error }).reacquire(); nil != err {
+			glog.Errorf("listener %s reacquire: %v", name, err)
+		}
+	}
+}
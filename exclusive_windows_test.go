@@ -0,0 +1,62 @@
+package daemon
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestExclusiveListeners(t *testing.T) {
+	infos, sockets, err := Default().childListeners([]ListenerInfo{
+		{ListenerSpec: ListenerSpec{Name: "web", Network: "tcp", Address: "127.0.0.1:0"}},
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	registry := newRegistry(infos)
+	registry.sockets = sockets
+	ln, err := registry.Listener("web")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	address := infos[0].Address
+
+	// 独占绑定时其他进程无法抢占端口
+	if other, e := net.Listen("tcp", address); nil == e {
+		other.Close()
+		t.Fatal("exclusive listener stolen")
+	}
+
+	// 释放后新子进程可以绑定，释放期间Accept阻塞
+	acceptCh := make(chan error, 1)
+	registry.releaseListeners()
+	go func() {
+		conn, e := ln.Accept()
+		if nil == e {
+			conn.Close()
+		}
+		acceptCh <- e
+	}()
+	other, err := net.Listen("tcp", address)
+	if nil != err {
+		t.Fatal(err)
+	}
+	other.Close()
+	select {
+	case err = <-acceptCh:
+		t.Fatal("accept returned while released", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// 重新绑定后继续接受连接
+	registry.reacquireListeners()
+	conn, err := net.Dial("tcp", address)
+	if nil != err {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if err = <-acceptCh; nil != err {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,46 @@
+package daemon
+
+import "sync/atomic"
+
+// ExhaustedPolicy 重启次数用尽后的处理策略
+type ExhaustedPolicy int
+
+// 重启次数用尽后的处理策略，任何策略下都会先分发EventRestartBudgetExhausted，
+// 可用OnEvent注册回调或用AddWebhook告警
+const (
+	ExhaustedExit   ExhaustedPolicy = iota // 停止其他工作进程、清理后以指定退出码退出
+	ExhaustedReturn                        // 清理后由Bootstrap返回ErrRestartBudgetExhausted
+	ExhaustedIdle                          // 守护进程保持运行但不再派生子进程，可通过更新恢复
+)
+
+// StatusFailed 重启次数用尽，守护进程空闲等待更新或停服
+const StatusFailed = "failed"
+
+// SetExhaustedPolicy 设置重启次数用尽后的处理策略，exitCode仅用于ExhaustedExit
+func (object *Daemon) SetExhaustedPolicy(policy ExhaustedPolicy, exitCode int) *Daemon {
+	object.exhaustedPolicy = policy
+	object.exhaustedExitCode = exitCode
+	return object
+}
+
+// resetRebootTimes 空闲后更新成功，恢复各工作进程的重启次数
+func (object *Daemon) resetRebootTimes(limit int) {
+	atomic.StoreInt32(&object.rebootTimes, int32(limit))
+	object.workersLock.Lock()
+	defer object.workersLock.Unlock()
+	for _, worker := range object.workers {
+		atomic.StoreInt32(&worker.rebootTimes, int32(limit))
+	}
+}
+
+// notifyExhausted 通知主循环重启次数用尽，工作进程交给主守护进程处理
+func (object *Daemon) notifyExhausted() {
+	target := object
+	if nil != object.primary {
+		target = object.primary
+	}
+	select {
+	case target.exhaustedCh <- object.workerIndex:
+	default:
+	}
+}
@@ -0,0 +1,75 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+)
+
+// crashingChild 前crashes个子进程准备好后立即崩溃
+func crashingChild(crashes int32) func(xCmdObj *XCmd, args []string) error {
+	return func(xCmdObj *XCmd, args []string) error {
+		if 0 <= atomic.AddInt32(&crashes, -1) {
+			xCmdObj.ChildWrite([]byte(ReadyOK))
+			return errors.New("crash")
+		}
+		return fakeChild(xCmdObj, args)
+	}
+}
+
+// newCrashingDaemon 子进程按crashingChild崩溃，不重启
+func newCrashingDaemon(t *testing.T, crashes int32) *Daemon {
+	dir := t.TempDir()
+	object := New("child", "upgrade", "bootstrap_args",
+		filepath.Join(dir, "logs"),
+		filepath.Join(dir, "pid")).
+		SetProcessRunner(NewFakeRunner(crashingChild(crashes))).
+		SetRebootTimes(0)
+	object.origArgs = []string{"app"}
+	return object
+}
+
+func TestExhaustedReturn(t *testing.T) {
+	exhausted := int32(0)
+	object := newCrashingDaemon(t, 1).
+		SetExhaustedPolicy(ExhaustedReturn, 0).
+		OnEvent(func(event Event) {
+			if EventRestartBudgetExhausted == event.Type {
+				atomic.AddInt32(&exhausted, 1)
+			}
+		})
+	err := object.runAsParent(make(chan os.Signal, 1))
+	if !errors.Is(err, ErrRestartBudgetExhausted) || 1 != atomic.LoadInt32(&exhausted) {
+		t.Fatal(err, exhausted)
+	}
+	if StatusStopped != object.Status().Phase {
+		t.Fatal(object.Status())
+	}
+}
+
+func TestExhaustedIdle(t *testing.T) {
+	object, signalCh, doneCh := startFakeParent(t, withChild(crashingChild(1)), withSetup(func(object *Daemon) {
+		object.SetRebootTimes(0).SetExhaustedPolicy(ExhaustedIdle, 0)
+	}), withReady(func(object *Daemon) bool {
+		return StatusFailed == object.Status().Phase
+	}))
+
+	// 更新后恢复运行与重启次数
+	if err := object.Upgrade(); nil != err {
+		t.Fatal(err)
+	}
+	if StatusRunning != object.Status().Phase || 0 != atomic.LoadInt32(&object.rebootTimes) {
+		t.Fatal(object.Status(), atomic.LoadInt32(&object.rebootTimes))
+	}
+
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// fillSys 终止信号与最大常驻内存
+func (object *ExitInfo) fillSys(state *os.ProcessState) {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		object.Signal = status.Signal().String()
+	}
+	if usage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		// darwin单位为字节，其他系统为KB
+		object.MaxRSS = int64(usage.Maxrss)
+		if "darwin" != runtime.GOOS {
+			object.MaxRSS *= 1024
+		}
+	}
+}
@@ -0,0 +1,7 @@
+package daemon
+
+import "os"
+
+// fillSys Windows没有终止信号，Wait后进程句柄已关闭，取不到最大常驻内存
+func (object *ExitInfo) fillSys(state *os.ProcessState) {
+}
@@ -0,0 +1,133 @@
+package daemon
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// FakeRunner 模拟进程运行器，子进程逻辑在协程中运行并通过内存管道通信，
+// 用于在不派生真实进程的情况下测试更新、崩溃重启与退出流程
+type FakeRunner struct {
+	sync.Mutex
+	child   func(xCmdObj *XCmd, args []string) error // 子进程逻辑，返回值作为Wait结果
+	nextPid int                                      // 下一个进程ID
+	spawned int                                      // 已启动进程数
+	signals []os.Signal                              // 收到的信号，不含os.Kill
+}
+
+// NewFakeRunner 工厂方法
+func NewFakeRunner(child func(xCmdObj *XCmd, args []string) error) *FakeRunner {
+	return &FakeRunner{
+		child:   child,
+		nextPid: 10000,
+	}
+}
+
+// Spawned 已启动进程数
+func (object *FakeRunner) Spawned() int {
+	object.Lock()
+	defer object.Unlock()
+	return object.spawned
+}
+
+// Signals 子进程收到的信号，不含os.Kill
+func (object *FakeRunner) Signals() []os.Signal {
+	object.Lock()
+	defer object.Unlock()
+	return append([]os.Signal(nil), object.signals...)
+}
+
+// Command 构建命令，父子两端各自持有管道的一端
+func (object *FakeRunner) Command(name string, arg ...string) (*XCmd, error) {
+	toChild := NewMemXPipe()
+	toParent := NewMemXPipe()
+	parent := &XCmd{
+		Cmd:       exec.Command(name, arg...),
+		nextFd:    4,
+		readPipe:  toParent.ReadEnd(),
+		writePipe: toChild.WriteEnd(),
+	}
+	parent.proc = &fakeProcess{
+		runner: object,
+		cmd:    parent.Cmd,
+		child: &XCmd{
+			readPipe:  toChild.ReadEnd(),
+			writePipe: toParent.WriteEnd(),
+		},
+		doneCh: make(chan struct{}),
+		killCh: make(chan struct{}),
+	}
+	return parent, nil
+}
+
+// fakeProcess 模拟进程
+type fakeProcess struct {
+	runner   *FakeRunner
+	cmd      *exec.Cmd
+	child    *XCmd
+	pid      int
+	err      error
+	doneCh   chan struct{}
+	killCh   chan struct{}
+	killOnce sync.Once
+}
+
+// Start 在协程中运行子进程逻辑
+func (object *fakeProcess) Start() error {
+	object.runner.Lock()
+	object.pid = object.runner.nextPid
+	object.runner.nextPid++
+	object.runner.spawned++
+	object.runner.Unlock()
+
+	args := make([]string, len(object.cmd.Args))
+	copy(args, object.cmd.Args)
+	go func() {
+		defer close(object.doneCh)
+		object.err = object.runner.child(object.child, args)
+		object.child.Close()
+	}()
+	return nil
+}
+
+// Wait 等待子进程逻辑返回或被强杀
+func (object *fakeProcess) Wait() error {
+	select {
+	case <-object.doneCh:
+		return object.err
+	case <-object.killCh:
+		return errors.New("signal: killed")
+	}
+}
+
+// Kill 强杀，关闭子进程一端的管道
+func (object *fakeProcess) Kill() error {
+	object.killOnce.Do(func() {
+		close(object.killCh)
+		object.child.Close()
+	})
+	return nil
+}
+
+// Signal 发送信号，模拟os.Kill，其他信号只记录
+func (object *fakeProcess) Signal(sig os.Signal) error {
+	if os.Kill == sig {
+		return object.Kill()
+	}
+	object.runner.Lock()
+	object.runner.signals = append(object.runner.signals, sig)
+	object.runner.Unlock()
+	return nil
+}
+
+// Release 释放资源
+func (object *fakeProcess) Release() error {
+	return nil
+}
+
+// Pid 进程ID
+func (object *fakeProcess) Pid() int {
+	return object.pid
+}
@@ -0,0 +1,96 @@
+package daemon
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// 侦听的地址族，ListenerOptions.IPFamily取前四个，ListenerInfo.Family为绑定后实际的地址族
+const (
+	IPFamilyAuto = ""     // 按网络与地址，Go的默认行为
+	IPFamilyV4   = "ipv4" // 只侦听IPv4，通配地址为0.0.0.0
+	IPFamilyV6   = "ipv6" // 只侦听IPv6（IPV6_V6ONLY=1），通配地址为::
+	IPFamilyDual = "dual" // 双栈（IPV6_V6ONLY=0），在::上同时接受IPv4连接
+	IPFamilyUnix = "unix" // unix域socket
+)
+
+// applyFamily 按IPFamily改写绑定用的网络与地址，非tcp/udp侦听不变；
+// 通配地址改写为对应地址族的通配地址，具体地址与地址族不符时报错
+func applyFamily(spec ListenerSpec) (network, address string, err error) {
+	network, address = spec.Network, spec.Address
+	family := spec.Options.IPFamily
+	base := strings.TrimRight(spec.Network, "46")
+	if IPFamilyAuto == family || ("tcp" != base && "udp" != base) {
+		return
+	}
+	var host, port string
+	if host, port, err = net.SplitHostPort(spec.Address); nil != err {
+		return
+	}
+	ip := net.ParseIP(host)
+	wildcard := 0 >= len(host) || (nil != ip && ip.IsUnspecified())
+	switch family {
+	case IPFamilyV4:
+		network = base + "4"
+		if wildcard {
+			host = "0.0.0.0"
+		} else if nil != ip && nil == ip.To4() {
+			err = fmt.Errorf("daemon: %s is not an ipv4 address", host)
+		}
+	case IPFamilyV6:
+		network = base + "6"
+		if wildcard {
+			host = "::"
+		} else if nil != ip && nil != ip.To4() {
+			err = fmt.Errorf("daemon: %s is not an ipv6 address", host)
+		}
+	case IPFamilyDual:
+		// Go在未限定地址族的网络上绑定IPv6通配地址时关闭IPV6_V6ONLY
+		network = base
+		if !wildcard {
+			err = fmt.Errorf("daemon: dual stack needs a wildcard address, got %s", host)
+		}
+		host = "::"
+	default:
+		err = fmt.Errorf("daemon: unknown ip family %q", family)
+	}
+	address = net.JoinHostPort(host, port)
+	return
+}
+
+// addressFamily 按网络与地址推断绑定后的地址族，无法读取socket时使用
+func addressFamily(network, address string) string {
+	if isUnixNetwork(network) {
+		return IPFamilyUnix
+	}
+	if strings.HasSuffix(network, "4") {
+		return IPFamilyV4
+	}
+	if strings.HasSuffix(network, "6") {
+		return IPFamilyV6
+	}
+	host, _, err := net.SplitHostPort(address)
+	if nil != err {
+		return ""
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case nil == ip:
+		return ""
+	case nil != ip.To4():
+		return IPFamilyV4
+	case ip.IsUnspecified():
+		return IPFamilyDual
+	}
+	return IPFamilyV6
+}
+
+// isUnixNetwork 是否为unix域socket
+func isUnixNetwork(network string) bool {
+	switch network {
+	case "unix", "unixgram", "unixpacket":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"net"
+	"testing"
+)
+
+func TestApplyFamily(t *testing.T) {
+	for _, c := range []struct {
+		network, address, family string
+		wantNetwork, wantAddress string
+		fail                     bool
+	}{
+		{"tcp", "0.0.0.0:80", IPFamilyAuto, "tcp", "0.0.0.0:80", false},
+		{"tcp", "0.0.0.0:80", IPFamilyV4, "tcp4", "0.0.0.0:80", false},
+		{"tcp", ":80", IPFamilyV6, "tcp6", "[::]:80", false},
+		{"udp6", "0.0.0.0:53", IPFamilyDual, "udp", "[::]:53", false},
+		{"tcp", "[::]:80", IPFamilyV4, "tcp4", "0.0.0.0:80", false},
+		{"tcp", "[::1]:80", IPFamilyV4, "", "", true},
+		{"tcp", "127.0.0.1:80", IPFamilyV6, "", "", true},
+		{"tcp", "127.0.0.1:80", IPFamilyDual, "", "", true},
+		{"tcp", ":80", "ipv5", "", "", true},
+		{"unix", "/run/app.sock", IPFamilyV6, "unix", "/run/app.sock", false},
+	} {
+		spec := ListenerSpec{Name: "web", Network: c.network, Address: c.address, Options: ListenerOptions{IPFamily: c.family}}
+		network, address, err := applyFamily(spec)
+		if c.fail {
+			if nil == err {
+				t.Fatal(c, network, address)
+			}
+			continue
+		}
+		if nil != err || c.wantNetwork != network || c.wantAddress != address {
+			t.Fatal(c, network, address, err)
+		}
+	}
+}
+
+func TestListenFamily(t *testing.T) {
+	if ln, err := net.Listen("tcp6", "[::1]:0"); nil != err {
+		t.Skip("ipv6 unavailable:", err)
+	} else {
+		ln.Close()
+	}
+	object := Default().SetListeners(
+		ListenerSpec{Name: "v4", Network: "tcp", Address: ":0", Options: ListenerOptions{IPFamily: IPFamilyV4}},
+		ListenerSpec{Name: "v6", Network: "tcp", Address: ":0", Options: ListenerOptions{IPFamily: IPFamilyV6}},
+		ListenerSpec{Name: "dual", Network: "tcp", Address: "0.0.0.0:0", Options: ListenerOptions{IPFamily: IPFamilyDual}},
+	)
+	specs, lnFiles, err := object.listen(object.listenerSpecs)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, f := range lnFiles {
+			f.Close()
+		}
+	}()
+	want := map[string]string{"v4": IPFamilyV4, "v6": IPFamilyV6, "dual": IPFamilyDual}
+	for _, spec := range specs {
+		if family := socketFamily(int(lnFiles[spec.Name].Fd())); want[spec.Name] != family {
+			t.Fatal(spec, family)
+		}
+		if family := addressFamily(spec.Network, spec.Address); want[spec.Name] != family {
+			t.Fatal(spec, family)
+		}
+	}
+}
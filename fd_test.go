@@ -0,0 +1,139 @@
+//go:build linux
+// +build linux
+
+package daemon
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// openFds 当前进程打开的fd数
+func openFds(t *testing.T) int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if nil != err {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
+
+func TestXCmdNoFdLeak(t *testing.T) {
+	before := openFds(t)
+	for i := 0; i < 10; i++ {
+		xCmdObj, err := NewXCmd("true")
+		if nil != err {
+			t.Fatal(err)
+		}
+		if err = xCmdObj.Start(); nil != err {
+			t.Fatal(err)
+		}
+		xCmdObj.Wait()
+		// 父进程只持有本端的两个管道端
+		if n := openFds(t) - before; 2 != n {
+			t.Fatal("fds held after start:", n)
+		}
+		xCmdObj.Close()
+	}
+	if after := openFds(t); before != after {
+		t.Fatal(before, after)
+	}
+}
+
+func TestListenFailureNoFdLeak(t *testing.T) {
+	// 先初始化网络轮询器
+	if ln, err := net.Listen("tcp", "127.0.0.1:0"); nil == err {
+		ln.Close()
+	}
+	before := openFds(t)
+	_, _, err := Default().listen([]ListenerSpec{
+		{Name: "web", Network: "tcp", Address: "127.0.0.1:0"},
+		{Name: "bad", Network: "tcp", Address: "256.0.0.1:0"},
+	})
+	if nil == err {
+		t.Fatal("bind to invalid address succeeded")
+	}
+	if after := openFds(t); before != after {
+		t.Fatal(before, after)
+	}
+}
+
+func TestUpgradeNoFdLeak(t *testing.T) {
+	object, _, doneCh := startFakeParent(t, withSetup(func(object *Daemon) {
+		object.SetListeners(ListenerSpec{Name: "web", Network: "tcp", Address: "127.0.0.1:0"})
+	}))
+
+	// 首次更新后打开的文件数不再增长
+	if err := object.ForceUpgrade(); nil != err {
+		t.Fatal(err)
+	}
+	before := openFds(t)
+	for i := 0; i < 10; i++ {
+		if err := object.ForceUpgrade(); nil != err {
+			t.Fatal(err)
+		}
+	}
+	if after := openFds(t); before < after {
+		t.Fatal(before, after)
+	}
+
+	if err := object.execCommand(ExitRequest); nil != err {
+		t.Fatal(err)
+	}
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+}
+
+func TestListenHoldsOnlyFiles(t *testing.T) {
+	if ln, err := net.Listen("tcp", "127.0.0.1:0"); nil == err {
+		ln.Close()
+	}
+	sock := filepath.Join(t.TempDir(), "web.sock")
+	before := openFds(t)
+	_, lnFiles, err := Default().listen([]ListenerSpec{
+		{Name: "web", Network: "tcp", Address: "127.0.0.1:0"},
+		{Name: "unix", Network: "unix", Address: sock},
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	// 每个侦听只剩导出的文件，unix socket路径保留
+	if n := openFds(t) - before; 2 != n {
+		t.Fatal("fds held:", n)
+	}
+	if _, err = os.Stat(sock); nil != err {
+		t.Fatal(err)
+	}
+	for _, f := range lnFiles {
+		f.Close()
+	}
+}
+
+func TestPassPipeKey(t *testing.T) {
+	xCmdObj, err := NewXCmd("true")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer xCmdObj.Close()
+	key, fd, err := passPipeKey(xCmdObj)
+	if nil != err {
+		t.Fatal(err)
+	}
+	// 子进程继承的fd紧随管道之后
+	if 5 != fd || pipeKeySize != len(key) {
+		t.Fatal(fd, len(key))
+	}
+	r := xCmdObj.ExtraFiles[len(xCmdObj.ExtraFiles)-1]
+	dup, err := syscall.Dup(int(r.Fd()))
+	if nil != err {
+		t.Fatal(err)
+	}
+	got, err := readPipeKey(dup)
+	if nil != err || !bytes.Equal(key, got) {
+		t.Fatal(err, got)
+	}
+}
@@ -0,0 +1,69 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyListenerFds(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lnFile, err := ln.(*net.TCPListener).File()
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer lnFile.Close()
+	unixLn, err := net.Listen("unix", filepath.Join(t.TempDir(), "admin.sock"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer unixLn.Close()
+	unixFile, err := unixLn.(*net.UnixListener).File()
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer unixFile.Close()
+
+	web := ListenerInfo{ListenerSpec: ListenerSpec{Name: "web", Network: "tcp", Address: ln.Addr().String()}, Fd: int(lnFile.Fd())}
+	admin := ListenerInfo{ListenerSpec: ListenerSpec{Name: "admin", Network: "unix", Address: unixLn.Addr().String()}, Fd: int(unixFile.Fd())}
+	if err = verifyListenerFds([]ListenerInfo{web, admin}); nil != err {
+		t.Fatal(err)
+	}
+
+	// 类型、地址族或地址不符
+	for _, info := range []ListenerInfo{
+		{ListenerSpec: ListenerSpec{Name: "web", Network: "udp", Address: web.Address}, Fd: web.Fd},
+		{ListenerSpec: ListenerSpec{Name: "web", Network: "tcp6", Address: web.Address}, Fd: web.Fd},
+		{ListenerSpec: ListenerSpec{Name: "web", Network: "tcp", Address: "127.0.0.1:1"}, Fd: web.Fd},
+		{ListenerSpec: ListenerSpec{Name: "web", Network: "tcp", Address: web.Address}, Fd: admin.Fd},
+	} {
+		if err = verifyListenerFds([]ListenerInfo{info}); nil == err ||
+			!strings.Contains(err.Error(), "listener 'web' missing or not a "+info.Network+" socket") {
+			t.Fatal(info, err)
+		}
+	}
+
+	// fd被关闭或不是socket
+	r, w, err := os.Pipe()
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	web.Fd = int(r.Fd())
+	if err = verifyListenerFds([]ListenerInfo{web}); nil == err {
+		t.Fatal("pipe accepted")
+	}
+	r.Close()
+	if err = verifyListenerFds([]ListenerInfo{web}); nil == err {
+		t.Fatal("closed fd accepted")
+	}
+}
@@ -0,0 +1,109 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// verifyListenerFds 核对继承的侦听fd仍然存在，socket类型与地址族符合描述，绑定的地址与父进程一致，
+// 防止被应用或第三方库关闭、设置了CLOEXEC后丢失，或被其他文件复用
+func verifyListenerFds(infos []ListenerInfo) error {
+	for _, info := range infos {
+		if 0 >= info.Fd {
+			continue
+		}
+		if err := verifyListenerFd(info); nil != err {
+			return fmt.Errorf("fd %d for listener '%s' missing or not a %s socket: %w", info.Fd, info.Name, info.Network, err)
+		}
+	}
+	return nil
+}
+
+// verifyListenerFd 核对一个侦听fd
+func verifyListenerFd(info ListenerInfo) error {
+	sa, err := syscall.Getsockname(info.Fd)
+	if nil != err {
+		return err
+	}
+	sotype, err := syscall.GetsockoptInt(info.Fd, syscall.SOL_SOCKET, syscall.SO_TYPE)
+	if nil != err {
+		return err
+	}
+	wantType := syscall.SOCK_STREAM
+	switch info.Network {
+	case "udp", "udp4", "udp6", "unixgram":
+		wantType = syscall.SOCK_DGRAM
+	case "unixpacket":
+		wantType = syscall.SOCK_SEQPACKET
+	}
+	if wantType != sotype {
+		return fmt.Errorf("socket type %d, expected %d", sotype, wantType)
+	}
+
+	var addr string
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		if "tcp6" == info.Network || "udp6" == info.Network || isUnixNetwork(info.Network) {
+			return fmt.Errorf("address family inet4")
+		}
+		addr = net.JoinHostPort(net.IP(sa.Addr[:]).String(), strconv.Itoa(sa.Port))
+	case *syscall.SockaddrInet6:
+		if "tcp4" == info.Network || "udp4" == info.Network || isUnixNetwork(info.Network) {
+			return fmt.Errorf("address family inet6")
+		}
+		addr = net.JoinHostPort(net.IP(sa.Addr[:]).String(), strconv.Itoa(sa.Port))
+	case *syscall.SockaddrUnix:
+		if !isUnixNetwork(info.Network) {
+			return fmt.Errorf("address family unix")
+		}
+		addr = sa.Name
+	default:
+		return fmt.Errorf("unexpected address family %T", sa)
+	}
+	if 0 < len(info.Address) && !sameAddress(info.Address, addr) {
+		return fmt.Errorf("bound to %s, expected %s", addr, info.Address)
+	}
+	return nil
+}
+
+// sameAddress 地址是否相同，IP按值比较，兼容IPv4映射的IPv6地址
+func sameAddress(expected, actual string) bool {
+	if expected == actual {
+		return true
+	}
+	eHost, ePort, err := net.SplitHostPort(expected)
+	if nil != err {
+		return false
+	}
+	aHost, aPort, err := net.SplitHostPort(actual)
+	if nil != err || ePort != aPort {
+		return false
+	}
+	eIP, aIP := net.ParseIP(eHost), net.ParseIP(aHost)
+	return nil != eIP && eIP.Equal(aIP)
+}
+
+// socketFamily 侦听fd实际的地址族，IPv6 socket按IPV6_V6ONLY区分ipv6与dual
+func socketFamily(fd int) string {
+	sa, err := syscall.Getsockname(fd)
+	if nil != err {
+		return ""
+	}
+	switch sa.(type) {
+	case *syscall.SockaddrInet4:
+		return IPFamilyV4
+	case *syscall.SockaddrInet6:
+		if v6only, err := syscall.GetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_V6ONLY); nil == err && 0 == v6only {
+			return IPFamilyDual
+		}
+		return IPFamilyV6
+	case *syscall.SockaddrUnix:
+		return IPFamilyUnix
+	}
+	return ""
+}
@@ -0,0 +1,6 @@
+package daemon
+
+// verifyListenerFds Windows下子进程自行绑定侦听，无需核对
+func verifyListenerFds(infos []ListenerInfo) error {
+	return nil
+}
@@ -0,0 +1,78 @@
+package daemon
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+)
+
+// FdLeakPolicy 子进程文件描述符泄漏告警，依赖SetProcessStats的采样，
+// 在accept因描述符耗尽失败之前发现泄漏
+type FdLeakPolicy struct {
+	Threshold int  // 描述符数达到该值才告警
+	Samples   int  // 连续增长的采样次数，期间不能下降，默认3
+	Replace   bool // 告警后按强制更新的流程优雅替换子进程
+}
+
+// fdTrend 单个子进程描述符数的变化趋势
+type fdTrend struct {
+	last    int  // 上次采样的描述符数
+	growth  int  // 连续增长的次数
+	alerted bool // 已告警，降到阈值以下前不重复
+}
+
+// SetFdLeakAlert 设置描述符泄漏告警，需同时开启SetProcessStats
+func (object *Daemon) SetFdLeakAlert(policy FdLeakPolicy) *Daemon {
+	if 0 >= policy.Samples {
+		policy.Samples = 3
+	}
+	object.fdLeak = &policy
+	return object
+}
+
+// next 按本次采样更新趋势，返回是否需要告警
+func (object fdTrend) next(fds int, policy *FdLeakPolicy) (trend fdTrend, alert bool) {
+	trend = object
+	switch {
+	case fds > trend.last:
+		trend.growth++
+	case fds < trend.last:
+		trend.growth = 0
+	}
+	trend.last = fds
+	if fds < policy.Threshold {
+		trend.alerted = false
+		return
+	}
+	if trend.alerted || trend.growth < policy.Samples {
+		return
+	}
+	trend.alerted = true
+	return trend, true
+}
+
+// checkFdLeak 检查一个子进程的描述符趋势，trends为上次采样的趋势
+func (object *Daemon) checkFdLeak(xCmdObj *XCmd, fds int, trends map[int]fdTrend) fdTrend {
+	pid := xCmdObj.Pid()
+	prev, ok := trends[pid]
+	if !ok {
+		// 首次采样只记录基线
+		return fdTrend{last: fds}
+	}
+	trend, alert := prev.next(fds, object.fdLeak)
+	if !alert {
+		return trend
+	}
+	reason := fmt.Sprintf("%d fds, growing for %d samples", fds, trend.growth)
+	glog.Warningf("child: %d possible fd leak: %s", pid, reason)
+	object.emit(Event{
+		Type:   EventFdLeak,
+		Pid:    pid,
+		Worker: xCmdObj.worker,
+		Reason: reason,
+	})
+	if object.fdLeak.Replace {
+		object.requestRestart(xCmdObj, "fd leak: "+reason)
+	}
+	return trend
+}
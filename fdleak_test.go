@@ -0,0 +1,54 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"testing"
+)
+
+func TestFdTrend(t *testing.T) {
+	policy := &FdLeakPolicy{Threshold: 10, Samples: 3}
+	var trend fdTrend
+	var alerts []int
+	for i, fds := range []int{5, 8, 7, 9, 11, 12, 13, 14, 15, 4, 12, 13, 14} {
+		var alert bool
+		if trend, alert = trend.next(fds, policy); alert {
+			alerts = append(alerts, i)
+		}
+	}
+	// 下降后重新计数，告警后降到阈值以下才能再次告警
+	if 2 != len(alerts) || 5 != alerts[0] || 12 != alerts[1] {
+		t.Fatal(alerts)
+	}
+}
+
+func TestFdLeakAlert(t *testing.T) {
+	object, _ := newFakeDaemon(fakeChild)
+	var events []Event
+	object.SetFdLeakAlert(FdLeakPolicy{Threshold: 20, Replace: true}).OnEvent(func(event Event) {
+		events = append(events, event)
+	})
+	if ok, err := object.replaceChildProcess(nil); !ok || nil != err {
+		t.Fatal(ok, err)
+	}
+	defer stopFakeDaemon(t, object)
+	child := object.currentChild()
+	trends := map[int]fdTrend{}
+	for _, fds := range []int{18, 19, 20, 21, 22} {
+		trends = map[int]fdTrend{child.Pid(): object.checkFdLeak(child, fds, trends)}
+	}
+	// 首次采样为基线，第4次采样时已连续增长3次，告警后请求替换
+	if 2 != len(events) || EventFdLeak != events[0].Type || child.Pid() != events[0].Pid ||
+		EventRestartRequested != events[1].Type {
+		t.Fatal(events)
+	}
+	select {
+	case cmd := <-object.controlCh:
+		if ForceUpgradeRequest != cmd.action {
+			t.Fatal(cmd.action)
+		}
+	default:
+		t.Fatal("no replacement requested")
+	}
+}
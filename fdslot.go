@@ -0,0 +1,94 @@
+package daemon
+
+import (
+	"os"
+	"strings"
+)
+
+// 命名的fd槽位：父进程登记名字->子进程fd并写入引导参数，子进程只按名字查找。
+// Unix下子进程fd的布局：3、4为通信管道(socketpair时只有3)，其后依次为通信密钥、侦听、
+// 分发连接的socket与AddExtraFile登记的文件；编号取决于开启的功能与添加顺序，属于实现细节
+const (
+	fdSlotPipeKey        = "daemon:pipe-key" // 通信密钥
+	fdSlotHandoff        = "daemon:handoff"  // 接收父进程分发的连接
+	fdSlotListenerPrefix = "listener:"       // 侦听，后接侦听名
+	fdSlotFilePrefix     = "file:"           // AddExtraFile登记的文件，后接文件名
+)
+
+// extraFile 登记的继承文件
+type extraFile struct {
+	name string
+	file *os.File
+}
+
+// AddExtraFile 登记子进程继承的文件，如预先打开的设备或共享内存文件；
+// 每个子进程都继承同一个文件，父进程持有f直到退出，子进程以Registry.File按名字取得，
+// 不要直接修改XCmd.ExtraFiles，以免与通信管道等守护进程管理的fd冲突
+func (object *Daemon) AddExtraFile(name string, f *os.File) *Daemon {
+	object.extraFiles = append(object.extraFiles, extraFile{name: name, file: f})
+	return object
+}
+
+// passExtraFiles 传递登记的文件
+func (object *Daemon) passExtraFiles(xCmdObj *XCmd) {
+	for _, extra := range object.extraFiles {
+		xCmdObj.AddNamedFile(fdSlotFilePrefix+extra.name, extra.file)
+	}
+}
+
+// listenerSlot 侦听的槽位名
+func listenerSlot(name string) string {
+	return fdSlotListenerPrefix + name
+}
+
+// AddNamedFile 添加命名的文件，返回子进程中的fd
+func (object *XCmd) AddNamedFile(name string, f *os.File) int {
+	fd := object.AddFile(f).NextFd()
+	if nil == object.fdSlots {
+		object.fdSlots = make(map[string]int)
+	}
+	object.fdSlots[name] = fd
+	return fd
+}
+
+// resolveFds 按命名槽位改写侦听、密钥与分发连接的fd；旧版父进程未传槽位时沿用按位置的fd
+func (object *bootstrapMeta) resolveFds() {
+	if 0 >= len(object.Fds) {
+		return
+	}
+	if fd, ok := object.Fds[fdSlotPipeKey]; ok {
+		object.Key = fd
+	}
+	if fd, ok := object.Fds[fdSlotHandoff]; ok {
+		object.Handoff = fd
+	}
+	for i := range object.Listeners {
+		if fd, ok := object.Fds[listenerSlot(object.Listeners[i].Name)]; ok {
+			object.Listeners[i].Fd = fd
+		}
+	}
+}
+
+// Fd 按名字查找父进程传入的fd：先按侦听名，再按AddExtraFile登记的文件名，最后按槽位名
+func (object *Registry) Fd(name string) (fd int, ok bool) {
+	if fd, ok = object.fdSlots[listenerSlot(name)]; ok {
+		return
+	}
+	if fd, ok = object.fdSlots[fdSlotFilePrefix+name]; ok {
+		return
+	}
+	if strings.HasPrefix(name, fdSlotListenerPrefix) || strings.HasPrefix(name, fdSlotFilePrefix) {
+		return
+	}
+	fd, ok = object.fdSlots[name]
+	return
+}
+
+// File 父进程以AddExtraFile登记的文件，各次调用返回的*os.File共用同一fd，关闭后fd即失效
+func (object *Registry) File(name string) (f *os.File, ok bool) {
+	var fd int
+	if fd, ok = object.fdSlots[fdSlotFilePrefix+name]; !ok {
+		return
+	}
+	return os.NewFile(uintptr(fd), name), true
+}
@@ -0,0 +1,104 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNamedFdSlots(t *testing.T) {
+	dir := t.TempDir()
+	var meta bootstrapMeta
+	object := New("child", "upgrade", "bootstrap_args",
+		filepath.Join(dir, "logs"),
+		filepath.Join(dir, "pid")).
+		SetListeners(
+			ListenerSpec{Name: "web", Network: "tcp", Address: "127.0.0.1:0"},
+			ListenerSpec{Name: "admin", Network: "unix", Address: filepath.Join(dir, "admin.sock")},
+		).
+		SetEncryption(true).
+		SetProcessRunner(NewFakeRunner(func(xCmdObj *XCmd, args []string) error {
+			for _, arg := range args {
+				if raw, ok := strings.CutPrefix(arg, "--bootstrap_args="); ok {
+					meta, _ = parseBootstrapMeta(raw)
+				}
+			}
+			return xCmdObj.ChildWrite([]byte(ReadyError))
+		}))
+	object.origArgs = []string{"app"}
+	specs, lnFiles, err := object.listen(object.listenerSpecs)
+	if nil != err {
+		t.Fatal(err)
+	}
+	object.listenerSpecs = specs
+	defer func() {
+		for _, f := range lnFiles {
+			f.Close()
+		}
+	}()
+	object.replaceChildProcess(lnFiles)
+
+	if 3 != len(meta.Fds) || meta.Key != meta.Fds[fdSlotPipeKey] {
+		t.Fatal(meta.Fds)
+	}
+	for _, info := range meta.Listeners {
+		if fd, ok := meta.Fds[listenerSlot(info.Name)]; !ok || fd != info.Fd {
+			t.Fatal(info, meta.Fds)
+		}
+	}
+
+	// 子进程只认槽位，按位置的fd错乱也不受影响
+	want := meta.Fds
+	meta.Key, meta.Listeners[0].Fd, meta.Listeners[1].Fd = 0, 0, 0
+	meta.resolveFds()
+	if want[fdSlotPipeKey] != meta.Key || want["listener:web"] != meta.Listeners[0].Fd ||
+		want["listener:admin"] != meta.Listeners[1].Fd {
+		t.Fatal(meta)
+	}
+	registry := newRegistry(meta.Listeners)
+	registry.fdSlots = meta.Fds
+	if fd, ok := registry.Fd("admin"); !ok || want["listener:admin"] != fd {
+		t.Fatal(fd, ok)
+	}
+	if fd, ok := registry.Fd(fdSlotPipeKey); !ok || meta.Key != fd {
+		t.Fatal(fd, ok)
+	}
+	if _, ok := registry.Fd("listener:missing"); ok {
+		t.Fatal("missing slot found")
+	}
+}
+
+func TestExtraFiles(t *testing.T) {
+	dir := t.TempDir()
+	shm, err := os.Create(filepath.Join(dir, "shm"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer shm.Close()
+	var meta bootstrapMeta
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		meta, _ = parseBootstrapMeta(strings.TrimPrefix(args[len(args)-1], "--bootstrap_args="))
+		return fakeChild(xCmdObj, args)
+	})
+	object.AddExtraFile("shm", shm)
+	if ok, err := object.replaceChildProcess(nil); !ok || nil != err {
+		t.Fatal(ok, err)
+	}
+	fd, ok := meta.Fds["file:shm"]
+	if extraFiles := object.currentChild().ExtraFiles; !ok || shm != extraFiles[len(extraFiles)-1] {
+		t.Fatal(meta.Fds, extraFiles)
+	}
+	registry := newRegistry(nil)
+	registry.fdSlots = meta.Fds
+	if got, ok := registry.Fd("shm"); !ok || fd != got {
+		t.Fatal(got, ok)
+	}
+	if _, ok = registry.File("missing"); ok {
+		t.Fatal("missing file found")
+	}
+	stopFakeDaemon(t, object)
+}
@@ -0,0 +1,173 @@
+package daemon
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// 帧格式：magic(2) | flags(1) | length(4) | [stream(4)] | [generation(8)] | payload | [crc32(4)]
+// 压缩时payload为 codec(1) | 压缩数据，length与校验和均针对传输的payload；
+// 控制通道的单帧消息不带stream字段，大消息按块拆分，块之间可插入其他通道的帧；
+// 设置了代数的管道在每帧附带子进程代数，读取时丢弃其他代数的帧
+const (
+	frameHeaderSize       = 7        // 帧头长度
+	frameStreamSize       = 4        // 通道ID长度
+	frameGenerationSize   = 8        // 代数长度
+	frameChecksumSize     = 4        // 校验和长度
+	frameChunkSize        = 64 << 10 // 大消息拆分的块长度
+	DefaultMaxMessageSize = 16 << 20 // 默认最大消息长度
+)
+
+// 帧标志位
+const (
+	frameFlagChecksum   = 1 << iota // 负载后附带CRC32校验和
+	frameFlagCompressed             // 负载已压缩
+	frameFlagStream                 // 帧头后附带通道ID
+	frameFlagMore                   // 消息未结束，后续还有块
+	frameFlagGeneration             // 帧头后附带子进程代数
+	frameFlagEncrypted              // 负载为序号与密文
+	frameFlagMask       = frameFlagChecksum | frameFlagCompressed | frameFlagStream | frameFlagMore | frameFlagGeneration | frameFlagEncrypted
+)
+
+// 逻辑通道
+const (
+	StreamControl   uint32 = 0  // 控制消息，Ready/Exit等
+	StreamHeartbeat uint32 = 1  // 心跳
+	StreamLog       uint32 = 2  // 日志转发
+	StreamState     uint32 = 3  // 状态交接
+	StreamTLS       uint32 = 4  // 证书下发
+	StreamDrain     uint32 = 5  // 排空进度
+	StreamMessage   uint32 = 6  // 父进程推送给子进程的消息，或子进程经Child.Send发给父进程的消息
+	StreamBus       uint32 = 7  // 子进程间经父进程转发的发布订阅
+	StreamLoad      uint32 = 8  // 子进程上报的负载
+	StreamGate      uint32 = 9  // 子进程上报的准备好条件
+	StreamProgress  uint32 = 10 // 子进程排空期间上报的进度说明
+	StreamSecret    uint32 = 11 // 机密下发
+	StreamUser      uint32 = 16 // 应用自定义通道起始ID
+)
+
+// crcTable CRC32校验表
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// frameMagic 帧头魔数，用于发现错位或被污染的数据流
+var frameMagic = [2]byte{'X', 'P'}
+
+// frameHeader 帧头
+type frameHeader struct {
+	flags      byte   // 标志位
+	length     uint32 // 负载长度
+	stream     uint32 // 逻辑通道
+	generation uint64 // 子进程代数，0为不附带
+}
+
+// size 帧头实际长度
+func (object frameHeader) size() (size int) {
+	size = frameHeaderSize
+	if 0 != object.flags&frameFlagStream {
+		size += frameStreamSize
+	}
+	if 0 != object.flags&frameFlagGeneration {
+		size += frameGenerationSize
+	}
+	return
+}
+
+// trailerSize 负载后附带的字节数
+func (object frameHeader) trailerSize() int {
+	if 0 != object.flags&frameFlagChecksum {
+		return frameChecksumSize
+	}
+	return 0
+}
+
+// writeTo 把帧头写入缓冲区
+func (object frameHeader) writeTo(buf *buffer) {
+	if StreamControl != object.stream {
+		object.flags |= frameFlagStream
+	}
+	if 0 != object.generation {
+		object.flags |= frameFlagGeneration
+	}
+	buf.WriteUint8(frameMagic[0]).
+		WriteUint8(frameMagic[1]).
+		WriteUint8(object.flags).
+		WriteUint32(object.length)
+	if 0 != object.flags&frameFlagStream {
+		buf.WriteUint32(object.stream)
+	}
+	if 0 != object.flags&frameFlagGeneration {
+		buf.WriteUint64(object.generation)
+	}
+}
+
+// decodeStream 解码通道ID与代数，raw需包含完整帧头
+func (object *frameHeader) decodeStream(raw []byte) {
+	offset := frameHeaderSize
+	if 0 != object.flags&frameFlagStream {
+		object.stream = binary.BigEndian.Uint32(raw[offset:])
+		offset += frameStreamSize
+	}
+	if 0 != object.flags&frameFlagGeneration {
+		object.generation = binary.BigEndian.Uint64(raw[offset:])
+	}
+}
+
+// decodeFrameHeader 解码并校验帧头固定部分
+func decodeFrameHeader(raw []byte, maxMessageSize int) (object frameHeader, err error) {
+	if frameMagic[0] != raw[0] || frameMagic[1] != raw[1] {
+		err = fmt.Errorf("%w: bad magic %#x%02x", ErrFrame, raw[0], raw[1])
+		return
+	}
+	object.flags = raw[2]
+	object.length = binary.BigEndian.Uint32(raw[3:])
+	if 0 != object.flags&^frameFlagMask {
+		err = fmt.Errorf("%w: unknown flags %#x", ErrFrame, object.flags)
+		return
+	}
+	if 0 < maxMessageSize && int64(object.length) > int64(maxMessageSize) {
+		err = fmt.Errorf("%w: message size %d exceeds %d", ErrFrame, object.length, maxMessageSize)
+		return
+	}
+	return
+}
+
+// verifyChecksum 校验负载
+func verifyChecksum(payload, trailer []byte) error {
+	expected := binary.BigEndian.Uint32(trailer)
+	if actual := crc32.Checksum(payload, crcTable); expected != actual {
+		return fmt.Errorf("%w: expected %08x, actual %08x", ErrFrameChecksum, expected, actual)
+	}
+	return nil
+}
+
+// compressPayload 压缩负载，压缩后未变小时返回nil
+func compressPayload(codecID byte, raw []byte) (payload []byte, err error) {
+	var codec Codec
+	if codec, err = getCodec(codecID); nil != err {
+		return
+	}
+	var compressed []byte
+	if compressed, err = codec.Compress(raw); nil != err {
+		return
+	}
+	if len(compressed)+1 >= len(raw) {
+		return
+	}
+	payload = append([]byte{codecID}, compressed...)
+	return
+}
+
+// decompressPayload 解压负载
+func decompressPayload(payload []byte, maxMessageSize int) (raw []byte, err error) {
+	if 0 >= len(payload) {
+		err = fmt.Errorf("%w: empty compressed payload", ErrFrame)
+		return
+	}
+	var codec Codec
+	if codec, err = getCodec(payload[0]); nil != err {
+		return
+	}
+	raw, err = codec.Decompress(payload[1:], maxMessageSize)
+	return
+}
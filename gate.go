@@ -0,0 +1,187 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// 准备好条件的状态
+const (
+	GatePending = "pending" // 未完成
+	GatePassed  = "passed"  // 已通过
+	GateFailed  = "failed"  // 失败
+)
+
+// GateListenerFds 子进程核对继承的侦听fd，失败原因指明缺失或类型不符的侦听
+const GateListenerFds = "listener-fds"
+
+// GateApplication 业务逻辑经Child.Fail回执启动失败
+const GateApplication = "application"
+
+// GateStatus 准备好条件的状态，子进程经StreamGate上报父进程
+type GateStatus struct {
+	Name  string `json:"name"`            // 条件名，如db-migrated
+	State string `json:"state"`           // 状态
+	Error string `json:"error,omitempty"` // 失败原因
+}
+
+// GateError 准备好条件未全部通过
+type GateError struct {
+	Failed  []GateStatus // 失败的条件
+	Pending []string     // 未完成的条件
+	Err     error        // 底层原因，如超时
+}
+
+// Error 错误描述
+func (object *GateError) Error() string {
+	var parts []string
+	for _, gate := range object.Failed {
+		parts = append(parts, fmt.Sprintf("gate %q failed: %s", gate.Name, gate.Error))
+	}
+	if 0 < len(object.Pending) {
+		parts = append(parts, fmt.Sprintf("gates pending: %s", strings.Join(object.Pending, ", ")))
+	}
+	if nil != object.Err {
+		parts = append(parts, object.Err.Error())
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Unwrap 底层原因
+func (object *GateError) Unwrap() error {
+	return object.Err
+}
+
+// readiness 一组准备好条件，子进程登记与等待，父进程跟踪上报
+type readiness struct {
+	sync.Mutex
+	gates     map[string]GateStatus // 条件
+	changedCh chan struct{}         // 条件变化通知
+}
+
+// newReadiness 工厂方法
+func newReadiness() *readiness {
+	return &readiness{
+		gates:     make(map[string]GateStatus),
+		changedCh: make(chan struct{}, 1),
+	}
+}
+
+// set 修改条件状态
+func (object *readiness) set(gate GateStatus) {
+	object.Lock()
+	object.gates[gate.Name] = gate
+	object.Unlock()
+	select {
+	case object.changedCh <- struct{}{}:
+	default:
+	}
+}
+
+// apply 记录子进程上报的条件状态
+func (object *readiness) apply(raw []byte) {
+	var gate GateStatus
+	if err := json.Unmarshal(raw, &gate); nil != err {
+		glog.Error(err)
+		return
+	}
+	if GateFailed == gate.State {
+		glog.Errorf("gate %s failed: %s", gate.Name, gate.Error)
+	} else {
+		glog.Infof("gate %s %s", gate.Name, gate.State)
+	}
+	object.set(gate)
+}
+
+// list 按名称排序的全部条件
+func (object *readiness) list() (gates []GateStatus) {
+	object.Lock()
+	defer object.Unlock()
+	for _, gate := range object.gates {
+		gates = append(gates, gate)
+	}
+	sort.Slice(gates, func(i, j int) bool { return gates[i].Name < gates[j].Name })
+	return
+}
+
+// err 未全部通过时返回GateError
+func (object *readiness) err(cause error) error {
+	gateErr := &GateError{Err: cause}
+	for _, gate := range object.list() {
+		switch gate.State {
+		case GateFailed:
+			gateErr.Failed = append(gateErr.Failed, gate)
+		case GatePending:
+			gateErr.Pending = append(gateErr.Pending, gate.Name)
+		}
+	}
+	if 0 >= len(gateErr.Failed) && 0 >= len(gateErr.Pending) {
+		return cause
+	}
+	return gateErr
+}
+
+// wait 等待全部条件通过，有条件失败时立即返回
+func (object *readiness) wait() error {
+	for {
+		gates := object.list()
+		passed := true
+		for _, gate := range gates {
+			if GateFailed == gate.State {
+				return object.err(nil)
+			}
+			passed = passed && GatePassed == gate.State
+		}
+		if passed {
+			return nil
+		}
+		<-object.changedCh
+	}
+}
+
+// AddGate 登记准备好条件，全部通过且ready收到true后才回执ReadyOK
+func (object *Registry) AddGate(names ...string) {
+	for _, name := range names {
+		object.setGate(GateStatus{Name: name, State: GatePending})
+	}
+}
+
+// PassGate 条件通过
+func (object *Registry) PassGate(name string) {
+	object.setGate(GateStatus{Name: name, State: GatePassed})
+}
+
+// FailGate 条件失败，子进程回执ReadyError，父进程报告失败的条件
+func (object *Registry) FailGate(name string, err error) {
+	gate := GateStatus{Name: name, State: GateFailed}
+	if nil != err {
+		gate.Error = err.Error()
+	}
+	object.setGate(gate)
+}
+
+// Gates 全部准备好条件
+func (object *Registry) Gates() []GateStatus {
+	return object.gates.list()
+}
+
+// setGate 修改条件并上报父进程
+func (object *Registry) setGate(gate GateStatus) {
+	object.gates.set(gate)
+	if nil == object.parent {
+		return
+	}
+	raw, err := json.Marshal(gate)
+	if nil != err {
+		glog.Error(err)
+		return
+	}
+	if err = object.parent.ChildWriteStream(StreamGate, raw); nil != err {
+		glog.Error(err)
+	}
+}
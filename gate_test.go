@@ -0,0 +1,68 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReadinessWait(t *testing.T) {
+	gates := newReadiness()
+	gates.set(GateStatus{Name: "db-migrated", State: GatePending})
+	doneCh := make(chan error, 1)
+	go func() {
+		doneCh <- gates.wait()
+	}()
+	gates.set(GateStatus{Name: "db-migrated", State: GatePassed})
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+
+	gates.set(GateStatus{Name: "cache-warm", State: GateFailed, Error: "redis down"})
+	var gateErr *GateError
+	if err := gates.wait(); !errors.As(err, &gateErr) ||
+		1 != len(gateErr.Failed) || "cache-warm" != gateErr.Failed[0].Name {
+		t.Fatal(err)
+	}
+}
+
+func TestDaemonGateFailed(t *testing.T) {
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		registry := newRegistry(nil)
+		registry.parent = xCmdObj
+		registry.AddGate("db-migrated", "cache-warm")
+		registry.PassGate("db-migrated")
+		registry.FailGate("cache-warm", errors.New("redis down"))
+		if err := registry.gates.wait(); nil == err {
+			t.Error("gate failure not reported")
+		}
+		return xCmdObj.ChildWrite([]byte(ReadyError))
+	})
+	ok, err := object.replaceChildProcess(nil)
+	var gateErr *GateError
+	if ok || !errors.Is(err, ErrChildNotReady) || !errors.As(err, &gateErr) ||
+		1 != len(gateErr.Failed) || "redis down" != gateErr.Failed[0].Error {
+		t.Fatal(ok, err)
+	}
+}
+
+func TestDaemonGatePending(t *testing.T) {
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		registry := newRegistry(nil)
+		registry.parent = xCmdObj
+		registry.AddGate("slow")
+		return xCmdObj.ChildRead(func(raw []byte) bool {
+			return nil != raw
+		})
+	})
+	object.SetReadyTimeout(50 * time.Millisecond)
+	ok, err := object.replaceChildProcess(nil)
+	var gateErr *GateError
+	if ok || !errors.Is(err, ErrReadyTimeout) || !errors.As(err, &gateErr) ||
+		1 != len(gateErr.Pending) || "slow" != gateErr.Pending[0] {
+		t.Fatal(ok, err)
+	}
+}
@@ -0,0 +1,224 @@
+package daemon
+
+import (
+	"errors"
+	"hash/fnv"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Balance 父进程接受连接后选择子进程的方式
+type Balance int
+
+// 分发方式
+const (
+	BalanceRoundRobin Balance = iota // 轮询
+	BalanceSourceHash                // 按来源IP哈希，同一来源固定到同一工作进程
+)
+
+// handoffBacklog 子进程尚未Accept的连接数
+const handoffBacklog = 128
+
+// 接受连接出错时的退避间隔
+const (
+	acceptMinBackoff = 5 * time.Millisecond
+	acceptMaxBackoff = time.Second
+)
+
+// SetBalance 设置父进程接受的连接分发给子进程的方式，
+// 仅对ListenerOptions.AcceptInParent为真的侦听有效
+func (object *Daemon) SetBalance(balance Balance) *Daemon {
+	object.balance = balance
+	return object
+}
+
+// acceptInParent 是否有侦听由父进程接受连接
+func (object *Daemon) acceptInParent() bool {
+	for _, spec := range object.listenerSpecs {
+		if spec.Options.AcceptInParent && !spec.IsPacket() {
+			return true
+		}
+	}
+	return false
+}
+
+// serveHandoff 父进程接受连接并分发给子进程，返回的函数关闭侦听
+func (object *Daemon) serveHandoff(lnFiles map[string]*os.File) (closeFn func(), err error) {
+	var listeners []net.Listener
+	closeFn = func() {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+	}
+	for _, spec := range object.listenerSpecs {
+		if !spec.Options.AcceptInParent || spec.IsPacket() {
+			continue
+		}
+		var ln net.Listener
+		if ln, err = net.FileListener(lnFiles[spec.Name]); nil != err {
+			closeFn()
+			return
+		}
+		listeners = append(listeners, ln)
+		go object.acceptLoop(spec.Name, ln)
+	}
+	return
+}
+
+// acceptLoop 接受连接，按分发方式交给子进程；侦听关闭时返回，
+// 其他错误如文件描述符耗尽时退避后重试，与net/http.Server.Serve相同
+func (object *Daemon) acceptLoop(name string, ln net.Listener) {
+	var delay time.Duration
+	for {
+		conn, err := ln.Accept()
+		if nil != err {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if 0 == delay {
+				delay = acceptMinBackoff
+			} else if delay *= 2; delay > acceptMaxBackoff {
+				delay = acceptMaxBackoff
+			}
+			glog.Errorf("accept on %s: %v, retrying in %v", name, err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+		child := object.pickChild(conn.RemoteAddr())
+		if nil == child {
+			glog.Warningf("no worker for connection on %s", name)
+			conn.Close()
+			continue
+		}
+		if err = sendConn(child.handoff, name, conn); nil != err {
+			glog.Errorf("handoff to child %d: %v", child.Pid(), err)
+		}
+		conn.Close()
+	}
+}
+
+// pickChild 选择接收连接的子进程
+func (object *Daemon) pickChild(addr net.Addr) *XCmd {
+	object.RLock()
+	all := object.children()
+	object.RUnlock()
+	children := all[:0]
+	for _, child := range all {
+		if nil != child.handoff {
+			children = append(children, child)
+		}
+	}
+	if 0 >= len(children) {
+		return nil
+	}
+	if BalanceSourceHash == object.balance {
+		host := addr.String()
+		if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+			host = tcpAddr.IP.String()
+		}
+		h := fnv.New32a()
+		h.Write([]byte(host))
+		return children[h.Sum32()%uint32(len(children))]
+	}
+	return children[atomic.AddUint32(&object.nextChild, 1)%uint32(len(children))]
+}
+
+// handoffListener 子进程中接收父进程分发连接的侦听
+type handoffListener struct {
+	name   string        // 侦听名
+	addr   net.Addr      // 父进程侦听的地址
+	connCh chan net.Conn // 分发来的连接
+	once   sync.Once
+	doneCh chan struct{} // 关闭通知
+}
+
+// newHandoffListener 工厂方法
+func newHandoffListener(info ListenerInfo) *handoffListener {
+	object := &handoffListener{
+		name:   info.Name,
+		connCh: make(chan net.Conn, handoffBacklog),
+		doneCh: make(chan struct{}),
+	}
+	if addr, err := net.ResolveTCPAddr(info.Network, info.Address); nil == err {
+		object.addr = addr
+	}
+	return object
+}
+
+// Accept 等待父进程分发的连接
+func (object *handoffListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-object.connCh:
+		return conn, nil
+	case <-object.doneCh:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close 关闭，之后分发来的连接直接关闭
+func (object *handoffListener) Close() error {
+	object.once.Do(func() {
+		close(object.doneCh)
+	})
+	return nil
+}
+
+// Addr 父进程侦听的地址
+func (object *handoffListener) Addr() net.Addr {
+	return object.addr
+}
+
+// deliver 投递连接，已关闭或积压过多时关闭连接
+func (object *handoffListener) deliver(conn net.Conn) {
+	select {
+	case <-object.doneCh:
+		conn.Close()
+		return
+	default:
+	}
+	select {
+	case object.connCh <- conn:
+	default:
+		glog.Warningf("handoff backlog full on %s", object.name)
+		conn.Close()
+	}
+}
+
+// handoffReceiver 子进程接收分发连接
+type handoffReceiver struct {
+	sync.Mutex
+	listeners map[string]*handoffListener // 侦听名对应的侦听
+}
+
+// listener 侦听名对应的侦听
+func (object *handoffReceiver) listener(info ListenerInfo) *handoffListener {
+	object.Lock()
+	defer object.Unlock()
+	if nil == object.listeners {
+		object.listeners = make(map[string]*handoffListener)
+	}
+	ln, ok := object.listeners[info.Name]
+	if !ok {
+		ln = newHandoffListener(info)
+		object.listeners[info.Name] = ln
+	}
+	return ln
+}
+
+// deliver 按侦听名投递，未获取侦听的连接直接关闭
+func (object *handoffReceiver) deliver(name string, conn net.Conn) {
+	object.Lock()
+	ln, ok := object.listeners[name]
+	object.Unlock()
+	if !ok {
+		conn.Close()
+		return
+	}
+	ln.deliver(conn)
+}
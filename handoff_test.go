@@ -0,0 +1,110 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"net"
+	"os/exec"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHandoff(t *testing.T) {
+	xCmdObj := &XCmd{Cmd: exec.Command("app"), nextFd: 2}
+	childFd, err := newHandoff(xCmdObj)
+	if nil != err || 3 != childFd {
+		t.Fatal(childFd, err)
+	}
+	defer xCmdObj.Close()
+
+	// 模拟子进程继承的fd
+	fd, _ := syscall.Dup(int(xCmdObj.handoffChild.Fd()))
+	receiver := &handoffReceiver{}
+	ln := receiver.listener(ListenerInfo{ListenerSpec: ListenerSpec{Name: "web", Network: "tcp", Address: "127.0.0.1:80"}})
+	defer ln.Close()
+	if err = receiver.receiveConns(fd); nil != err {
+		t.Fatal(err)
+	}
+
+	// 父进程接受连接后分发
+	parentLn, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer parentLn.Close()
+	client, err := net.Dial("tcp", parentLn.Addr().String())
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	accepted, _ := parentLn.Accept()
+	if err = sendConn(xCmdObj.handoff, "web", accepted); nil != err {
+		t.Fatal(err)
+	}
+	accepted.Close()
+
+	conn, err := ln.Accept()
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if n, _ := conn.Read(buf); "ping" != string(buf[:n]) || "127.0.0.1:80" != ln.Addr().String() {
+		t.Fatal(string(buf[:n]), ln.Addr())
+	}
+}
+
+func TestPickChild(t *testing.T) {
+	object := Default()
+	if nil != object.pickChild(&net.TCPAddr{}) {
+		t.Fatal("no child should be picked")
+	}
+	object.xCmdObj = &XCmd{handoff: &net.UnixConn{}}
+	worker := object.newWorker(1)
+	worker.xCmdObj = &XCmd{handoff: &net.UnixConn{}}
+	object.workers = []*Daemon{worker}
+
+	first, second := object.pickChild(&net.TCPAddr{}), object.pickChild(&net.TCPAddr{})
+	if first == second {
+		t.Fatal("round robin")
+	}
+	object.SetBalance(BalanceSourceHash)
+	addr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000}
+	sticky := object.pickChild(addr)
+	addr.Port = 2000
+	if sticky != object.pickChild(addr) {
+		t.Fatal("source hash not sticky")
+	}
+}
+
+// failingListener Accept先返回若干次错误，之后按已关闭返回
+type failingListener struct {
+	net.Listener
+	failures int32
+	accepted int32
+}
+
+func (object *failingListener) Accept() (net.Conn, error) {
+	if atomic.AddInt32(&object.accepted, 1) <= object.failures {
+		return nil, syscall.EMFILE
+	}
+	return nil, net.ErrClosed
+}
+
+func TestAcceptLoopRetry(t *testing.T) {
+	ln := &failingListener{failures: 3}
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		Default().acceptLoop("web", ln)
+	}()
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("accept loop not returned")
+	}
+	if 4 != atomic.LoadInt32(&ln.accepted) {
+		t.Fatal(ln.accepted)
+	}
+}
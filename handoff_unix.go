@@ -0,0 +1,109 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/golang/glog"
+)
+
+// handoffNameSize 侦听名的最大长度
+const handoffNameSize = 256
+
+// newHandoff 建立分发连接用的报文socketpair，子进程端作为继承文件，返回其fd
+func newHandoff(xCmdObj *XCmd) (childFd int, err error) {
+	syscall.ForkLock.RLock()
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_DGRAM, 0)
+	if nil == err {
+		syscall.CloseOnExec(fds[0])
+		syscall.CloseOnExec(fds[1])
+	}
+	syscall.ForkLock.RUnlock()
+	if nil != err {
+		err = os.NewSyscallError("socketpair", err)
+		return
+	}
+	xCmdObj.handoffChild = os.NewFile(uintptr(fds[1]), "handoffChild")
+	if xCmdObj.handoff, err = fileUnixConn(os.NewFile(uintptr(fds[0]), "handoff")); nil != err {
+		xCmdObj.handoffChild.Close()
+		xCmdObj.handoffChild = nil
+		return
+	}
+	childFd = xCmdObj.AddNamedFile(fdSlotHandoff, xCmdObj.handoffChild)
+	return
+}
+
+// sendConn 把连接的fd连同侦听名发给子进程
+func sendConn(handoff *net.UnixConn, name string, conn net.Conn) error {
+	fileConn, ok := conn.(interface{ File() (*os.File, error) })
+	if !ok {
+		return fmt.Errorf("%w: %T cannot be handed off", ErrTransport, conn)
+	}
+	f, err := fileConn.File()
+	if nil != err {
+		return err
+	}
+	defer f.Close()
+	_, _, err = handoff.WriteMsgUnix([]byte(name), syscall.UnixRights(int(f.Fd())), nil)
+	return err
+}
+
+// receiveConns 子进程接收父进程分发的连接，直到socket关闭
+func (object *handoffReceiver) receiveConns(fd int) error {
+	conn, err := fileUnixConn(os.NewFile(uintptr(fd), "handoff"))
+	if nil != err {
+		return err
+	}
+	go func() {
+		defer conn.Close()
+		buf := make([]byte, handoffNameSize)
+		oob := make([]byte, syscall.CmsgSpace(4))
+		for {
+			n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+			if nil != err {
+				return
+			}
+			if c, err := rightsConn(oob[:oobn]); nil != err {
+				glog.Error(err)
+			} else {
+				object.deliver(string(buf[:n]), c)
+			}
+		}
+	}()
+	return nil
+}
+
+// rightsConn 由SCM_RIGHTS中的fd构建连接
+func rightsConn(oob []byte) (conn net.Conn, err error) {
+	var msgs []syscall.SocketControlMessage
+	if msgs, err = syscall.ParseSocketControlMessage(oob); nil != err {
+		return
+	}
+	for _, msg := range msgs {
+		var fds []int
+		if fds, err = syscall.ParseUnixRights(&msg); nil != err {
+			continue
+		}
+		for i, fd := range fds {
+			if 0 < i {
+				syscall.Close(fd)
+				continue
+			}
+			f := os.NewFile(uintptr(fd), "handoffConn")
+			conn, err = net.FileConn(f)
+			f.Close()
+		}
+		if nil != conn {
+			return
+		}
+	}
+	if nil == err {
+		err = fmt.Errorf("%w: no fd in handoff message", ErrTransport)
+	}
+	return
+}
@@ -0,0 +1,21 @@
+package daemon
+
+import (
+	"fmt"
+	"net"
+)
+
+// newHandoff Windows不支持父进程分发连接
+func newHandoff(xCmdObj *XCmd) (int, error) {
+	return 0, fmt.Errorf("%w: accept in parent on windows", ErrTransport)
+}
+
+// sendConn Windows不支持父进程分发连接
+func sendConn(handoff *net.UnixConn, name string, conn net.Conn) error {
+	return fmt.Errorf("%w: accept in parent on windows", ErrTransport)
+}
+
+// receiveConns Windows不支持父进程分发连接
+func (object *handoffReceiver) receiveConns(fd int) error {
+	return fmt.Errorf("%w: accept in parent on windows", ErrTransport)
+}
@@ -0,0 +1,92 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// healthzPath 管理侦听上的健康检查路径
+const healthzPath = "/healthz"
+
+// SetLivenessTimeout 子进程准备好后按timeout的三分之一持续发送心跳，
+// 管理侦听的/healthz在超过timeout未收到主工作进程心跳时返回503；0为不检查心跳
+func (object *Daemon) SetLivenessTimeout(timeout time.Duration) *Daemon {
+	object.livenessTimeout = timeout
+	return object
+}
+
+// livenessInterval 子进程准备好后发送心跳的间隔，0表示不发送
+func (object *Daemon) livenessInterval() time.Duration {
+	if 0 >= object.livenessTimeout {
+		return 0
+	}
+	return object.livenessTimeout / 3
+}
+
+// upgradeDeadline 更新的最长耗时，设置了更新期限，或协商、准备好与排空均有超时时才有，0表示不限
+func (object *Daemon) upgradeDeadline() time.Duration {
+	if 0 < object.deployDeadline && 0 < object.drainTimeout {
+		return object.deployDeadline + object.drainTimeout
+	}
+	if 0 >= object.readyTimeout || 0 >= object.drainTimeout {
+		return 0
+	}
+	deadline := object.readyTimeout + object.drainTimeout + object.prepareTimeout
+	if 0 < object.startupGrace {
+		deadline += object.startupGrace
+	}
+	return deadline
+}
+
+// Health 守护进程整体的健康状况：主工作进程运行中且按时发送心跳时返回nil；
+// 更新超过期限、重启次数用尽或没有子进程时返回原因
+func (object *Daemon) Health() error {
+	status := object.Status()
+	switch status.Phase {
+	case StatusRunning:
+	case StatusUpgrading:
+		if deadline := object.upgradeDeadline(); 0 < deadline && time.Since(status.PhaseSince) > deadline {
+			return fmt.Errorf("upgrade exceeded %s", deadline)
+		}
+	case StatusFailed:
+		return ErrRestartBudgetExhausted
+	default:
+		return fmt.Errorf("daemon %s", status.Phase)
+	}
+	child := object.currentChild()
+	if nil == child {
+		return errors.New("no child running")
+	}
+	if 0 < object.livenessTimeout && !child.IPCLost() {
+		last := time.Unix(0, atomic.LoadInt64(&child.lastBeat))
+		if elapsed := time.Since(last); elapsed > object.livenessTimeout {
+			return fmt.Errorf("child %d heartbeat missing for %s", child.Pid(), elapsed.Truncate(time.Millisecond))
+		}
+	}
+	return nil
+}
+
+// serveHealthz 健康时返回200，否则返回503及原因，供负载均衡或Kubernetes探测
+func (object *Daemon) serveHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := object.Health(); nil != err {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, err)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// handleHealthz 注册/healthz，应用已通过HandleAdmin注册时保留应用的
+func (object *Daemon) handleHealthz(mux *http.ServeMux) {
+	request := &http.Request{Method: http.MethodGet, URL: &url.URL{Path: healthzPath}}
+	if _, pattern := mux.Handler(request); healthzPath == pattern {
+		return
+	}
+	mux.HandleFunc(healthzPath, object.serveHealthz)
+}
@@ -0,0 +1,142 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// HistoryRequest 控制socket查询更新历史的指令
+const HistoryRequest = "history"
+
+// 更新结果
+const (
+	UpgradeOK     = "ok"     // 新子进程已接管
+	UpgradeFailed = "failed" // 更新失败
+)
+
+// UpgradeRecord 一次更新尝试的记录，每行一条JSON追加到历史文件
+type UpgradeRecord struct {
+	Time           time.Time     `json:"time"`                      // 开始时间
+	Trigger        string        `json:"trigger"`                   // 触发来源，如signal/control socket/api
+	OldChecksum    string        `json:"old_checksum,omitempty"`    // 更新前可执行文件SHA-256
+	NewChecksum    string        `json:"new_checksum,omitempty"`    // 更新后可执行文件SHA-256
+	Duration       time.Duration `json:"duration"`                  // 耗时
+	Result         string        `json:"result"`                    // 结果
+	Error          string        `json:"error,omitempty"`           // 失败原因
+	RollbackReason string        `json:"rollback_reason,omitempty"` // 回退到旧子进程的原因
+	Phase          string        `json:"phase,omitempty"`           // 失败时所处的阶段，如spawn/ready
+	Deploy         *Deploy       `json:"deploy,omitempty"`          // 更新附带的部署信息
+}
+
+// historyState 更新历史相关的状态
+type historyState struct {
+	sync.Mutex
+	path string // 历史文件路径，为空时不记录
+}
+
+// SetHistoryFile 设置更新历史文件，只追加不改写
+func (object *Daemon) SetHistoryFile(path string) *Daemon {
+	object.history.path = path
+	return object
+}
+
+// recordUpgrade 记录一次更新尝试
+func (object *Daemon) recordUpgrade(trigger string, start time.Time, err error) {
+	if 0 >= len(object.history.path) {
+		return
+	}
+	record := UpgradeRecord{
+		Time:        start,
+		Trigger:     trigger,
+		OldChecksum: object.Status().BinaryChecksum,
+		Duration:    time.Since(start),
+		Result:      UpgradeOK,
+		Deploy:      object.deployInfo(),
+	}
+	if _, sum, e := binaryChecksum(); nil == e {
+		record.NewChecksum = sum
+	}
+	if nil != err {
+		record.Result = UpgradeFailed
+		record.Error = err.Error()
+		record.Phase = failedPhase(err)
+		if !errors.Is(err, ErrSameBinary) {
+			record.RollbackReason = "new child not ready, old child kept serving"
+			if 0 < len(record.Phase) {
+				record.RollbackReason = fmt.Sprintf("%s failed, old child kept serving", record.Phase)
+			}
+		}
+	}
+	if e := object.appendHistory(record); nil != e {
+		glog.Error(e)
+	}
+}
+
+// appendHistory 追加一条记录
+func (object *Daemon) appendHistory(record UpgradeRecord) (err error) {
+	var raw []byte
+	if raw, err = json.Marshal(record); nil != err {
+		return
+	}
+	object.history.Lock()
+	defer object.history.Unlock()
+	var f *os.File
+	if f, err = os.OpenFile(object.history.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); nil != err {
+		return
+	}
+	if _, err = f.Write(append(raw, '\n')); nil != err {
+		f.Close()
+		return
+	}
+	err = f.Close()
+	return
+}
+
+// historyJSON 控制socket返回的历史记录，单行JSON数组
+func (object *Daemon) historyJSON() (raw []byte, err error) {
+	if 0 >= len(object.history.path) {
+		err = ErrNoHistory
+		return
+	}
+	object.history.Lock()
+	records, err := ReadHistory(object.history.path)
+	object.history.Unlock()
+	if nil != err && !os.IsNotExist(err) {
+		return
+	}
+	if nil == records {
+		records = []UpgradeRecord{}
+	}
+	raw, err = json.Marshal(records)
+	return
+}
+
+// ReadHistory 读取更新历史文件，按时间先后返回
+func ReadHistory(path string) (records []UpgradeRecord, err error) {
+	var f *os.File
+	if f, err = os.Open(path); nil != err {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		if 0 >= len(scanner.Bytes()) {
+			continue
+		}
+		var record UpgradeRecord
+		if err = json.Unmarshal(scanner.Bytes(), &record); nil != err {
+			return
+		}
+		records = append(records, record)
+	}
+	err = scanner.Err()
+	return
+}
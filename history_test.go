@@ -0,0 +1,58 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestUpgradeHistory(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "history.jsonl")
+	object, signalCh, doneCh := startFakeParent(t, withSetup(func(object *Daemon) {
+		object.SetControlSocket(filepath.Join(dir, "ctl.sock")).SetHistoryFile(path)
+	}))
+
+	if err := object.Upgrade(); nil != err {
+		t.Fatal(err)
+	}
+	if err := SendControl(object.controlSocket, UpgradeRequest); nil != err {
+		t.Fatal(err)
+	}
+
+	result, err := QueryControl(object.controlSocket, HistoryRequest)
+	if nil != err {
+		t.Fatal(err)
+	}
+	var records []UpgradeRecord
+	if err = json.Unmarshal([]byte(result), &records); nil != err || 2 != len(records) {
+		t.Fatal(err, result)
+	}
+	if "api" != records[0].Trigger || "control socket" != records[1].Trigger {
+		t.Fatal(records)
+	}
+	for _, record := range records {
+		if UpgradeOK != record.Result || 64 != len(record.OldChecksum) ||
+			record.OldChecksum != record.NewChecksum || 0 >= record.Duration {
+			t.Fatal(record)
+		}
+	}
+
+	signalCh <- syscall.SIGTERM
+	if err = <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+	if records, err = ReadHistory(path); nil != err || 2 != len(records) {
+		t.Fatal(err, records)
+	}
+}
+
+func TestHistoryNotSet(t *testing.T) {
+	if _, err := New("child", "upgrade", "bootstrap_args", "", "").historyJSON(); ErrNoHistory != err {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,92 @@
+package daemon
+
+import (
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/golang/glog"
+)
+
+// RunInline 前台运行，不派生子进程，绑定端口后直接在当前进程调用业务逻辑，
+// 业务逻辑拿到的fd、准备好通道与退出通道与子进程模式一致，便于开发调试
+func (object *Daemon) RunInline(tcpPorts map[string]int, //TCP端口
+	logical func(tcpFds map[string]int,
+		ready chan bool, /*准备好通道*/
+		exitCh chan interface{} /*退出通道*/), // 业务逻辑
+) error {
+	return object.RunInlineListeners(TCPListenerSpecs(tcpPorts), func(registry *Registry,
+		ready chan bool,
+		exitCh chan interface{}) {
+		logical(registry.Fds(), ready, exitCh)
+	})
+}
+
+// RunInlineListeners 前台运行，侦听与业务逻辑同BootstrapListeners
+func (object *Daemon) RunInlineListeners(specs []ListenerSpec, logical RegistryLogical) error {
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, object.handledSignals(false)...)
+	object.listenerSpecs = specs
+	return object.runInline(signalCh, logical)
+}
+
+// runInline 在当前进程运行业务逻辑
+func (object *Daemon) runInline(signalCh chan os.Signal, logical RegistryLogical) (err error) {
+	// 侦听
+	var infos []ListenerInfo
+	var sockets map[string]io.Closer
+	if infos, sockets, err = object.inlineListeners(object.listenerSpecs); nil != err {
+		glog.Error(err)
+		return
+	}
+
+	registry := newRegistry(infos)
+	registry.sockets = sockets
+	if registry.secrets, err = object.inlineSecrets(); nil != err {
+		glog.Error(err)
+		return
+	}
+	if nil != registry.secrets {
+		defer registry.secrets.wipe()
+	}
+	ready := make(chan bool, 1)
+	exitCh := make(chan interface{}, 1)
+	go func() {
+		if ok := <-ready; !ok {
+			glog.Error("logical ready not ok")
+			return
+		}
+		if err := registry.gates.wait(); nil != err {
+			glog.Error(err)
+			return
+		}
+		glog.Info("inline logical ready ok")
+	}()
+
+	// 等待退出信号或控制指令，准备好之前收到的退出同样通知业务逻辑
+	go func() {
+		for {
+			cmd := &command{}
+			select {
+			case s := <-signalCh:
+				cmd.action = object.signalAction(s)
+			case cmd = <-object.controlCh:
+			}
+			if ExitRequest == cmd.action {
+				registry.drain(true)
+				close(exitCh)
+				cmd.reply(nil)
+				return
+			}
+			if ReloadRequest == cmd.action {
+				registry.reload()
+			}
+			cmd.reply(nil)
+		}
+	}()
+
+	logical(registry, ready, exitCh)
+	registry.drain(false)
+	glog.Info("inline logical exited")
+	return
+}
@@ -0,0 +1,62 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunInline(t *testing.T) {
+	for _, beforeReady := range []bool{true, false} {
+		object := Default().SetListeners(ListenerSpec{Name: "web", Network: "tcp", Address: "127.0.0.1:0"})
+		signalCh := make(chan os.Signal, 1)
+		served := make(chan error, 1)
+		doneCh := make(chan error, 1)
+		go func() {
+			doneCh <- object.runInline(signalCh, func(registry *Registry, ready chan bool, exitCh chan interface{}) {
+				ln, err := registry.Listener("web")
+				if nil != err {
+					served <- err
+					return
+				}
+				defer ln.Close()
+				conn, err := net.Dial("tcp", ln.Addr().String())
+				if nil == err {
+					conn.Close()
+				}
+				served <- err
+
+				// 准备好之前收到的SIGTERM同样通知业务逻辑退出
+				if beforeReady {
+					signalCh <- syscall.SIGTERM
+				} else {
+					ready <- true
+				}
+				select {
+				case <-exitCh:
+				case <-time.After(5 * time.Second):
+					t.Error("exit not delivered", beforeReady)
+				}
+			})
+		}()
+		if err := <-served; nil != err {
+			t.Fatal(err)
+		}
+		if !beforeReady {
+			signalCh <- syscall.SIGTERM
+		}
+		select {
+		case err := <-doneCh:
+			if nil != err {
+				t.Fatal(err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("inline not exited", beforeReady)
+		}
+	}
+}
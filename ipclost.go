@@ -0,0 +1,54 @@
+package daemon
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// ipcLostGrace 管道断开后等待子进程退出的时间，超过仍在运行即视为通信丢失
+const ipcLostGrace = 200 * time.Millisecond
+
+// watchIPC 子进程一端的管道断开后区分退出与通信丢失：
+// 部分库会关闭"未知"的fd，子进程仍在服务却无法再收发消息，此时降级为只用信号控制
+func (object *Daemon) watchIPC(xCmdObj *XCmd) {
+	if xCmdObj.readPipe.IsClosed() || nil == xCmdObj.exited {
+		return
+	}
+	timer := time.NewTimer(ipcLostGrace)
+	defer timer.Stop()
+	select {
+	case <-xCmdObj.exited:
+		return
+	case <-timer.C:
+	}
+	atomic.StoreInt32(&xCmdObj.ipcLost, 1)
+	glog.Warningf("child: %d closed its IPC pipes but is still running, supervise by signals only", xCmdObj.Pid())
+	object.emit(Event{
+		Type:   EventIPCLost,
+		Pid:    xCmdObj.Pid(),
+		Worker: xCmdObj.worker,
+	})
+	object.setStatus(func(status *Status) {})
+}
+
+// IPCLost 子进程是否已断开通信管道
+func (object *XCmd) IPCLost() bool {
+	return 0 != atomic.LoadInt32(&object.ipcLost)
+}
+
+// signalSafeExit 通信丢失时以信号请求子进程退出，等待其退出或ctx结束
+func (object *Daemon) signalSafeExit(ctx context.Context, xCmdObj *XCmd) error {
+	glog.Infof("child: %d IPC lost, request exit by signal", xCmdObj.Pid())
+	if err := xCmdObj.Signal(terminateSignal()); nil != err {
+		return err
+	}
+	select {
+	case <-xCmdObj.exited:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
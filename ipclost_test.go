@@ -0,0 +1,57 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"context"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIPCLost(t *testing.T) {
+	var events []Event
+	var runner *FakeRunner
+	var object *Daemon
+	object, runner = newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		if err := xCmdObj.ChildWrite([]byte(ReadyOK)); nil != err {
+			return err
+		}
+		// 模拟库关闭了fd 3、4，进程继续运行直到收到SIGTERM
+		xCmdObj.Close()
+		for {
+			for _, sig := range runner.Signals() {
+				if syscall.SIGTERM == sig {
+					return nil
+				}
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+	object.SetLivenessTimeout(50 * time.Millisecond).OnEvent(func(event Event) {
+		events = append(events, event)
+	})
+	if ok, err := object.replaceChildProcess(nil); !ok || nil != err {
+		t.Fatal(ok, err)
+	}
+	child := object.currentChild()
+	// 事件发布后才刷新状态
+	waitFor(t, func() bool { return object.Status().Degraded })
+	if !child.IPCLost() || 1 != len(events) || EventIPCLost != events[0].Type || child.Pid() != events[0].Pid {
+		t.Fatal(events)
+	}
+
+	// 心跳不再到达也不视为不健康，退出改用信号
+	object.setPhase(StatusRunning)
+	time.Sleep(100 * time.Millisecond)
+	if err := object.Health(); nil != err {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&object.killedFlag, 1)
+	if err := object.waitChildSafeExit(context.Background()); nil != err {
+		t.Fatal(err)
+	}
+	object.wg.Wait()
+}
@@ -0,0 +1,164 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// Launch 子进程的启动环境
+type Launch struct {
+	Args  []string `json:"args"`            // 命令行
+	Env   []string `json:"env"`             // 环境变量，不含机密
+	Dir   string   `json:"dir,omitempty"`   // 工作目录
+	Files []string `json:"files,omitempty"` // 继承的fd，格式为"fd=名字"
+
+	bootstrap string // 去掉子进程代数的引导参数
+	bootIndex int    // 引导参数在命令行中的位置
+}
+
+// LaunchReport 未准备好的子进程的启动环境及与上次成功启动的差异
+type LaunchReport struct {
+	Worker  int      `json:"worker"`            // 工作进程序号
+	Pid     int      `json:"pid,omitempty"`     // 子进程ID
+	Launch  Launch   `json:"launch"`            // 启动环境
+	Changes []string `json:"changes,omitempty"` // 差异，"+"为新增，"-"为删除，"~"为变化；没有成功启动过时为空
+}
+
+// newLaunch 记录子进程的启动环境
+func (object *Daemon) newLaunch(xCmdObj *XCmd) *Launch {
+	launch := &Launch{
+		Args: append([]string(nil), xCmdObj.Args...),
+		Env:  append([]string(nil), xCmdObj.Env...),
+		Dir:  xCmdObj.Dir,
+	}
+	prefix := fmt.Sprintf("--%s=", object.bootstrapArgs)
+	for i, arg := range launch.Args {
+		if !strings.HasPrefix(arg, prefix) {
+			continue
+		}
+		if meta, err := parseBootstrapMeta(strings.TrimPrefix(arg, prefix)); nil == err {
+			meta.Worker.Generation = 0
+			raw, _ := json.Marshal(meta)
+			launch.bootstrap, launch.bootIndex = string(raw), i
+		}
+		break
+	}
+	for i, f := range xCmdObj.ExtraFiles {
+		name := "<nil>"
+		if nil != f {
+			name = f.Name()
+		}
+		launch.Files = append(launch.Files, fmt.Sprintf("%d=%s", 3+i, name))
+	}
+	return launch
+}
+
+// Diff 与之前的启动环境的差异
+func (object *Launch) Diff(previous *Launch) (changes []string) {
+	if nil == previous {
+		return
+	}
+	if 0 < len(object.bootstrap) && object.bootstrap == previous.bootstrap {
+		// 子进程代数每次都会变化，引导参数的其余部分相同时不计入差异
+		object, previous = object.withoutGeneration(), previous.withoutGeneration()
+	}
+	if strings.Join(previous.Args, "\x00") != strings.Join(object.Args, "\x00") {
+		changes = append(changes, fmt.Sprintf("~args %q -> %q", previous.Args, object.Args))
+	}
+	if previous.Dir != object.Dir {
+		changes = append(changes, fmt.Sprintf("~dir %q -> %q", previous.Dir, object.Dir))
+	}
+	changes = append(changes, diffPairs("env ", previous.Env, object.Env)...)
+	changes = append(changes, diffPairs("fd ", previous.Files, object.Files)...)
+	return
+}
+
+// withoutGeneration 去掉子进程代数的副本
+func (object *Launch) withoutGeneration() *Launch {
+	launch := *object
+	launch.Args = append([]string(nil), object.Args...)
+	launch.Args[object.bootIndex] = object.bootstrap
+	launch.Env = nil
+	for _, env := range object.Env {
+		if !strings.HasPrefix(env, EnvWorkerGeneration+"=") {
+			launch.Env = append(launch.Env, env)
+		}
+	}
+	return &launch
+}
+
+// diffPairs 按"key=value"的key比较
+func diffPairs(prefix string, previous, current []string) (changes []string) {
+	old := pairMap(previous)
+	now := pairMap(current)
+	for key, value := range now {
+		if before, ok := old[key]; !ok {
+			changes = append(changes, fmt.Sprintf("+%s%s=%s", prefix, key, value))
+		} else if before != value {
+			changes = append(changes, fmt.Sprintf("~%s%s=%s -> %s", prefix, key, before, value))
+		}
+	}
+	for key, value := range old {
+		if _, ok := now[key]; !ok {
+			changes = append(changes, fmt.Sprintf("-%s%s=%s", prefix, key, value))
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i][1:] < changes[j][1:]
+	})
+	return
+}
+
+// pairMap "key=value"列表转为映射，重复的key以后者为准
+func pairMap(pairs []string) map[string]string {
+	m := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, _ := strings.Cut(pair, "=")
+		m[key] = value
+	}
+	return m
+}
+
+// reportLaunch 子进程未准备好时记录启动环境与差异，写入日志与状态文件的failed_launch
+func (object *Daemon) reportLaunch(xCmdObj *XCmd, launch *Launch) {
+	report := &LaunchReport{
+		Worker:  object.workerIndex,
+		Pid:     xCmdObj.Pid(),
+		Launch:  *launch,
+		Changes: launch.Diff(object.lastLaunch),
+	}
+	if nil == object.lastLaunch {
+		glog.Errorf("child %d not ready, launched with args %q dir %q files %v, no previous successful launch",
+			report.Pid, launch.Args, launch.Dir, launch.Files)
+	} else if 0 >= len(report.Changes) {
+		glog.Errorf("child %d not ready, launch environment unchanged since last success", report.Pid)
+	} else {
+		glog.Errorf("child %d not ready, launch environment changed since last success:\n  %s",
+			report.Pid, strings.Join(report.Changes, "\n  "))
+	}
+	object.statusTarget().setStatus(func(status *Status) {
+		status.FailedLaunch = report
+	})
+}
+
+// launchSucceeded 记录成功启动的环境，清除该工作进程之前的失败报告
+func (object *Daemon) launchSucceeded(launch *Launch) {
+	object.lastLaunch = launch
+	object.statusTarget().setStatus(func(status *Status) {
+		if nil != status.FailedLaunch && object.workerIndex == status.FailedLaunch.Worker {
+			status.FailedLaunch = nil
+		}
+	})
+}
+
+// statusTarget 状态文件所属的Daemon，工作进程写入主Daemon
+func (object *Daemon) statusTarget() *Daemon {
+	if nil != object.primary {
+		return object.primary
+	}
+	return object
+}
@@ -0,0 +1,61 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLaunchDiff(t *testing.T) {
+	previous := &Launch{
+		Args:  []string{"app", "-v"},
+		Env:   []string{"A=1", "B=2"},
+		Dir:   "/srv",
+		Files: []string{"3=readPipe", "5=tcp:80"},
+	}
+	current := &Launch{
+		Args:  []string{"app", "-v"},
+		Env:   []string{"A=1", "B=3", "C=4"},
+		Dir:   "/srv",
+		Files: []string{"3=readPipe"},
+	}
+	want := []string{"~env B=2 -> 3", "+env C=4", "-fd 5=tcp:80"}
+	if changes := current.Diff(previous); !reflect.DeepEqual(want, changes) {
+		t.Fatal(changes)
+	}
+	if changes := current.Diff(nil); nil != changes {
+		t.Fatal(changes)
+	}
+}
+
+func TestLaunchReport(t *testing.T) {
+	var broken int32
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		if 1 == atomic.LoadInt32(&broken) {
+			return xCmdObj.ChildWrite([]byte(ReadyError))
+		}
+		return fakeChild(xCmdObj, args)
+	})
+	if ok, err := object.replaceChildProcess(nil); !ok || nil != err {
+		t.Fatal(ok, err)
+	}
+	if nil != object.Status().FailedLaunch {
+		t.Fatal(object.Status().FailedLaunch)
+	}
+
+	// 新子进程未准备好，报告与上次成功启动的差异
+	object.SetEnv("BROKEN", "1")
+	atomic.StoreInt32(&broken, 1)
+	if ok, err := object.replaceChildProcess(nil); ok || !errors.Is(err, ErrChildNotReady) {
+		t.Fatal(ok, err)
+	}
+	report := object.Status().FailedLaunch
+	if nil == report || 0 == report.Pid || !reflect.DeepEqual([]string{"+env BROKEN=1"}, report.Changes) {
+		t.Fatal(report)
+	}
+	stopFakeDaemon(t, object)
+}
@@ -0,0 +1,46 @@
+package daemon
+
+import (
+	"syscall"
+)
+
+// ListenerControl 绑定前对socket执行的控制函数，同net.ListenConfig.Control，
+// 用于设置包内未提供的选项，如IP_TRANSPARENT、SO_MARK、IP_TOS
+type ListenerControl func(network, address string, c syscall.RawConn) error
+
+// listenerControls 侦听名->控制函数，空名作用于未单独设置的全部侦听
+type listenerControls map[string]ListenerControl
+
+// SetListenerControl 设置名为name的侦听绑定前的控制函数，name为空时作用于未单独设置的全部侦听，
+// control为nil时该侦听不使用控制函数；Unix下由父进程绑定时调用，Windows下由子进程绑定时调用，
+// 父子进程使用同一配置
+func (object *Daemon) SetListenerControl(name string, control ListenerControl) *Daemon {
+	if nil == object.listenerControls {
+		object.listenerControls = make(listenerControls)
+	}
+	object.listenerControls[name] = control
+	return object
+}
+
+// listenerControl 侦听的控制函数，未设置时为nil
+func (object *Daemon) listenerControl(name string) ListenerControl {
+	if control, ok := object.listenerControls[name]; ok {
+		return control
+	}
+	return object.listenerControls[""]
+}
+
+// chainControl 依次执行控制函数，跳过nil，任一失败即返回
+func chainControl(controls ...ListenerControl) ListenerControl {
+	return func(network, address string, c syscall.RawConn) error {
+		for _, control := range controls {
+			if nil == control {
+				continue
+			}
+			if err := control(network, address, c); nil != err {
+				return err
+			}
+		}
+		return nil
+	}
+}
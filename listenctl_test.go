@@ -0,0 +1,53 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+)
+
+func TestListenerControl(t *testing.T) {
+	called := map[string]string{}
+	record := func(name string) ListenerControl {
+		return func(network, address string, c syscall.RawConn) error {
+			called[name] = network
+			var opErr error
+			if err := c.Control(func(fd uintptr) {
+				opErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF, 65536)
+			}); nil != err {
+				return err
+			}
+			return opErr
+		}
+	}
+	object := Default().SetListeners(
+		ListenerSpec{Name: "web", Network: "tcp", Address: "127.0.0.1:0"},
+		ListenerSpec{Name: "dns", Network: "udp", Address: "127.0.0.1:0"},
+		ListenerSpec{Name: "plain", Network: "tcp", Address: "127.0.0.1:0"},
+	).SetListenerControl("", record("all")).
+		SetListenerControl("web", record("web")).
+		SetListenerControl("plain", nil)
+	_, lnFiles, err := object.listen(object.listenerSpecs)
+	if nil != err {
+		t.Fatal(err)
+	}
+	for _, f := range lnFiles {
+		f.Close()
+	}
+	if "tcp4" != called["web"] || "udp4" != called["all"] || 2 != len(called) {
+		t.Fatal(called)
+	}
+
+	// 控制函数失败时绑定失败
+	errDenied := errors.New("denied")
+	object = Default().SetListeners(ListenerSpec{Name: "web", Network: "tcp", Address: "127.0.0.1:0"}).
+		SetListenerControl("web", func(network, address string, c syscall.RawConn) error {
+			return errDenied
+		})
+	if _, _, err = object.listen(object.listenerSpecs); !errors.Is(err, errDenied) || !errors.Is(err, ErrPortBind) {
+		t.Fatal(err)
+	}
+}
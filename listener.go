@@ -0,0 +1,197 @@
+package daemon
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ListenerSpec 父进程侦听的描述
+type ListenerSpec struct {
+	Name    string `json:"name"`    // 唯一名
+	Network string `json:"network"` // tcp/tcp4/tcp6/udp/udp4/udp6/unix/unixgram/unixpacket
+	Address string `json:"address"` // 侦听地址，绑定后为实际地址；Linux下unix侦听以@开头时为抽象命名空间
+	TLS     bool   `json:"tls"`     // 子进程是否应以TLS提供服务
+
+	Options ListenerOptions `json:"options"` // socket选项
+}
+
+// IsPacket 是否为面向报文的侦听，需通过PacketConn获取
+func (object ListenerSpec) IsPacket() bool {
+	switch object.Network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return true
+	}
+	return false
+}
+
+// ListenerInfo 子进程继承的侦听
+type ListenerInfo struct {
+	ListenerSpec
+	Fd     int    `json:"fd"`               // 子进程中的fd，Windows下为子进程自行绑定的句柄
+	Family string `json:"family,omitempty"` // 绑定后实际的地址族，IPFamilyV4/IPFamilyV6/IPFamilyDual/IPFamilyUnix
+}
+
+// TCPListenerSpecs 由端口表构建TCP侦听描述，按名字排序
+func TCPListenerSpecs(tcpPorts map[string]int) []ListenerSpec {
+	specs := make([]ListenerSpec, 0, len(tcpPorts))
+	for name, port := range tcpPorts {
+		specs = append(specs, ListenerSpec{
+			Name:    name,
+			Network: "tcp",
+			Address: fmt.Sprintf("0.0.0.0:%d", port),
+		})
+	}
+	sort.Slice(specs, func(i, j int) bool {
+		return specs[i].Name < specs[j].Name
+	})
+	return specs
+}
+
+// parseBootstrapArgs 解析引导参数，兼容旧版父进程传入的 名字->fd 表
+func parseBootstrapArgs(raw string) (infos []ListenerInfo, err error) {
+	if strings.HasPrefix(strings.TrimSpace(raw), "{") {
+		tcpFds := make(map[string]int)
+		if err = json.Unmarshal([]byte(raw), &tcpFds); nil != err {
+			return
+		}
+		for name, fd := range tcpFds {
+			infos = append(infos, ListenerInfo{
+				ListenerSpec: ListenerSpec{Name: name, Network: "tcp"},
+				Fd:           fd,
+			})
+		}
+		return
+	}
+	err = json.Unmarshal([]byte(raw), &infos)
+	return
+}
+
+// Registry 子进程继承的侦听注册表
+type Registry struct {
+	sync.Mutex
+	infos       map[string]ListenerInfo   // 侦听描述
+	listeners   map[string]net.Listener   // 已构建的Listener
+	packetConns map[string]net.PacketConn // 已构建的PacketConn
+	tls         *tlsStore                 // 父进程下发的证书，未配置时为nil
+	secrets     *secretStore              // 父进程下发的机密，未配置时为nil
+	dryRun      bool                      // 更新前的启动校验
+	worker      WorkerInfo                // 子进程身份
+	subscribers []func(msg []byte)        // 父进程推送消息的订阅者
+	topics      map[string][]func([]byte) // 总线主题的订阅者
+	parent      *XCmd                     // 与父进程的通信对象，前台运行时为nil
+	handoff     *handoffReceiver          // 接收父进程分发的连接，未开启时为nil
+	gates       *readiness                // 准备好条件
+	reloaders   []func()                  // 收到重载指令时的回调
+	drainOrders map[string]drainOrder     // 侦听的排空顺序
+	preparers   []func() error            // 更新前的回调
+	fdSlots     map[string]int            // 父进程传入的命名fd槽位
+	deploy      *Deploy                   // 所属的部署，父进程未附带时为nil
+	sockets     map[string]io.Closer      // Windows下子进程独占绑定的侦听，Unix下为nil
+}
+
+// newRegistry 工厂方法
+func newRegistry(infos []ListenerInfo) *Registry {
+	object := &Registry{
+		infos:       make(map[string]ListenerInfo),
+		listeners:   make(map[string]net.Listener),
+		packetConns: make(map[string]net.PacketConn),
+		gates:       newReadiness(),
+	}
+	for _, info := range infos {
+		object.infos[info.Name] = info
+	}
+	return object
+}
+
+// Names 所有侦听名，按名字排序
+func (object *Registry) Names() []string {
+	names := make([]string, 0, len(object.infos))
+	for name := range object.infos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Info 侦听描述
+func (object *Registry) Info(name string) (info ListenerInfo, ok bool) {
+	info, ok = object.infos[name]
+	return
+}
+
+// Fds 名字->fd 表，兼容Bootstrap的业务逻辑
+func (object *Registry) Fds() map[string]int {
+	fds := make(map[string]int)
+	for name, info := range object.infos {
+		fds[name] = info.Fd
+	}
+	return fds
+}
+
+// TLSConfig 父进程下发证书时的TLS配置，未配置时返回nil；
+// 适用于需要自行包装侦听的场景，如HTTP/2或gRPC
+func (object *Registry) TLSConfig() *tls.Config {
+	if nil == object.tls {
+		return nil
+	}
+	return object.tls.config()
+}
+
+// TrackTicketKeys 让自行管理证书的配置也使用父进程轮换的票据密钥，未开启时原样返回
+func (object *Registry) TrackTicketKeys(config *tls.Config) *tls.Config {
+	if nil == object.tls {
+		return config
+	}
+	return object.tls.track(config)
+}
+
+// Listener 获取面向流的侦听，Info.TLS为真且父进程下发了证书时返回TLS侦听，多次获取返回同一对象
+func (object *Registry) Listener(name string) (ln net.Listener, err error) {
+	object.Lock()
+	defer object.Unlock()
+	if ln = object.listeners[name]; nil != ln {
+		return
+	}
+	info, ok := object.infos[name]
+	if !ok || info.IsPacket() {
+		err = fmt.Errorf("listener not found: %s", name)
+		return
+	}
+	if info.Options.AcceptInParent && 0 > info.Fd && nil != object.handoff {
+		ln = object.handoff.listener(info)
+	} else if ln, err = object.fileListener(info); nil != err {
+		return
+	}
+	ln = wrapListener(ln, info.Options)
+	if info.TLS && nil != object.tls {
+		// 证书由父进程管理，重载后无需重建侦听
+		ln = tls.NewListener(ln, object.tls.config())
+	}
+	object.listeners[name] = ln
+	return
+}
+
+// PacketConn 获取面向报文的侦听，多次获取返回同一对象
+func (object *Registry) PacketConn(name string) (conn net.PacketConn, err error) {
+	object.Lock()
+	defer object.Unlock()
+	if conn = object.packetConns[name]; nil != conn {
+		return
+	}
+	info, ok := object.infos[name]
+	if !ok || !info.IsPacket() {
+		err = fmt.Errorf("packet conn not found: %s", name)
+		return
+	}
+	if conn, err = object.filePacketConn(info); nil != err {
+		return
+	}
+	object.packetConns[name] = conn
+	return
+}
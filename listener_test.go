@@ -0,0 +1,151 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestListenerRegistry(t *testing.T) {
+	specs := []ListenerSpec{
+		{Name: "web", Network: "tcp", Address: "127.0.0.1:0", TLS: true},
+		{Name: "dns", Network: "udp", Address: "127.0.0.1:0"},
+		{Name: "admin", Network: "unix", Address: filepath.Join(t.TempDir(), "admin.sock")},
+	}
+	object := Default()
+	specs, lnFiles, err := object.listen(specs)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// 模拟子进程继承的fd，经引导参数传递
+	var infos []ListenerInfo
+	for _, spec := range specs {
+		fd, err := syscall.Dup(int(lnFiles[spec.Name].Fd()))
+		if nil != err {
+			t.Fatal(err)
+		}
+		infos = append(infos, ListenerInfo{ListenerSpec: spec, Fd: fd})
+		lnFiles[spec.Name].Close()
+	}
+	raw, _ := json.Marshal(infos)
+	if infos, err = parseBootstrapArgs(string(raw)); nil != err {
+		t.Fatal(err)
+	}
+	registry := newRegistry(infos)
+
+	if info, ok := registry.Info("web"); !ok || !info.TLS || "127.0.0.1:0" == info.Address {
+		t.Fatal(info)
+	}
+	ln, err := registry.Listener("web")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if again, _ := registry.Listener("web"); again != ln {
+		t.Fatal("listener not cached")
+	}
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if nil != err {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	packetConn, err := registry.PacketConn("dns")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if _, err = registry.Listener("dns"); nil == err {
+		t.Fatal("udp as listener")
+	}
+	if _, err = registry.Listener("admin"); nil != err {
+		t.Fatal(err)
+	}
+	if 3 != len(registry.Names()) || 3 != len(registry.Fds()) {
+		t.Fatal(registry.Names())
+	}
+	ln.Close()
+	packetConn.Close()
+}
+
+func TestListenKeepsSpecs(t *testing.T) {
+	configured := []ListenerSpec{{Name: "web", Network: "tcp", Address: "127.0.0.1:0"}}
+	object := Default().SetListeners(configured...)
+
+	// 传入的描述保持配置的原样，实际地址只在返回的副本中
+	bound, lnFiles, err := object.listen(object.listenerSpecs)
+	if nil != err {
+		t.Fatal(err)
+	}
+	lnFiles["web"].Close()
+	if "127.0.0.1:0" != object.listenerSpecs[0].Address || "127.0.0.1:0" != configured[0].Address {
+		t.Fatal(object.listenerSpecs, configured)
+	}
+	if "127.0.0.1:0" == bound[0].Address || "web" != bound[0].Name {
+		t.Fatal(bound)
+	}
+}
+
+func TestParseLegacyBootstrapArgs(t *testing.T) {
+	infos, err := parseBootstrapArgs(`{"web":5}`)
+	if nil != err || 1 != len(infos) || "web" != infos[0].Name || "tcp" != infos[0].Network || 5 != infos[0].Fd {
+		t.Fatal(err, infos)
+	}
+}
+
+func TestListenerOptions(t *testing.T) {
+	noDelay := false
+	specs := []ListenerSpec{{
+		Name:    "web",
+		Network: "tcp",
+		Address: "127.0.0.1:0",
+		Options: ListenerOptions{
+			NoDelay:       &noDelay,
+			KeepAlive:     -1,
+			Backlog:       16,
+			DeferAccept:   2 * time.Second,
+			FastOpen:      8,
+			ProxyProtocol: true,
+		},
+	}}
+	specs, lnFiles, err := Default().listen(specs)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// 选项随引导参数传给子进程
+	fd, _ := syscall.Dup(int(lnFiles["web"].Fd()))
+	lnFiles["web"].Close()
+	raw, _ := json.Marshal([]ListenerInfo{{ListenerSpec: specs[0], Fd: fd}})
+	infos, err := parseBootstrapArgs(string(raw))
+	if nil != err || !infos[0].Options.ProxyProtocol || nil == infos[0].Options.NoDelay || *infos[0].Options.NoDelay {
+		t.Fatal(err, infos)
+	}
+	ln, err := newRegistry(infos).Listener("web")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if _, ok := ln.(*optionListener); !ok {
+		t.Fatalf("%T", ln)
+	}
+	go func() {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if nil == err {
+			// 开启defer accept时需发送数据才会被接受
+			conn.Write([]byte("x"))
+			defer conn.Close()
+			time.Sleep(100 * time.Millisecond)
+		}
+	}()
+	conn, err := ln.Accept()
+	if nil != err {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
@@ -0,0 +1,200 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// ListenerSource 重载时重新读取侦听描述，如重新解析配置文件
+type ListenerSource func() ([]ListenerSpec, error)
+
+// listenerSetState 侦听集合的重载状态
+type listenerSetState struct {
+	source     ListenerSource  // 为nil时侦听集合在启动后固定
+	configured []ListenerSpec  // 配置的侦听描述，绑定前的原样，用于比较变化
+	pending    *listenerChange // 进行中的变化，随更新结束提交或回滚
+}
+
+// listenerChange 一次侦听集合的变化，保存变化前的集合用于回滚
+type listenerChange struct {
+	configured []ListenerSpec      // 变化前配置的侦听描述
+	specs      []ListenerSpec      // 变化前绑定的侦听描述
+	lnFiles    map[string]*os.File // 变化前的侦听文件
+	added      []string            // 新增或改动的侦听名
+	removed    []string            // 移除或改动的侦听名
+	reused     []string            // 地址未变只改动选项、沿用原侦听的侦听名
+}
+
+// SetListenerSource 设置重载时读取侦听描述的函数。侦听有增删或改动时，父进程绑定新增的侦听，
+// 强制热更新子进程使其取得新的侦听集合，旧子进程退出后再关闭移除的侦听；更新失败时恢复原来的侦听。
+// 同名侦听的地址改动按先增后删处理，地址未变只改动选项时沿用原侦听并重新应用绑定期选项；
+// 重载时端口被占用不重试，由父进程接受连接的侦听不能增删或改动；前台运行时不生效
+func (object *Daemon) SetListenerSource(source ListenerSource) *Daemon {
+	object.listenerSet.source = source
+	return object
+}
+
+// changeListeners 重新读取侦听描述，有变化时绑定新增的侦听并切换到新集合，返回是否有变化；
+// 子进程热更新后才取得新侦听，更新结束时调用commitListeners提交或回滚
+func (object *Daemon) changeListeners() (changed bool, err error) {
+	var configured []ListenerSpec
+	if configured, err = object.listenerSet.source(); nil != err {
+		return false, fmt.Errorf("daemon: reload listeners: %w", err)
+	}
+	prev := make(map[string]ListenerSpec, len(object.listenerSet.configured))
+	for _, spec := range object.listenerSet.configured {
+		prev[spec.Name] = spec
+	}
+	bound := make(map[string]ListenerSpec, len(object.listenerSpecs))
+	for _, spec := range object.listenerSpecs {
+		bound[spec.Name] = spec
+	}
+
+	// 与配置的原样或已绑定的描述相同即未变化，已绑定的地址可能是实际分配的端口
+	change := &listenerChange{
+		configured: object.listenerSet.configured,
+		specs:      object.listenerSpecs,
+		lnFiles:    object.lnFiles,
+	}
+	seen := make(map[string]bool, len(configured))
+	var added []ListenerSpec
+	for _, spec := range configured {
+		if seen[spec.Name] {
+			return false, fmt.Errorf("daemon: reload listeners: duplicate listener %q", spec.Name)
+		}
+		seen[spec.Name] = true
+		old, ok := prev[spec.Name]
+		if ok && (reflect.DeepEqual(old, spec) || reflect.DeepEqual(bound[spec.Name], spec)) {
+			continue
+		}
+		if spec.Options.AcceptInParent || (ok && old.Options.AcceptInParent) {
+			return false, fmt.Errorf("daemon: reload listeners: listener %s accepts in parent and is fixed at startup", spec.Name)
+		}
+		if ok {
+			change.removed = append(change.removed, spec.Name)
+		}
+		change.added = append(change.added, spec.Name)
+		if ok && sameSocket(old, spec) {
+			// 同一地址无法先绑定新侦听，沿用已绑定的
+			reused := spec
+			reused.Network, reused.Address = bound[spec.Name].Network, bound[spec.Name].Address
+			bound[spec.Name] = reused
+			change.reused = append(change.reused, spec.Name)
+			continue
+		}
+		added = append(added, spec)
+	}
+	for _, spec := range object.listenerSet.configured {
+		if seen[spec.Name] {
+			continue
+		}
+		if spec.Options.AcceptInParent {
+			return false, fmt.Errorf("daemon: reload listeners: listener %s accepts in parent and is fixed at startup", spec.Name)
+		}
+		change.removed = append(change.removed, spec.Name)
+	}
+	if 0 == len(change.added) && 0 == len(change.removed) {
+		return false, nil
+	}
+
+	// 绑定新增的侦听，使用实际绑定的地址；在主循环中绑定，不重试
+	var addedFiles map[string]*os.File
+	if added, addedFiles, err = object.listenRetry(added, BindRetry{}); nil != err {
+		return false, err
+	}
+	for _, name := range change.reused {
+		object.reapplyOptions(bound[name])
+	}
+	for _, spec := range added {
+		bound[spec.Name] = spec
+	}
+	specs := make([]ListenerSpec, 0, len(configured))
+	lnFiles := make(map[string]*os.File, len(configured))
+	for _, spec := range configured {
+		specs = append(specs, bound[spec.Name])
+		if f, ok := addedFiles[spec.Name]; ok {
+			lnFiles[spec.Name] = f
+		} else if f, ok := object.lnFiles[spec.Name]; ok {
+			lnFiles[spec.Name] = f
+		}
+	}
+	object.listenerSet.configured = append([]ListenerSpec(nil), configured...)
+	object.listenerSet.pending = change
+	object.setListeners(specs, lnFiles)
+	glog.Infof("listeners changed, added %v, removed %v", change.added, change.removed)
+	return true, nil
+}
+
+// commitListeners 更新结束时提交侦听集合的变化：成功时旧子进程已退出，关闭移除的侦听；
+// 失败时旧子进程仍在运行，恢复原来的侦听并关闭新绑定的
+func (object *Daemon) commitListeners(ok bool) {
+	change := object.listenerSet.pending
+	if nil == change {
+		return
+	}
+	object.listenerSet.pending = nil
+	outSpecs, outFiles, keep := change.specs, change.lnFiles, object.lnFiles
+	if !ok {
+		outSpecs, outFiles, keep = object.listenerSpecs, object.lnFiles, change.lnFiles
+		object.listenerSet.configured = change.configured
+		object.setListeners(change.specs, change.lnFiles)
+		for _, spec := range change.specs {
+			for _, name := range change.reused {
+				if name == spec.Name {
+					object.reapplyOptions(spec)
+				}
+			}
+		}
+		glog.Warningf("listeners change rolled back, added %v, removed %v", change.added, change.removed)
+	}
+	kept := make(map[*os.File]bool, len(keep))
+	for _, f := range keep {
+		kept[f] = true
+	}
+	for _, spec := range outSpecs {
+		if f, found := outFiles[spec.Name]; found && !kept[f] {
+			f.Close()
+			removeSocketFile(spec.Network, spec.Address)
+		}
+	}
+	if ok {
+		object.emit(Event{
+			Type:   EventListenersChanged,
+			Reason: fmt.Sprintf("added %s; removed %s", strings.Join(change.added, ","), strings.Join(change.removed, ",")),
+		})
+	}
+}
+
+// sameSocket 两个侦听描述是否绑定同一socket，只有选项改动时可沿用
+func sameSocket(a ListenerSpec, b ListenerSpec) bool {
+	return a.Network == b.Network && a.Address == b.Address && a.Options.IPFamily == b.Options.IPFamily
+}
+
+// reapplyOptions 对沿用的侦听重新应用绑定期选项，失败时保留原选项继续服务
+func (object *Daemon) reapplyOptions(spec ListenerSpec) {
+	f, ok := object.lnFiles[spec.Name]
+	if !ok || !strings.HasPrefix(spec.Network, "tcp") {
+		return
+	}
+	if err := applyFileOptions(f, spec.Options); nil != err {
+		glog.Warningf("listener %s: reapply options: %v", spec.Name, err)
+	}
+}
+
+// setListeners 切换侦听集合，工作进程随之切换，之后派生的子进程使用新集合
+func (object *Daemon) setListeners(specs []ListenerSpec, lnFiles map[string]*os.File) {
+	object.Lock()
+	object.listenerSpecs, object.lnFiles = specs, lnFiles
+	object.Unlock()
+	object.workersLock.Lock()
+	defer object.workersLock.Unlock()
+	for _, worker := range object.workers {
+		worker.Lock()
+		worker.listenerSpecs = specs
+		worker.Unlock()
+	}
+}
@@ -0,0 +1,166 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"errors"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+)
+
+func TestReloadListeners(t *testing.T) {
+	var lock sync.Mutex
+	var spawned [][]string
+	specs := []ListenerSpec{
+		{Name: "web", Network: "tcp", Address: "127.0.0.1:0"},
+		{Name: "api", Network: "tcp", Address: "127.0.0.1:0"},
+	}
+	var refuse int32
+	var events []Event
+	object, signalCh, doneCh := startFakeParent(t, withChild(func(xCmdObj *XCmd, args []string) error {
+		meta, _ := parseBootstrapMeta(strings.TrimPrefix(args[len(args)-1], "--bootstrap_args="))
+		var names []string
+		for _, info := range meta.Listeners {
+			names = append(names, info.Name)
+		}
+		sort.Strings(names)
+		lock.Lock()
+		spawned = append(spawned, names)
+		lock.Unlock()
+		return fakeChild(xCmdObj, args)
+	}), withSetup(func(object *Daemon) {
+		object.origArgs = []string{os.Args[0]}
+		object.SetListeners(specs...).
+			SetListenerSource(func() ([]ListenerSpec, error) {
+				lock.Lock()
+				defer lock.Unlock()
+				return append([]ListenerSpec(nil), specs...), nil
+			}).
+			AddPreflight("refuse", func(binary string) error {
+				if 1 == atomic.LoadInt32(&refuse) {
+					return errors.New("refused")
+				}
+				return nil
+			}).
+			OnEvent(func(event Event) {
+				if EventListenersChanged == event.Type {
+					events = append(events, event)
+				}
+			})
+	}))
+	web, api := object.lnFiles["web"], object.lnFiles["api"]
+
+	// 未变化时只重载证书，不更新
+	if err := object.Reload(); nil != err {
+		t.Fatal(err)
+	}
+	lock.Lock()
+	if 1 != len(spawned) {
+		t.Fatal(spawned)
+	}
+	// 移除api，新增admin
+	specs = []ListenerSpec{
+		{Name: "web", Network: "tcp", Address: "127.0.0.1:0"},
+		{Name: "admin", Network: "tcp", Address: "127.0.0.1:0"},
+	}
+	lock.Unlock()
+	if err := object.Reload(); nil != err {
+		t.Fatal(err)
+	}
+	lock.Lock()
+	if !reflect.DeepEqual([][]string{{"api", "web"}, {"admin", "web"}}, spawned) {
+		t.Fatal(spawned)
+	}
+	lock.Unlock()
+	if web != object.lnFiles["web"] || nil == object.lnFiles["admin"] || 2 != len(object.lnFiles) {
+		t.Fatal(object.lnFiles)
+	}
+	if ^uintptr(0) != api.Fd() {
+		t.Fatal("removed listener not closed")
+	}
+	if 1 != len(events) || "added admin; removed api" != events[0].Reason {
+		t.Fatal(events)
+	}
+
+	// 更新被拒绝时恢复原来的侦听并关闭新绑定的
+	atomic.StoreInt32(&refuse, 1)
+	lock.Lock()
+	specs = append(specs, ListenerSpec{Name: "metrics", Network: "tcp", Address: "127.0.0.1:0"})
+	lock.Unlock()
+	if err := object.Reload(); !errors.Is(err, ErrPreflight) {
+		t.Fatal(err)
+	}
+	if 2 != len(object.lnFiles) || nil != object.lnFiles["metrics"] || 2 != len(object.listenerSpecs) {
+		t.Fatal(object.lnFiles, object.listenerSpecs)
+	}
+	atomic.StoreInt32(&refuse, 0)
+
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadListenerOptions(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	address := ln.Addr().String()
+	ln.Close()
+
+	var lock sync.Mutex
+	var spawned []ListenerInfo
+	specs := []ListenerSpec{{Name: "web", Network: "tcp", Address: address}}
+	object, signalCh, doneCh := startFakeParent(t, withChild(func(xCmdObj *XCmd, args []string) error {
+		meta, _ := parseBootstrapMeta(strings.TrimPrefix(args[len(args)-1], "--bootstrap_args="))
+		lock.Lock()
+		spawned = append(spawned, meta.Listeners...)
+		lock.Unlock()
+		return fakeChild(xCmdObj, args)
+	}), withSetup(func(object *Daemon) {
+		object.origArgs = []string{os.Args[0]}
+		object.SetListeners(specs...).
+			SetListenerSource(func() ([]ListenerSpec, error) {
+				lock.Lock()
+				defer lock.Unlock()
+				return append([]ListenerSpec(nil), specs...), nil
+			})
+	}))
+	web := object.lnFiles["web"]
+
+	// 固定地址只改动选项时沿用原侦听，不重新绑定
+	lock.Lock()
+	specs = []ListenerSpec{{Name: "web", Network: "tcp", Address: address, TLS: true,
+		Options: ListenerOptions{ProxyProtocol: true, Backlog: 64}}}
+	lock.Unlock()
+	if err = object.Reload(); nil != err {
+		t.Fatal(err)
+	}
+	if web != object.lnFiles["web"] || 1 != len(object.lnFiles) {
+		t.Fatal(object.lnFiles)
+	}
+	lock.Lock()
+	if 2 != len(spawned) || spawned[1].Address != address || !spawned[1].TLS || !spawned[1].Options.ProxyProtocol {
+		t.Fatal(spawned)
+	}
+	lock.Unlock()
+	conn, err := net.Dial("tcp", address)
+	if nil != err {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	signalCh <- syscall.SIGTERM
+	if err = <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,190 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// 日志级别
+const (
+	LogInfo    = "INFO"
+	LogWarning = "WARNING"
+	LogError   = "ERROR"
+)
+
+// LogRecord 子进程转发给父进程的结构化日志
+type LogRecord struct {
+	Time       time.Time         `json:"time"`                 // 时间
+	Level      string            `json:"level"`                // 级别
+	Message    string            `json:"message"`              // 内容
+	Fields     map[string]string `json:"fields,omitempty"`     // 附加字段
+	Worker     int               `json:"worker"`               // 工作进程序号，父进程填写
+	Generation uint64            `json:"generation,omitempty"` // 代数，父进程填写
+	Pid        int               `json:"pid,omitempty"`        // 子进程ID，父进程填写
+}
+
+// Log 经父进程转发日志，父进程统一打上工作进程标签写入同一文件；
+// 前台运行时直接写入glog
+func (object *Registry) Log(level, message string, fields map[string]string) error {
+	record := LogRecord{
+		Time:    time.Now(),
+		Level:   level,
+		Message: message,
+		Fields:  fields,
+	}
+	if nil == object.parent {
+		record.Pid = os.Getpid()
+		logRecord(record)
+		return nil
+	}
+	raw, err := json.Marshal(record)
+	if nil != err {
+		return err
+	}
+	return object.parent.ChildWriteStream(StreamLog, raw)
+}
+
+// LogWriter 每次Write作为一条INFO日志转发，可用于log.SetOutput等
+func (object *Registry) LogWriter() *LogWriter {
+	return &LogWriter{registry: object, level: LogInfo}
+}
+
+// LogWriter 转发日志的写入器
+type LogWriter struct {
+	registry *Registry // 转发所用的注册表
+	level    string    // 日志级别
+}
+
+// Write 写入一条日志，去掉末尾换行
+func (object *LogWriter) Write(p []byte) (n int, err error) {
+	message := string(p)
+	for 0 < len(message) && '\n' == message[len(message)-1] {
+		message = message[:len(message)-1]
+	}
+	if err = object.registry.Log(object.level, message, nil); nil != err {
+		return
+	}
+	n = len(p)
+	return
+}
+
+// SetLogForwarding 设置把子进程转发的日志写入path，每行一条JSON，
+// 超过maxSize字节时轮转，保留maxBackups个旧文件；未设置时转发的日志写入glog
+func (object *Daemon) SetLogForwarding(path string, maxSize int64, maxBackups int) *Daemon {
+	object.logSink = &logRotator{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	return object
+}
+
+// forwardLog 记录子进程转发的日志
+func (object *Daemon) forwardLog(xCmdObj *XCmd, raw []byte) {
+	var record LogRecord
+	if err := json.Unmarshal(raw, &record); nil != err {
+		glog.Error(err)
+		return
+	}
+	record.Worker = xCmdObj.worker.Index
+	record.Generation = xCmdObj.worker.Generation
+	record.Pid = xCmdObj.Pid()
+	if nil == object.logSink {
+		logRecord(record)
+		return
+	}
+	line, _ := json.Marshal(record)
+	if _, err := object.logSink.Write(append(line, '\n')); nil != err {
+		glog.Error(err)
+	}
+}
+
+// logRecord 写入glog
+func logRecord(record LogRecord) {
+	message := fmt.Sprintf("[worker %d pid %d] %s", record.Worker, record.Pid, record.Message)
+	for key, value := range record.Fields {
+		message += fmt.Sprintf(" %s=%s", key, value)
+	}
+	switch record.Level {
+	case LogError:
+		glog.ErrorDepth(1, message)
+	case LogWarning:
+		glog.WarningDepth(1, message)
+	default:
+		glog.InfoDepth(1, message)
+	}
+}
+
+// logRotator 按大小轮转的日志文件
+type logRotator struct {
+	sync.Mutex
+	path       string   // 文件路径
+	maxSize    int64    // 轮转阈值，0表示不轮转
+	maxBackups int      // 保留的旧文件数
+	file       *os.File // 当前文件
+	size       int64    // 当前文件大小
+}
+
+// Write 写入，超过阈值先轮转
+func (object *logRotator) Write(p []byte) (n int, err error) {
+	object.Lock()
+	defer object.Unlock()
+	if nil == object.file {
+		if err = object.open(); nil != err {
+			return
+		}
+	}
+	if 0 < object.maxSize && 0 < object.size && object.size+int64(len(p)) > object.maxSize {
+		if err = object.rotate(); nil != err {
+			return
+		}
+	}
+	n, err = object.file.Write(p)
+	object.size += int64(n)
+	return
+}
+
+// open 打开当前文件
+func (object *logRotator) open() (err error) {
+	if object.file, err = os.OpenFile(object.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); nil != err {
+		return
+	}
+	var info os.FileInfo
+	if info, err = object.file.Stat(); nil != err {
+		return
+	}
+	object.size = info.Size()
+	return
+}
+
+// rotate 轮转：path.N-1 -> path.N，path -> path.1
+func (object *logRotator) rotate() error {
+	object.file.Close()
+	object.file = nil
+	if 0 >= object.maxBackups {
+		os.Remove(object.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", object.path, object.maxBackups))
+		for i := object.maxBackups - 1; 0 < i; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", object.path, i), fmt.Sprintf("%s.%d", object.path, i+1))
+		}
+		os.Rename(object.path, object.path+".1")
+	}
+	return object.open()
+}
+
+// Close 关闭当前文件
+func (object *logRotator) Close() (err error) {
+	object.Lock()
+	defer object.Unlock()
+	if nil != object.file {
+		err = object.file.Close()
+		object.file = nil
+	}
+	return
+}
@@ -0,0 +1,47 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogForwarding(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "workers.log")
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		registry := newRegistry(nil)
+		registry.parent = xCmdObj
+		registry.Log(LogInfo, "starting", map[string]string{"shard": "3"})
+		xCmdObj.ChildWrite([]byte(ReadyOK))
+		registry.LogWriter().Write([]byte("serving\n"))
+		return fakeChild(xCmdObj, args)
+	})
+	object.SetLogForwarding(path, 64, 1)
+	if ok, err := object.replaceChildProcess(nil); !ok || nil != err {
+		t.Fatal(ok, err)
+	}
+	waitFor(t, func() bool {
+		raw, _ := ioutil.ReadFile(path)
+		return strings.Contains(string(raw), "serving")
+	})
+	stopFakeDaemon(t, object)
+	object.logSink.Close()
+
+	// 第一条超过阈值后轮转到.1
+	raw, err := ioutil.ReadFile(path + ".1")
+	if nil != err {
+		t.Fatal(err)
+	}
+	var record LogRecord
+	if err = json.Unmarshal(raw, &record); nil != err {
+		t.Fatal(err)
+	}
+	if "starting" != record.Message || "3" != record.Fields["shard"] || 1 != record.Generation || 0 == record.Pid {
+		t.Fatal(record)
+	}
+}
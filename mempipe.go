@@ -0,0 +1,111 @@
+package daemon
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// memPipe 内存管道，写入不阻塞，语义与os.Pipe一致
+type memPipe struct {
+	sync.Mutex
+	cond         *sync.Cond
+	buf          bytes.Buffer
+	readClosed   bool
+	writeClosed  bool
+	readDeadline time.Time   // 读超时
+	readTimer    *time.Timer // 读超时唤醒
+}
+
+// memPipeReader 内存管道读端
+type memPipeReader struct {
+	*memPipe
+}
+
+// memPipeWriter 内存管道写端
+type memPipeWriter struct {
+	*memPipe
+}
+
+// newMemPipe 新建内存管道
+func newMemPipe() (io.ReadCloser, io.WriteCloser) {
+	object := &memPipe{}
+	object.cond = sync.NewCond(&object.Mutex)
+	return &memPipeReader{object}, &memPipeWriter{object}
+}
+
+// Read 读取，无数据时阻塞，写端关闭后返回EOF
+func (object *memPipeReader) Read(p []byte) (n int, err error) {
+	object.Lock()
+	defer object.Unlock()
+	for 0 == object.buf.Len() && !object.writeClosed && !object.readClosed {
+		if !object.readDeadline.IsZero() && !time.Now().Before(object.readDeadline) {
+			return 0, os.ErrDeadlineExceeded
+		}
+		object.cond.Wait()
+	}
+	if object.readClosed {
+		return 0, io.ErrClosedPipe
+	}
+	if 0 == object.buf.Len() {
+		return 0, io.EOF
+	}
+	return object.buf.Read(p)
+}
+
+// SetReadDeadline 设置读超时，零值表示不超时
+func (object *memPipeReader) SetReadDeadline(t time.Time) error {
+	object.Lock()
+	defer object.Unlock()
+	object.readDeadline = t
+	if nil != object.readTimer {
+		object.readTimer.Stop()
+		object.readTimer = nil
+	}
+	if !t.IsZero() {
+		object.readTimer = time.AfterFunc(time.Until(t), func() {
+			object.Lock()
+			object.cond.Broadcast()
+			object.Unlock()
+		})
+	}
+	object.cond.Broadcast()
+	return nil
+}
+
+// Close 关闭读端
+func (object *memPipeReader) Close() error {
+	object.Lock()
+	defer object.Unlock()
+	object.readClosed = true
+	object.cond.Broadcast()
+	return nil
+}
+
+// Write 写入
+func (object *memPipeWriter) Write(p []byte) (n int, err error) {
+	object.Lock()
+	defer object.Unlock()
+	if object.writeClosed || object.readClosed {
+		return 0, io.ErrClosedPipe
+	}
+	n, err = object.buf.Write(p)
+	object.cond.Broadcast()
+	return
+}
+
+// SetWriteDeadline 写入不阻塞，无需超时
+func (object *memPipeWriter) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// Close 关闭写端
+func (object *memPipeWriter) Close() error {
+	object.Lock()
+	defer object.Unlock()
+	object.writeClosed = true
+	object.cond.Broadcast()
+	return nil
+}
@@ -0,0 +1,172 @@
+package daemon
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// childEventBacklog 暂存子进程消息的数量
+const childEventBacklog = 64
+
+// childEventWait 有读取者时投递子进程消息最长等待的时间，超过后丢弃
+const childEventWait = time.Second
+
+// dispatchChild 子进程准备好后由分发协程独占读取，总线消息交给代理，日志写入汇总文件，
+// 替换请求投递给主循环，其余消息经events交给waitChildSafeExit，子进程退出后关闭events
+func (object *Daemon) dispatchChild(xCmdObj *XCmd) {
+	xCmdObj.events = make(chan streamMessage, childEventBacklog)
+	atomic.StoreInt64(&xCmdObj.lastBeat, time.Now().UnixNano())
+	go func() {
+		defer close(xCmdObj.events)
+		defer object.bus.remove(xCmdObj)
+		err := xCmdObj.ParentReadStreams(func(stream uint32, raw []byte) bool {
+			if StreamControl == stream && nil == raw {
+				return false
+			}
+			if StreamControl == stream {
+				if reason, ok := parseRestartRequest(raw); ok {
+					object.requestRestart(xCmdObj, reason)
+					return true
+				}
+			}
+			if StreamBus == stream {
+				object.bus.handle(xCmdObj, raw)
+				return true
+			}
+			if StreamLog == stream {
+				object.forwardLog(xCmdObj, raw)
+				return true
+			}
+			if StreamMessage == stream {
+				object.childMessage(xCmdObj, raw)
+				return true
+			}
+			if StreamLoad == stream {
+				xCmdObj.setLoad(raw)
+				return true
+			}
+			if StreamHeartbeat == stream {
+				atomic.StoreInt64(&xCmdObj.lastBeat, time.Now().UnixNano())
+				return true
+			}
+			if StreamGate == stream {
+				xCmdObj.gates.apply(raw)
+				return true
+			}
+			xCmdObj.pushEvent(streamMessage{stream: stream, data: append([]byte(nil), raw...)})
+			return true
+		})
+		if nil != err && !xCmdObj.readPipe.IsClosed() {
+			glog.Error(err)
+		}
+		object.watchIPC(xCmdObj)
+	}()
+}
+
+// pushEvent 把消息交给events的读取者，只有排空与更新协商期间有读取者：
+// 有读取者时等待其取走，最长childEventWait；没有读取者时缓冲满即丢弃最旧的消息。
+// 分发协程不因无人读取而阻塞，心跳、总线与日志照常处理
+func (object *XCmd) pushEvent(message streamMessage) {
+	if 0 < atomic.LoadInt32(&object.eventReaders) {
+		timer := time.NewTimer(childEventWait)
+		defer timer.Stop()
+		select {
+		case object.events <- message:
+		case <-timer.C:
+			glog.Warningf("child: %d drop message of stream %d, reader busy", object.Pid(), message.stream)
+		}
+		return
+	}
+	for {
+		select {
+		case object.events <- message:
+			return
+		default:
+		}
+		select {
+		case dropped := <-object.events:
+			glog.V(1).Infof("child: %d drop unread message of stream %d", object.Pid(), dropped.stream)
+		default:
+		}
+	}
+}
+
+// readEvents 开始读取events，返回结束读取的函数
+func (object *XCmd) readEvents() func() {
+	atomic.AddInt32(&object.eventReaders, 1)
+	return func() {
+		atomic.AddInt32(&object.eventReaders, -1)
+	}
+}
+
+// children 当前的全部子进程，调用方需持有读锁
+func (object *Daemon) children() (children []*XCmd) {
+	if nil != object.xCmdObj {
+		children = append(children, object.xCmdObj)
+	}
+	object.workersLock.Lock()
+	workers := make([]*Daemon, len(object.workers))
+	copy(workers, object.workers)
+	object.workersLock.Unlock()
+	for _, worker := range workers {
+		worker.RLock()
+		if nil != worker.xCmdObj {
+			children = append(children, worker.xCmdObj)
+		}
+		worker.RUnlock()
+	}
+	return
+}
+
+// Broadcast 向全部子进程推送消息，子进程通过Registry.Subscribe接收；
+// 更新进行中时等待更新完成，返回第一个发送错误
+func (object *Daemon) Broadcast(msg []byte) (err error) {
+	object.RLock()
+	defer object.RUnlock()
+	children := object.children()
+	if 0 >= len(children) {
+		return ErrNotRunning
+	}
+	for _, child := range children {
+		if e := child.ParentWriteStream(StreamMessage, msg); nil != e && nil == err {
+			err = fmt.Errorf("worker %d: %w", child.worker.Index, e)
+		}
+	}
+	return
+}
+
+// SendTo 向指定序号的子进程推送消息
+func (object *Daemon) SendTo(workerID int, msg []byte) error {
+	object.RLock()
+	defer object.RUnlock()
+	for _, child := range object.children() {
+		if workerID == child.worker.Index {
+			return child.ParentWriteStream(StreamMessage, msg)
+		}
+	}
+	return fmt.Errorf("%w: %d", ErrUnknownWorker, workerID)
+}
+
+// Subscribe 订阅父进程推送的消息，handler在读协程中调用，不应长时间阻塞；
+// msg为独立的副本，handler可以保留；订阅前到达的消息被丢弃
+func (object *Registry) Subscribe(handler func(msg []byte)) {
+	object.Lock()
+	defer object.Unlock()
+	object.subscribers = append(object.subscribers, handler)
+}
+
+// publish 分发父进程推送的消息
+func (object *Registry) publish(msg []byte) {
+	object.Lock()
+	subscribers := make([]func(msg []byte), len(object.subscribers))
+	copy(subscribers, object.subscribers)
+	object.Unlock()
+	// 读缓冲区在回调后复用，交给handler的是副本
+	msg = append([]byte(nil), msg...)
+	for _, handler := range subscribers {
+		handler(msg)
+	}
+}
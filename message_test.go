@@ -0,0 +1,126 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDaemonBroadcast(t *testing.T) {
+	received := make(chan string, 2)
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		registry := newRegistry(nil)
+		registry.Subscribe(func(msg []byte) {
+			received <- string(msg)
+		})
+		xCmdObj.ChildWrite([]byte(ReadyOK))
+		xCmdObj.ChildReadStreams(func(stream uint32, raw []byte) bool {
+			if StreamMessage == stream {
+				registry.publish(raw)
+				return true
+			}
+			return StreamControl != stream || (nil != raw && ExitRequest != string(raw))
+		})
+		return xCmdObj.ChildWrite([]byte(ExitReply))
+	})
+	if err := object.Broadcast([]byte("config")); !errors.Is(err, ErrNotRunning) {
+		t.Fatal(err)
+	}
+	if ok, err := object.replaceChildProcess(nil); !ok || nil != err {
+		t.Fatal(ok, err)
+	}
+
+	if err := object.Broadcast([]byte("config")); nil != err {
+		t.Fatal(err)
+	}
+	if err := object.SendTo(0, []byte("invalidate")); nil != err {
+		t.Fatal(err)
+	}
+	if err := object.SendTo(1, nil); !errors.Is(err, ErrUnknownWorker) {
+		t.Fatal(err)
+	}
+	if first, second := <-received, <-received; "config" != first || "invalidate" != second {
+		t.Fatal(first, second)
+	}
+	stopFakeDaemon(t, object)
+}
+
+func TestSubscribeRetainsMessage(t *testing.T) {
+	received := make(chan []byte, 2)
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		registry := newRegistry(nil)
+		registry.Subscribe(func(msg []byte) {
+			// 保留消息，不立即使用
+			received <- msg
+		})
+		xCmdObj.ChildWrite([]byte(ReadyOK))
+		xCmdObj.ChildReadStreams(func(stream uint32, raw []byte) bool {
+			if StreamMessage == stream {
+				registry.publish(raw)
+				return true
+			}
+			return StreamControl != stream || (nil != raw && ExitRequest != string(raw))
+		})
+		return xCmdObj.ChildWrite([]byte(ExitReply))
+	})
+	if ok, err := object.replaceChildProcess(nil); !ok || nil != err {
+		t.Fatal(ok, err)
+	}
+	for _, msg := range []string{"AAAA", "BBBB"} {
+		if err := object.Broadcast([]byte(msg)); nil != err {
+			t.Fatal(err)
+		}
+	}
+	if first, second := <-received, <-received; "AAAA" != string(first) || "BBBB" != string(second) {
+		t.Fatal(string(first), string(second))
+	}
+	stopFakeDaemon(t, object)
+}
+
+func TestDispatchUnreadEvents(t *testing.T) {
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		if err := xCmdObj.ChildWrite([]byte(ReadyOK)); nil != err {
+			return err
+		}
+		// 无人读取的进度消息超过缓冲，之后的心跳与消息照常处理
+		for i := 0; i < 2*childEventBacklog; i++ {
+			if err := xCmdObj.ChildWriteStream(StreamProgress, []byte("flushing")); nil != err {
+				return err
+			}
+		}
+		for i := 0; i < 5; i++ {
+			if err := xCmdObj.ChildWriteStream(StreamHeartbeat, nil); nil != err {
+				return err
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err := xCmdObj.ChildWriteStream(StreamMessage, []byte("alive")); nil != err {
+			return err
+		}
+		return fakeChild(xCmdObj, args)
+	})
+	received := make(chan string, 1)
+	object.OnChildMessage(func(worker WorkerInfo, msg []byte) {
+		received <- string(msg)
+	})
+	start := time.Now()
+	if ok, err := object.replaceChildProcess(nil); !ok || nil != err {
+		t.Fatal(ok, err)
+	}
+	select {
+	case msg := <-received:
+		if "alive" != msg {
+			t.Fatal(msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatcher blocked")
+	}
+	if last := time.Unix(0, atomic.LoadInt64(&object.xCmdObj.lastBeat)); !last.After(start) {
+		t.Fatal("heartbeat not handled", last)
+	}
+	stopFakeDaemon(t, object)
+}
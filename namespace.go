@@ -0,0 +1,30 @@
+package daemon
+
+// Namespaces 子进程新建的Linux命名空间，可组合；继承的侦听fd不受影响，
+// 新建命名空间通常需要root或CAP_SYS_ADMIN
+type Namespaces uint
+
+const (
+	NamespacePID   Namespaces = 1 << iota // 独立的PID空间，子进程为其中的1号进程，需自行回收孤儿进程
+	NamespaceMount                        // 独立的挂载空间，挂载点设为私有，子进程在/tmp挂载私有的tmpfs
+	NamespaceNet                          // 独立的网络空间，只有未启用的回环接口，对外只能使用继承的侦听
+)
+
+// SetNamespaces 子进程在新建的命名空间中运行，轻量隔离业务逻辑；
+// 非Linux平台由Start返回ErrNamespaces
+func (object *XCmd) SetNamespaces(namespaces Namespaces) *XCmd {
+	if 0 == namespaces || nil == object.Cmd {
+		return object
+	}
+	if err := setNamespaces(object.Cmd, namespaces); nil != err && nil == object.startErr {
+		object.startErr = err
+	}
+	return object
+}
+
+// SetNamespaces 子进程在新建的命名空间中运行，见XCmd.SetNamespaces。
+// PID空间中子进程的pid与父进程所见不同，开启校验对端凭证时应使用socketpair传输
+func (object *Daemon) SetNamespaces(namespaces Namespaces) *Daemon {
+	object.namespaces = namespaces
+	return object
+}
@@ -0,0 +1,29 @@
+package daemon
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setNamespaces 设置clone标志；挂载空间经unshare新建，由运行时把挂载点设为私有，
+// 避免子进程的挂载传播回父进程的空间
+func setNamespaces(cmd *exec.Cmd, namespaces Namespaces) error {
+	if nil == cmd.SysProcAttr {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	if 0 != namespaces&NamespacePID {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWPID
+	}
+	if 0 != namespaces&NamespaceNet {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+	if 0 != namespaces&NamespaceMount {
+		cmd.SysProcAttr.Unshareflags |= syscall.CLONE_NEWNS
+	}
+	return nil
+}
+
+// mountPrivateTmp 在新建的挂载空间中为/tmp挂载私有的tmpfs
+func mountPrivateTmp() error {
+	return syscall.Mount("tmpfs", "/tmp", "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=1777")
+}
@@ -0,0 +1,62 @@
+package daemon
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestSetNamespaces(t *testing.T) {
+	xCmdObj, err := NewXCmd("sh", "-c", `echo $$; cat /proc/net/dev | grep -c : ; read line <&5; echo "$line"`)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer xCmdObj.Close()
+	xCmdObj.SetNamespaces(NamespacePID | NamespaceNet | NamespaceMount)
+	attr := xCmdObj.SysProcAttr
+	if syscall.CLONE_NEWPID|syscall.CLONE_NEWNET != attr.Cloneflags || syscall.CLONE_NEWNS != attr.Unshareflags {
+		t.Fatal(attr.Cloneflags, attr.Unshareflags)
+	}
+
+	// 继承父进程空间中的连接
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	accepted, err := ln.Accept()
+	if nil != err {
+		t.Fatal(err)
+	}
+	f, err := accepted.(*net.TCPConn).File()
+	accepted.Close()
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	xCmdObj.AddFile(f)
+	var out bytes.Buffer
+	xCmdObj.Stdout = &out
+	if err = xCmdObj.Start(); nil != err {
+		if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EINVAL) {
+			t.Skip("namespaces not permitted:", err)
+		}
+		t.Fatal(err)
+	}
+	conn.Write([]byte("hello\n"))
+	if err = xCmdObj.Wait(); nil != err {
+		t.Fatal(err)
+	}
+	// 1号进程，只有回环接口，仍能读取继承的连接
+	if lines := strings.Fields(out.String()); 3 != len(lines) || "1" != lines[0] || "1" != lines[1] || "hello" != lines[2] {
+		t.Fatal(out.String())
+	}
+}
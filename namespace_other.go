@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package daemon
+
+import (
+	"os/exec"
+)
+
+// setNamespaces 不支持
+func setNamespaces(cmd *exec.Cmd, namespaces Namespaces) error {
+	return ErrNamespaces
+}
+
+// mountPrivateTmp 不支持
+func mountPrivateTmp() error {
+	return ErrNamespaces
+}
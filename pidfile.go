@@ -0,0 +1,35 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// lockPIDFile 锁定并写入PID文件，锁随文件句柄持有到守护进程退出，
+// 已被其他守护进程锁定时返回ErrPIDFileLocked
+func (object *Daemon) lockPIDFile() (err error) {
+	var f *os.File
+	if f, err = os.OpenFile(object.pidFile, os.O_RDWR|os.O_CREATE, 0666); nil != err {
+		return
+	}
+	if err = lockFile(f); nil != err {
+		f.Close()
+		if lockBusy(err) {
+			err = fmt.Errorf("%w: %s: %w", ErrPIDFileLocked, object.pidFile, err)
+		} else {
+			err = fmt.Errorf("daemon: lock pid file %s: %w", object.pidFile, err)
+		}
+		return
+	}
+	if err = f.Truncate(0); nil != err {
+		f.Close()
+		return
+	}
+	if _, err = f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0); nil != err {
+		f.Close()
+		return
+	}
+	object.pidFileHandle = f
+	return
+}
@@ -0,0 +1,44 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestLockPIDFileTwice(t *testing.T) {
+	dir := t.TempDir()
+	first := New("child", "upgrade", "bootstrap_args",
+		filepath.Join(dir, "logs"),
+		filepath.Join(dir, "pid"))
+	second := New("child", "upgrade", "bootstrap_args",
+		filepath.Join(dir, "logs"),
+		filepath.Join(dir, "pid"))
+	if err := first.lockPIDFile(); nil != err {
+		t.Fatal(err)
+	}
+	defer first.releasePIDFile()
+	if err := second.lockPIDFile(); !errors.Is(err, ErrPIDFileLocked) {
+		t.Fatal(err)
+	}
+	if !second.daemonRunning() {
+		t.Fatal("pid file not locked")
+	}
+}
+
+func TestLockBusy(t *testing.T) {
+	// 只有被其他进程锁定才映射为ErrPIDFileLocked，其他加锁错误原样返回
+	if !lockBusy(fmt.Errorf("flock: %w", syscall.EWOULDBLOCK)) {
+		t.Fatal("EWOULDBLOCK not busy")
+	}
+	for _, err := range []error{syscall.ENOLCK, syscall.EBADF, syscall.EINTR} {
+		if lockBusy(err) {
+			t.Fatal(err)
+		}
+	}
+}
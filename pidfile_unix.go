@@ -0,0 +1,30 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile 非阻塞加排他锁
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+// lockBusy 加锁失败是否因为文件已被其他进程锁定
+func lockBusy(err error) bool {
+	return errors.Is(err, syscall.EWOULDBLOCK)
+}
+
+// releasePIDFile 先删除再关闭，关闭前锁仍有效，不会误删其他守护进程的PID文件
+func (object *Daemon) releasePIDFile() {
+	if nil == object.pidFileHandle {
+		return
+	}
+	os.Remove(object.pidFile)
+	object.pidFileHandle.Close()
+	object.pidFileHandle = nil
+}
@@ -0,0 +1,33 @@
+package daemon
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockFile 非阻塞加排他锁，锁定文件内容之外的区域，不影响读取PID
+func lockFile(f *os.File) error {
+	return windows.LockFileEx(windows.Handle(f.Fd()),
+		windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY,
+		0,
+		1,
+		0,
+		&windows.Overlapped{OffsetHigh: 1})
+}
+
+// lockBusy 加锁失败是否因为文件已被其他进程锁定
+func lockBusy(err error) bool {
+	return errors.Is(err, windows.ERROR_LOCK_VIOLATION)
+}
+
+// releasePIDFile 打开的文件不能删除，先关闭再删除
+func (object *Daemon) releasePIDFile() {
+	if nil == object.pidFileHandle {
+		return
+	}
+	object.pidFileHandle.Close()
+	object.pidFileHandle = nil
+	os.Remove(object.pidFile)
+}
@@ -1,26 +1,121 @@
 package daemon
 
 import (
-	"encoding/binary"
-	"errors"
+	"context"
+	"crypto/cipher"
+	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
+	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
 )
 
 // XPipe 管道
+//
+// 并发约定：Write/WriteStream可被多个goroutine同时调用，每条消息完整写入，
+// 帧级别互斥保证帧内字节不交错，同一通道的分块消息整体互斥，不同通道的块可交错；
+// Read/ReadStreams同一时刻只有一个读取者，其余读取者等待；Close可与读写并发调用
 type XPipe struct {
-	closed    int32
-	ReadPipe  *os.File
-	WritePipe *os.File
+	closed         int32
+	ReadPipe       *os.File
+	WritePipe      *os.File
+	reader         io.ReadCloser          // 读端，文件或内存管道
+	writer         io.WriteCloser         // 写端，文件或内存管道
+	maxMessageSize int                    // 最大消息长度，<=0表示不限制
+	checksum       bool                   // 写入时附带校验和
+	codecID        byte                   // 压缩算法
+	compressAbove  int                    // 超过该长度的消息才压缩
+	writeLock      sync.Mutex             // 写入帧的锁
+	messageLocks   sync.Map               // 各通道写入分块消息的锁
+	readBuf        frameBuffer            // 读缓冲区，跨读取保留未处理的数据
+	ringBuffer     bool                   // 读缓冲区使用环形缓冲区
+	partials       map[uint32][]byte      // 各通道未完成的分块消息
+	readLock       sync.Mutex             // 读取者的锁
+	backlog        []streamMessage        // 打开的通道读取时暂存的其他消息
+	streamLock     sync.Mutex             // 打开的通道的锁
+	streamCond     *sync.Cond             // 通道数据到达或读取者变化时唤醒
+	streams        map[uint32]*pipeStream // 通过OpenStream打开的通道
+	readers        int                    // 正在读底层管道的读取者数量
+	generation     uint64                 // 子进程代数，写入时附带，读取时丢弃其他代数的帧，0为不附带
+	aead           cipher.AEAD            // 帧负载的认证加密，nil为不加密
+	sendSeq        uint64                 // 最近写入的加密帧序号，持有writeLock时修改
+	recvSeq        uint64                 // 最近读取的加密帧序号，持有readLock时修改
 }
 
 // NewXPipe 工厂方法
-func NewXPipe() *XPipe {
-	object := &XPipe{}
-	var err error
-	object.ReadPipe, object.WritePipe, err = os.Pipe()
-	panicOnError(err)
+func NewXPipe() (object *XPipe, err error) {
+	readPipe, writePipe, err := os.Pipe()
+	if nil != err {
+		return
+	}
+	object = (&XPipe{maxMessageSize: DefaultMaxMessageSize}).SetReadPipe(readPipe).SetWritePipe(writePipe)
+	return
+}
+
+// NewMemXPipe 内存管道，不占用fd，用于测试
+func NewMemXPipe() *XPipe {
+	reader, writer := newMemPipe()
+	return &XPipe{reader: reader, writer: writer, maxMessageSize: DefaultMaxMessageSize}
+}
+
+// ReadEnd 仅包含读端的管道，用于把一条管道的两端分给不同的持有者
+func (object *XPipe) ReadEnd() *XPipe {
+	return &XPipe{ReadPipe: object.ReadPipe, reader: object.reader, maxMessageSize: object.maxMessageSize}
+}
+
+// WriteEnd 仅包含写端的管道
+func (object *XPipe) WriteEnd() *XPipe {
+	return &XPipe{
+		WritePipe:      object.WritePipe,
+		writer:         object.writer,
+		maxMessageSize: object.maxMessageSize,
+		checksum:       object.checksum,
+		codecID:        object.codecID,
+		compressAbove:  object.compressAbove,
+	}
+}
+
+// SetMaxMessageSize 设置最大消息长度，超出时读写返回ErrFrame，<=0表示不限制
+func (object *XPipe) SetMaxMessageSize(maxMessageSize int) *XPipe {
+	object.maxMessageSize = maxMessageSize
+	return object
+}
+
+// SetChecksum 设置写入时是否附带CRC32校验和，读取时按帧标志自动校验
+func (object *XPipe) SetChecksum(checksum bool) *XPipe {
+	object.checksum = checksum
+	return object
+}
+
+// SetCompression 设置写入时压缩超过threshold字节的消息，CodecNone表示不压缩；
+// 读取时按帧标志自动解压
+func (object *XPipe) SetCompression(codecID byte, threshold int) *XPipe {
+	object.codecID = codecID
+	object.compressAbove = threshold
+	return object
+}
+
+// SetGeneration 设置子进程代数，之后写入的帧附带代数，读取时丢弃其他代数的帧；
+// 未附带代数的帧照常读取，兼容旧版本的对端
+func (object *XPipe) SetGeneration(generation uint64) *XPipe {
+	atomic.StoreUint64(&object.generation, generation)
+	return object
+}
+
+// SetEncryption 设置帧负载的认证加密，读写前调用；开启后读取时拒绝未加密的帧
+func (object *XPipe) SetEncryption(aead cipher.AEAD) *XPipe {
+	object.aead = aead
+	return object
+}
+
+// SetRingBuffer 设置读缓冲区使用环形缓冲区，避免每帧搬移剩余数据，适合持续的大流量；
+// 环形缓冲区随管道常驻，不归还到池
+func (object *XPipe) SetRingBuffer(ringBuffer bool) *XPipe {
+	object.ringBuffer = ringBuffer
 	return object
 }
 
@@ -32,6 +127,7 @@ func (object *XPipe) GetReadPipe() *os.File {
 // SetReadPipe 设置读管道
 func (object *XPipe) SetReadPipe(readPipe *os.File) *XPipe {
 	object.ReadPipe = readPipe
+	object.reader = readPipe
 	return object
 }
 
@@ -43,6 +139,7 @@ func (object *XPipe) GetWritePipe() *os.File {
 // SetWritePipe 设置写管道
 func (object *XPipe) SetWritePipe(writePipe *os.File) *XPipe {
 	object.WritePipe = writePipe
+	object.writer = writePipe
 	return object
 }
 
@@ -56,17 +153,20 @@ func (object *XPipe) Close() (err error) {
 	if !atomic.CompareAndSwapInt32(&object.closed, 0, 1) {
 		return
 	}
-	if nil != object.ReadPipe {
-		if err = object.ReadPipe.Close(); nil != err {
+	object.closeStreams(ErrPipeClosed)
+	if nil != object.reader {
+		if err = object.reader.Close(); nil != err {
 			return
 		}
 		object.ReadPipe = nil
+		object.reader = nil
 	}
-	if nil != object.WritePipe {
-		if err = object.WritePipe.Close(); nil != err {
+	if nil != object.writer {
+		if err = object.writer.Close(); nil != err {
 			return
 		}
 		object.WritePipe = nil
+		object.writer = nil
 	}
 	return
 }
@@ -74,8 +174,9 @@ func (object *XPipe) Close() (err error) {
 // writeEmpty 写空
 func (object *XPipe) writeEmpty(raw []byte) (err error) {
 	var n int
+	writer := object.writer
 	for 0 < len(raw) {
-		n, err = object.WritePipe.Write(raw)
+		n, err = writer.Write(raw)
 		if nil != err {
 			return
 		}
@@ -84,61 +185,339 @@ func (object *XPipe) writeEmpty(raw []byte) (err error) {
 	return
 }
 
-// Write 写入
-func (object *XPipe) Write(raw []byte) (err error) {
+// writeFrame 写入一帧，帧内字节不会与其他写入交错
+func (object *XPipe) writeFrame(stream uint32, more bool, raw []byte) (err error) {
+	header := frameHeader{stream: stream, generation: atomic.LoadUint64(&object.generation)}
+	if more {
+		header.flags |= frameFlagMore
+	}
+	if CodecNone != object.codecID && len(raw) > object.compressAbove {
+		var compressed []byte
+		if compressed, err = compressPayload(object.codecID, raw); nil != err {
+			return
+		}
+		if nil != compressed {
+			raw = compressed
+			header.flags |= frameFlagCompressed
+		}
+	}
+	header.length = uint32(len(raw))
+	if nil != object.aead {
+		header.flags |= frameFlagEncrypted
+		header.length = uint32(sealedSize(object.aead, len(raw)))
+	}
+	if object.checksum {
+		header.flags |= frameFlagChecksum
+	}
+
+	// 整帧拼入池化缓冲区，一次写出
+	frame := getBuffer(frameHeaderSize + frameStreamSize + frameGenerationSize + int(header.length) + frameChecksumSize)
+	defer putBuffer(frame)
+	header.writeTo(frame)
+
+	object.writeLock.Lock()
+	defer object.writeLock.Unlock()
+	if nil != object.aead {
+		// 序号在锁内分配，保证写出的顺序与序号一致
+		object.sendSeq++
+		raw = sealFrame(object.aead, object.sendSeq, frame.Slice(frame.ReadableBytes()), raw)
+	}
+	frame.WriteBytes(raw)
+	if object.checksum {
+		frame.WriteUint32(crc32.Checksum(raw, crcTable))
+	}
+	err = object.writeEmpty(frame.Slice(frame.ReadableBytes()))
+	return
+}
+
+// Write 写入控制通道
+func (object *XPipe) Write(raw []byte) error {
+	return object.WriteStream(StreamControl, raw)
+}
+
+// WriteStream 写入指定逻辑通道，大消息按块拆分，其他通道的消息可插入块之间
+func (object *XPipe) WriteStream(stream uint32, raw []byte) (err error) {
 	if object.IsClosed() {
-		err = errors.New("XPipe closed")
+		err = ErrPipeClosed
 		return
 	}
-	header := make([]byte, 4)
-	binary.BigEndian.PutUint32(header, uint32(len(raw)))
-	if err = object.writeEmpty(header); nil != err {
+	if 0 < object.maxMessageSize && len(raw) > object.maxMessageSize {
+		err = fmt.Errorf("%w: message size %d exceeds %d", ErrFrame, len(raw), object.maxMessageSize)
 		return
 	}
-	if err = object.writeEmpty(raw); nil != err {
-		return
+
+	// 同一通道的消息不能插入其他消息的块之间
+	lock, _ := object.messageLocks.LoadOrStore(stream, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+	for {
+		chunk := raw
+		if frameChunkSize < len(chunk) {
+			chunk = chunk[:frameChunkSize]
+		}
+		raw = raw[len(chunk):]
+		if err = object.writeFrame(stream, 0 < len(raw), chunk); nil != err || 0 >= len(raw) {
+			return
+		}
 	}
-	return
 }
 
-// Read 读取
-func (object *XPipe) Read(callback func(data []byte) bool) (err error) {
+// Read 读取控制通道，其他未打开通道的消息被丢弃并记录告警，需要时先OpenStream；
+// 对端关闭时以nil回调一次
+func (object *XPipe) Read(callback func(data []byte) bool) error {
+	return object.ReadStreams(func(stream uint32, data []byte) bool {
+		if StreamControl != stream {
+			glog.Warningf("drop %d bytes of unopened stream %d", len(data), stream)
+			return true
+		}
+		return callback(data)
+	})
+}
+
+// ReadStreams 读取所有逻辑通道的完整消息，回调返回false时停止，未处理的数据留待下次读取；
+// 已通过OpenStream打开的通道不经过回调。对端关闭时以(StreamControl, nil)回调一次。
+// 同一时刻只有一个读取者，其余读取者等待
+func (object *XPipe) ReadStreams(callback func(stream uint32, data []byte) bool) (err error) {
 	if object.IsClosed() {
-		err = errors.New("XPipe closed")
+		err = ErrPipeClosed
 		return
 	}
+	object.readLock.Lock()
+	object.setReading(true)
+	defer func() {
+		object.setReading(false)
+		object.readLock.Unlock()
+	}()
+
+	// 先投递其他读取者暂存的消息
+	for 0 < len(object.backlog) {
+		message := object.backlog[0]
+		object.backlog = object.backlog[1:]
+		if !callback(message.stream, message.data) {
+			return
+		}
+	}
+	if err = object.readFrames(object.route(callback)); io.EOF == err {
+		err = nil
+		callback(StreamControl, nil)
+	}
+	return
+}
+
+// readFrames 从底层读取帧直到回调返回false，调用方需持有readLock；对端关闭时返回io.EOF
+func (object *XPipe) readFrames(callback func(stream uint32, data []byte) bool) (err error) {
+	reader := object.reader
+	if nil == object.readBuf {
+		if object.ringBuffer {
+			object.readBuf = newRingBuffer(pooledBufferSize)
+		} else {
+			object.readBuf = getBuffer(0)
+		}
+	}
+	if nil == object.partials {
+		object.partials = make(map[uint32][]byte)
+	}
+	readBuf := object.readBuf
+	defer func() {
+		// 没有遗留数据时归还缓冲区，空闲的管道不占用内存
+		if linear, ok := readBuf.(*buffer); ok && linear.IsEmpty() {
+			putBuffer(linear)
+			object.readBuf = nil
+		}
+	}()
+
+	// 先处理上次遗留的数据
 	flag := true
-	readBuf := NewBuffer(1 << 16)
+	if flag, err = object.dispatchFrames(callback); nil != err || !flag {
+		return
+	}
+
 	var n int
-	for flag {
-		n, err = object.ReadPipe.Read(readBuf.Internal[readBuf.GetWriteIndex():])
-		if nil != err {
-			if io.EOF == err {
-				flag = false
-			} else {
+	for {
+		n, err = readBuf.ReadOnce(reader)
+		if 0 < n {
+			var e error
+			if flag, e = object.dispatchFrames(callback); nil != e {
+				err = e
+				return
+			}
+			if !flag {
+				err = nil
 				return
 			}
 		}
-		if 0 >= n {
+		if io.EOF == err {
+			object.closeStreams(err)
+			return
+		}
+		if nil != err {
+			return
+		}
+	}
+}
+
+// dispatchFrames 解析缓冲区中的完整帧，重组消息后回调
+func (object *XPipe) dispatchFrames(callback func(stream uint32, data []byte) bool) (flag bool, err error) {
+	readBuf := object.readBuf
+	flag = true
+	for flag && frameHeaderSize <= readBuf.ReadableBytes() {
+		var header frameHeader
+		if header, err = decodeFrameHeader(readBuf.Slice(frameHeaderSize), object.maxMessageSize); nil != err {
+			return
+		}
+		chunkSize := int(header.length)
+		frameSize := header.size() + chunkSize + header.trailerSize()
+		if frameSize > readBuf.ReadableBytes() {
+			// 帧大于缓冲区时扩容，继续读取剩余部分
+			readBuf.reserve(frameSize)
 			break
 		}
-		readBuf.SetWriteIndex(readBuf.GetWriteIndex() + n)
-		for 4 <= readBuf.ReadableBytes() {
-			chunkSize := int(binary.BigEndian.Uint32(readBuf.Slice(4)))
-			if chunkSize+4 > readBuf.ReadableBytes() {
-				break
+		frame := readBuf.Slice(frameSize)
+		header.decodeStream(frame)
+		if generation := atomic.LoadUint64(&object.generation); 0 != generation && 0 != header.generation && generation != header.generation {
+			// 已被替换的子进程残留的帧，不交给当前子进程的读取者
+			glog.Warningf("drop frame of stale generation %d, expected %d", header.generation, generation)
+			readBuf.consume(frameSize)
+			continue
+		}
+		payload := frame[header.size() : header.size()+chunkSize]
+		if 0 < header.trailerSize() {
+			if err = verifyChecksum(payload, frame[header.size()+chunkSize:]); nil != err {
+				return
 			}
-			readBuf.SetReadIndex(readBuf.GetReadIndex() + 4)
-			flag = callback(readBuf.Slice(chunkSize))
-			readBuf.SetReadIndex(readBuf.GetReadIndex() + chunkSize)
-			readBuf.DiscardReadBytes()
-			if !flag {
-				break
+		}
+		if nil != object.aead {
+			if 0 == header.flags&frameFlagEncrypted {
+				err = fmt.Errorf("%w: unencrypted frame", ErrFrame)
+				return
+			}
+			var seq uint64
+			if payload, seq, err = openFrame(object.aead, object.recvSeq, frame[:header.size()], payload); nil != err {
+				return
+			}
+			object.recvSeq = seq
+		} else if 0 != header.flags&frameFlagEncrypted {
+			err = fmt.Errorf("%w: encrypted frame without key", ErrFrame)
+			return
+		}
+		if 0 != header.flags&frameFlagCompressed {
+			if payload, err = decompressPayload(payload, object.maxMessageSize); nil != err {
+				return
+			}
+		}
+
+		// 重组分块消息
+		partial, chunked := object.partials[header.stream]
+		if chunked || 0 != header.flags&frameFlagMore {
+			partial = append(partial, payload...)
+			if 0 < object.maxMessageSize && len(partial) > object.maxMessageSize {
+				err = fmt.Errorf("%w: message size %d exceeds %d", ErrFrame, len(partial), object.maxMessageSize)
+				return
+			}
+			if 0 != header.flags&frameFlagMore {
+				object.partials[header.stream] = partial
+			} else {
+				delete(object.partials, header.stream)
+				flag = callback(header.stream, partial)
+			}
+		} else {
+			flag = callback(header.stream, payload)
+		}
+		readBuf.consume(frameSize)
+	}
+	return
+}
+
+// readDeadliner 支持读超时
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// writeDeadliner 支持写超时
+type writeDeadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// withContext 在ctx有效期内执行op，通过deadline打断阻塞的读写；
+// 不支持deadline的管道(如Windows匿名管道)在ctx结束时直接关闭
+func (object *XPipe) withContext(ctx context.Context,
+	setDeadline func(t time.Time) error,
+	op func() error) (err error) {
+	if err = ctx.Err(); nil != err {
+		return
+	}
+	// ctx结束时再设置过期的deadline，保证返回时ctx.Err()已生效
+	if nil != setDeadline && nil != setDeadline(time.Time{}) {
+		setDeadline = nil
+	}
+
+	doneCh := make(chan struct{})
+	exitedCh := make(chan struct{})
+	go func() {
+		defer close(exitedCh)
+		select {
+		case <-ctx.Done():
+			if nil != setDeadline {
+				setDeadline(time.Unix(1, 0))
+			} else {
+				object.Close()
 			}
+		case <-doneCh:
 		}
+	}()
+
+	err = op()
+	close(doneCh)
+	<-exitedCh
+	if nil != setDeadline {
+		setDeadline(time.Time{})
 	}
-	if flag {
-		callback(nil)
+	if nil != err && nil != ctx.Err() {
+		err = ctx.Err()
 	}
 	return
 }
+
+// ReadContext 可取消的读取，ctx到期或取消时返回ctx.Err()
+func (object *XPipe) ReadContext(ctx context.Context, callback func(data []byte) bool) error {
+	var setDeadline func(t time.Time) error
+	if d, ok := object.reader.(readDeadliner); ok {
+		setDeadline = d.SetReadDeadline
+	}
+	return object.withContext(ctx, setDeadline, func() error {
+		return object.Read(callback)
+	})
+}
+
+// ReadStreamsContext 可取消的多通道读取
+func (object *XPipe) ReadStreamsContext(ctx context.Context, callback func(stream uint32, data []byte) bool) error {
+	var setDeadline func(t time.Time) error
+	if d, ok := object.reader.(readDeadliner); ok {
+		setDeadline = d.SetReadDeadline
+	}
+	return object.withContext(ctx, setDeadline, func() error {
+		return object.ReadStreams(callback)
+	})
+}
+
+// WriteStreamContext 可取消的指定通道写入，ctx到期或取消时返回ctx.Err()
+func (object *XPipe) WriteStreamContext(ctx context.Context, stream uint32, raw []byte) error {
+	var setDeadline func(t time.Time) error
+	if d, ok := object.writer.(writeDeadliner); ok {
+		setDeadline = d.SetWriteDeadline
+	}
+	return object.withContext(ctx, setDeadline, func() error {
+		return object.WriteStream(stream, raw)
+	})
+}
+
+// WriteContext 可取消的写入，ctx到期或取消时返回ctx.Err()
+func (object *XPipe) WriteContext(ctx context.Context, raw []byte) error {
+	var setDeadline func(t time.Time) error
+	if d, ok := object.writer.(writeDeadliner); ok {
+		setDeadline = d.SetWriteDeadline
+	}
+	return object.withContext(ctx, setDeadline, func() error {
+		return object.Write(raw)
+	})
+}
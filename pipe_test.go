@@ -0,0 +1,429 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// encode 编码帧头，用于构造测试帧
+func (object frameHeader) encode() []byte {
+	buf := NewBuffer(frameHeaderSize + frameStreamSize + frameGenerationSize)
+	object.writeTo(buf)
+	return buf.Slice(buf.ReadableBytes())
+}
+
+// checksum 计算负载校验和，用于构造测试帧
+func checksum(payload []byte) []byte {
+	trailer := make([]byte, frameChecksumSize)
+	binary.BigEndian.PutUint32(trailer, crc32.Checksum(payload, crcTable))
+	return trailer
+}
+
+func TestXPipeReadContext(t *testing.T) {
+	for name, newPipe := range map[string]func() (*XPipe, error){
+		"os":  NewXPipe,
+		"mem": func() (*XPipe, error) { return NewMemXPipe(), nil },
+	} {
+		object, err := newPipe()
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		err = object.ReadContext(ctx, func(data []byte) bool { return true })
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatal(name, err)
+		}
+
+		// 超时后管道仍可用
+		if err = object.WriteContext(context.Background(), []byte("hello")); nil != err {
+			t.Fatal(name, err)
+		}
+		var got string
+		if err = object.ReadContext(context.Background(), func(data []byte) bool {
+			got = string(data)
+			return false
+		}); nil != err || "hello" != got {
+			t.Fatal(name, err, got)
+		}
+		object.Close()
+	}
+}
+
+func TestXPipeGeneration(t *testing.T) {
+	object := NewMemXPipe()
+	defer object.Close()
+	// 旧子进程残留的帧、未附带代数的帧与当前代数的帧
+	object.SetGeneration(1).Write([]byte(ExitReply))
+	object.SetGeneration(0).WriteStream(StreamLog, []byte("legacy"))
+	object.SetGeneration(2).Write([]byte(ReadyOK))
+
+	var got []string
+	if err := object.ReadStreams(func(stream uint32, data []byte) bool {
+		got = append(got, string(data))
+		return 2 > len(got)
+	}); nil != err {
+		t.Fatal(err)
+	}
+	if "legacy,"+ReadyOK != strings.Join(got, ",") {
+		t.Fatal(got)
+	}
+
+	// 帧头附带代数后长度与解码一致
+	header := frameHeader{stream: StreamLog, generation: 7}
+	raw := header.encode()
+	decoded, err := decodeFrameHeader(raw, 0)
+	if nil != err {
+		t.Fatal(err)
+	}
+	decoded.decodeStream(raw)
+	if len(raw) != decoded.size() || StreamLog != decoded.stream || 7 != decoded.generation {
+		t.Fatal(len(raw), decoded)
+	}
+}
+
+func TestXPipeFrameValidation(t *testing.T) {
+	object := NewMemXPipe().SetMaxMessageSize(8)
+	if err := object.Write(make([]byte, 9)); !errors.Is(err, ErrFrame) {
+		t.Fatal(err)
+	}
+
+	// 过大的长度前缀
+	header := frameHeader{length: 1 << 30}.encode()
+	object.writeEmpty(header)
+	if err := object.Read(func(data []byte) bool { return true }); !errors.Is(err, ErrFrame) {
+		t.Fatal(err)
+	}
+
+	// 魔数错误
+	object = NewMemXPipe()
+	object.writeEmpty([]byte("garbage"))
+	if err := object.Read(func(data []byte) bool { return true }); !errors.Is(err, ErrFrame) {
+		t.Fatal(err)
+	}
+}
+
+func TestXPipeLargeMessage(t *testing.T) {
+	object, err := NewXPipe()
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer object.Close()
+
+	raw := make([]byte, 1<<20+3)
+	for i := range raw {
+		raw[i] = byte(i)
+	}
+	go object.Write(raw)
+
+	var got []byte
+	if err = object.Read(func(data []byte) bool {
+		got = append(got, data...)
+		return false
+	}); nil != err {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw, got) {
+		t.Fatal("message mismatch", len(got))
+	}
+}
+
+func TestXPipeChecksum(t *testing.T) {
+	object := NewMemXPipe().SetChecksum(true)
+	if err := object.Write([]byte("hello")); nil != err {
+		t.Fatal(err)
+	}
+	var got string
+	if err := object.Read(func(data []byte) bool {
+		got = string(data)
+		return false
+	}); nil != err || "hello" != got {
+		t.Fatal(err, got)
+	}
+
+	// 负载被篡改
+	header := frameHeader{flags: frameFlagChecksum, length: 5}.encode()
+	object.writeEmpty(header)
+	object.writeEmpty([]byte("hellO"))
+	object.writeEmpty(checksum([]byte("hello")))
+	if err := object.Read(func(data []byte) bool { return true }); !errors.Is(err, ErrFrameChecksum) {
+		t.Fatal(err)
+	}
+}
+
+func TestXPipeCompression(t *testing.T) {
+	raw := bytes.Repeat([]byte("state"), 1024)
+	for _, codecID := range []byte{CodecFlate, CodecSnappy} {
+		object := NewMemXPipe().SetChecksum(true).SetCompression(codecID, 16)
+		for _, msg := range [][]byte{raw, []byte("small")} {
+			if err := object.Write(msg); nil != err {
+				t.Fatal(codecID, err)
+			}
+			var got []byte
+			if err := object.Read(func(data []byte) bool {
+				got = append(got, data...)
+				return false
+			}); nil != err || !bytes.Equal(msg, got) {
+				t.Fatal(codecID, err, len(got))
+			}
+		}
+	}
+}
+
+func TestXPipeStreams(t *testing.T) {
+	object := NewMemXPipe()
+	state := bytes.Repeat([]byte("state"), 3*frameChunkSize/5+7)
+
+	// 状态数据分块写入，控制消息插在块之间
+	done := make(chan error, 1)
+	go func() {
+		done <- object.WriteStream(StreamState, state)
+	}()
+	if err := object.Write([]byte("ready")); nil != err {
+		t.Fatal(err)
+	}
+	if err := <-done; nil != err {
+		t.Fatal(err)
+	}
+	if err := object.WriteStream(StreamLog, []byte("log")); nil != err {
+		t.Fatal(err)
+	}
+
+	got := make(map[uint32][]byte)
+	if err := object.ReadStreams(func(stream uint32, data []byte) bool {
+		got[stream] = append([]byte(nil), data...)
+		return 3 > len(got)
+	}); nil != err {
+		t.Fatal(err)
+	}
+	if "ready" != string(got[StreamControl]) || "log" != string(got[StreamLog]) || !bytes.Equal(state, got[StreamState]) {
+		t.Fatal(len(got[StreamControl]), len(got[StreamLog]), len(got[StreamState]))
+	}
+
+	// Read只投递控制通道
+	object.WriteStream(StreamHeartbeat, []byte("ping"))
+	object.Write([]byte("exit"))
+	var control string
+	if err := object.Read(func(data []byte) bool {
+		control = string(data)
+		return false
+	}); nil != err || "exit" != control {
+		t.Fatal(err, control)
+	}
+}
+
+func TestXPipeOpenStream(t *testing.T) {
+	object := NewMemXPipe()
+	stream, err := object.OpenStream("state")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if _, err = object.OpenStream("state"); !errors.Is(err, ErrStreamOpened) {
+		t.Fatal(err)
+	}
+
+	// 控制消息与通道数据交错，通道读取时控制消息暂存给Read
+	type state struct {
+		Conns int
+		Name  string
+	}
+	object.Write([]byte("ready"))
+	if err = json.NewEncoder(stream).Encode(state{Conns: 3, Name: "web"}); nil != err {
+		t.Fatal(err)
+	}
+	var got state
+	if err = json.NewDecoder(stream).Decode(&got); nil != err || 3 != got.Conns || "web" != got.Name {
+		t.Fatal(err, got)
+	}
+	var control string
+	if err = object.Read(func(data []byte) bool {
+		control = string(data)
+		return false
+	}); nil != err || "ready" != control {
+		t.Fatal(err, control)
+	}
+
+	// 已有读取者时由其投递到通道
+	done := make(chan string, 1)
+	go func() {
+		object.Read(func(data []byte) bool {
+			done <- string(data)
+			return false
+		})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	stream.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	if _, err = io.ReadFull(stream, buf); nil != err || "hello" != string(buf) {
+		t.Fatal(err, string(buf))
+	}
+	object.Write([]byte("exit"))
+	if control = <-done; "exit" != control {
+		t.Fatal(control)
+	}
+
+	object.Close()
+	if _, err = stream.Read(buf); !errors.Is(err, ErrPipeClosed) {
+		t.Fatal(err)
+	}
+}
+
+func TestXPipeConcurrentWrite(t *testing.T) {
+	object := NewMemXPipe()
+	const writers = 8
+	const messages = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// 大消息需分块，与其他goroutine的消息并发写入同一通道
+			message := bytes.Repeat([]byte{byte('a' + i)}, frameChunkSize+i)
+			for j := 0; j < messages; j++ {
+				if err := object.WriteStream(StreamState+uint32(i%2), message); nil != err {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	count := 0
+	if err := object.ReadStreams(func(stream uint32, data []byte) bool {
+		i := int(data[0] - 'a')
+		if frameChunkSize+i != len(data) || StreamState+uint32(i%2) != stream || !bytes.Equal(bytes.Repeat(data[:1], len(data)), data) {
+			t.Fatal(stream, len(data))
+		}
+		count++
+		return writers*messages > count
+	}); nil != err {
+		t.Fatal(err)
+	}
+}
+
+// benchmarkXPipe 每次迭代写入并读回一条消息
+func benchmarkXPipe(b *testing.B, object *XPipe, size int) {
+	message := bytes.Repeat([]byte("m"), size)
+	b.ReportAllocs()
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := object.Write(message); nil != err {
+			b.Fatal(err)
+		}
+		if err := object.Read(func(data []byte) bool { return false }); nil != err {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkXPipeSmallMessage(b *testing.B) {
+	benchmarkXPipe(b, NewMemXPipe(), 64)
+}
+
+func BenchmarkXPipeSmallMessageOSPipe(b *testing.B) {
+	object, err := NewXPipe()
+	if nil != err {
+		b.Fatal(err)
+	}
+	defer object.Close()
+	benchmarkXPipe(b, object, 64)
+}
+
+func BenchmarkXPipeChecksum(b *testing.B) {
+	benchmarkXPipe(b, NewMemXPipe().SetChecksum(true), 4<<10)
+}
+
+func BenchmarkXPipeLargeMessage(b *testing.B) {
+	benchmarkXPipe(b, NewMemXPipe(), 1<<20)
+}
+
+func BenchmarkXPipeRingBuffer(b *testing.B) {
+	benchmarkXPipe(b, NewMemXPipe().SetRingBuffer(true), 4<<10)
+}
+
+// frameRecorder 记录写出的帧
+type frameRecorder struct {
+	bytes.Buffer
+}
+
+// Close 关闭
+func (object *frameRecorder) Close() error {
+	return nil
+}
+
+func TestXPipeEncryption(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, pipeKeySize)
+	aead, err := newPipeAEAD(key, pipeKeyParentToChild)
+	if nil != err {
+		t.Fatal(err)
+	}
+	object := NewMemXPipe().SetChecksum(true).SetCompression(CodecFlate, 16).SetEncryption(aead)
+	large := bytes.Repeat([]byte("secret"), frameChunkSize)
+	for _, msg := range [][]byte{[]byte("hello"), large} {
+		if err = object.WriteStream(StreamState, msg); nil != err {
+			t.Fatal(err)
+		}
+		var got []byte
+		if err = object.ReadStreams(func(stream uint32, data []byte) bool {
+			got = append(got, data...)
+			return false
+		}); nil != err || !bytes.Equal(msg, got) {
+			t.Fatal(err, len(got))
+		}
+	}
+
+	// 线上只有密文
+	recorder := &frameRecorder{}
+	writer := &XPipe{writer: recorder}
+	writer.SetEncryption(aead)
+	writer.generation = 3
+	if err = writer.Write([]byte("password")); nil != err {
+		t.Fatal(err)
+	}
+	frame := append([]byte(nil), recorder.Bytes()...)
+	if bytes.Contains(frame, []byte("password")) {
+		t.Fatal("plaintext on the wire")
+	}
+
+	// 重放、篡改、未加密与缺少密钥的帧均被拒绝
+	newReader := func() *XPipe {
+		return NewMemXPipe().SetEncryption(aead)
+	}
+	for name, c := range map[string]struct {
+		reader *XPipe
+		frames [][]byte
+	}{
+		"replay":      {newReader(), [][]byte{frame, frame}},
+		"tampered":    {newReader(), [][]byte{append(append([]byte(nil), frame[:len(frame)-1]...), frame[len(frame)-1]^1)}},
+		"header":      {newReader(), [][]byte{append(append([]byte(nil), frame[:frameHeaderSize]...), append([]byte{0, 0, 0, 0, 0, 0, 0, 4}, frame[frameHeaderSize+8:]...)...)}},
+		"plaintext":   {newReader(), [][]byte{append(frameHeader{length: 5}.encode(), "hello"...)}},
+		"without key": {NewMemXPipe(), [][]byte{frame}},
+	} {
+		for _, f := range c.frames {
+			c.reader.writeEmpty(f)
+		}
+		var count int
+		err = c.reader.Read(func(data []byte) bool {
+			count++
+			return 1 < len(c.frames)
+		})
+		if !errors.Is(err, ErrFrame) || len(c.frames)-1 != count {
+			t.Fatal(name, err, count)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package daemon
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// PreflightCheck 派生子进程前的检查，binary为将要运行的可执行文件，返回错误时不派生
+type PreflightCheck func(binary string) error
+
+// preflight 命名的检查
+type preflight struct {
+	name  string
+	check PreflightCheck
+}
+
+// AddPreflight 添加派生前的检查，每次启动、更新、重启与扩容派生子进程前依次执行，
+// 失败时返回Phase为preflight、Kind为ErrPreflight的错误并发布EventPreflightFailed，
+// 运行中的子进程不受影响。开启chroot时binary为父进程所见的路径
+func (object *Daemon) AddPreflight(name string, check PreflightCheck) *Daemon {
+	object.preflights = append(object.preflights, preflight{name: name, check: check})
+	return object
+}
+
+// runPreflight 依次执行派生前的检查
+func (object *Daemon) runPreflight() error {
+	if 0 >= len(object.preflights) {
+		return nil
+	}
+	binary, err := object.childBinary()
+	if nil != err {
+		return newLifecycleError(PhasePreflight, 0, ErrPreflight, err)
+	}
+	for _, check := range object.preflights {
+		if err = check.check(binary); nil == err {
+			continue
+		}
+		glog.Errorf("preflight %s: %v", check.name, err)
+		object.emit(Event{
+			Type:   EventPreflightFailed,
+			Worker: WorkerInfo{Index: object.workerIndex},
+			Reason: check.name,
+			Error:  err.Error(),
+		})
+		return newLifecycleError(PhasePreflight, 0, ErrPreflight, fmt.Errorf("%s: %w", check.name, err))
+	}
+	return nil
+}
+
+// CheckExecutable 可执行文件存在且可执行
+func CheckExecutable() PreflightCheck {
+	return func(binary string) error {
+		info, err := os.Stat(binary)
+		if nil != err {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s is not a regular file", binary)
+		}
+		return checkExecutable(binary, info)
+	}
+}
+
+// CheckChecksum 可执行文件的SHA-256与清单一致，清单为sha256sum的输出，
+// 只有一行一列时直接作为校验和，否则取文件名与可执行文件相同的一行
+func CheckChecksum(manifest string) PreflightCheck {
+	return func(binary string) error {
+		expected, err := manifestChecksum(manifest, filepath.Base(binary))
+		if nil != err {
+			return err
+		}
+		actual, err := fileChecksum(binary)
+		if nil != err {
+			return err
+		}
+		if !strings.EqualFold(expected, actual) {
+			return fmt.Errorf("checksum %s does not match manifest %s", actual, expected)
+		}
+		return nil
+	}
+}
+
+// manifestChecksum 从清单中读取name的校验和
+func manifestChecksum(manifest, name string) (sum string, err error) {
+	var f *os.File
+	if f, err = os.Open(manifest); nil != err {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if 1 == len(fields) {
+			sum = fields[0]
+			continue
+		}
+		if 2 == len(fields) && name == filepath.Base(strings.TrimPrefix(fields[1], "*")) {
+			return fields[0], nil
+		}
+	}
+	if err = scanner.Err(); nil == err && 0 >= len(sum) {
+		err = fmt.Errorf("%s not found in manifest %s", name, manifest)
+	}
+	return
+}
+
+// CheckDiskSpace path所在文件系统至少有minFree字节可用，如日志与状态所在的目录
+func CheckDiskSpace(path string, minFree uint64) PreflightCheck {
+	return func(binary string) error {
+		free, err := diskFree(path)
+		if nil != err {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("%s has %d bytes free, need %d", path, free, minFree)
+		}
+		return nil
+	}
+}
+
+// CheckConfig 配置可解析，parse通常以新程序相同的方式读取配置文件
+func CheckConfig(parse func() error) PreflightCheck {
+	return func(binary string) error {
+		return parse()
+	}
+}
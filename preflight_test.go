@@ -0,0 +1,109 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+)
+
+func TestPreflightChecks(t *testing.T) {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "app")
+	if err := os.WriteFile(binary, []byte("#!/bin/sh\n"), 0644); nil != err {
+		t.Fatal(err)
+	}
+	if err := CheckExecutable()(binary); nil == err {
+		t.Fatal("non-executable passed")
+	}
+	if err := os.Chmod(binary, 0755); nil != err {
+		t.Fatal(err)
+	}
+	if err := CheckExecutable()(binary); nil != err {
+		t.Fatal(err)
+	}
+	if err := CheckExecutable()(dir); nil == err {
+		t.Fatal("directory passed")
+	}
+
+	// sha256sum格式的清单，按文件名匹配
+	sum := sha256.Sum256([]byte("#!/bin/sh\n"))
+	manifest := filepath.Join(dir, "SHA256SUMS")
+	content := "0000  other\n" + hex.EncodeToString(sum[:]) + " *app\n"
+	if err := os.WriteFile(manifest, []byte(content), 0644); nil != err {
+		t.Fatal(err)
+	}
+	if err := CheckChecksum(manifest)(binary); nil != err {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(manifest, []byte("0000\n"), 0644); nil != err {
+		t.Fatal(err)
+	}
+	if err := CheckChecksum(manifest)(binary); nil == err {
+		t.Fatal("checksum mismatch passed")
+	}
+
+	if err := CheckDiskSpace(dir, 1)(binary); nil != err {
+		t.Fatal(err)
+	}
+	if err := CheckDiskSpace(dir, ^uint64(0))(binary); nil == err {
+		t.Fatal("disk space passed")
+	}
+}
+
+func TestPreflightBeforeUpgrade(t *testing.T) {
+	var spawned, failing int32
+	var events []Event
+	object, signalCh, doneCh := startFakeParent(t, withChild(func(xCmdObj *XCmd, args []string) error {
+		atomic.AddInt32(&spawned, 1)
+		return fakeChild(xCmdObj, args)
+	}), withSetup(func(object *Daemon) {
+		object.origArgs = []string{os.Args[0]}
+		object.AddPreflight("config", CheckConfig(func() error {
+			if 1 == atomic.LoadInt32(&failing) {
+				return errors.New("bad config")
+			}
+			return nil
+		})).OnEvent(func(event Event) {
+			events = append(events, event)
+		})
+	}))
+
+	// 检查失败时不派生，原来的子进程继续服务
+	atomic.StoreInt32(&failing, 1)
+	err := object.Upgrade()
+	var lifecycleErr *LifecycleError
+	if !errors.Is(err, ErrPreflight) || !errors.As(err, &lifecycleErr) || PhasePreflight != lifecycleErr.Phase {
+		t.Fatal(err)
+	}
+	if 1 != atomic.LoadInt32(&spawned) || StatusRunning != object.Status().Phase {
+		t.Fatal(spawned, object.Status())
+	}
+	found := false
+	for _, event := range events {
+		found = found || (EventPreflightFailed == event.Type && "config" == event.Reason)
+	}
+	if !found {
+		t.Fatal(events)
+	}
+
+	atomic.StoreInt32(&failing, 0)
+	if err = object.Upgrade(); nil != err {
+		t.Fatal(err)
+	}
+	if 2 != atomic.LoadInt32(&spawned) {
+		t.Fatal(spawned)
+	}
+
+	signalCh <- syscall.SIGTERM
+	if err = <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+}
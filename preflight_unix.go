@@ -0,0 +1,28 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// checkExecutable 当前用户可执行
+func checkExecutable(binary string, info os.FileInfo) error {
+	if 0 == info.Mode().Perm()&0111 {
+		return fmt.Errorf("%s is not executable", binary)
+	}
+	return unix.Access(binary, unix.X_OK)
+}
+
+// diskFree 非特权用户可用的字节数
+func diskFree(path string) (uint64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); nil != err {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
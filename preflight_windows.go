@@ -0,0 +1,27 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// checkExecutable Windows按扩展名判断
+func checkExecutable(binary string, info os.FileInfo) error {
+	if !strings.HasSuffix(strings.ToLower(binary), ".exe") {
+		return fmt.Errorf("%s is not an executable", binary)
+	}
+	return nil
+}
+
+// diskFree 当前用户可用的字节数
+func diskFree(path string) (free uint64, err error) {
+	var name *uint16
+	if name, err = windows.UTF16PtrFromString(path); nil != err {
+		return
+	}
+	err = windows.GetDiskFreeSpaceEx(name, &free, nil, nil)
+	return
+}
@@ -0,0 +1,98 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// 更新前父进程与旧子进程的协商
+const (
+	PrepareUpgradeRequest = "PrepareUpgrade" // 父进程询问旧子进程能否切换
+	UpgradeReadyReply     = "UpgradeReady"   // 旧子进程同意切换
+	UpgradeVetoReply      = "UpgradeVeto"    // 旧子进程否决本次更新，后跟":原因"
+)
+
+// SetPrepareUpgradeTimeout 开启更新前的协商：启动新子进程前向旧子进程发送PrepareUpgrade，
+// 旧子进程可推迟回复以延后切换，或否决本次更新；超过timeout未回复时不再等待，继续更新。0为关闭
+func (object *Daemon) SetPrepareUpgradeTimeout(timeout time.Duration) *Daemon {
+	object.prepareTimeout = timeout
+	return object
+}
+
+// prepareUpgrade 与当前子进程协商，否决时返回ErrUpgradeVetoed，超时或子进程已退出时继续更新
+func (object *Daemon) prepareUpgrade(ctx context.Context) (err error) {
+	if 0 >= object.prepareTimeout {
+		return
+	}
+	xCmdObj := object.currentChild()
+	if nil == xCmdObj || nil == xCmdObj.events {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, object.prepareTimeout)
+	defer cancel()
+	defer xCmdObj.readEvents()()
+	if err = xCmdObj.ParentWriteContext(ctx, []byte(PrepareUpgradeRequest)); nil != err {
+		glog.Warningf("child: %d prepare upgrade: %v, override", xCmdObj.Pid(), err)
+		return nil
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(context.Cause(ctx), ErrUpgradeDeadline) {
+				return newLifecycleError(PhasePrepare, xCmdObj.Pid(), ErrUpgradeDeadline, nil)
+			}
+			glog.Warningf("child: %d prepare upgrade timeout, override", xCmdObj.Pid())
+			return
+		case message, ok := <-xCmdObj.events:
+			if !ok {
+				return
+			}
+			if StreamControl != message.stream {
+				continue
+			}
+			reply := string(message.data)
+			if UpgradeReadyReply == reply {
+				return
+			}
+			if reason, vetoed := strings.CutPrefix(reply, UpgradeVetoReply+":"); vetoed {
+				glog.Warningf("child: %d vetoed upgrade: %s", xCmdObj.Pid(), reason)
+				return newLifecycleError(PhaseUpgrade, xCmdObj.Pid(), ErrUpgradeVetoed, errors.New(reason))
+			}
+		}
+	}
+}
+
+// OnPrepareUpgrade 注册更新前的回调，父进程开启协商时在子进程收到PrepareUpgrade后依次调用：
+// 回调阻塞即推迟切换，如等待进行中的批处理事务提交；返回错误即否决本次更新。
+// 父进程等待超过协商超时后不再理会回调的结果
+func (object *Registry) OnPrepareUpgrade(handler func() error) {
+	object.Lock()
+	defer object.Unlock()
+	object.preparers = append(object.preparers, handler)
+}
+
+// prepareUpgrade 调用更新前的回调并回复父进程
+func (object *Registry) prepareUpgrade() {
+	object.Lock()
+	preparers := make([]func() error, len(object.preparers))
+	copy(preparers, object.preparers)
+	object.Unlock()
+	reply := UpgradeReadyReply
+	for _, handler := range preparers {
+		if err := handler(); nil != err {
+			reply = UpgradeVetoReply + ":" + err.Error()
+			break
+		}
+	}
+	if nil == object.parent {
+		return
+	}
+	if err := object.parent.ChildWrite([]byte(reply)); nil != err {
+		glog.Error(err)
+	}
+}
@@ -0,0 +1,81 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"errors"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestPrepareUpgrade(t *testing.T) {
+	var spawned int32
+	var delay atomic.Value
+	delay.Store(time.Duration(0))
+	object, signalCh, doneCh := startFakeParent(t, withChild(func(xCmdObj *XCmd, args []string) error {
+		atomic.AddInt32(&spawned, 1)
+		registry := newRegistry(nil)
+		registry.parent = xCmdObj
+		registry.OnPrepareUpgrade(func() error {
+			// 负值表示否决
+			d := delay.Load().(time.Duration)
+			if 0 > d {
+				return errors.New("batch running")
+			}
+			time.Sleep(d)
+			return nil
+		})
+		if err := xCmdObj.ChildWrite([]byte(ReadyOK)); nil != err {
+			return err
+		}
+		if err := xCmdObj.ChildRead(func(raw []byte) bool {
+			if PrepareUpgradeRequest == string(raw) {
+				go registry.prepareUpgrade()
+				return true
+			}
+			return nil != raw && ExitRequest != string(raw)
+		}); nil != err {
+			return err
+		}
+		return xCmdObj.ChildWrite([]byte(ExitReply))
+	}), withSetup(func(object *Daemon) {
+		object.SetPrepareUpgradeTimeout(200 * time.Millisecond)
+	}))
+
+	// 否决
+	delay.Store(time.Duration(-1))
+	if err := object.Upgrade(); !errors.Is(err, ErrUpgradeVetoed) {
+		t.Fatal(err)
+	}
+	if 1 != atomic.LoadInt32(&spawned) {
+		t.Fatal(spawned)
+	}
+
+	// 推迟后同意
+	delay.Store(50 * time.Millisecond)
+	start := time.Now()
+	if err := object.Upgrade(); nil != err {
+		t.Fatal(err)
+	}
+	if 2 != atomic.LoadInt32(&spawned) || 50*time.Millisecond > time.Since(start) {
+		t.Fatal(spawned, time.Since(start))
+	}
+
+	// 超时后不再等待
+	delay.Store(time.Second)
+	start = time.Now()
+	if err := object.Upgrade(); nil != err {
+		t.Fatal(err)
+	}
+	if 3 != atomic.LoadInt32(&spawned) || time.Second < time.Since(start) {
+		t.Fatal(spawned, time.Since(start))
+	}
+
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,119 @@
+package daemon
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// HealthProbe 父进程对子进程的TCP探测：按侦听的实际地址拨号，连接进入与子进程共享的侦听队列，
+// 由子进程接受。只拨号时内核即可完成握手，仅能确认侦听存在；
+// 设置Send/Expect才能确认子进程在接受并处理连接。多个工作进程时由任一工作进程应答
+type HealthProbe struct {
+	Listener string        // 探测的侦听名，需为流式侦听且未开启AcceptInParent
+	Interval time.Duration // 探测间隔
+	Timeout  time.Duration // 单次探测的超时，含拨号与读写
+	Failures int           // 连续失败多少次视为不健康，<=0时为1
+	Send     []byte        // 连接后发送的内容，为空时不发送
+	Expect   []byte        // 期望读到的回复前缀，为空时不读取
+	Restart  bool          // 不健康时强杀主工作进程，按意外退出重启
+}
+
+// SetHealthProbe 设置父进程对子进程的健康探测，Interval<=0时关闭
+func (object *Daemon) SetHealthProbe(probe HealthProbe) *Daemon {
+	object.healthProbe = &probe
+	return object
+}
+
+// probeSpec 探测的侦听描述，未开启时ok为false
+func (object *Daemon) probeSpec() (spec ListenerSpec, ok bool, err error) {
+	if nil == object.healthProbe || 0 >= object.healthProbe.Interval {
+		return
+	}
+	for _, candidate := range object.listenerSpecs {
+		if object.healthProbe.Listener != candidate.Name {
+			continue
+		}
+		if candidate.IsPacket() || candidate.Options.AcceptInParent {
+			err = fmt.Errorf("daemon: health probe on listener %s: not a stream listener accepted by the child", candidate.Name)
+			return
+		}
+		return candidate, true, nil
+	}
+	err = fmt.Errorf("daemon: health probe on unknown listener %s", object.healthProbe.Listener)
+	return
+}
+
+// probe 探测一次
+func (object *Daemon) probe(spec ListenerSpec) (err error) {
+	probe := object.healthProbe
+	var conn net.Conn
+	if conn, err = net.DialTimeout(spec.Network, spec.Address, probe.Timeout); nil != err {
+		return
+	}
+	defer conn.Close()
+	if 0 < probe.Timeout {
+		conn.SetDeadline(time.Now().Add(probe.Timeout))
+	}
+	if 0 < len(probe.Send) {
+		if _, err = conn.Write(probe.Send); nil != err {
+			return
+		}
+	}
+	if 0 < len(probe.Expect) {
+		reply := make([]byte, len(probe.Expect))
+		if _, err = io.ReadFull(conn, reply); nil != err {
+			return
+		}
+		if !bytes.Equal(probe.Expect, reply) {
+			err = fmt.Errorf("daemon: health probe unexpected reply %q", reply)
+		}
+	}
+	return
+}
+
+// watchHealth 定期探测，连续失败达到阈值时上报事件，按设置强杀子进程；更新期间不探测
+func (object *Daemon) watchHealth(spec ListenerSpec, exitCh chan interface{}) {
+	probe := object.healthProbe
+	threshold := probe.Failures
+	if 0 >= threshold {
+		threshold = 1
+	}
+	failures := 0
+	go object.every(probe.Interval, exitCh, func() error {
+		if object.IsUpgrading() || 0 == atomic.LoadInt32(&object.running) {
+			return nil
+		}
+		err := object.probe(spec)
+		if nil == err {
+			if threshold <= failures {
+				glog.Infof("health probe on %s recovered", spec.Name)
+				object.emit(Event{Type: EventHealthRecovered, Reason: spec.Name})
+			}
+			failures = 0
+			return nil
+		}
+		if failures++; threshold != failures {
+			return nil
+		}
+
+		// 刚达到阈值时处理一次，恢复前不重复
+		xCmdObj := object.currentChild()
+		event := Event{Type: EventHealthFailed, Reason: spec.Name, Error: err.Error()}
+		if nil != xCmdObj {
+			event.Pid, event.Worker = xCmdObj.Pid(), xCmdObj.worker
+		}
+		object.emit(event)
+		if probe.Restart && nil != xCmdObj {
+			// 重启后重新计数
+			failures = 0
+			object.killChild(xCmdObj, "health probe failed")
+		}
+		return fmt.Errorf("%w: %s: %v", ErrHealthProbe, spec.Name, err)
+	})
+}
@@ -0,0 +1,87 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"net"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestProbe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if nil != err {
+				return
+			}
+			buf := make([]byte, 4)
+			if _, err = conn.Read(buf); nil == err && "PING" == string(buf) {
+				conn.Write([]byte("PONG"))
+			}
+			conn.Close()
+		}
+	}()
+
+	spec := ListenerSpec{Name: "web", Network: "tcp", Address: ln.Addr().String()}
+	object := Default().SetHealthProbe(HealthProbe{
+		Listener: "web",
+		Interval: time.Second,
+		Timeout:  time.Second,
+		Send:     []byte("PING"),
+		Expect:   []byte("PONG"),
+	})
+	if err = object.probe(spec); nil != err {
+		t.Fatal(err)
+	}
+	object.healthProbe.Expect = []byte("OK")
+	if err = object.probe(spec); nil == err {
+		t.Fatal("unexpected reply accepted")
+	}
+
+	object.SetListeners(ListenerSpec{Name: "web", Network: "tcp", Options: ListenerOptions{AcceptInParent: true}})
+	if _, _, err = object.probeSpec(); nil == err {
+		t.Fatal("probe on listener accepted in parent")
+	}
+}
+
+func TestHealthProbeRestart(t *testing.T) {
+	runner := NewFakeRunner(fakeChild)
+	var failed int32
+	_, signalCh, doneCh := startFakeParent(t, withRunner(runner), withSetup(func(object *Daemon) {
+		object.SetListeners(ListenerSpec{Name: "web", Network: "tcp", Address: "127.0.0.1:0"}).
+			SetHealthProbe(HealthProbe{
+				Listener: "web",
+				Interval: 50 * time.Millisecond,
+				Timeout:  20 * time.Millisecond,
+				Failures: 2,
+				Expect:   []byte("OK"),
+				Restart:  true,
+			}).
+			OnEvent(func(event Event) {
+				if EventHealthFailed == event.Type {
+					atomic.AddInt32(&failed, 1)
+				}
+			})
+	}), withReady(func(object *Daemon) bool {
+		// 模拟子进程不处理连接，握手成功但没有回复
+		status := object.Status()
+		return 1 <= atomic.LoadInt32(&failed) && 1 <= status.Restarts && StatusRunning == status.Phase
+	}))
+	if 2 > runner.Spawned() {
+		t.Fatal(runner.Spawned())
+	}
+
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+}
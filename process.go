@@ -0,0 +1,91 @@
+package daemon
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// Process 进程句柄
+type Process interface {
+	Start() error               // 启动
+	Wait() error                // 等待退出
+	Kill() error                // 强杀
+	Signal(sig os.Signal) error // 发送信号
+	Release() error             // 释放资源
+	Pid() int                   // 进程ID
+}
+
+// Transport 父子进程通信的传输方式
+type Transport int
+
+// 传输方式
+const (
+	TransportPipe       Transport = iota // 两条匿名管道，子进程fd 3、4
+	TransportSocketpair                  // 一对unix socket，子进程fd 3，可传递fd并校验对端凭证
+)
+
+// ProcessRunner 进程运行器，负责构建带通信管道的子进程命令
+type ProcessRunner interface {
+	Command(name string, arg ...string) (*XCmd, error)
+}
+
+// execProcess 基于exec.Cmd的进程
+type execProcess struct {
+	cmd *exec.Cmd
+}
+
+// Start 启动
+func (object *execProcess) Start() error {
+	return object.cmd.Start()
+}
+
+// Wait 等待退出
+func (object *execProcess) Wait() error {
+	return object.cmd.Wait()
+}
+
+// Kill 强杀
+func (object *execProcess) Kill() error {
+	if nil == object.cmd.Process {
+		return errors.New("process not started")
+	}
+	return object.cmd.Process.Kill()
+}
+
+// Signal 发送信号
+func (object *execProcess) Signal(sig os.Signal) error {
+	if nil == object.cmd.Process {
+		return errors.New("process not started")
+	}
+	return object.cmd.Process.Signal(sig)
+}
+
+// Release 释放资源
+func (object *execProcess) Release() error {
+	if nil == object.cmd.Process {
+		return nil
+	}
+	return object.cmd.Process.Release()
+}
+
+// Pid 进程ID
+func (object *execProcess) Pid() int {
+	if nil == object.cmd.Process {
+		return 0
+	}
+	return object.cmd.Process.Pid
+}
+
+// execRunner 真实派生进程的运行器
+type execRunner struct {
+	transport Transport // 传输方式
+}
+
+// Command 构建命令
+func (object execRunner) Command(name string, arg ...string) (*XCmd, error) {
+	if TransportSocketpair == object.transport {
+		return NewSocketXCmd(name, arg...)
+	}
+	return NewXCmd(name, arg...)
+}
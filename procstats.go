@@ -0,0 +1,157 @@
+package daemon
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// ProcessStats 子进程的资源占用，父进程定期采样
+type ProcessStats struct {
+	Worker     int       `json:"worker"`      // 工作进程序号
+	Generation uint64    `json:"generation"`  // 子进程代数
+	Pid        int       `json:"pid"`         // 子进程ID
+	CPUPercent float64   `json:"cpu_percent"` // 两次采样间的CPU占用，100为一个核满载
+	RSS        uint64    `json:"rss"`         // 常驻内存字节数
+	Fds        int       `json:"fds"`         // 打开的文件描述符数
+	Threads    int       `json:"threads"`     // 线程数
+	SampledAt  time.Time `json:"sampled_at"`  // 采样时间
+}
+
+// procSample 一次原始采样
+type procSample struct {
+	cpu     time.Duration // 累计的用户态与内核态CPU时间
+	rss     uint64        // 常驻内存字节数
+	fds     int           // 文件描述符数
+	threads int           // 线程数
+	at      time.Time     // 采样时间
+}
+
+// procStatsState 子进程资源采样的状态
+type procStatsState struct {
+	sync.Mutex
+	interval time.Duration      // 采样间隔，0为不采样
+	last     map[int]procSample // 子进程ID->上次采样，用于计算CPU占用
+	stats    []ProcessStats     // 最近一次采样结果，按工作进程序号排列
+	fds      map[int]fdTrend    // 子进程ID->描述符数趋势，开启泄漏告警时有效
+}
+
+// SetProcessStats 开启子进程资源采样，结果见Status().Processes与管理侦听的/metrics，
+// 目前只支持Linux
+func (object *Daemon) SetProcessStats(interval time.Duration) *Daemon {
+	object.procStats.interval = interval
+	return object
+}
+
+// ProcessStats 最近一次采样的子进程资源占用
+func (object *Daemon) ProcessStats() []ProcessStats {
+	object.procStats.Lock()
+	defer object.procStats.Unlock()
+	return append([]ProcessStats(nil), object.procStats.stats...)
+}
+
+// sampleProcesses 采样当前全部子进程
+func (object *Daemon) sampleProcesses() error {
+	object.RLock()
+	children := object.children()
+	object.RUnlock()
+	stats := make([]ProcessStats, 0, len(children))
+	samples := make(map[int]procSample, len(children))
+	trends := make(map[int]fdTrend, len(children))
+	object.procStats.Lock()
+	last, lastTrends := object.procStats.last, object.procStats.fds
+	object.procStats.Unlock()
+	for _, child := range children {
+		pid := child.Pid()
+		if 0 >= pid {
+			continue
+		}
+		sample, err := readProcSample(pid)
+		if nil != err {
+			// 子进程可能刚好退出
+			glog.V(1).Infof("sample process %d: %v", pid, err)
+			continue
+		}
+		samples[pid] = sample
+		stat := ProcessStats{
+			Worker:     child.worker.Index,
+			Generation: child.worker.Generation,
+			Pid:        pid,
+			RSS:        sample.rss,
+			Fds:        sample.fds,
+			Threads:    sample.threads,
+			SampledAt:  sample.at,
+		}
+		if prev, ok := last[pid]; ok {
+			stat.CPUPercent = cpuPercent(prev, sample)
+		}
+		stats = append(stats, stat)
+		if nil != object.fdLeak {
+			trends[pid] = object.checkFdLeak(child, sample.fds, lastTrends)
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Worker < stats[j].Worker
+	})
+	object.procStats.Lock()
+	object.procStats.last = samples
+	object.procStats.stats = stats
+	object.procStats.fds = trends
+	object.procStats.Unlock()
+	return nil
+}
+
+// cpuPercent 两次采样间的CPU占用
+func cpuPercent(prev, cur procSample) float64 {
+	elapsed := cur.at.Sub(prev.at)
+	if 0 >= elapsed || cur.cpu < prev.cpu {
+		return 0
+	}
+	return float64(cur.cpu-prev.cpu) / float64(elapsed) * 100
+}
+
+// watchProcessStats 定期采样子进程资源
+func (object *Daemon) watchProcessStats(exitCh chan interface{}) {
+	if 0 >= object.procStats.interval {
+		return
+	}
+	if _, err := readProcSample(os.Getpid()); nil != err {
+		glog.Warningf("process stats disabled: %v", err)
+		return
+	}
+	object.sampleProcesses()
+	go object.every(object.procStats.interval, exitCh, object.sampleProcesses)
+}
+
+// serveMetrics 以Prometheus文本格式输出子进程资源占用
+func (object *Daemon) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	stats := object.ProcessStats()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics := []struct {
+		name  string
+		kind  string
+		help  string
+		value func(stat ProcessStats) string
+	}{
+		{"daemon_child_cpu_percent", "gauge", "CPU usage of the child process, 100 is one full core.",
+			func(stat ProcessStats) string { return fmt.Sprintf("%g", stat.CPUPercent) }},
+		{"daemon_child_resident_memory_bytes", "gauge", "Resident memory of the child process in bytes.",
+			func(stat ProcessStats) string { return fmt.Sprint(stat.RSS) }},
+		{"daemon_child_open_fds", "gauge", "Open file descriptors of the child process.",
+			func(stat ProcessStats) string { return fmt.Sprint(stat.Fds) }},
+		{"daemon_child_threads", "gauge", "Threads of the child process.",
+			func(stat ProcessStats) string { return fmt.Sprint(stat.Threads) }},
+	}
+	for _, metric := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", metric.name, metric.help, metric.name, metric.kind)
+		for _, stat := range stats {
+			fmt.Fprintf(w, "%s{worker=\"%d\",generation=\"%d\",pid=\"%d\"} %s\n",
+				metric.name, stat.Worker, stat.Generation, stat.Pid, metric.value(stat))
+		}
+	}
+}
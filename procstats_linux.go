@@ -0,0 +1,77 @@
+package daemon
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks /proc/<pid>/stat中CPU时间的单位，Linux的USER_HZ固定为100
+const clockTicks = 100
+
+// readProcSample 读取/proc/<pid>/stat、/proc/<pid>/status与/proc/<pid>/fd
+func readProcSample(pid int) (sample procSample, err error) {
+	sample.at = time.Now()
+	dir := fmt.Sprintf("/proc/%d", pid)
+	var raw []byte
+	if raw, err = ioutil.ReadFile(dir + "/stat"); nil != err {
+		return
+	}
+	// 进程名可能含空格与括号，从最后一个右括号之后开始按空格分割，
+	// 第一个字段为state(第3列)，utime与stime为第14、15列
+	end := bytes.LastIndexByte(raw, ')')
+	if 0 > end {
+		err = fmt.Errorf("%s/stat: malformed", dir)
+		return
+	}
+	fields := strings.Fields(string(raw[end+1:]))
+	if 13 > len(fields) {
+		err = fmt.Errorf("%s/stat: too few fields", dir)
+		return
+	}
+	var utime, stime uint64
+	if utime, err = strconv.ParseUint(fields[11], 10, 64); nil != err {
+		return
+	}
+	if stime, err = strconv.ParseUint(fields[12], 10, 64); nil != err {
+		return
+	}
+	sample.cpu = time.Duration(utime+stime) * time.Second / clockTicks
+
+	if raw, err = ioutil.ReadFile(dir + "/status"); nil != err {
+		return
+	}
+	for _, line := range strings.Split(string(raw), "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if 2 != len(kv) {
+			continue
+		}
+		value := strings.Fields(kv[1])
+		if 0 >= len(value) {
+			continue
+		}
+		switch kv[0] {
+		case "VmRSS":
+			kb, _ := strconv.ParseUint(value[0], 10, 64)
+			sample.rss = kb * 1024
+		case "Threads":
+			sample.threads, _ = strconv.Atoi(value[0])
+		}
+	}
+
+	var fd *os.File
+	if fd, err = os.Open(dir + "/fd"); nil != err {
+		return
+	}
+	defer fd.Close()
+	var names []string
+	if names, err = fd.Readdirnames(-1); nil != err {
+		return
+	}
+	sample.fds = len(names)
+	return
+}
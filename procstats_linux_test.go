@@ -0,0 +1,77 @@
+package daemon
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadProcSample(t *testing.T) {
+	before, err := readProcSample(os.Getpid())
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 0 >= before.rss || 0 >= before.threads || 0 >= before.fds {
+		t.Fatalf("%+v", before)
+	}
+	f, err := ioutil.TempFile("", "procstats")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	after, err := readProcSample(os.Getpid())
+	if nil != err {
+		t.Fatal(err)
+	}
+	if after.fds <= before.fds {
+		t.Fatal(before.fds, after.fds)
+	}
+	if after.cpu < before.cpu {
+		t.Fatal(before.cpu, after.cpu)
+	}
+	if _, err = readProcSample(1 << 30); nil == err {
+		t.Fatal("no error for missing process")
+	}
+}
+
+func TestCPUPercent(t *testing.T) {
+	now := time.Now()
+	prev := procSample{cpu: time.Second, at: now}
+	cur := procSample{cpu: 2500 * time.Millisecond, at: now.Add(time.Second)}
+	if percent := cpuPercent(prev, cur); 150 != percent {
+		t.Fatal(percent)
+	}
+	if percent := cpuPercent(cur, prev); 0 != percent {
+		t.Fatal(percent)
+	}
+}
+
+func TestProcessMetrics(t *testing.T) {
+	object, _ := newFakeDaemon(fakeChild)
+	object.SetProcessStats(time.Second)
+	object.procStats.stats = []ProcessStats{
+		{Worker: 0, Generation: 3, Pid: 100, CPUPercent: 12.5, RSS: 4096, Fds: 7, Threads: 5},
+		{Worker: 1, Generation: 4, Pid: 101, RSS: 8192, Fds: 9, Threads: 6},
+	}
+	if processes := object.Status().Processes; 2 != len(processes) || 101 != processes[1].Pid {
+		t.Fatal(processes)
+	}
+	w := httptest.NewRecorder()
+	object.serveMetrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	for _, line := range []string{
+		"# TYPE daemon_child_cpu_percent gauge",
+		`daemon_child_cpu_percent{worker="0",generation="3",pid="100"} 12.5`,
+		`daemon_child_resident_memory_bytes{worker="1",generation="4",pid="101"} 8192`,
+		`daemon_child_open_fds{worker="0",generation="3",pid="100"} 7`,
+		`daemon_child_threads{worker="1",generation="4",pid="101"} 6`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Fatalf("missing %q in:\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package daemon
+
+// readProcSample 不支持
+func readProcSample(pid int) (procSample, error) {
+	return procSample{}, ErrProcessStats
+}
@@ -0,0 +1,67 @@
+package daemon
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// reapTimeout 强杀未准备好的子进程后等待其退出的时间
+const reapTimeout = 5 * time.Second
+
+// processProber 可核对进程是否已彻底消失的进程
+type processProber interface {
+	Gone() bool
+}
+
+// Gone 进程已被回收，Linux下核对/proc中没有该进程
+func (object *execProcess) Gone() bool {
+	return processGone(object.Pid())
+}
+
+// gone 子进程已彻底消失，运行器不支持核对时视为已消失
+func (object *XCmd) gone() bool {
+	if prober, ok := object.proc.(processProber); ok {
+		return prober.Gone()
+	}
+	return true
+}
+
+// hasExited 子进程已退出并回收
+func (object *XCmd) hasExited() bool {
+	if nil == object.exited {
+		return false
+	}
+	select {
+	case <-object.exited:
+		return true
+	default:
+		return false
+	}
+}
+
+// reapChild 强杀未准备好的子进程并等待其退出，核对进程连同继承的侦听fd都已释放，
+// 下一次派生不会与半死的进程争抢端口；之后关闭通信管道，调用方不再使用该子进程
+func (object *Daemon) reapChild(xCmdObj *XCmd, reason string) {
+	defer xCmdObj.Close()
+	object.killChild(xCmdObj, reason)
+	waitCh := make(chan error, 1)
+	go func() {
+		waitCh <- xCmdObj.Wait()
+	}()
+	timer := time.NewTimer(reapTimeout)
+	defer timer.Stop()
+	select {
+	case <-waitCh:
+		if nil != xCmdObj.exited {
+			close(xCmdObj.exited)
+		}
+	case <-timer.C:
+		glog.Error(fmt.Errorf("%w: child %d still running %v after kill", ErrChildNotReaped, xCmdObj.Pid(), reapTimeout))
+		return
+	}
+	if !xCmdObj.gone() {
+		glog.Error(fmt.Errorf("%w: child %d still present after wait", ErrChildNotReaped, xCmdObj.Pid()))
+	}
+}
@@ -0,0 +1,33 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"os"
+	"testing"
+)
+
+func TestReapChild(t *testing.T) {
+	if processGone(os.Getpid()) {
+		t.Fatal("self gone")
+	}
+	xCmdObj, err := NewXCmd("sleep", "60")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err = xCmdObj.Start(); nil != err {
+		t.Fatal(err)
+	}
+	xCmdObj.exited = make(chan struct{})
+	pid := xCmdObj.Pid()
+	Default().reapChild(xCmdObj, "child not ready")
+	select {
+	case <-xCmdObj.exited:
+	default:
+		t.Fatal("exited not closed")
+	}
+	if !processGone(pid) || !xCmdObj.gone() {
+		t.Fatal("child still present", pid)
+	}
+}
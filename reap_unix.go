@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// processGone 进程已不存在：有/proc时核对目录，否则以信号0探测
+func processGone(pid int) bool {
+	if 0 >= pid {
+		return true
+	}
+	if _, err := os.Stat("/proc/self"); nil == err {
+		_, err = os.Stat(fmt.Sprintf("/proc/%d", pid))
+		return os.IsNotExist(err)
+	}
+	return unix.ESRCH == unix.Kill(pid, 0)
+}
@@ -0,0 +1,6 @@
+package daemon
+
+// processGone Wait返回后进程句柄已关闭，视为已消失
+func processGone(pid int) bool {
+	return true
+}
@@ -0,0 +1,52 @@
+package daemon
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// SelfRestartRequest 子进程请求父进程替换自己，后跟":原因"
+const SelfRestartRequest = "SelfRestart"
+
+// RequestRestart 请求父进程替换当前子进程，如发现无法恢复的状态、完成占用大量内存的批处理后，
+// 父进程按强制更新的流程先启动新子进程，准备好后再排空当前子进程；多个工作进程时依次替换全部工作进程。
+// 前台运行时返回ErrNotRunning
+func (object *Registry) RequestRestart(reason string) error {
+	if nil == object.parent {
+		return ErrNotRunning
+	}
+	return object.parent.ChildWrite([]byte(SelfRestartRequest + ":" + reason))
+}
+
+// parseRestartRequest 解析子进程的替换请求
+func parseRestartRequest(raw []byte) (reason string, ok bool) {
+	request := string(raw)
+	if SelfRestartRequest != request && !strings.HasPrefix(request, SelfRestartRequest+":") {
+		return
+	}
+	return strings.TrimPrefix(request[len(SelfRestartRequest):], ":"), true
+}
+
+// requestRestart 把子进程的替换请求投递给主循环，启动期间的请求在主循环开始后处理，
+// 已有指令待处理时丢弃
+func (object *Daemon) requestRestart(xCmdObj *XCmd, reason string) {
+	primary := object
+	if nil != object.primary {
+		primary = object.primary
+	}
+	glog.Infof("child: %d requests restart: %s", xCmdObj.Pid(), reason)
+	object.emit(Event{
+		Type:   EventRestartRequested,
+		Pid:    xCmdObj.Pid(),
+		Worker: xCmdObj.worker,
+		Reason: reason,
+	})
+	cmd := &command{action: ForceUpgradeRequest, source: fmt.Sprintf("child %d: %s", xCmdObj.Pid(), reason)}
+	select {
+	case primary.controlCh <- cmd:
+	default:
+		glog.Warningf("restart request from child %d dropped, daemon busy", xCmdObj.Pid())
+	}
+}
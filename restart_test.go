@@ -0,0 +1,75 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"sync/atomic"
+	"syscall"
+	"testing"
+)
+
+func TestParseRestartRequest(t *testing.T) {
+	for raw, want := range map[string]string{
+		"SelfRestart":             "",
+		"SelfRestart:batch done":  "batch done",
+		"SelfRestart:a:b":         "a:b",
+		"SelfRestartNow":          "-",
+		ExitReply:                 "-",
+		"Self":                    "-",
+		"SelfRestart:corrupt map": "corrupt map",
+	} {
+		reason, ok := parseRestartRequest([]byte(raw))
+		if ("-" == want) == ok || ok && want != reason {
+			t.Fatal(raw, reason, ok)
+		}
+	}
+}
+
+func TestRequestRestart(t *testing.T) {
+	var spawned int32
+	var reason atomic.Value
+	_, signalCh, doneCh := startFakeParent(t, withChild(func(xCmdObj *XCmd, args []string) error {
+		if 1 != atomic.AddInt32(&spawned, 1) {
+			return fakeChild(xCmdObj, args)
+		}
+		// 第一个子进程准备好后请求替换自己
+		if err := xCmdObj.ChildWrite([]byte(ReadyOK)); nil != err {
+			return err
+		}
+		registry := newRegistry(nil)
+		registry.parent = xCmdObj
+		if err := registry.RequestRestart("batch done"); nil != err {
+			return err
+		}
+		if err := xCmdObj.ChildRead(func(raw []byte) bool {
+			return nil != raw && ExitRequest != string(raw)
+		}); nil != err {
+			return err
+		}
+		return xCmdObj.ChildWrite([]byte(ExitReply))
+	}), withSetup(func(object *Daemon) {
+		object.OnEvent(func(event Event) {
+			if EventRestartRequested == event.Type {
+				reason.Store(event.Reason)
+			}
+		})
+	}), withReady(func(object *Daemon) bool {
+		status := object.Status()
+		return 2 == atomic.LoadInt32(&spawned) && !object.IsUpgrading() && StatusRunning == status.Phase
+	}))
+	if "batch done" != reason.Load() {
+		t.Fatal(reason.Load())
+	}
+
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+	if 2 != atomic.LoadInt32(&spawned) {
+		t.Fatal(spawned)
+	}
+	if err := newRegistry(nil).RequestRestart("inline"); ErrNotRunning != err {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,101 @@
+package daemon
+
+import "io"
+
+// frameBuffer 读取帧使用的缓冲区，buffer与ringBuffer均实现
+type frameBuffer interface {
+	IsEmpty() bool                     // 是否为空
+	ReadableBytes() int                // 可读取字节数
+	Slice(size int) []byte             // 连续的size字节，不移动读索引
+	ReadOnce(r io.Reader) (int, error) // 从r读取一次
+	reserve(size int)                  // 确保可容纳size字节的未读数据
+	consume(size int)                  // 消费size字节
+}
+
+// ringBuffer 环形缓冲区，消费数据只移动读位置，不搬移剩余数据
+type ringBuffer struct {
+	Internal []byte // 存储
+	head     int    // 读位置
+	size     int    // 可读字节数
+}
+
+// newRingBuffer 新建环形缓冲区
+func newRingBuffer(capacity int) *ringBuffer {
+	return &ringBuffer{Internal: make([]byte, capacity)}
+}
+
+// IsEmpty 是否为空
+func (object *ringBuffer) IsEmpty() bool {
+	return 0 == object.size
+}
+
+// ReadableBytes 可读取字节数
+func (object *ringBuffer) ReadableBytes() int {
+	return object.size
+}
+
+// WriteableBytes 可写入字节数
+func (object *ringBuffer) WriteableBytes() int {
+	return len(object.Internal) - object.size
+}
+
+// linearize 把数据搬到存储开头，容量至少为capacity
+func (object *ringBuffer) linearize(capacity int) {
+	if capacity < len(object.Internal) {
+		capacity = len(object.Internal)
+	}
+	copied := make([]byte, capacity)
+	n := copy(copied, object.Internal[object.head:])
+	if n < object.size {
+		copy(copied[n:], object.Internal[:object.size-n])
+	}
+	object.Internal = copied
+	object.head = 0
+}
+
+// Slice 连续的size字节，数据跨越存储末尾时搬移一次
+func (object *ringBuffer) Slice(size int) []byte {
+	if object.head+size > len(object.Internal) {
+		object.linearize(len(object.Internal))
+	}
+	return object.Internal[object.head : object.head+size]
+}
+
+// ReadOnce 从r读取一次到空闲空间，空间不足时扩容
+func (object *ringBuffer) ReadOnce(r io.Reader) (n int, err error) {
+	if minReadSize > object.WriteableBytes() {
+		object.reserve(object.size + minReadSize)
+	}
+	tail := (object.head + object.size) % len(object.Internal)
+	end := len(object.Internal)
+	if tail < object.head {
+		end = object.head
+	}
+	n, err = r.Read(object.Internal[tail:end])
+	if 0 < n {
+		object.size += n
+	}
+	return
+}
+
+// reserve 确保可容纳size字节的未读数据
+func (object *ringBuffer) reserve(size int) {
+	if size <= len(object.Internal) {
+		return
+	}
+	capacity := 2 * len(object.Internal)
+	for capacity < size {
+		capacity *= 2
+	}
+	object.linearize(capacity)
+}
+
+// consume 消费size字节
+func (object *ringBuffer) consume(size int) {
+	object.size -= size
+	if 0 == object.size {
+		object.head = 0
+		return
+	}
+	object.head = (object.head + size) % len(object.Internal)
+}
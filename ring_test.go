@@ -0,0 +1,46 @@
+package daemon
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRingBufferWrap(t *testing.T) {
+	object := newRingBuffer(1024)
+	src := bytes.NewReader(bytes.Repeat([]byte("0123456789"), 300))
+	var out []byte
+	for 0 < src.Len() || !object.IsEmpty() {
+		if 0 < src.Len() {
+			if _, err := object.ReadOnce(src); nil != err {
+				t.Fatal(err)
+			}
+		}
+		// 每次消费7字节，读位置会跨越存储末尾
+		size := 7
+		if size > object.ReadableBytes() {
+			size = object.ReadableBytes()
+		}
+		out = append(out, object.Slice(size)...)
+		object.consume(size)
+	}
+	if !bytes.Equal(bytes.Repeat([]byte("0123456789"), 300), out) {
+		t.Fatal(len(out))
+	}
+}
+
+func TestXPipeRingBuffer(t *testing.T) {
+	object := NewMemXPipe().SetRingBuffer(true)
+	for _, size := range []int{10, 3000, 70000, 1, 200000, 5} {
+		message := bytes.Repeat([]byte{byte(size)}, size)
+		if err := object.Write(message); nil != err {
+			t.Fatal(err)
+		}
+		var got []byte
+		if err := object.Read(func(data []byte) bool {
+			got = append(got, data...)
+			return false
+		}); nil != err || !bytes.Equal(message, got) {
+			t.Fatal(size, err, len(got))
+		}
+	}
+}
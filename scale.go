@@ -0,0 +1,185 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+)
+
+// WorkersRequest 调整工作进程数的控制指令，格式为 Workers:n
+const WorkersRequest = "Workers"
+
+// workersAction 调整为n个工作进程的控制指令
+func workersAction(n int) string {
+	return fmt.Sprintf("%s:%d", WorkersRequest, n)
+}
+
+// parseWorkersAction 解析调整工作进程数的控制指令
+func parseWorkersAction(action string) (n int, ok bool) {
+	if !strings.HasPrefix(action, WorkersRequest+":") {
+		return
+	}
+	// 带符号的为相对调整，见parseWorkersDelta
+	value := action[len(WorkersRequest)+1:]
+	if strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-") {
+		return
+	}
+	var err error
+	if n, err = strconv.Atoi(value); nil != err || 0 >= n {
+		return 0, false
+	}
+	return n, true
+}
+
+// SetWorkers 设置工作进程数，各工作进程共享父进程的侦听；Windows下侦听由子进程独占，有侦听时只能有一个；
+// 未运行时在启动时生效，运行中时扩容派生新子进程、缩容排空并退出序号最大的子进程，返回调整结果
+func (object *Daemon) SetWorkers(n int) error {
+	if 0 >= n {
+		return fmt.Errorf("daemon: invalid worker count %d", n)
+	}
+	if exclusiveListeners && 1 < n && 0 < len(object.listenerSpecs) {
+		return fmt.Errorf("%w: %d workers", ErrExclusiveListeners, n)
+	}
+	if 0 == atomic.LoadInt32(&object.running) {
+		object.workerCount = n
+		return nil
+	}
+	return object.execCommand(workersAction(n))
+}
+
+// Workers 当前工作进程数
+func (object *Daemon) Workers() int {
+	object.workersLock.Lock()
+	defer object.workersLock.Unlock()
+	return 1 + len(object.workers)
+}
+
+// newWorker 序号为index的工作进程，与主Daemon共享配置、侦听、消息代理与日志
+func (object *Daemon) newWorker(index int) *Daemon {
+	worker := New(object.childCmd, object.upgradeCmd, object.bootstrapArgs, object.bootstrapLogDir, object.pidFile)
+	worker.primary = object
+	worker.workerIndex = index
+	worker.rebootTimes = atomic.LoadInt32(&object.rebootTimes)
+	worker.origArgs = object.origArgs
+	worker.appArgs = object.appArgs
+	worker.childExtraArgs = object.childExtraArgs
+	worker.legacyFlags = object.legacyFlags
+	worker.runner = object.runner
+	worker.readyTimeout = object.readyTimeout
+	worker.startupGrace = object.startupGrace
+	worker.heartbeatTimeout = object.heartbeatTimeout
+	worker.drainTimeout = object.drainTimeout
+	worker.prepareTimeout = object.prepareTimeout
+	worker.livenessTimeout = object.livenessTimeout
+	worker.namespaces = object.namespaces
+	worker.childDir = object.childDir
+	worker.childUmask = object.childUmask
+	worker.childChroot = object.childChroot
+	worker.cpusPerWorker = object.cpusPerWorker
+	worker.encryption = object.encryption
+	worker.preflights = object.preflights
+	worker.spawnTimeout = object.spawnTimeout
+	worker.extraFiles = object.extraFiles
+	worker.sharedSegments = object.sharedSegments
+	worker.exitTimeout = object.exitTimeout
+	worker.maxMessageSize = object.maxMessageSize
+	worker.checksum = object.checksum
+	worker.codecID = object.codecID
+	worker.compressAbove = object.compressAbove
+	worker.transport = object.transport
+	worker.verifyPeer = object.verifyPeer
+	worker.listenerSpecs = object.listenerSpecs
+	worker.command = object.command
+	worker.commandArgs = object.commandArgs
+	worker.commandEnv = object.commandEnv
+	worker.envFilter = object.envFilter
+	worker.envOverrides = object.envOverrides
+	worker.bus = object.bus
+	worker.eventHandlers = object.eventHandlers
+	worker.messageHandlers = object.messageHandlers
+	worker.webhooks = object.webhooks
+	worker.tracer = object.tracer
+	worker.logSink = object.logSink
+	worker.audit = object.audit
+	worker.balance = object.balance
+	return worker
+}
+
+// scaleWorkers 调整工作进程数，扩容失败时保留已启动的工作进程
+func (object *Daemon) scaleWorkers(n int) error {
+	for object.Workers() < n {
+		worker := object.newWorker(object.Workers())
+		if _, err := worker.replaceChildProcess(object.lnFiles); nil != err {
+			return err
+		}
+		object.workersLock.Lock()
+		object.workers = append(object.workers, worker)
+		object.workersLock.Unlock()
+		glog.Infof("worker %d started", worker.workerIndex)
+	}
+	for object.Workers() > n {
+		object.workersLock.Lock()
+		worker := object.workers[len(object.workers)-1]
+		object.workers = object.workers[:len(object.workers)-1]
+		object.workersLock.Unlock()
+		worker.stopChild(context.Background(), "worker stopped")
+		glog.Infof("worker %d retired", worker.workerIndex)
+	}
+	object.workerCount = n
+	return nil
+}
+
+// upgradeWorkers 依次更新其他工作进程
+func (object *Daemon) upgradeWorkers(ctx context.Context) error {
+	object.workersLock.Lock()
+	workers := make([]*Daemon, len(object.workers))
+	copy(workers, object.workers)
+	object.workersLock.Unlock()
+	for _, worker := range workers {
+		if err := worker.prepareUpgrade(ctx); nil != err {
+			return fmt.Errorf("worker %d: %w", worker.workerIndex, err)
+		}
+		if _, err := worker.replaceChildProcessContext(ctx, object.lnFiles); nil != err {
+			return fmt.Errorf("worker %d: %w", worker.workerIndex, err)
+		}
+	}
+	return nil
+}
+
+// stopWorkers 停止其他工作进程
+func (object *Daemon) stopWorkers(ctx context.Context) {
+	object.workersLock.Lock()
+	workers := object.workers
+	object.workers = nil
+	object.workersLock.Unlock()
+	for _, worker := range workers {
+		worker.stopChild(ctx, "worker stopped")
+	}
+}
+
+// stopChild 走安全退出流程停止子进程，ctx结束时不再等待排空
+func (object *Daemon) stopChild(ctx context.Context, reason string) {
+	object.Lock()
+	defer object.Unlock()
+	if nil == object.xCmdObj {
+		return
+	}
+	atomic.StoreInt32(&object.killedFlag, 1)
+	if object.xCmdObj.hasExited() {
+		// 已停止
+		object.xCmdObj.Close()
+		return
+	}
+	if err := object.waitChildSafeExit(ctx); nil != err {
+		glog.Error(err)
+	}
+	if err := object.killChild(object.xCmdObj, reason); nil != err {
+		glog.Error(err)
+	}
+	object.wg.Wait()
+	object.xCmdObj.Close()
+}
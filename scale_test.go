@@ -0,0 +1,46 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestDaemonScaleWorkers(t *testing.T) {
+	runner := NewFakeRunner(fakeChild)
+	object, signalCh, doneCh := startFakeParent(t, withRunner(runner), withSetup(func(object *Daemon) {
+		object.SetControlSocket(filepath.Join(t.TempDir(), "ctl.sock"))
+		if err := object.SetWorkers(2); nil != err {
+			t.Fatal(err)
+		}
+	}))
+	if 2 != object.Workers() || 2 != runner.Spawned() {
+		t.Fatal(object.Workers(), runner.Spawned())
+	}
+
+	// 经控制socket扩缩容
+	if err := SendControl(object.controlSocket, workersAction(3)); nil != err {
+		t.Fatal(err)
+	}
+	if 3 != object.Workers() || 2 != object.workers[1].xCmdObj.worker.Index {
+		t.Fatal(object.Workers())
+	}
+	if err := SendControl(object.controlSocket, workersAction(1)); nil != err || 1 != object.Workers() {
+		t.Fatal(err, object.Workers())
+	}
+	if err := SendControl(object.controlSocket, "Bogus"); nil == err {
+		t.Fatal("unknown command accepted")
+	}
+
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(object.controlSocket); !os.IsNotExist(err) {
+		t.Fatal("control socket not removed")
+	}
+}
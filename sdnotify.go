@@ -0,0 +1,55 @@
+package daemon
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// sdNotify 通知systemd状态，未由systemd托管时忽略
+func sdNotify(state string) (err error) {
+	socketAddr := os.Getenv("NOTIFY_SOCKET")
+	if 0 >= len(socketAddr) {
+		return
+	}
+	if '@' == socketAddr[0] {
+		// 抽象命名空间
+		socketAddr = "\x00" + socketAddr[1:]
+	}
+
+	var conn *net.UnixConn
+	if conn, err = net.DialUnix("unixgram", nil, &net.UnixAddr{
+		Name: socketAddr,
+		Net:  "unixgram",
+	}); nil != err {
+		return
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return
+}
+
+// notifyServiceManager 通知服务管理器，失败仅记录日志
+func notifyServiceManager(state string) {
+	if err := sdNotify(state); nil != err {
+		glog.Error(err)
+	}
+}
+
+// newWatchdog 按WatchdogSec的一半周期喂狗的定时器，未开启看门狗时返回nil通道；
+// 由主循环在select中喂狗，主循环卡住时systemd随之重启服务
+func newWatchdog() (tick <-chan time.Time, stop func()) {
+	stop = func() {}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if nil != err || 0 >= usec {
+		return
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); 0 < len(pid) && strconv.Itoa(os.Getpid()) != pid {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(usec) * time.Microsecond / 2)
+	return ticker.C, ticker.Stop
+}
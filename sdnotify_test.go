@@ -0,0 +1,44 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWatchdog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+	t.Setenv("WATCHDOG_USEC", "20000")
+	t.Setenv("WATCHDOG_PID", "")
+
+	// 主循环运行时喂狗
+	_, signalCh, doneCh := startFakeParent(t)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 256)
+	for {
+		n, e := conn.Read(buf)
+		if nil != e {
+			t.Fatal(e)
+		}
+		if strings.Contains(string(buf[:n]), "WATCHDOG=1") {
+			break
+		}
+	}
+
+	signalCh <- syscall.SIGTERM
+	if err = <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+}
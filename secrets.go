@@ -0,0 +1,232 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// SecretProvider 机密来源，父进程每次派生子进程前调用，返回名字->内容；
+// 内置文件与环境变量来源，Vault、KMS等可实现该接口接入，ctx在停服时取消
+type SecretProvider interface {
+	Secrets(ctx context.Context) (map[string][]byte, error)
+}
+
+// SecretLoader 以回调实现的机密来源
+type SecretLoader func() (map[string][]byte, error)
+
+// Secrets 调用回调
+func (object SecretLoader) Secrets(ctx context.Context) (map[string][]byte, error) {
+	return object()
+}
+
+// FileSecrets 从文件加载机密，名字->路径，每次派生前重新读取
+type FileSecrets map[string]string
+
+// Secrets 读取全部文件
+func (object FileSecrets) Secrets(ctx context.Context) (map[string][]byte, error) {
+	secrets := make(map[string][]byte, len(object))
+	for name, path := range object {
+		raw, err := os.ReadFile(path)
+		if nil != err {
+			wipeSecrets(secrets)
+			return nil, err
+		}
+		secrets[name] = raw
+	}
+	return secrets, nil
+}
+
+// EnvSecrets 从父进程的环境变量加载机密，以变量名为名字；
+// 通过AddSecretProvider添加时这些变量不再传给子进程
+type EnvSecrets []string
+
+// Secrets 读取全部变量，未设置时返回错误
+func (object EnvSecrets) Secrets(ctx context.Context) (map[string][]byte, error) {
+	secrets := make(map[string][]byte, len(object))
+	for _, name := range object {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("secret env %s not set", name)
+		}
+		secrets[name] = []byte(value)
+	}
+	return secrets, nil
+}
+
+// AddSecretProvider 添加机密来源，父进程每次派生子进程前依次调用，同名时后者覆盖，
+// 启动后经管道下发，不出现在子进程的参数与环境变量中，更新时重新加载并下发；
+// 子进程通过Registry.Secret读取，只保存在内存中
+func (object *Daemon) AddSecretProvider(provider SecretProvider) *Daemon {
+	if env, ok := provider.(EnvSecrets); ok {
+		object.secretEnv = append(object.secretEnv, env...)
+	}
+	object.secretProviders = append(object.secretProviders, provider)
+	return object
+}
+
+// AddSecrets 添加回调实现的机密来源
+func (object *Daemon) AddSecrets(loader SecretLoader) *Daemon {
+	return object.AddSecretProvider(loader)
+}
+
+// AddSecretFiles 从文件加载机密，files为名字->路径
+func (object *Daemon) AddSecretFiles(files map[string]string) *Daemon {
+	return object.AddSecretProvider(FileSecrets(files))
+}
+
+// AddSecretEnv 从父进程的环境变量加载机密，这些变量不再传给子进程
+func (object *Daemon) AddSecretEnv(names ...string) *Daemon {
+	return object.AddSecretProvider(EnvSecrets(names))
+}
+
+// hasSecretEnv 是否有作为机密的环境变量
+func (object *Daemon) hasSecretEnv() bool {
+	if nil != object.primary {
+		return 0 < len(object.primary.secretEnv)
+	}
+	return 0 < len(object.secretEnv)
+}
+
+// isSecretEnv 是否为机密环境变量
+func (object *Daemon) isSecretEnv(key string) bool {
+	names := object.secretEnv
+	if nil != object.primary {
+		names = object.primary.secretEnv
+	}
+	for _, name := range names {
+		if name == key {
+			return true
+		}
+	}
+	return false
+}
+
+// loadSecrets 依次调用机密来源并编码，未配置时返回nil
+func (object *Daemon) loadSecrets(ctx context.Context) (raw []byte, err error) {
+	providers := object.secretProviders
+	if nil != object.primary {
+		providers = object.primary.secretProviders
+	}
+	if 0 >= len(providers) {
+		return
+	}
+	secrets := make(map[string][]byte)
+	defer wipeSecrets(secrets)
+	for i, provider := range providers {
+		var loaded map[string][]byte
+		if loaded, err = provider.Secrets(ctx); nil != err {
+			err = fmt.Errorf("%w: provider %d: %v", ErrSecrets, i, err)
+			return
+		}
+		for name, value := range loaded {
+			secrets[name] = value
+		}
+	}
+	raw, err = json.Marshal(secrets)
+	return
+}
+
+// wipeSecrets 清零机密内容
+func wipeSecrets(secrets map[string][]byte) {
+	for name, value := range secrets {
+		wipe(value)
+		delete(secrets, name)
+	}
+}
+
+// wipe 清零
+func wipe(raw []byte) {
+	for i := range raw {
+		raw[i] = 0
+	}
+}
+
+// secretStore 子进程收到的机密
+type secretStore struct {
+	sync.RWMutex
+	secrets map[string][]byte
+}
+
+// update 替换机密，清零旧的内容
+func (object *secretStore) update(raw []byte) (err error) {
+	secrets := make(map[string][]byte)
+	if err = json.Unmarshal(raw, &secrets); nil != err {
+		return
+	}
+	object.Lock()
+	defer object.Unlock()
+	if nil != object.secrets {
+		wipeSecrets(object.secrets)
+	}
+	object.secrets = secrets
+	return
+}
+
+// get 读取机密的副本
+func (object *secretStore) get(name string) ([]byte, bool) {
+	object.RLock()
+	defer object.RUnlock()
+	value, ok := object.secrets[name]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), value...), true
+}
+
+// wipe 清零全部机密
+func (object *secretStore) wipe() {
+	object.Lock()
+	defer object.Unlock()
+	if nil != object.secrets {
+		wipeSecrets(object.secrets)
+	}
+}
+
+// Secret 父进程下发的机密，返回副本，用完后调用方可自行清零；未下发时返回false
+func (object *Registry) Secret(name string) ([]byte, bool) {
+	if nil == object.secrets {
+		return nil, false
+	}
+	return object.secrets.get(name)
+}
+
+// receiveSecrets 子进程构建侦听前读取父进程下发的机密，读取后清零收到的帧
+func (object *Daemon) receiveSecrets() (store *secretStore, err error) {
+	store = &secretStore{}
+	var received bool
+	if err = object.xCmdObj.ChildReadStreams(func(stream uint32, raw []byte) bool {
+		if StreamSecret != stream {
+			return true
+		}
+		defer wipe(raw)
+		if err := store.update(raw); nil != err {
+			glog.Error(err)
+			return false
+		}
+		received = true
+		return false
+	}); nil != err {
+		return
+	}
+	if !received {
+		err = fmt.Errorf("%w: not received", ErrSecrets)
+	}
+	return
+}
+
+// inlineSecrets 前台运行时在当前进程加载机密
+func (object *Daemon) inlineSecrets() (store *secretStore, err error) {
+	var raw []byte
+	if raw, err = object.loadSecrets(context.Background()); nil != err || nil == raw {
+		return
+	}
+	defer wipe(raw)
+	store = &secretStore{}
+	err = store.update(raw)
+	return
+}
@@ -0,0 +1,136 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+)
+
+func TestSecrets(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("file-key"), 0600); nil != err {
+		t.Fatal(err)
+	}
+	os.Setenv("DAEMON_TEST_TOKEN", "env-token")
+	defer os.Unsetenv("DAEMON_TEST_TOKEN")
+
+	var loads int32
+	received := make(chan *secretStore, 4)
+	object, signalCh, doneCh := startFakeParent(t, withChild(func(xCmdObj *XCmd, args []string) error {
+		// 机密不在参数中
+		if strings.Contains(strings.Join(args, " "), "env-token") {
+			return errors.New("secret in args")
+		}
+		daemon := &Daemon{xCmdObj: xCmdObj}
+		store, err := daemon.receiveSecrets()
+		if nil != err {
+			return err
+		}
+		received <- store
+		return fakeChild(xCmdObj, args)
+	}), withSetup(func(object *Daemon) {
+		object.AddSecretFiles(map[string]string{"key": keyFile}).
+			AddSecretEnv("DAEMON_TEST_TOKEN").
+			AddSecrets(func() (map[string][]byte, error) {
+				if 2 == atomic.AddInt32(&loads, 1) {
+					return map[string][]byte{"dynamic": []byte("v2")}, nil
+				}
+				return map[string][]byte{"dynamic": []byte("v1")}, nil
+			})
+	}))
+	store := <-received
+	for name, want := range map[string]string{"key": "file-key", "DAEMON_TEST_TOKEN": "env-token", "dynamic": "v1"} {
+		if value, ok := (&Registry{secrets: store}).Secret(name); !ok || want != string(value) {
+			t.Fatal(name, string(value), ok)
+		}
+	}
+	// 机密环境变量不传给子进程
+	for _, kv := range object.currentChild().Env {
+		if "DAEMON_TEST_TOKEN" == envKey(kv) {
+			t.Fatal(kv)
+		}
+	}
+
+	// 更新时重新加载
+	if err := object.Upgrade(); nil != err {
+		t.Fatal(err)
+	}
+	store = <-received
+	if value, _ := store.get("dynamic"); "v2" != string(value) {
+		t.Fatal(string(value))
+	}
+	store.wipe()
+	if _, ok := (&Registry{}).Secret("dynamic"); ok {
+		t.Fatal("secret without store")
+	}
+
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+
+	// 加载失败时不启动
+	object.AddSecrets(func() (map[string][]byte, error) {
+		return nil, errors.New("vault sealed")
+	})
+	if _, err := object.loadSecrets(context.Background()); !errors.Is(err, ErrSecrets) {
+		t.Fatal(err)
+	}
+}
+
+// vaultProvider 模拟外部机密服务
+type vaultProvider struct {
+	calls int32
+}
+
+// Secrets 等待ctx
+func (object *vaultProvider) Secrets(ctx context.Context) (map[string][]byte, error) {
+	atomic.AddInt32(&object.calls, 1)
+	if err := ctx.Err(); nil != err {
+		return nil, err
+	}
+	return map[string][]byte{"db": []byte("vault-db")}, nil
+}
+
+func TestSecretProviders(t *testing.T) {
+	if _, err := (FileSecrets{"key": filepath.Join(t.TempDir(), "missing")}).Secrets(context.Background()); nil == err {
+		t.Fatal("missing file loaded")
+	}
+	if _, err := (EnvSecrets{"DAEMON_TEST_UNSET"}).Secrets(context.Background()); nil == err {
+		t.Fatal("unset env loaded")
+	}
+
+	vault := &vaultProvider{}
+	object := Default().AddSecretProvider(vault).AddSecretProvider(EnvSecrets{"DAEMON_TEST_VAULT_TOKEN"})
+	os.Setenv("DAEMON_TEST_VAULT_TOKEN", "token")
+	defer os.Unsetenv("DAEMON_TEST_VAULT_TOKEN")
+	if !object.isSecretEnv("DAEMON_TEST_VAULT_TOKEN") {
+		t.Fatal("env provider not stripped")
+	}
+	raw, err := object.loadSecrets(context.Background())
+	if nil != err {
+		t.Fatal(err)
+	}
+	store := &secretStore{}
+	if err = store.update(raw); nil != err {
+		t.Fatal(err)
+	}
+	if value, _ := store.get("db"); "vault-db" != string(value) {
+		t.Fatal(string(value))
+	}
+
+	// 停服时取消
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = object.loadSecrets(ctx); !errors.Is(err, ErrSecrets) || 2 != atomic.LoadInt32(&vault.calls) {
+		t.Fatal(err, vault.calls)
+	}
+}
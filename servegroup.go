@@ -0,0 +1,58 @@
+package daemon
+
+import (
+	"net"
+
+	"github.com/golang/glog"
+)
+
+// ServeGroup 在继承的侦听上运行一组服务，供daemonhttp/daemongrpc等业务逻辑复用：
+// 按侦听名取回侦听并跟踪连接，服务全部启动后上报准备好，
+// 收到退出或某个服务异常退出时调用stop停止全部服务，等到全部serve返回后返回第一个错误。
+// serve停止后应返回nil，stop决定各服务的停止方式
+func ServeGroup(registry *Registry,
+	ready chan bool,
+	exitCh chan interface{},
+	serves map[string]func(ln net.Listener) error,
+	stop func()) (err error) {
+	// 取回侦听，连接被跟踪以便父进程等待排空
+	listeners := make(map[string]*TrackedListener, len(serves))
+	for name := range serves {
+		var ln net.Listener
+		if ln, err = registry.Listener(name); nil != err {
+			for _, tracked := range listeners {
+				tracked.Close()
+			}
+			ready <- false
+			return
+		}
+		listeners[name] = TrackListener(ln)
+	}
+
+	errCh := make(chan error, len(serves))
+	for name, serve := range serves {
+		go func(serve func(ln net.Listener) error, ln net.Listener) {
+			errCh <- serve(ln)
+		}(serve, listeners[name])
+	}
+	ready <- true
+
+	// 等待退出或某个服务异常退出
+	pending := len(serves)
+	select {
+	case <-exitCh:
+	case err = <-errCh:
+		pending--
+		if nil != err {
+			glog.Error(err)
+		}
+	}
+	stop()
+
+	for ; 0 < pending; pending-- {
+		if serveErr := <-errCh; nil != serveErr && nil == err {
+			err = serveErr
+		}
+	}
+	return
+}
@@ -0,0 +1,46 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 服务管理器
+const (
+	ServiceManagerSystemd = "systemd"
+	ServiceManagerLaunchd = "launchd"
+)
+
+// getServiceName 系统服务名
+func (object *Daemon) getServiceName() string {
+	if 0 < len(object.serviceName) {
+		return object.serviceName
+	}
+	name := filepath.Base(object.origArgs[0])
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// serviceArgs 系统服务启动参数，去掉安装参数，使用service子命令或--service
+func (object *Daemon) serviceArgs() (exePath string, args []string, err error) {
+	if exePath, err = os.Executable(); nil != err {
+		return
+	}
+	source := object.appArgs
+	if object.legacyFlags {
+		source = object.origArgs[1:]
+	} else {
+		args = append(args, CommandService)
+	}
+	for _, arg := range source {
+		switch strings.TrimLeft(arg, "-") {
+		case "install", "uninstall", "service", "systemd", "launchd", "daemonize":
+			continue
+		}
+		args = append(args, arg)
+	}
+	if object.legacyFlags {
+		args = append(args, "--service")
+	}
+	return
+}
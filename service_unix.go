@@ -0,0 +1,199 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/golang/glog"
+	"golang.org/x/sys/unix"
+)
+
+// 服务单元参数
+const (
+	systemdUnitDir     = "/etc/systemd/system"
+	launchdPlistDir    = "/Library/LaunchDaemons"
+	serviceWatchdogSec = 30
+)
+
+// getServiceManager 服务管理器，默认按平台选择
+func (object *Daemon) getServiceManager() string {
+	if 0 < len(object.serviceManager) {
+		return object.serviceManager
+	}
+	if "darwin" == runtime.GOOS {
+		return ServiceManagerLaunchd
+	}
+	return ServiceManagerSystemd
+}
+
+// systemdUnitPath systemd单元文件路径
+func (object *Daemon) systemdUnitPath() string {
+	return filepath.Join(systemdUnitDir, object.getServiceName()+".service")
+}
+
+// launchdPlistPath launchd配置文件路径
+func (object *Daemon) launchdPlistPath() string {
+	return filepath.Join(launchdPlistDir, object.getServiceName()+".plist")
+}
+
+// runCommand 运行外部命令
+func runCommand(name string, arg ...string) error {
+	output, err := exec.Command(name, arg...).CombinedOutput()
+	if nil != err {
+		return fmt.Errorf("%s %s: %v: %s", name, strings.Join(arg, " "), err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// systemdUnit 生成systemd单元，守护进程自己负责重启子进程，因此Restart=no；
+// ExecReload发送映射到更新的信号，没有映射时返回ErrNoSignal
+func (object *Daemon) systemdUnit(exePath string, args []string, workDir string) (string, error) {
+	execStart := []string{strconv.Quote(exePath)}
+	for _, arg := range args {
+		execStart = append(execStart, strconv.Quote(arg))
+	}
+	s, ok := object.signalFor(UpgradeRequest).(syscall.Signal)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNoSignal, UpgradeRequest)
+	}
+	return fmt.Sprintf(`[Unit]
+Description=%s
+After=network.target
+
+[Service]
+Type=notify
+NotifyAccess=main
+WorkingDirectory=%s
+ExecStart=%s
+ExecReload=/bin/kill -%s $MAINPID
+KillMode=mixed
+Restart=no
+WatchdogSec=%d
+
+[Install]
+WantedBy=multi-user.target
+`, object.getServiceName(), workDir, strings.Join(execStart, " "),
+		strings.TrimPrefix(unix.SignalName(s), "SIG"), serviceWatchdogSec), nil
+}
+
+// launchdPlist 生成launchd配置
+func (object *Daemon) launchdPlist(exePath string, args []string, workDir string) string {
+	escape := func(s string) string {
+		var buf bytes.Buffer
+		xml.EscapeText(&buf, []byte(s))
+		return buf.String()
+	}
+	var programArgs strings.Builder
+	for _, arg := range append([]string{exePath}, args...) {
+		programArgs.WriteString("\t\t<string>" + escape(arg) + "</string>\n")
+	}
+	logPath := escape(filepath.Join(workDir, object.bootstrapLogDir, object.getServiceName()+".log"))
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+%s	</array>
+	<key>WorkingDirectory</key>
+	<string>%s</string>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<false/>
+	<key>StandardOutPath</key>
+	<string>%s</string>
+	<key>StandardErrorPath</key>
+	<string>%s</string>
+</dict>
+</plist>
+`, escape(object.getServiceName()), programArgs.String(), escape(workDir), logPath, logPath)
+}
+
+// installService 写入服务单元并启用
+func (object *Daemon) installService() (err error) {
+	exePath, args, err := object.serviceArgs()
+	if nil != err {
+		return
+	}
+	var workDir string
+	if workDir, err = os.Getwd(); nil != err {
+		return
+	}
+
+	switch object.getServiceManager() {
+	case ServiceManagerSystemd:
+		var unit string
+		if unit, err = object.systemdUnit(exePath, args, workDir); nil != err {
+			return
+		}
+		if err = ioutil.WriteFile(object.systemdUnitPath(), []byte(unit), 0644); nil != err {
+			return
+		}
+		if err = runCommand("systemctl", "daemon-reload"); nil != err {
+			return
+		}
+		err = runCommand("systemctl", "enable", object.getServiceName())
+
+	case ServiceManagerLaunchd:
+		if err = ioutil.WriteFile(object.launchdPlistPath(),
+			[]byte(object.launchdPlist(exePath, args, workDir)),
+			0644); nil != err {
+			return
+		}
+		err = runCommand("launchctl", "load", "-w", object.launchdPlistPath())
+
+	default:
+		err = fmt.Errorf("unknown service manager: %s", object.getServiceManager())
+	}
+	if nil == err {
+		glog.Infof("service %s installed", object.getServiceName())
+	}
+	return
+}
+
+// uninstallService 停用并删除服务单元
+func (object *Daemon) uninstallService() (err error) {
+	switch object.getServiceManager() {
+	case ServiceManagerSystemd:
+		if err = runCommand("systemctl", "disable", "--now", object.getServiceName()); nil != err {
+			return
+		}
+		if err = os.Remove(object.systemdUnitPath()); nil != err {
+			return
+		}
+		err = runCommand("systemctl", "daemon-reload")
+
+	case ServiceManagerLaunchd:
+		if err = runCommand("launchctl", "unload", "-w", object.launchdPlistPath()); nil != err {
+			return
+		}
+		err = os.Remove(object.launchdPlistPath())
+
+	default:
+		err = fmt.Errorf("unknown service manager: %s", object.getServiceManager())
+	}
+	if nil == err {
+		glog.Infof("service %s uninstalled", object.getServiceName())
+	}
+	return
+}
+
+// runAsService 以系统服务运行，Unix下与普通守护进程一致
+func (object *Daemon) runAsService(signalCh chan os.Signal) error {
+	return object.runAsParent(signalCh)
+}
@@ -0,0 +1,45 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files under testdata")
+
+// checkGolden 与testdata下的golden文件比较，-update时重写
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := ioutil.WriteFile(path, []byte(got), 0644); nil != err {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(path)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if string(want) != got {
+		t.Fatalf("%s mismatch:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func TestServiceUnitGolden(t *testing.T) {
+	object := New("child", "upgrade", "bootstrap_args", "logs", "pid").
+		SetServiceName("app")
+	args := []string{"--config=/etc/app/a&b.yaml", "--name=say \"hi\""}
+
+	// Type=notify、Restart=no、WatchdogSec与ExecReload
+	unit, err := object.systemdUnit("/usr/local/bin/app", args, "/var/lib/app")
+	if nil != err {
+		t.Fatal(err)
+	}
+	checkGolden(t, "app.service", unit)
+	checkGolden(t, "app.plist", object.launchdPlist("/usr/local/bin/app", args, "/var/lib/app"))
+}
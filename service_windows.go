@@ -0,0 +1,138 @@
+package daemon
+
+import (
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceHandler SCM服务处理器
+type serviceHandler struct {
+	object   *Daemon
+	signalCh chan os.Signal
+}
+
+// serviceCommand SCM指令对应的守护进程动作与回复给SCM的状态
+type serviceCommand struct {
+	action string
+	state  svc.State
+}
+
+// serviceCommands 停止/关机走安全退出流程，暂停/继续重新加载，不替换子进程
+var serviceCommands = map[svc.Cmd]serviceCommand{
+	svc.Stop:     {action: ExitRequest, state: svc.StopPending},
+	svc.Shutdown: {action: ExitRequest, state: svc.StopPending},
+	svc.Pause:    {action: ReloadRequest, state: svc.Paused},
+	svc.Continue: {action: ReloadRequest, state: svc.Running},
+}
+
+// Execute 处理SCM指令，按serviceCommands转为守护进程的动作
+func (handler *serviceHandler) Execute(args []string,
+	requests <-chan svc.ChangeRequest,
+	status chan<- svc.Status) (svcSpecificEC bool, exitCode uint32) {
+	const accepts = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptPauseAndContinue
+	status <- svc.Status{State: svc.StartPending}
+
+	doneCh := make(chan error, 1)
+	go func() {
+		doneCh <- handler.object.runAsParent(handler.signalCh)
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: accepts}
+
+	for {
+		select {
+		case err := <-doneCh:
+			if nil != err {
+				glog.Error(err)
+				exitCode = 1
+			}
+			status <- svc.Status{State: svc.StopPending}
+			return
+
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+
+			default:
+				if command, ok := serviceCommands[request.Cmd]; ok {
+					status <- svc.Status{State: command.state, Accepts: accepts}
+					handler.object.postCommand(command.action, "service manager")
+				}
+			}
+		}
+	}
+}
+
+// installService 注册到SCM
+func (object *Daemon) installService() (err error) {
+	exePath, args, err := object.serviceArgs()
+	if nil != err {
+		return
+	}
+
+	var m *mgr.Mgr
+	if m, err = mgr.Connect(); nil != err {
+		return
+	}
+	defer m.Disconnect()
+
+	var s *mgr.Service
+	if s, err = m.CreateService(object.getServiceName(),
+		exePath,
+		mgr.Config{
+			DisplayName: object.getServiceName(),
+			StartType:   mgr.StartAutomatic,
+		},
+		args...); nil != err {
+		return
+	}
+	defer s.Close()
+
+	glog.Infof("service %s installed", object.getServiceName())
+	return
+}
+
+// uninstallService 从SCM注销
+func (object *Daemon) uninstallService() (err error) {
+	var m *mgr.Mgr
+	if m, err = mgr.Connect(); nil != err {
+		return
+	}
+	defer m.Disconnect()
+
+	var s *mgr.Service
+	if s, err = m.OpenService(object.getServiceName()); nil != err {
+		return
+	}
+	defer s.Close()
+
+	if _, err = s.Control(svc.Stop); nil == err {
+		// 等待服务停止
+		for i := 0; i < 30; i++ {
+			var st svc.Status
+			if st, err = s.Query(); nil != err || svc.Stopped == st.State {
+				break
+			}
+			time.Sleep(time.Second)
+		}
+	}
+
+	if err = s.Delete(); nil != err {
+		return
+	}
+
+	glog.Infof("service %s uninstalled", object.getServiceName())
+	return
+}
+
+// runAsService 在SCM下运行
+func (object *Daemon) runAsService(signalCh chan os.Signal) error {
+	return svc.Run(object.getServiceName(), &serviceHandler{
+		object:   object,
+		signalCh: signalCh,
+	})
+}
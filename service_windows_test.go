@@ -0,0 +1,28 @@
+package daemon
+
+import (
+	"testing"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+func TestServiceCommands(t *testing.T) {
+	for _, c := range []struct {
+		cmd    svc.Cmd
+		action string
+		state  svc.State
+	}{
+		{svc.Stop, ExitRequest, svc.StopPending},
+		{svc.Shutdown, ExitRequest, svc.StopPending},
+		{svc.Pause, ReloadRequest, svc.Paused},
+		{svc.Continue, ReloadRequest, svc.Running},
+	} {
+		command, ok := serviceCommands[c.cmd]
+		if !ok || c.action != command.action || c.state != command.state {
+			t.Fatal(c.cmd, command)
+		}
+	}
+	if _, ok := serviceCommands[svc.Interrogate]; ok {
+		t.Fatal("interrogate mapped")
+	}
+}
@@ -0,0 +1,168 @@
+package daemon
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"unsafe"
+)
+
+// 共享内存环形缓冲区的布局：读写位置各占一个缓存行，其后为数据区；
+// 记录为4字节小端长度加内容，按4字节对齐，数据区末尾放不下时写入填充标记后回绕
+const (
+	shmTailOffset   = 0          // 写位置
+	shmHeadOffset   = 64         // 读位置
+	shmDataOffset   = 128        // 数据区
+	shmPadMarker    = 0xFFFFFFFF // 填充标记，读者跳到数据区开头
+	fdSlotShmPrefix = "shm:"     // 共享内存的槽位名，后接名字
+)
+
+// sharedSegment 登记的共享内存
+type sharedSegment struct {
+	name string
+	file *os.File
+	err  error
+}
+
+// AddSharedMemory 新建size字节的共享内存(Linux下为memfd)，每个子进程都继承同一段，
+// 父进程以SharedRing、子进程以Registry.SharedRing按名字映射为环形缓冲区；
+// 适合指标汇总、新旧子进程交接状态等管道吞吐不足的场景。新建失败时派生子进程返回错误
+func (object *Daemon) AddSharedMemory(name string, size int) *Daemon {
+	segment := sharedSegment{name: name}
+	if size <= shmDataOffset {
+		segment.err = fmt.Errorf("%w: %s size %d too small", ErrSharedMemory, name, size)
+	} else if segment.file, segment.err = createSegment(name, size); nil != segment.err {
+		segment.err = fmt.Errorf("%w: %s: %w", ErrSharedMemory, name, segment.err)
+	}
+	object.sharedSegments = append(object.sharedSegments, segment)
+	return object
+}
+
+// SharedRing 父进程映射登记的共享内存
+func (object *Daemon) SharedRing(name string) (*SharedRing, error) {
+	for _, segment := range object.sharedSegments {
+		if name != segment.name {
+			continue
+		}
+		if nil != segment.err {
+			return nil, segment.err
+		}
+		return mapSharedRing(int(segment.file.Fd()))
+	}
+	return nil, fmt.Errorf("%w: unknown segment %s", ErrSharedMemory, name)
+}
+
+// passSharedMemory 传递登记的共享内存
+func (object *Daemon) passSharedMemory(xCmdObj *XCmd) error {
+	for _, segment := range object.sharedSegments {
+		if nil != segment.err {
+			return segment.err
+		}
+		xCmdObj.AddNamedFile(fdSlotShmPrefix+segment.name, segment.file)
+	}
+	return nil
+}
+
+// SharedRing 子进程映射父进程传入的共享内存
+func (object *Registry) SharedRing(name string) (*SharedRing, error) {
+	fd, ok := object.fdSlots[fdSlotShmPrefix+name]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown segment %s", ErrSharedMemory, name)
+	}
+	return mapSharedRing(fd)
+}
+
+// mapSharedRing 映射共享内存为环形缓冲区，不接管fd
+func mapSharedRing(fd int) (*SharedRing, error) {
+	mem, err := mapSegment(fd)
+	if nil != err {
+		return nil, fmt.Errorf("%w: %w", ErrSharedMemory, err)
+	}
+	if len(mem) <= shmDataOffset {
+		unmapSegment(mem)
+		return nil, fmt.Errorf("%w: segment size %d too small", ErrSharedMemory, len(mem))
+	}
+	return &SharedRing{mem: mem, data: mem[shmDataOffset : shmDataOffset+(len(mem)-shmDataOffset)&^3]}, nil
+}
+
+// SharedRing 共享内存上的单生产者单消费者环形缓冲区，记录保持边界；
+// 同一段只能有一个写者和一个读者，多个工作进程写入时应各用一段
+type SharedRing struct {
+	mem  []byte // 整个映射
+	data []byte // 数据区
+}
+
+// position 读写位置
+func (object *SharedRing) position(offset int) *uint64 {
+	return (*uint64)(unsafe.Pointer(&object.mem[offset]))
+}
+
+// Write 写入一条记录，空间不足时返回ErrRingFull
+func (object *SharedRing) Write(p []byte) error {
+	capacity := uint64(len(object.data))
+	size := uint64(4+len(p)+3) &^ 3
+	if size > capacity {
+		return fmt.Errorf("%w: record %d bytes exceeds capacity %d", ErrRingFull, len(p), capacity)
+	}
+	tail := atomic.LoadUint64(object.position(shmTailOffset))
+	head := atomic.LoadUint64(object.position(shmHeadOffset))
+	free := capacity - (tail - head)
+	offset := tail % capacity
+	var pad uint64
+	if offset+size > capacity {
+		pad = capacity - offset
+	}
+	if pad+size > free {
+		return ErrRingFull
+	}
+	if 0 < pad {
+		binary.LittleEndian.PutUint32(object.data[offset:], shmPadMarker)
+		offset = 0
+	}
+	binary.LittleEndian.PutUint32(object.data[offset:], uint32(len(p)))
+	copy(object.data[offset+4:], p)
+	atomic.StoreUint64(object.position(shmTailOffset), tail+pad+size)
+	return nil
+}
+
+// Read 读取一条记录，没有记录时ok为false；共享内存中的位置或长度越界时返回ErrRingCorrupt，
+// 不移动读位置
+func (object *SharedRing) Read() (record []byte, ok bool, err error) {
+	capacity := uint64(len(object.data))
+	head := atomic.LoadUint64(object.position(shmHeadOffset))
+	tail := atomic.LoadUint64(object.position(shmTailOffset))
+	if tail-head > capacity {
+		return nil, false, fmt.Errorf("%w: %d unread bytes exceed capacity %d", ErrRingCorrupt, tail-head, capacity)
+	}
+	for head != tail {
+		offset := head % capacity
+		n := binary.LittleEndian.Uint32(object.data[offset:])
+		if shmPadMarker == n {
+			if capacity-offset > tail-head {
+				return nil, false, fmt.Errorf("%w: padding at %d beyond tail", ErrRingCorrupt, offset)
+			}
+			head += capacity - offset
+			continue
+		}
+		size := (4 + uint64(n) + 3) &^ 3
+		if uint64(n) > capacity-offset-4 || size > tail-head {
+			return nil, false, fmt.Errorf("%w: record length %d at %d", ErrRingCorrupt, n, offset)
+		}
+		record = append([]byte(nil), object.data[offset+4:offset+4+uint64(n)]...)
+		atomic.StoreUint64(object.position(shmHeadOffset), head+size)
+		return record, true, nil
+	}
+	atomic.StoreUint64(object.position(shmHeadOffset), head)
+	return nil, false, nil
+}
+
+// Len 未读的字节数，含记录头与填充
+func (object *SharedRing) Len() int {
+	return int(atomic.LoadUint64(object.position(shmTailOffset)) - atomic.LoadUint64(object.position(shmHeadOffset)))
+}
+
+// Close 解除映射
+func (object *SharedRing) Close() error {
+	return unmapSegment(object.mem)
+}
@@ -0,0 +1,21 @@
+package daemon
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// createSegment 以memfd新建共享内存，不占用文件系统路径
+func createSegment(name string, size int) (*os.File, error) {
+	fd, err := unix.MemfdCreate("daemon-"+name, unix.MFD_CLOEXEC)
+	if nil != err {
+		return nil, os.NewSyscallError("memfd_create", err)
+	}
+	f := os.NewFile(uintptr(fd), name)
+	if err = f.Truncate(int64(size)); nil != err {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,20 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package daemon
+
+import "os"
+
+// createSegment 以删除了路径的临时文件新建共享内存
+func createSegment(name string, size int) (*os.File, error) {
+	f, err := os.CreateTemp("", "daemon-"+name+"-")
+	if nil != err {
+		return nil, err
+	}
+	os.Remove(f.Name())
+	if err = f.Truncate(int64(size)); nil != err {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
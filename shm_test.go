@@ -0,0 +1,90 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestSharedRing(t *testing.T) {
+	object := Default().AddSharedMemory("metrics", shmDataOffset+64)
+	parent, err := object.SharedRing("metrics")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer parent.Close()
+
+	// 子进程按槽位名映射同一段
+	xCmdObj, err := NewFakeRunner(fakeChild).Command("app")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err = object.passSharedMemory(xCmdObj); nil != err {
+		t.Fatal(err)
+	}
+	registry := newRegistry(nil)
+	registry.fdSlots = map[string]int{"shm:metrics": int(xCmdObj.ExtraFiles[0].Fd())}
+	child, err := registry.SharedRing("metrics")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer child.Close()
+
+	// 多次回绕，记录保持边界与顺序
+	for i := 0; i < 50; i++ {
+		record := []byte(fmt.Sprintf("record-%d", i))
+		if err = child.Write(record); nil != err {
+			t.Fatal(i, err)
+		}
+		got, ok, e := parent.Read()
+		if nil != e || !ok || !bytes.Equal(record, got) {
+			t.Fatal(i, string(got), ok, e)
+		}
+	}
+	if _, ok, e := parent.Read(); nil != e || ok || 0 != parent.Len() {
+		t.Fatal("ring not empty", e)
+	}
+	for err = nil; nil == err; {
+		err = child.Write(make([]byte, 10))
+	}
+	if !errors.Is(err, ErrRingFull) {
+		t.Fatal(err)
+	}
+	if err = child.Write(make([]byte, 100)); !errors.Is(err, ErrRingFull) {
+		t.Fatal(err)
+	}
+	if _, err = object.SharedRing("missing"); !errors.Is(err, ErrSharedMemory) {
+		t.Fatal(err)
+	}
+	if _, err = Default().AddSharedMemory("tiny", 8).SharedRing("tiny"); !errors.Is(err, ErrSharedMemory) {
+		t.Fatal(err)
+	}
+}
+
+func TestSharedRingCorrupt(t *testing.T) {
+	object := Default().AddSharedMemory("metrics", shmDataOffset+64)
+	ring, err := object.SharedRing("metrics")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer ring.Close()
+
+	// 长度越界时返回错误而不是越界访问
+	if err = ring.Write([]byte("record")); nil != err {
+		t.Fatal(err)
+	}
+	binary.LittleEndian.PutUint32(ring.data, 100000)
+	if _, ok, e := ring.Read(); ok || !errors.Is(e, ErrRingCorrupt) {
+		t.Fatal(ok, e)
+	}
+	binary.LittleEndian.PutUint32(ring.data, 6)
+	*ring.position(shmTailOffset) = 1 << 20
+	if _, ok, e := ring.Read(); ok || !errors.Is(e, ErrRingCorrupt) {
+		t.Fatal(ok, e)
+	}
+}
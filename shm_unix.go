@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mapSegment 映射fd对应的整个文件
+func mapSegment(fd int) ([]byte, error) {
+	var stat unix.Stat_t
+	if err := unix.Fstat(fd, &stat); nil != err {
+		return nil, os.NewSyscallError("fstat", err)
+	}
+	return unix.Mmap(fd, 0, int(stat.Size), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+}
+
+// unmapSegment 解除映射
+func unmapSegment(mem []byte) error {
+	return unix.Munmap(mem)
+}
@@ -0,0 +1,18 @@
+package daemon
+
+import "os"
+
+// createSegment Windows不支持继承共享内存
+func createSegment(name string, size int) (*os.File, error) {
+	return nil, ErrSharedMemory
+}
+
+// mapSegment Windows不支持继承共享内存
+func mapSegment(fd int) ([]byte, error) {
+	return nil, ErrSharedMemory
+}
+
+// unmapSegment Windows不支持继承共享内存
+func unmapSegment(mem []byte) error {
+	return nil
+}
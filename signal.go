@@ -0,0 +1,174 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// 可映射到信号的其他指令
+const (
+	ReloadRequest     = "Reload"               // 重载证书，子进程回调Registry.OnReload注册的函数
+	RotateLogsRequest = "RotateLogs"           // 重新打开转发日志与审计日志文件
+	ScaleUpRequest    = WorkersRequest + ":+1" // 工作进程数加一
+	ScaleDownRequest  = WorkersRequest + ":-1" // 工作进程数减一，至少保留一个
+)
+
+// SetSignalAction 把信号映射到控制指令，action为空时取消映射、恢复信号的默认行为；
+// 如SIGHUP->ReloadRequest、SIGUSR1->RotateLogsRequest、SIGTTIN/SIGTTOU->ScaleUpRequest/ScaleDownRequest，
+// 默认SIGINT、SIGTERM->ExitRequest，SIGUSR2->UpgradeRequest
+func (object *Daemon) SetSignalAction(s os.Signal, action string) *Daemon {
+	if 0 >= len(action) {
+		delete(object.signalActions, s)
+	} else {
+		object.signalActions[s] = action
+	}
+	return object
+}
+
+// signalAction 信号对应的控制指令
+func (object *Daemon) signalAction(s os.Signal) string {
+	return object.signalActions[s]
+}
+
+// signalFor 映射到指令的信号，多个时按名字取最前的，保证结果稳定
+func (object *Daemon) signalFor(action string) (found os.Signal) {
+	for s, a := range object.signalActions {
+		if action == a && (nil == found || s.String() < found.String()) {
+			found = s
+		}
+	}
+	return
+}
+
+// handledSignals 订阅的信号，forwardQuit时另订阅SIGQUIT转发给子进程，
+// 其余信号保持默认行为
+func (object *Daemon) handledSignals(forwardQuit bool) []os.Signal {
+	signals := make([]os.Signal, 0, len(object.signalActions)+1)
+	for s := range object.signalActions {
+		signals = append(signals, s)
+	}
+	if forwardQuit {
+		for _, s := range forwardedSignals() {
+			if _, ok := object.signalActions[s]; !ok {
+				signals = append(signals, s)
+			}
+		}
+	}
+	return signals
+}
+
+// parseWorkersDelta 解析相对的扩缩容指令，如Workers:+1、Workers:-1，结果至少为1
+func parseWorkersDelta(action string, current int) (n int, ok bool) {
+	if !strings.HasPrefix(action, WorkersRequest+":") {
+		return
+	}
+	delta := action[len(WorkersRequest)+1:]
+	if !strings.HasPrefix(delta, "+") && !strings.HasPrefix(delta, "-") {
+		return
+	}
+	d, err := strconv.Atoi(delta)
+	if nil != err {
+		return
+	}
+	if n = current + d; 1 > n {
+		n = 1
+	}
+	return n, true
+}
+
+// Reload 重载证书，并通知全部子进程回调Registry.OnReload注册的函数；
+// 设置了SetListenerSource且侦听集合有变化时改为热更新，更新结束后返回
+func (object *Daemon) Reload() error {
+	return object.execCommand(ReloadRequest)
+}
+
+// reload 重载证书后向全部子进程下发重载指令
+func (object *Daemon) reload() (err error) {
+	if err = object.ReloadTLS(); nil != err {
+		return
+	}
+	object.RLock()
+	defer object.RUnlock()
+	for _, child := range object.children() {
+		if e := child.ParentWriteStream(StreamControl, []byte(ReloadRequest)); nil != e && nil == err {
+			err = fmt.Errorf("daemon: reload child %d: %w", child.Pid(), e)
+		}
+	}
+	return
+}
+
+// OnReload 注册收到重载指令时的回调，如重新读取配置文件
+func (object *Registry) OnReload(handler func()) {
+	object.Lock()
+	defer object.Unlock()
+	object.reloaders = append(object.reloaders, handler)
+}
+
+// reload 依次调用重载回调
+func (object *Registry) reload() {
+	object.Lock()
+	reloaders := make([]func(), len(object.reloaders))
+	copy(reloaders, object.reloaders)
+	object.Unlock()
+	for _, handler := range reloaders {
+		handler()
+	}
+}
+
+// RotateLogs 重新打开转发日志与审计日志文件，配合外部的logrotate使用
+func (object *Daemon) RotateLogs() error {
+	return object.execCommand(RotateLogsRequest)
+}
+
+// rotateLogs 关闭日志文件，下次写入时按原路径重新打开
+func (object *Daemon) rotateLogs() (err error) {
+	glog.Flush()
+	if nil != object.logSink {
+		err = object.logSink.Close()
+	}
+	if nil != object.audit {
+		if e := object.audit.sink.Close(); nil != e && nil == err {
+			err = e
+		}
+	}
+	return
+}
+
+// SetForwardSIGQUIT 设置把SIGQUIT转发给全部子进程，便于获取应用的协程栈；
+// 未开启时守护进程不订阅SIGQUIT，按Go默认行为输出自身协程栈并退出
+func (object *Daemon) SetForwardSIGQUIT(forward bool) *Daemon {
+	object.forwardQuit = forward
+	return object
+}
+
+// forwardSignal 把信号原样转发给全部子进程
+func (object *Daemon) forwardSignal(s os.Signal) {
+	object.RLock()
+	defer object.RUnlock()
+	for _, child := range object.children() {
+		object.auditAction(AuditSignal, child, map[string]string{"signal": s.String(), "action": "forward"})
+		if err := child.Signal(s); nil != err {
+			glog.Error(err)
+		}
+	}
+}
+
+// handledSignals 全部服务订阅的信号的并集
+func (object *Supervisor) handledSignals() (signals []os.Signal) {
+	object.RLock()
+	defer object.RUnlock()
+	seen := make(map[os.Signal]bool)
+	for _, service := range object.services {
+		for _, s := range service.daemon.handledSignals(service.daemon.forwardQuit) {
+			if !seen[s] {
+				seen[s] = true
+				signals = append(signals, s)
+			}
+		}
+	}
+	return
+}
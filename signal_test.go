@@ -0,0 +1,186 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHandledSignals(t *testing.T) {
+	object := Default()
+	for _, s := range object.handledSignals(false) {
+		if syscall.SIGQUIT == s {
+			t.Fatal("SIGQUIT subscribed")
+		}
+	}
+	signals := object.handledSignals(true)
+	if syscall.SIGQUIT != signals[len(signals)-1] {
+		t.Fatal(signals)
+	}
+
+	// 取消映射后不再订阅，重新映射后更新使用新信号
+	object.SetSignalAction(syscall.SIGUSR2, "").SetSignalAction(syscall.SIGHUP, UpgradeRequest)
+	if 3 != len(object.handledSignals(false)) || "" != object.signalAction(syscall.SIGUSR2) {
+		t.Fatal(object.handledSignals(false))
+	}
+	if syscall.SIGHUP != object.signalFor(UpgradeRequest) {
+		t.Fatal(object.signalFor(UpgradeRequest))
+	}
+	if err := notifyDaemon(os.Getpid(), ReloadRequest, object.signalFor(ReloadRequest)); !errors.Is(err, ErrNoSignal) {
+		t.Fatal(err)
+	}
+}
+
+func TestServiceReloadSignal(t *testing.T) {
+	object := Default().SetServiceName("app")
+	unit, err := object.systemdUnit("/usr/bin/app", nil, "/")
+	if nil != err || !strings.Contains(unit, "ExecReload=/bin/kill -USR2 $MAINPID\n") {
+		t.Fatal(unit, err)
+	}
+	// 重新映射后systemctl reload发送新信号
+	object.SetSignalAction(syscall.SIGUSR2, "").SetSignalAction(syscall.SIGHUP, UpgradeRequest)
+	if unit, err = object.systemdUnit("/usr/bin/app", nil, "/"); nil != err || !strings.Contains(unit, "ExecReload=/bin/kill -HUP $MAINPID\n") {
+		t.Fatal(unit, err)
+	}
+	// 没有映射时不安装，避免reload以默认行为杀死守护进程
+	object.SetSignalAction(syscall.SIGHUP, "")
+	if _, err = object.systemdUnit("/usr/bin/app", nil, "/"); !errors.Is(err, ErrNoSignal) {
+		t.Fatal(err)
+	}
+}
+
+func TestParseWorkersDelta(t *testing.T) {
+	for action, want := range map[string]int{ScaleUpRequest: 3, ScaleDownRequest: 1, "Workers:-5": 1} {
+		if n, ok := parseWorkersDelta(action, 2); !ok || want != n {
+			t.Fatal(action, n, ok)
+		}
+	}
+	if _, ok := parseWorkersDelta("Workers:2", 2); ok {
+		t.Fatal("absolute count parsed as delta")
+	}
+	if _, ok := parseWorkersAction(ScaleUpRequest); ok {
+		t.Fatal("delta parsed as absolute count")
+	}
+}
+
+func TestSignalActions(t *testing.T) {
+	var reloads int32
+	object, signalCh, doneCh := startFakeParent(t, withChild(func(xCmdObj *XCmd, args []string) error {
+		if err := xCmdObj.ChildWrite([]byte(ReadyOK)); nil != err {
+			return err
+		}
+		if err := xCmdObj.ChildRead(func(raw []byte) bool {
+			if ReloadRequest == string(raw) {
+				atomic.AddInt32(&reloads, 1)
+			}
+			return nil != raw && ExitRequest != string(raw)
+		}); nil != err {
+			return err
+		}
+		return xCmdObj.ChildWrite([]byte(ExitReply))
+	}), withSetup(func(object *Daemon) {
+		object.SetSignalAction(syscall.SIGHUP, ReloadRequest).
+			SetSignalAction(syscall.SIGTTIN, ScaleUpRequest).
+			SetSignalAction(syscall.SIGTTOU, ScaleDownRequest)
+	}))
+
+	signalCh <- syscall.SIGHUP
+	waitFor(t, func() bool { return 1 == atomic.LoadInt32(&reloads) })
+
+	signalCh <- syscall.SIGTTIN
+	waitFor(t, func() bool { return 2 == object.Workers() && !object.IsUpgrading() })
+	signalCh <- syscall.SIGTTOU
+	waitFor(t, func() bool { return 1 == object.Workers() && !object.IsUpgrading() })
+
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+}
+
+func TestForwardSIGQUIT(t *testing.T) {
+	audit := filepath.Join(t.TempDir(), "audit.jsonl")
+	object, signalCh, doneCh := startFakeParent(t, withSetup(func(object *Daemon) {
+		object.SetAuditLog(audit, 0, 0).SetForwardSIGQUIT(true)
+	}))
+
+	// 模拟进程忽略SIGQUIT，转发后子进程仍在运行
+	signalCh <- syscall.SIGQUIT
+	waitFor(t, func() bool {
+		records, _ := ReadAudit(audit)
+		for _, record := range records {
+			if AuditSignal == record.Action && "forward" == record.Fields["action"] {
+				return 0 != record.ChildPid
+			}
+		}
+		return false
+	})
+	if StatusRunning != object.Status().Phase {
+		t.Fatal(object.Status())
+	}
+
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+}
+
+func TestUpgradeSignalBurst(t *testing.T) {
+	var spawned int32
+	var skipped sync.Map
+	skips := func(reason string) int32 {
+		if count, ok := skipped.Load(reason); ok {
+			return atomic.LoadInt32(count.(*int32))
+		}
+		return 0
+	}
+	object, signalCh, doneCh := startFakeParent(t, withChild(func(xCmdObj *XCmd, args []string) error {
+		if 1 < atomic.AddInt32(&spawned, 1) {
+			// 更新期间持续一段时间
+			time.Sleep(100 * time.Millisecond)
+		}
+		return fakeChild(xCmdObj, args)
+	}), withSetup(func(object *Daemon) {
+		object.SetUpgradeCooldown(time.Minute).
+			OnEvent(func(event Event) {
+				if EventUpgradeSkipped == event.Type {
+					count, _ := skipped.LoadOrStore(event.Reason, new(int32))
+					atomic.AddInt32(count.(*int32), 1)
+				}
+			})
+	}))
+
+	// 连发的信号只更新一次
+	for i := 0; i < 3; i++ {
+		signalCh <- syscall.SIGUSR2
+	}
+	waitFor(t, func() bool { return 2 == skips("already upgrading") && !object.IsUpgrading() })
+	waitFor(t, func() bool { return StatusRunning == object.Status().Phase })
+
+	// 冷却期内的信号被忽略，Upgrade调用不受限制
+	signalCh <- syscall.SIGUSR2
+	waitFor(t, func() bool { return 1 == skips("cooldown") })
+	if 2 != atomic.LoadInt32(&spawned) {
+		t.Fatal(spawned)
+	}
+	if err := object.Upgrade(); nil != err {
+		t.Fatal(err)
+	}
+	if 3 != atomic.LoadInt32(&spawned) {
+		t.Fatal(spawned)
+	}
+
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,162 @@
+package daemon
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// snappy块格式：uvarint原始长度，随后是字面量与回溯复制，元素类型取标记字节的低两位
+const (
+	snappyLiteral = 0 // 字面量，长度减一在高6位，60~63表示随后1~4字节的长度
+	snappyCopy1   = 1 // 长度4~11，偏移11位
+	snappyCopy2   = 2 // 长度1~64，偏移16位
+	snappyCopy4   = 3 // 长度1~64，偏移32位，只解码
+)
+
+const (
+	snappyHashBits  = 14      // 匹配哈希表的位数
+	snappyMaxOffset = 1 << 16 // 编码时回溯的最大偏移，只输出copy1/copy2
+	snappyExpansion = 22      // 每字节压缩数据最多解出的字节数，copy2以3字节表示64字节
+)
+
+// snappyCodec snappy块格式，比deflate快得多，适合交接时的大状态
+type snappyCodec struct{}
+
+// Compress 贪心匹配4字节前缀，未命中时随字面量增长加大步长，不可压缩的数据很快跳过
+func (snappyCodec) Compress(raw []byte) ([]byte, error) {
+	dst := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64+len(raw)+len(raw)/60+1), uint64(len(raw)))
+	var table [1 << snappyHashBits]int32
+	lit := 0
+	for s := 1; s+4 <= len(raw); {
+		h := snappyHash(binary.LittleEndian.Uint32(raw[s:]))
+		cand := int(table[h])
+		table[h] = int32(s)
+		if s-cand >= snappyMaxOffset ||
+			binary.LittleEndian.Uint32(raw[cand:]) != binary.LittleEndian.Uint32(raw[s:]) {
+			s += 1 + (s-lit)>>5
+			continue
+		}
+		n := 4
+		for s+n < len(raw) && raw[cand+n] == raw[s+n] {
+			n++
+		}
+		dst = snappyEmitLiteral(dst, raw[lit:s])
+		dst = snappyEmitCopy(dst, s-cand, n)
+		s += n
+		lit = s
+	}
+	return snappyEmitLiteral(dst, raw[lit:]), nil
+}
+
+// Decompress 解压，长度与偏移越界时返回ErrFrame
+func (snappyCodec) Decompress(raw []byte, maxSize int) ([]byte, error) {
+	size, n := binary.Uvarint(raw)
+	if 0 >= n || size > uint64(len(raw)-n)*snappyExpansion {
+		return nil, fmt.Errorf("%w: corrupt snappy header", ErrFrame)
+	}
+	if 0 < maxSize && size > uint64(maxSize) {
+		return nil, fmt.Errorf("%w: decompressed size exceeds %d", ErrFrame, maxSize)
+	}
+	dst := make([]byte, 0, size)
+	src := raw[n:]
+	for 0 < len(src) {
+		tag := src[0]
+		var length, offset int
+		switch tag & 3 {
+		case snappyLiteral:
+			length = int(tag >> 2)
+			src = src[1:]
+			if 60 <= length {
+				width := length - 59
+				if len(src) < width {
+					return nil, fmt.Errorf("%w: corrupt snappy literal", ErrFrame)
+				}
+				length = 0
+				for i := width - 1; 0 <= i; i-- {
+					length = length<<8 | int(src[i])
+				}
+				src = src[width:]
+			}
+			length++
+			if length > len(src) || length > cap(dst)-len(dst) {
+				return nil, fmt.Errorf("%w: corrupt snappy literal", ErrFrame)
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+		case snappyCopy1:
+			if 2 > len(src) {
+				return nil, fmt.Errorf("%w: corrupt snappy copy", ErrFrame)
+			}
+			length = 4 + int(tag>>2&7)
+			offset = int(tag>>5)<<8 | int(src[1])
+			src = src[2:]
+		case snappyCopy2:
+			if 3 > len(src) {
+				return nil, fmt.Errorf("%w: corrupt snappy copy", ErrFrame)
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case snappyCopy4:
+			if 5 > len(src) {
+				return nil, fmt.Errorf("%w: corrupt snappy copy", ErrFrame)
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+		if 0 >= offset || offset > len(dst) || length > cap(dst)-len(dst) {
+			return nil, fmt.Errorf("%w: corrupt snappy copy", ErrFrame)
+		}
+		// 偏移小于长度时复制的内容与输出重叠，逐字节复制
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[len(dst)-offset])
+		}
+	}
+	if uint64(len(dst)) != size {
+		return nil, fmt.Errorf("%w: snappy length mismatch", ErrFrame)
+	}
+	return dst, nil
+}
+
+// snappyHash 4字节前缀的哈希
+func snappyHash(u uint32) uint32 {
+	return u * 0x1e35a7bd >> (32 - snappyHashBits)
+}
+
+// snappyEmitLiteral 输出字面量
+func snappyEmitLiteral(dst, lit []byte) []byte {
+	if 0 >= len(lit) {
+		return dst
+	}
+	switch n := len(lit) - 1; {
+	case 60 > n:
+		dst = append(dst, byte(n)<<2|snappyLiteral)
+	case 1<<8 > n:
+		dst = append(dst, 60<<2|snappyLiteral, byte(n))
+	case 1<<16 > n:
+		dst = append(dst, 61<<2|snappyLiteral, byte(n), byte(n>>8))
+	case 1<<24 > n:
+		dst = append(dst, 62<<2|snappyLiteral, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2|snappyLiteral, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+// snappyEmitCopy 输出回溯复制，长度超过64时拆成多段，末段不短于4字节
+func snappyEmitCopy(dst []byte, offset, length int) []byte {
+	for 68 <= length {
+		dst = append(dst, 63<<2|snappyCopy2, byte(offset), byte(offset>>8))
+		length -= 64
+	}
+	if 64 < length {
+		dst = append(dst, 59<<2|snappyCopy2, byte(offset), byte(offset>>8))
+		length -= 60
+	}
+	if 12 <= length || 2048 <= offset {
+		return append(dst, byte(length-1)<<2|snappyCopy2, byte(offset), byte(offset>>8))
+	}
+	return append(dst, byte(offset>>8)<<5|byte(length-4)<<2|snappyCopy1, byte(offset))
+}
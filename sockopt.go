@@ -0,0 +1,96 @@
+package daemon
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// ListenerOptions 侦听的socket选项，父进程绑定时生效的选项仅部分平台支持，
+// 不支持时记录警告并忽略
+type ListenerOptions struct {
+	NoDelay       *bool         `json:"no_delay,omitempty"`       // 接受的连接设置TCP_NODELAY，nil为Go默认（开启）
+	KeepAlive     time.Duration `json:"keep_alive,omitempty"`     // 接受的连接的保活间隔，<0关闭，0为Go默认
+	Backlog       int           `json:"backlog,omitempty"`        // 侦听队列长度，0为系统默认
+	DeferAccept   time.Duration `json:"defer_accept,omitempty"`   // 有数据到达才唤醒accept（TCP_DEFER_ACCEPT）
+	FastOpen      int           `json:"fast_open,omitempty"`      // TCP Fast Open队列长度，0为关闭
+	ProxyProtocol bool          `json:"proxy_protocol,omitempty"` // 前端代理会发送PROXY协议头，由子进程解析
+	IPFamily      string        `json:"ip_family,omitempty"`      // 地址族，IPFamilyV4/IPFamilyV6/IPFamilyDual，默认按网络与地址
+
+	AcceptInParent bool `json:"accept_in_parent,omitempty"` // 由父进程接受连接后经SCM_RIGHTS分发给子进程，仅Unix
+}
+
+// optionListener 对接受的连接应用选项
+type optionListener struct {
+	net.Listener
+	options ListenerOptions
+}
+
+// wrapListener 需要时包装侦听，以对接受的连接应用选项
+func wrapListener(ln net.Listener, options ListenerOptions) net.Listener {
+	if nil == options.NoDelay && 0 == options.KeepAlive {
+		return ln
+	}
+	return &optionListener{Listener: ln, options: options}
+}
+
+// Accept 接受连接并应用选项
+func (object *optionListener) Accept() (conn net.Conn, err error) {
+	if conn, err = object.Listener.Accept(); nil != err {
+		return
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+	if nil != object.options.NoDelay {
+		tcpConn.SetNoDelay(*object.options.NoDelay)
+	}
+	if 0 > object.options.KeepAlive {
+		tcpConn.SetKeepAlive(false)
+	} else if 0 < object.options.KeepAlive {
+		tcpConn.SetKeepAlive(true)
+		tcpConn.SetKeepAlivePeriod(object.options.KeepAlive)
+	}
+	return
+}
+
+// applyListenerOptions 对父进程绑定的侦听应用绑定期选项
+func applyListenerOptions(ln net.Listener, options ListenerOptions) error {
+	if 0 >= options.Backlog && 0 >= options.DeferAccept && 0 >= options.FastOpen {
+		return nil
+	}
+	tcpLn, ok := ln.(*net.TCPListener)
+	if !ok {
+		return nil
+	}
+	rawConn, err := tcpLn.SyscallConn()
+	if nil != err {
+		return err
+	}
+	return controlListenerOptions(rawConn, options)
+}
+
+// applyFileOptions 对导出的侦听文件应用绑定期选项，经SyscallConn而非Fd，不改变子进程共享的非阻塞模式
+func applyFileOptions(f *os.File, options ListenerOptions) error {
+	if 0 >= options.Backlog && 0 >= options.DeferAccept && 0 >= options.FastOpen {
+		return nil
+	}
+	rawConn, err := f.SyscallConn()
+	if nil != err {
+		return err
+	}
+	return controlListenerOptions(rawConn, options)
+}
+
+// controlListenerOptions 在socket上设置绑定期选项
+func controlListenerOptions(rawConn syscall.RawConn, options ListenerOptions) error {
+	var opErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		opErr = setListenerOptions(fd, options)
+	}); nil != err {
+		return err
+	}
+	return opErr
+}
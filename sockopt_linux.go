@@ -0,0 +1,31 @@
+package daemon
+
+import (
+	"syscall"
+)
+
+// TCP_FASTOPEN syscall包未定义
+const tcpFastOpen = 23
+
+// setListenerOptions 设置侦听socket选项
+func setListenerOptions(fd uintptr, options ListenerOptions) (err error) {
+	if 0 < options.DeferAccept {
+		seconds := int(options.DeferAccept.Seconds())
+		if 0 >= seconds {
+			seconds = 1
+		}
+		if err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_DEFER_ACCEPT, seconds); nil != err {
+			return
+		}
+	}
+	if 0 < options.FastOpen {
+		if err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpFastOpen, options.FastOpen); nil != err {
+			return
+		}
+	}
+	if 0 < options.Backlog {
+		// 对已侦听的socket再次listen以调整队列长度
+		err = syscall.Listen(int(fd), options.Backlog)
+	}
+	return
+}
@@ -0,0 +1,28 @@
+package daemon
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSetListenerOptions(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if err = applyListenerOptions(ln, ListenerOptions{Backlog: 16, DeferAccept: 2 * time.Second, FastOpen: 8}); nil != err {
+		t.Fatal(err)
+	}
+	rawConn, _ := ln.(*net.TCPListener).SyscallConn()
+	rawConn.Control(func(fd uintptr) {
+		if v, err := syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_DEFER_ACCEPT); nil != err || 0 >= v {
+			t.Error("defer accept", v, err)
+		}
+		if v, err := syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpFastOpen); nil != err || 8 != v {
+			t.Error("fast open", v, err)
+		}
+	})
+}
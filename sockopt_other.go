@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package daemon
+
+import "github.com/golang/glog"
+
+// setListenerOptions 非Linux平台不支持绑定期选项
+func setListenerOptions(fd uintptr, options ListenerOptions) error {
+	glog.Warning("backlog, defer accept and fast open are only supported on linux")
+	return nil
+}
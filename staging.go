@@ -0,0 +1,128 @@
+package daemon
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// stagingSuffix 暂存侦听unix socket路径的后缀
+const stagingSuffix = ".staging"
+
+// Staging 蓝绿更新：新程序先在暂存侦听上启动并通过检查，通过后停掉暂存的子进程，
+// 再按正常流程在正式侦听上启动新子进程并替换旧子进程；检查失败时旧子进程不受影响
+type Staging struct {
+	PortOffset int           // 暂存端口相对正式端口的偏移，<=0时使用随机端口；unix侦听在路径后加.staging
+	Timeout    time.Duration // 检查的超时，<=0时不限
+	// Check 检查暂存的子进程，listeners为侦听名到暂存地址；为空时按健康探测的设置探测一次，
+	// 也未设置健康探测时只要求子进程准备好
+	Check func(ctx context.Context, listeners map[string]string) error
+}
+
+// SetStaging 开启蓝绿更新，暂存的子进程与升级校验一样以DryRun启动，业务逻辑可据此跳过对外部的副作用
+func (object *Daemon) SetStaging(staging Staging) *Daemon {
+	object.staging = &staging
+	return object
+}
+
+// stagingListeners 暂存侦听：网络侦听的端口加上偏移，unix侦听在路径后加后缀
+func stagingListeners(specs []ListenerSpec, offset int) []ListenerSpec {
+	staged := make([]ListenerSpec, 0, len(specs))
+	for _, spec := range specs {
+		if strings.HasPrefix(spec.Network, "unix") {
+			spec.Address += stagingSuffix
+		} else if host, port, err := net.SplitHostPort(spec.Address); nil == err {
+			n, _ := strconv.Atoi(port)
+			if 0 >= offset || 0 == n {
+				n = 0
+			} else {
+				n += offset
+			}
+			spec.Address = net.JoinHostPort(host, strconv.Itoa(n))
+		}
+		staged = append(staged, spec)
+	}
+	return staged
+}
+
+// stageUpgrade 在暂存侦听上启动新程序并检查，通过后停掉暂存的子进程
+func (object *Daemon) stageUpgrade(ctx context.Context) (err error) {
+	if nil == object.staging {
+		return nil
+	}
+	specs := stagingListeners(object.listenerSpecs, object.staging.PortOffset)
+	var lnFiles map[string]*os.File
+	if specs, lnFiles, err = object.listen(specs); nil != err {
+		return object.stagingFailed(0, err)
+	}
+	defer func() {
+		for _, f := range lnFiles {
+			f.Close()
+		}
+		for _, spec := range specs {
+			removeSocketFile(spec.Network, spec.Address)
+		}
+	}()
+
+	// 暂存的子进程不进入消息代理，不发事件，退出不重启
+	stage := object.newWorker(object.workerIndex)
+	stage.listenerSpecs = specs
+	stage.lnFiles = lnFiles
+	stage.dryRun = true
+	stage.bus = &bus{}
+	stage.eventHandlers = nil
+	stage.webhooks = nil
+	stage.audit = nil
+	stage.killedFlag = 1
+	if _, err = stage.replaceChildProcessContext(ctx, lnFiles); nil != err {
+		return object.stagingFailed(0, err)
+	}
+	pid := stage.currentChild().Pid()
+	defer stage.stopChild(context.Background(), "staging done")
+
+	addrs := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		addrs[spec.Name] = spec.Address
+	}
+	glog.Infof("staging child %d ready on %v", pid, addrs)
+	if 0 < object.staging.Timeout {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, object.staging.Timeout)
+		defer cancel()
+	}
+	if err = object.checkStaging(ctx, specs, addrs); nil != err {
+		return object.stagingFailed(pid, err)
+	}
+	glog.Infof("staging child %d passed", pid)
+	return nil
+}
+
+// checkStaging 检查暂存的子进程
+func (object *Daemon) checkStaging(ctx context.Context, specs []ListenerSpec, addrs map[string]string) error {
+	if nil != object.staging.Check {
+		return object.staging.Check(ctx, addrs)
+	}
+	spec, ok, err := object.probeSpec()
+	if nil != err || !ok {
+		return err
+	}
+	spec.Address = addrs[spec.Name]
+	return object.probe(spec)
+}
+
+// stagingFailed 暂存阶段失败
+func (object *Daemon) stagingFailed(pid int, err error) error {
+	glog.Errorf("staging failed: %v", err)
+	object.emit(Event{
+		Type:   EventStagingFailed,
+		Pid:    pid,
+		Worker: WorkerInfo{Index: object.workerIndex},
+		Error:  err.Error(),
+	})
+	return newLifecycleError(PhaseUpgrade, pid, ErrStagingFailed, err)
+}
@@ -0,0 +1,76 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+	"testing"
+)
+
+func TestStagingListeners(t *testing.T) {
+	specs := stagingListeners([]ListenerSpec{
+		{Name: "web", Network: "tcp", Address: "127.0.0.1:8080"},
+		{Name: "dns", Network: "udp", Address: "[::1]:53"},
+		{Name: "admin", Network: "unix", Address: "/run/app/admin.sock"},
+	}, 10000)
+	want := []string{"127.0.0.1:18080", "[::1]:10053", "/run/app/admin.sock.staging"}
+	for i, spec := range specs {
+		if want[i] != spec.Address {
+			t.Fatal(spec)
+		}
+	}
+	if specs = stagingListeners(specs[:1], 0); "127.0.0.1:0" != specs[0].Address {
+		t.Fatal(specs)
+	}
+}
+
+func TestStagingUpgrade(t *testing.T) {
+	var spawned, failing int32
+	var staged map[string]string
+	object, signalCh, doneCh := startFakeParent(t, withChild(func(xCmdObj *XCmd, args []string) error {
+		atomic.AddInt32(&spawned, 1)
+		return fakeChild(xCmdObj, args)
+	}), withSetup(func(object *Daemon) {
+		object.SetListeners(ListenerSpec{Name: "web", Network: "tcp", Address: "127.0.0.1:0"}).
+			SetStaging(Staging{Check: func(ctx context.Context, listeners map[string]string) error {
+				staged = listeners
+				if 1 == atomic.LoadInt32(&failing) {
+					return errors.New("smoke test failed")
+				}
+				return nil
+			}})
+	}))
+	pid := object.currentChild().Pid()
+
+	// 暂存的子进程未通过检查，旧子进程继续服务
+	atomic.StoreInt32(&failing, 1)
+	if err := object.Upgrade(); !errors.Is(err, ErrStagingFailed) {
+		t.Fatal(err)
+	}
+	if 2 != atomic.LoadInt32(&spawned) || pid != object.currentChild().Pid() {
+		t.Fatal(spawned, object.currentChild().Pid())
+	}
+	production := map[string]string{"web": object.listenerSpecs[0].Address}
+	if 1 != len(staged) || reflect.DeepEqual(production, staged) {
+		t.Fatal(staged)
+	}
+
+	// 通过检查后在正式侦听上替换
+	atomic.StoreInt32(&failing, 0)
+	if err := object.Upgrade(); nil != err {
+		t.Fatal(err)
+	}
+	if 4 != atomic.LoadInt32(&spawned) || pid == object.currentChild().Pid() {
+		t.Fatal(spawned, object.currentChild().Pid())
+	}
+
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+}
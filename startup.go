@@ -0,0 +1,190 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// SetStartupGrace 设置启动宽限期，期间子进程只需按时发送心跳即可存活，
+// 宽限期结束后才开始计算准备好超时；heartbeatTimeout为宽限期内两次心跳的最大间隔，
+// 子进程按其三分之一的间隔发送。外部命令不会发送心跳，不应开启
+func (object *Daemon) SetStartupGrace(grace, heartbeatTimeout time.Duration) *Daemon {
+	object.startupGrace = grace
+	object.heartbeatTimeout = heartbeatTimeout
+	return object
+}
+
+// heartbeatInterval 子进程发送心跳的间隔，0表示不发送
+func (object *Daemon) heartbeatInterval() time.Duration {
+	if 0 >= object.startupGrace || 0 >= object.heartbeatTimeout {
+		return 0
+	}
+	return object.heartbeatTimeout / 3
+}
+
+// spawnContext 派生子进程的上下文，停服时取消以中止进行中的启动；工作进程使用主Daemon的
+func (object *Daemon) spawnContext() context.Context {
+	if nil != object.primary {
+		return object.primary.spawnContext()
+	}
+	return object.spawnCtx
+}
+
+// startChild 在协程中启动worker的子进程，侦听取主Daemon当前的侦听文件；
+// 等待期间收到退出信号时中止启动，返回stopped；其他信号在启动完成后重新投递
+func (object *Daemon) startChild(worker *Daemon, signalCh chan os.Signal) (stopped bool, err error) {
+	doneCh := make(chan error, 1)
+	go func() {
+		_, e := worker.replaceChildProcess(object.lnFiles)
+		doneCh <- e
+	}()
+
+	var deferred []os.Signal
+	for {
+		select {
+		case err = <-doneCh:
+			if 0 < len(deferred) {
+				go func() {
+					for _, s := range deferred {
+						signalCh <- s
+					}
+				}()
+			}
+			return
+
+		case s := <-signalCh:
+			if ExitRequest != object.signalAction(s) {
+				deferred = append(deferred, s)
+				continue
+			}
+			glog.Infof("signal %s during startup, abort", s)
+			object.auditAction(AuditSignal, nil, map[string]string{"signal": s.String(), "action": ExitRequest})
+			object.abortSpawn(ErrSpawnAborted)
+			if err = <-doneCh; nil == err {
+				// 中止前已准备好
+				worker.stopChild(context.Background(), "stop")
+			}
+			return true, nil
+		}
+	}
+}
+
+// notifyCrashed 通知主循环重启意外退出的子进程，停服时放弃
+func (object *Daemon) notifyCrashed() {
+	target := object
+	if nil != object.primary {
+		target = object.primary
+	}
+	select {
+	case target.crashCh <- object:
+	case <-target.spawnCtx.Done():
+	}
+}
+
+// restartCrashed 在主循环中重启worker意外退出的子进程，启动失败时消耗重启次数重试，
+// 用尽时交给主循环按策略处理；启动期间收到退出信号时中止并返回stopped
+func (object *Daemon) restartCrashed(worker *Daemon, signalCh chan os.Signal) (stopped bool) {
+	// 期间已被更新替换
+	if nil != worker.currentChild() {
+		return
+	}
+	for {
+		var err error
+		if stopped, err = object.startChild(worker, signalCh); stopped {
+			return
+		}
+		if nil == err {
+			worker.setPhase(StatusRunning)
+			return
+		}
+		glog.Error(err)
+		rebootTimes := atomic.AddInt32(&worker.rebootTimes, -1)
+		glog.Errorf("worker %d restart failed, reboot times countdown: %d", worker.workerIndex, rebootTimes)
+		if 0 > rebootTimes {
+			worker.emit(Event{
+				Type:   EventRestartBudgetExhausted,
+				Worker: WorkerInfo{Index: worker.workerIndex, Generation: worker.generation},
+				Error:  err.Error(),
+			})
+			worker.notifyExhausted()
+			return
+		}
+	}
+}
+
+// readyContext 等待子进程准备好的上下文；开启宽限期时准备好超时顺延，
+// 宽限期内超过heartbeatTimeout未收到心跳则取消，原因为ErrHeartbeatTimeout
+func (object *Daemon) readyContext() (ctx context.Context, beat func(), cancel func()) {
+	timeout := object.readyTimeout
+	if 0 < timeout && 0 < object.startupGrace {
+		timeout += object.startupGrace
+	}
+	base, cancelBase := timeoutContext(object.spawnContext(), timeout)
+	if 0 >= object.heartbeatInterval() {
+		return base, func() {}, cancelBase
+	}
+
+	var cancelCause context.CancelCauseFunc
+	ctx, cancelCause = context.WithCancelCause(base)
+	graceEnd := time.Now().Add(object.startupGrace)
+	var once sync.Once
+	timer := time.AfterFunc(object.heartbeatTimeout, func() {
+		if time.Now().Before(graceEnd) {
+			cancelCause(ErrHeartbeatTimeout)
+		}
+	})
+	beat = func() {
+		if time.Now().Before(graceEnd) {
+			timer.Reset(object.heartbeatTimeout)
+		}
+	}
+	cancel = func() {
+		once.Do(func() {
+			timer.Stop()
+			cancelCause(nil)
+			cancelBase()
+		})
+	}
+	return
+}
+
+// startHeartbeat 子进程在准备好之前定时发送心跳，返回的函数停止发送并等待协程退出
+func (object *Daemon) startHeartbeat(interval time.Duration) (stop func()) {
+	if 0 >= interval {
+		return func() {}
+	}
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case now := <-ticker.C:
+				raw := NewBuffer(8).WriteUint64(uint64(now.UnixNano()))
+				if err := object.xCmdObj.ChildWriteStream(StreamHeartbeat, raw.Slice(raw.ReadableBytes())); nil != err {
+					if !errors.Is(err, ErrPipeClosed) {
+						glog.Error(err)
+					}
+					return
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stopCh)
+			<-doneCh
+		})
+	}
+}
@@ -0,0 +1,99 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"errors"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStartupGrace(t *testing.T) {
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		// 迁移耗时超过准备好超时，期间靠心跳存活
+		stop := (&Daemon{xCmdObj: xCmdObj}).startHeartbeat(20 * time.Millisecond)
+		time.Sleep(200 * time.Millisecond)
+		stop()
+		return fakeChild(xCmdObj, args)
+	})
+	object.SetReadyTimeout(50*time.Millisecond).SetStartupGrace(time.Second, 100*time.Millisecond)
+	if ok, err := object.replaceChildProcess(nil); !ok || nil != err {
+		t.Fatal(ok, err)
+	}
+	stopFakeDaemon(t, object)
+}
+
+func TestStartupHeartbeatTimeout(t *testing.T) {
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		// 不发心跳
+		return xCmdObj.ChildRead(func(raw []byte) bool {
+			return nil != raw
+		})
+	})
+	object.SetReadyTimeout(time.Minute).SetStartupGrace(time.Minute, 50*time.Millisecond)
+	start := time.Now()
+	ok, err := object.replaceChildProcess(nil)
+	if ok || !errors.Is(err, ErrHeartbeatTimeout) || time.Second < time.Since(start) {
+		t.Fatal(ok, err)
+	}
+}
+
+// hangingChild 不回复准备好，直到被强杀
+func hangingChild(xCmdObj *XCmd, args []string) error {
+	return xCmdObj.ChildRead(func(raw []byte) bool {
+		return nil != raw
+	})
+}
+
+func TestAbortStartupOnExit(t *testing.T) {
+	runner := NewFakeRunner(hangingChild)
+	object, signalCh, doneCh := startFakeParent(t, withRunner(runner), withReady(func(object *Daemon) bool {
+		return 1 == runner.Spawned()
+	}))
+
+	// 准备好超时为一分钟，停服不必等待
+	signalCh <- syscall.SIGTERM
+	select {
+	case err := <-doneCh:
+		if nil != err {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("startup not aborted")
+	}
+	if StatusStopped != object.Status().Phase {
+		t.Fatal(object.Status())
+	}
+}
+
+func TestAbortUpgradeOnExit(t *testing.T) {
+	var spawned int32
+	object, signalCh, doneCh := startFakeParent(t, withChild(func(xCmdObj *XCmd, args []string) error {
+		if 1 == atomic.AddInt32(&spawned, 1) {
+			return fakeChild(xCmdObj, args)
+		}
+		return hangingChild(xCmdObj, args)
+	}))
+
+	upgradeCh := make(chan error, 1)
+	go func() {
+		upgradeCh <- object.Upgrade()
+	}()
+	waitFor(t, func() bool { return 2 == atomic.LoadInt32(&spawned) })
+
+	signalCh <- syscall.SIGTERM
+	select {
+	case err := <-doneCh:
+		if nil != err {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("upgrade not aborted")
+	}
+	if err := <-upgradeCh; !errors.Is(err, ErrSpawnAborted) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,208 @@
+package daemon
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// 状态机阶段
+const (
+	StatusStarting   = "starting"   // 启动中，首个子进程尚未准备好
+	StatusRunning    = "running"    // 运行中
+	StatusUpgrading  = "upgrading"  // 更新中
+	StatusRestarting = "restarting" // 子进程意外退出，重启中
+	StatusStopping   = "stopping"   // 停服中
+	StatusStopped    = "stopped"    // 已停止
+)
+
+// Status 守护进程状态，写入状态文件供外部监控与--upgrade核对结果
+type Status struct {
+	Pid             int            `json:"pid"`                        // 守护进程ID
+	Phase           string         `json:"phase"`                      // 状态机阶段
+	PhaseSince      time.Time      `json:"phase_since"`                // 进入当前阶段的时间
+	ChildPid        int            `json:"child_pid,omitempty"`        // 主工作进程ID
+	Generation      uint64         `json:"generation"`                 // 主工作进程代数
+	Workers         int            `json:"workers"`                    // 工作进程数
+	Binary          string         `json:"binary"`                     // 可执行文件路径
+	BinaryChecksum  string         `json:"binary_checksum"`            // 可执行文件SHA-256
+	Restarts        int            `json:"restarts"`                   // 意外退出后的重启次数
+	LastUpgrade     time.Time      `json:"last_upgrade,omitempty"`     // 最近一次更新结束的时间
+	LastError       string         `json:"last_error,omitempty"`       // 最近一次更新或重启的错误
+	Build           *BuildInfo     `json:"build,omitempty"`            // 主工作进程上报的构建信息
+	LastExit        *ExitInfo      `json:"last_exit,omitempty"`        // 最近一次非更新导致的子进程退出
+	Degraded        bool           `json:"degraded,omitempty"`         // 主工作进程断开了通信管道，只能以信号控制
+	FailedLaunch    *LaunchReport  `json:"failed_launch,omitempty"`    // 最近一次未准备好的子进程的启动环境
+	Deploy          *Deploy        `json:"deploy,omitempty"`           // 主工作进程所属的部署
+	AwaitingConfirm int            `json:"awaiting_confirm,omitempty"` // 等待手动确认切换的新子进程ID
+	Processes       []ProcessStats `json:"processes,omitempty"`        // 子进程资源占用，开启SetProcessStats时有效
+	UpdatedAt       time.Time      `json:"updated_at"`                 // 更新时间
+}
+
+// statusState 状态文件相关的状态
+type statusState struct {
+	sync.Mutex
+	path   string // 状态文件路径，为空时不写
+	status Status // 最近一次写入的状态
+}
+
+// SetStatusFile 设置状态文件，每次状态变化时原子地写入JSON
+func (object *Daemon) SetStatusFile(path string) *Daemon {
+	object.status.path = path
+	return object
+}
+
+// Status 当前状态
+func (object *Daemon) Status() Status {
+	object.status.Lock()
+	status := object.status.status
+	object.status.Unlock()
+	status.Processes = object.ProcessStats()
+	return status
+}
+
+// setStatus 修改状态并写入状态文件
+func (object *Daemon) setStatus(update func(status *Status)) {
+	object.status.Lock()
+	defer object.status.Unlock()
+	status := &object.status.status
+	status.Pid = os.Getpid()
+	phase := status.Phase
+	update(status)
+	if phase != status.Phase {
+		status.PhaseSince = time.Now()
+	}
+	status.Workers = object.Workers()
+	status.Degraded = false
+	if child := object.currentChild(); nil != child {
+		status.Degraded = child.IPCLost()
+		status.ChildPid = child.Pid()
+		status.Generation = child.worker.Generation
+		status.Build = child.build
+		status.Deploy = child.deploy
+	}
+	status.UpdatedAt = time.Now()
+	if 0 >= len(object.status.path) {
+		return
+	}
+	if err := writeStatusFile(object.status.path, *status); nil != err {
+		glog.Error(err)
+	}
+}
+
+// setPhase 切换状态机阶段
+func (object *Daemon) setPhase(phase string) {
+	object.setStatus(func(status *Status) {
+		status.Phase = phase
+	})
+}
+
+// writeStatusFile 写临时文件后改名，读者不会看到写了一半的内容
+func writeStatusFile(path string, status Status) (err error) {
+	var raw []byte
+	if raw, err = json.MarshalIndent(status, "", "  "); nil != err {
+		return
+	}
+	var f *os.File
+	if f, err = ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp"); nil != err {
+		return
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(raw); nil != err {
+		f.Close()
+		return
+	}
+	if err = f.Close(); nil != err {
+		return
+	}
+	err = os.Rename(f.Name(), path)
+	return
+}
+
+// ReadStatus 读取状态文件
+func ReadStatus(path string) (status Status, err error) {
+	var raw []byte
+	if raw, err = ioutil.ReadFile(path); nil != err {
+		return
+	}
+	err = json.Unmarshal(raw, &status)
+	return
+}
+
+// binaryChecksum 当前可执行文件的路径与SHA-256
+func binaryChecksum() (path, sum string, err error) {
+	if path, err = os.Executable(); nil != err {
+		return
+	}
+	sum, err = fileChecksum(path)
+	return
+}
+
+// fileChecksum 文件的SHA-256
+func fileChecksum(path string) (sum string, err error) {
+	var f *os.File
+	if f, err = os.Open(path); nil != err {
+		return
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); nil != err {
+		return
+	}
+	sum = hex.EncodeToString(h.Sum(nil))
+	return
+}
+
+// recordBinary 记录当前可执行文件
+func (object *Daemon) recordBinary(status *Status) {
+	path, sum, err := binaryChecksum()
+	if nil != err {
+		glog.Error(err)
+		return
+	}
+	status.Binary, status.BinaryChecksum = path, sum
+}
+
+// waitUpgradeResult --upgrade等待状态文件记录本次更新的结果
+func (object *Daemon) waitUpgradeResult(before time.Time) error {
+	deadline := time.Now().Add(object.readyTimeout + object.drainTimeout + 5*time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		status, err := ReadStatus(object.status.path)
+		if nil != err || !status.LastUpgrade.After(before) {
+			continue
+		}
+		if 0 < len(status.LastError) {
+			return newLifecycleError(PhaseUpgrade, status.ChildPid, ErrUpgradeFailed, errors.New(status.LastError))
+		}
+		glog.Infof("upgrade ok, child: %d generation: %d", status.ChildPid, status.Generation)
+		return nil
+	}
+	return newLifecycleError(PhaseUpgrade, 0, ErrUpgradeFailed, errors.New("no result in status file"))
+}
+
+// finishUpgrade 记录更新或扩缩容的结果
+func (object *Daemon) finishUpgrade(action string, err error) {
+	object.setStatus(func(status *Status) {
+		status.Phase = StatusRunning
+		if !isUpgradeAction(action) {
+			return
+		}
+		status.LastUpgrade = time.Now()
+		status.LastError = ""
+		if nil != err {
+			status.LastError = err.Error()
+			return
+		}
+		object.recordBinary(status)
+	})
+}
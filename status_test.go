@@ -0,0 +1,44 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestStatusFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "status.json")
+	object, signalCh, doneCh := startFakeParent(t, withSetup(func(object *Daemon) {
+		object.SetStatusFile(path)
+	}))
+	status, err := ReadStatus(path)
+	if nil != err || StatusRunning != status.Phase || 0 == status.ChildPid ||
+		1 != status.Generation || 64 != len(status.BinaryChecksum) {
+		t.Fatal(err, status)
+	}
+
+	if err = object.Upgrade(); nil != err {
+		t.Fatal(err)
+	}
+	if status, err = ReadStatus(path); nil != err || 2 != status.Generation ||
+		status.LastUpgrade.IsZero() || 0 < len(status.LastError) {
+		t.Fatal(err, status)
+	}
+
+	signalCh <- syscall.SIGTERM
+	if err = <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+	if status, err = ReadStatus(path); nil != err || StatusStopped != status.Phase {
+		t.Fatal(err, status)
+	}
+	// 只剩状态文件，临时文件已删除
+	if files, _ := ioutil.ReadDir(dir); 1 != len(files) {
+		t.Fatal("temporary status files left", len(files))
+	}
+}
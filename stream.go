@@ -0,0 +1,192 @@
+package daemon
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"sync"
+)
+
+// streamMessage 暂存的消息
+type streamMessage struct {
+	stream uint32 // 逻辑通道
+	data   []byte // 消息
+}
+
+// pipeStream 以字节流方式读写的逻辑通道
+type pipeStream struct {
+	pipe   *XPipe       // 读取的管道
+	writer *XPipe       // 写入的管道
+	id     uint32       // 通道ID
+	buf    bytes.Buffer // 已到达未读取的数据
+	err    error        // 管道关闭等终止错误
+	closed bool         // 是否已关闭
+}
+
+// StreamID 通道名对应的通道ID，两端使用相同的名字即可打开同一通道
+func StreamID(name string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return StreamUser + h.Sum32()%(math.MaxUint32-StreamUser)
+}
+
+// OpenStream 打开名为name的逻辑通道，返回的读写器可配合json.Encoder、gob、io.Copy等使用；
+// 每次Write作为一条消息发送，Read按字节流读取。打开后该通道的消息不再经过Read/ReadStreams回调
+func (object *XPipe) OpenStream(name string) (io.ReadWriteCloser, error) {
+	return object.openStream(name, object)
+}
+
+// openStream 从object读取、向writer写入的逻辑通道
+func (object *XPipe) openStream(name string, writer *XPipe) (io.ReadWriteCloser, error) {
+	if "" == name {
+		return nil, fmt.Errorf("%w: empty stream name", ErrFrame)
+	}
+	if object.IsClosed() {
+		return nil, ErrPipeClosed
+	}
+	id := StreamID(name)
+	object.streamLock.Lock()
+	defer object.streamLock.Unlock()
+	object.initStreams()
+	if _, ok := object.streams[id]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrStreamOpened, name)
+	}
+	stream := &pipeStream{pipe: object, writer: writer, id: id}
+	object.streams[id] = stream
+	return stream, nil
+}
+
+// initStreams 初始化通道状态，调用方需持有streamLock
+func (object *XPipe) initStreams() {
+	if nil == object.streamCond {
+		object.streamCond = sync.NewCond(&object.streamLock)
+		object.streams = make(map[uint32]*pipeStream)
+	}
+}
+
+// setReading 登记或注销正在读底层管道的读取者
+func (object *XPipe) setReading(reading bool) {
+	object.streamLock.Lock()
+	defer object.streamLock.Unlock()
+	object.initStreams()
+	if reading {
+		object.readers++
+	} else {
+		object.readers--
+	}
+	object.streamCond.Broadcast()
+}
+
+// deliver 把消息投递给打开的通道，未打开时返回false
+func (object *XPipe) deliver(stream uint32, data []byte) bool {
+	object.streamLock.Lock()
+	defer object.streamLock.Unlock()
+	target, ok := object.streams[stream]
+	if !ok {
+		return false
+	}
+	target.buf.Write(data)
+	object.streamCond.Broadcast()
+	return true
+}
+
+// closeStreams 底层管道终止，打开的通道读完剩余数据后返回err
+func (object *XPipe) closeStreams(err error) {
+	object.streamLock.Lock()
+	defer object.streamLock.Unlock()
+	for _, stream := range object.streams {
+		stream.err = err
+	}
+	if nil != object.streamCond {
+		object.streamCond.Broadcast()
+	}
+}
+
+// route 打开的通道直接投递，其余交给回调
+func (object *XPipe) route(callback func(stream uint32, data []byte) bool) func(stream uint32, data []byte) bool {
+	return func(stream uint32, data []byte) bool {
+		if object.deliver(stream, data) {
+			return true
+		}
+		return callback(stream, data)
+	}
+}
+
+// pump 没有其他读取者时由通道自己读取底层管道，直到本通道有数据；
+// 其他消息暂存到backlog，留给Read/ReadStreams
+func (object *XPipe) pump(target *pipeStream) error {
+	object.readLock.Lock()
+	defer object.readLock.Unlock()
+	object.streamLock.Lock()
+	ready := 0 < target.buf.Len() || nil != target.err || target.closed
+	object.streamLock.Unlock()
+	if ready {
+		return nil
+	}
+	return object.readFrames(func(stream uint32, data []byte) bool {
+		if object.deliver(stream, data) {
+			return stream != target.id
+		}
+		object.backlog = append(object.backlog, streamMessage{stream: stream, data: append([]byte(nil), data...)})
+		return true
+	})
+}
+
+// Read 读取通道数据，无数据时阻塞
+func (object *pipeStream) Read(p []byte) (n int, err error) {
+	pipe := object.pipe
+	pipe.streamLock.Lock()
+	defer pipe.streamLock.Unlock()
+	for {
+		if object.closed {
+			return 0, io.ErrClosedPipe
+		}
+		if 0 < object.buf.Len() {
+			return object.buf.Read(p)
+		}
+		if nil != object.err {
+			return 0, object.err
+		}
+		if pipe.IsClosed() {
+			return 0, ErrPipeClosed
+		}
+		if 0 < pipe.readers {
+			pipe.streamCond.Wait()
+			continue
+		}
+		pipe.readers++
+		pipe.streamLock.Unlock()
+		err = pipe.pump(object)
+		pipe.streamLock.Lock()
+		pipe.readers--
+		pipe.streamCond.Broadcast()
+		if nil != err && 0 == object.buf.Len() {
+			return
+		}
+	}
+}
+
+// Write 作为一条消息写入通道
+func (object *pipeStream) Write(p []byte) (n int, err error) {
+	if err = object.writer.WriteStream(object.id, p); nil != err {
+		return
+	}
+	n = len(p)
+	return
+}
+
+// Close 关闭通道，之后到达的数据交给Read/ReadStreams回调
+func (object *pipeStream) Close() error {
+	pipe := object.pipe
+	pipe.streamLock.Lock()
+	defer pipe.streamLock.Unlock()
+	if object.closed {
+		return nil
+	}
+	object.closed = true
+	delete(pipe.streams, object.id)
+	pipe.streamCond.Broadcast()
+	return nil
+}
@@ -0,0 +1,216 @@
+package daemon
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// supervisedServiceFlag 子进程据此选择要运行的服务
+const supervisedServiceFlag = "supervised_service"
+
+// supervisedService 被监督的服务
+type supervisedService struct {
+	name            string          // 服务名
+	daemon          *Daemon         // 守护该服务的子进程
+	logical         RegistryLogical // 业务逻辑
+	upgradeOnSignal bool            // 收到更新信号时更新
+	signalCh        chan os.Signal  // 转发给该服务的信号
+}
+
+// Supervisor 监督树，一个父进程同时守护多个服务，
+// 每个服务有独立的侦听、重启次数与更新触发方式，子进程互不影响；
+// 控制通道与服务管理器通知由Supervisor统一负责，Windows下通过Upgrade(name)更新
+type Supervisor struct {
+	sync.RWMutex
+	services []*supervisedService // 按注册顺序
+}
+
+// NewSupervisor 工厂方法
+func NewSupervisor() *Supervisor {
+	return &Supervisor{}
+}
+
+// Register 注册服务，d配置该服务的侦听(SetListeners)、重启次数(SetRebootTimes)、外部程序(SetCommand)等，
+// 各服务的命令行参数名需一致；PID文件与引导日志目录自动加上服务名后缀；
+// upgradeOnSignal为真时更新信号会更新该服务，否则只能通过Upgrade(name)更新
+func (object *Supervisor) Register(name string, d *Daemon, logical RegistryLogical, upgradeOnSignal bool) *Supervisor {
+	object.Lock()
+	defer object.Unlock()
+	d.supervised = true
+	d.pidFile = fmt.Sprintf("%s.%s", d.pidFile, name)
+	d.bootstrapLogDir = fmt.Sprintf("%s.%s", d.bootstrapLogDir, name)
+	object.services = append(object.services, &supervisedService{
+		name:            name,
+		daemon:          d,
+		logical:         logical,
+		upgradeOnSignal: upgradeOnSignal,
+		signalCh:        make(chan os.Signal, 1),
+	})
+	return object
+}
+
+// Services 已注册的服务名
+func (object *Supervisor) Services() []string {
+	object.RLock()
+	defer object.RUnlock()
+	names := make([]string, 0, len(object.services))
+	for _, service := range object.services {
+		names = append(names, service.name)
+	}
+	return names
+}
+
+// Daemon 守护该服务的Daemon
+func (object *Supervisor) Daemon(name string) (d *Daemon, ok bool) {
+	var service *supervisedService
+	if service, ok = object.lookup(name); ok {
+		d = service.daemon
+	}
+	return
+}
+
+// Upgrade 更新单个服务，返回更新结果
+func (object *Supervisor) Upgrade(name string) error {
+	service, ok := object.lookup(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownService, name)
+	}
+	return service.daemon.Upgrade()
+}
+
+// lookup 查找服务
+func (object *Supervisor) lookup(name string) (*supervisedService, bool) {
+	object.RLock()
+	defer object.RUnlock()
+	for _, service := range object.services {
+		if name == service.name {
+			return service, true
+		}
+	}
+	return nil, false
+}
+
+// Run 引导，子进程运行所属服务的业务逻辑，父进程守护全部服务直到收到退出信号
+func (object *Supervisor) Run() (err error) {
+	object.RLock()
+	if 0 >= len(object.services) {
+		object.RUnlock()
+		return fmt.Errorf("%w: no service registered", ErrUnknownService)
+	}
+	first := object.services[0].daemon
+	object.RUnlock()
+
+	var opts cliOptions
+	if opts, err = first.parseCommandLine(os.Args[1:]); nil != err {
+		if flag.ErrHelp == err {
+			err = nil
+		}
+		return
+	}
+
+	// 运行业务逻辑
+	if first.childCmd == opts.command {
+		service, ok := object.lookup(opts.supervisedService)
+		if !ok {
+			err = fmt.Errorf("%w: %s", ErrUnknownService, opts.supervisedService)
+			glog.Error(err)
+			return
+		}
+		if err = service.daemon.runAsChild(&opts.bootstrapArgs, service.logical); nil != err {
+			glog.Error(err)
+		}
+		return
+	}
+	if CommandRun != opts.command {
+		err = fmt.Errorf("daemon: command %q not supported by supervisor", opts.command)
+		glog.Error(err)
+		return
+	}
+
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, object.handledSignals()...)
+	err = object.supervise(signalCh)
+	return
+}
+
+// supervise 在父进程守护全部服务，信号转发给各服务，返回第一个错误
+func (object *Supervisor) supervise(signalCh chan os.Signal) (err error) {
+	object.RLock()
+	services := make([]*supervisedService, len(object.services))
+	copy(services, object.services)
+	object.RUnlock()
+
+	// 按首个服务解析的命令行派生子进程
+	first := services[0].daemon
+	errCh := make(chan error, len(services))
+	for _, service := range services {
+		// 子进程参数带上服务名
+		if service.daemon.legacyFlags = first.legacyFlags; first.legacyFlags {
+			service.daemon.origArgs = append([]string{}, os.Args...)
+		} else {
+			service.daemon.origArgs = []string{os.Args[0], CommandRun}
+			service.daemon.appArgs = first.appArgs
+		}
+		service.daemon.childExtraArgs = []string{fmt.Sprintf("--%s=%s", supervisedServiceFlag, service.name)}
+		go func(service *supervisedService) {
+			e := service.daemon.runAsParent(service.signalCh)
+			if nil != e {
+				e = fmt.Errorf("service %s: %w", service.name, e)
+			}
+			errCh <- e
+		}(service)
+	}
+
+	watchdog, stopWatchdog := newWatchdog()
+	defer stopWatchdog()
+
+	// 全部服务启动后通知服务管理器
+	readyTicker := time.NewTicker(100 * time.Millisecond)
+	defer readyTicker.Stop()
+	for pending := len(services); 0 < pending; {
+		select {
+		case <-watchdog:
+			notifyServiceManager("WATCHDOG=1")
+		case s := <-signalCh:
+			for _, service := range services {
+				if ExitRequest == service.daemon.signalAction(s) {
+					notifyServiceManager("STOPPING=1")
+					break
+				}
+			}
+			for _, service := range services {
+				if UpgradeRequest == service.daemon.signalAction(s) && !service.upgradeOnSignal {
+					continue
+				}
+				select {
+				case service.signalCh <- s:
+				default:
+				}
+			}
+		case e := <-errCh:
+			pending--
+			if nil != e && nil == err {
+				err = e
+			}
+		case <-readyTicker.C:
+			running := 0
+			for _, service := range services {
+				running += int(atomic.LoadInt32(&service.daemon.running))
+			}
+			if len(services) == running {
+				notifyServiceManager(fmt.Sprintf("READY=1\nMAINPID=%d", os.Getpid()))
+				readyTicker.Stop()
+			}
+		}
+	}
+
+	glog.Info("supervisor exited")
+	return
+}
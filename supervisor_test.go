@@ -0,0 +1,65 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+)
+
+func TestSupervisor(t *testing.T) {
+	dir := t.TempDir()
+	newService := func(name string) (*Daemon, *FakeRunner) {
+		runner := NewFakeRunner(func(xCmdObj *XCmd, args []string) error {
+			if !strings.Contains(strings.Join(args, " "), "--"+supervisedServiceFlag+"="+name) {
+				return xCmdObj.ChildWrite([]byte(ReadyError))
+			}
+			return fakeChild(xCmdObj, args)
+		})
+		d := New("child", "upgrade", "bootstrap_args",
+			filepath.Join(dir, "logs"),
+			filepath.Join(dir, "pid")).SetProcessRunner(runner)
+		return d, runner
+	}
+	web, webRunner := newService("web")
+	admin, adminRunner := newService("admin")
+	object := NewSupervisor().
+		Register("web", web, nil, true).
+		Register("admin", admin, nil, false)
+	if names := object.Services(); 2 != len(names) || "web" != names[0] {
+		t.Fatal(names)
+	}
+	if web.pidFile == admin.pidFile {
+		t.Fatal("pid file shared")
+	}
+
+	signalCh := make(chan os.Signal, 1)
+	doneCh := make(chan error, 1)
+	go func() {
+		doneCh <- object.supervise(signalCh)
+	}()
+	waitFor(t, func() bool {
+		return 1 == atomic.LoadInt32(&web.running) && 1 == atomic.LoadInt32(&admin.running)
+	})
+
+	// 更新信号只更新web，admin需单独更新
+	signalCh <- syscall.SIGUSR2
+	waitFor(t, func() bool { return 2 == webRunner.Spawned() && !web.IsUpgrading() })
+	if err := object.Upgrade("admin"); nil != err || 2 != adminRunner.Spawned() {
+		t.Fatal(err, adminRunner.Spawned())
+	}
+	if err := object.Upgrade("missing"); !errors.Is(err, ErrUnknownService) {
+		t.Fatal(err)
+	}
+
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+}
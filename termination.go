@@ -0,0 +1,57 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// terminationKillMargin 宽限期内留给强杀与回收子进程的时间上限
+const terminationKillMargin = time.Second
+
+// SetTermination 适配Kubernetes的停服：收到停服信号后/healthz立即返回503，
+// 子进程继续服务preStopDelay以等待Endpoints摘除，之后再排空；
+// 整个停服在gracePeriod(对应terminationGracePeriodSeconds)内完成，到期前强杀子进程。
+// gracePeriod为0时不限，只受排空超时约束；preStopDelay期间再次收到停服信号立即开始排空
+func (object *Daemon) SetTermination(preStopDelay, gracePeriod time.Duration) *Daemon {
+	object.preStopDelay = preStopDelay
+	object.terminationGrace = gracePeriod
+	return object
+}
+
+// terminationContext 停服的上下文，有宽限期时留出强杀的时间
+func (object *Daemon) terminationContext() (context.Context, context.CancelFunc) {
+	if 0 >= object.terminationGrace {
+		return context.WithCancel(context.Background())
+	}
+	margin := terminationKillMargin
+	if margin > object.terminationGrace/10 {
+		margin = object.terminationGrace / 10
+	}
+	return context.WithTimeout(context.Background(), object.terminationGrace-margin)
+}
+
+// preStop 排空前等待preStopDelay，期间子进程照常服务，ctx结束或再次收到停服信号时提前返回
+func (object *Daemon) preStop(ctx context.Context, signalCh chan os.Signal) {
+	if 0 >= object.preStopDelay {
+		return
+	}
+	glog.Infof("pre-stop delay %s before draining", object.preStopDelay)
+	timer := time.NewTimer(object.preStopDelay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return
+		case <-ctx.Done():
+			return
+		case s := <-signalCh:
+			if ExitRequest == object.signalAction(s) {
+				glog.Infof("signal %s during pre-stop delay, drain now", s)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTermination(t *testing.T) {
+	run := func(t *testing.T, drain bool, setup func(object *Daemon)) (*Daemon, chan os.Signal, chan error, *int64) {
+		var exitAt int64
+		object, signalCh, doneCh := startFakeParent(t, withChild(func(xCmdObj *XCmd, args []string) error {
+			if err := xCmdObj.ChildWrite([]byte(ReadyOK)); nil != err {
+				return err
+			}
+			// drain为false时收到退出指令后不回复，等待强杀
+			if err := xCmdObj.ChildRead(func(raw []byte) bool {
+				if ExitRequest == string(raw) {
+					atomic.CompareAndSwapInt64(&exitAt, 0, time.Now().UnixNano())
+					return !drain
+				}
+				return nil != raw
+			}); nil != err {
+				return err
+			}
+			return xCmdObj.ChildWrite([]byte(ExitReply))
+		}), withSetup(func(object *Daemon) {
+			object.SetDrainTimeout(0)
+		}), withSetup(setup))
+		return object, signalCh, doneCh, &exitAt
+	}
+
+	t.Run("pre-stop delay", func(t *testing.T) {
+		object, signalCh, doneCh, exitAt := run(t, true, func(object *Daemon) {
+			object.SetTermination(150*time.Millisecond, 0)
+		})
+		start := time.Now()
+		signalCh <- syscall.SIGTERM
+		waitFor(t, func() bool { return StatusStopping == object.Status().Phase })
+		if nil == object.Health() || 0 != atomic.LoadInt64(exitAt) {
+			t.Fatal(object.Health(), atomic.LoadInt64(exitAt))
+		}
+		if err := <-doneCh; nil != err {
+			t.Fatal(err)
+		}
+		if delay := time.Duration(atomic.LoadInt64(exitAt) - start.UnixNano()); 150*time.Millisecond > delay {
+			t.Fatal(delay)
+		}
+	})
+
+	t.Run("second signal", func(t *testing.T) {
+		_, signalCh, doneCh, _ := run(t, true, func(object *Daemon) {
+			object.SetTermination(time.Minute, 0)
+		})
+		start := time.Now()
+		signalCh <- syscall.SIGTERM
+		signalCh <- syscall.SIGTERM
+		if err := <-doneCh; nil != err {
+			t.Fatal(err)
+		}
+		if time.Second < time.Since(start) {
+			t.Fatal(time.Since(start))
+		}
+	})
+
+	t.Run("grace period", func(t *testing.T) {
+		_, signalCh, doneCh, exitAt := run(t, false, func(object *Daemon) {
+			object.SetTermination(100*time.Millisecond, 400*time.Millisecond)
+		})
+		start := time.Now()
+		signalCh <- syscall.SIGTERM
+		if err := <-doneCh; nil != err {
+			t.Fatal(err)
+		}
+		if 0 == atomic.LoadInt64(exitAt) || 400*time.Millisecond < time.Since(start) {
+			t.Fatal(atomic.LoadInt64(exitAt), time.Since(start))
+		}
+	})
+}
@@ -0,0 +1,259 @@
+package daemon
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// TLSSource 证书来源，父进程启动、更新及定期重载时调用；
+// 可包装ACME等证书管理器，返回当前应使用的证书
+type TLSSource func() (*tls.Certificate, error)
+
+// FileTLSSource 从PEM文件加载证书，文件更新后下次重载生效
+func FileTLSSource(certFile, keyFile string) TLSSource {
+	return func() (*tls.Certificate, error) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if nil != err {
+			return nil, err
+		}
+		return &cert, nil
+	}
+}
+
+// tlsMaterial 经管道传给子进程的证书
+type tlsMaterial struct {
+	Certificate [][]byte   `json:"certificate"` // DER证书链
+	PrivateKey  []byte     `json:"private_key"` // PKCS8私钥
+	TicketKeys  [][32]byte `json:"ticket_keys"` // 会话票据密钥，跨更新保持不变以支持会话恢复
+}
+
+// newTicketKey 生成会话票据密钥
+func newTicketKey() (key [32]byte, err error) {
+	_, err = rand.Read(key[:])
+	return
+}
+
+// marshalTLSMaterial 编码证书，cert为nil时只下发票据密钥
+func marshalTLSMaterial(cert *tls.Certificate, ticketKeys [][32]byte) (raw []byte, err error) {
+	material := tlsMaterial{TicketKeys: ticketKeys}
+	if nil != cert {
+		material.Certificate = cert.Certificate
+		if material.PrivateKey, err = x509.MarshalPKCS8PrivateKey(cert.PrivateKey); nil != err {
+			return
+		}
+	}
+	raw, err = json.Marshal(material)
+	return
+}
+
+// tlsStore 子进程当前的证书，更新后对已构建的TLS侦听立即生效
+type tlsStore struct {
+	sync.RWMutex
+	cert    *tls.Certificate // 当前证书
+	configs []*tls.Config    // 已下发的配置，用于同步票据密钥
+	keys    [][32]byte       // 当前票据密钥
+}
+
+// newTLSStore 工厂方法
+func newTLSStore() *tlsStore {
+	return &tlsStore{}
+}
+
+// update 应用父进程下发的证书
+func (object *tlsStore) update(raw []byte) (err error) {
+	var material tlsMaterial
+	if err = json.Unmarshal(raw, &material); nil != err {
+		return
+	}
+	var cert *tls.Certificate
+	if 0 < len(material.Certificate) {
+		cert = &tls.Certificate{Certificate: material.Certificate}
+		if cert.PrivateKey, err = x509.ParsePKCS8PrivateKey(material.PrivateKey); nil != err {
+			return
+		}
+	}
+
+	object.Lock()
+	defer object.Unlock()
+	if nil != cert {
+		object.cert = cert
+	}
+	object.keys = material.TicketKeys
+	for _, config := range object.configs {
+		object.applyTicketKeys(config)
+	}
+	return
+}
+
+// applyTicketKeys 设置票据密钥，调用方需持有锁
+func (object *tlsStore) applyTicketKeys(config *tls.Config) {
+	if 0 < len(object.keys) {
+		config.SetSessionTicketKeys(object.keys)
+	}
+}
+
+// getCertificate 握手时取当前证书
+func (object *tlsStore) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	object.RLock()
+	defer object.RUnlock()
+	return object.cert, nil
+}
+
+// config 构建服务端配置
+func (object *tlsStore) config() *tls.Config {
+	return object.track(&tls.Config{GetCertificate: object.getCertificate})
+}
+
+// track 登记配置，之后轮换的票据密钥同步到该配置
+func (object *tlsStore) track(config *tls.Config) *tls.Config {
+	object.Lock()
+	defer object.Unlock()
+	object.applyTicketKeys(config)
+	object.configs = append(object.configs, config)
+	return config
+}
+
+// loadTLS 父进程加载证书并编码下发内容，返回内容是否变化
+func (object *Daemon) loadTLS() (changed bool, err error) {
+	if nil == object.tlsSource && 0 >= object.ticketRotation {
+		return
+	}
+	var cert *tls.Certificate
+	if nil != object.tlsSource {
+		if cert, err = object.tlsSource(); nil != err {
+			return
+		}
+	}
+	object.Lock()
+	defer object.Unlock()
+	if nil == object.ticketKeys {
+		var key [32]byte
+		if key, err = newTicketKey(); nil != err {
+			return
+		}
+		object.ticketKeys = [][32]byte{key}
+	}
+	object.tlsCert = cert
+	changed, err = object.encodeTLS()
+	return
+}
+
+// encodeTLS 编码下发内容，调用方需持有锁
+func (object *Daemon) encodeTLS() (changed bool, err error) {
+	var raw []byte
+	if raw, err = marshalTLSMaterial(object.tlsCert, object.ticketKeys); nil != err {
+		return
+	}
+	changed = !bytes.Equal(raw, object.tlsMaterial)
+	object.tlsMaterial = raw
+	return
+}
+
+// pushTLS 把下发内容发给当前全部子进程
+func (object *Daemon) pushTLS() (err error) {
+	object.RLock()
+	defer object.RUnlock()
+	for _, child := range object.children() {
+		if e := child.ParentWriteStream(StreamTLS, object.tlsMaterial); nil != e && nil == err {
+			err = e
+		}
+	}
+	return
+}
+
+// ReloadTLS 重新加载证书，变化时下发给当前子进程
+func (object *Daemon) ReloadTLS() (err error) {
+	var changed bool
+	if changed, err = object.loadTLS(); nil != err || !changed {
+		return
+	}
+	err = object.pushTLS()
+	return
+}
+
+// watchTLS 定期重载证书、轮换票据密钥
+func (object *Daemon) watchTLS(exitCh chan interface{}) {
+	if nil != object.tlsSource && 0 < object.tlsInterval {
+		go object.every(object.tlsInterval, exitCh, object.ReloadTLS)
+	}
+	if 0 < object.ticketRotation {
+		go object.every(object.ticketRotation, exitCh, object.RotateTicketKeys)
+	}
+}
+
+// every 每隔interval执行一次fn，exitCh关闭后停止
+func (object *Daemon) every(interval time.Duration, exitCh chan interface{}, fn func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-exitCh:
+			return
+		case <-ticker.C:
+			if err := fn(); nil != err {
+				glog.Error(err)
+			}
+		}
+	}
+}
+
+// receiveTLS 子进程有TLS侦听或开启票据密钥轮换时，构建侦听前先读取父进程下发的内容
+func (object *Daemon) receiveTLS(infos []ListenerInfo) (err error) {
+	needTLS := 0 < object.ticketRotation
+	for _, info := range infos {
+		needTLS = needTLS || info.TLS
+	}
+	if !needTLS {
+		return
+	}
+	object.tlsStore = newTLSStore()
+	var received bool
+	if err = object.xCmdObj.ChildReadStreams(func(stream uint32, raw []byte) bool {
+		if StreamTLS != stream {
+			return true
+		}
+		if err := object.tlsStore.update(raw); nil != err {
+			glog.Error(err)
+			return false
+		}
+		received = true
+		return false
+	}); nil != err {
+		return
+	}
+	if !received {
+		err = errors.New("tls material not received")
+	}
+	return
+}
+
+// ticketKeyHistory 保留的票据密钥个数，轮换前签发的票据在此期间仍可恢复
+const ticketKeyHistory = 3
+
+// RotateTicketKeys 生成新的票据密钥用于签发，旧密钥保留用于解密，并下发给当前子进程
+func (object *Daemon) RotateTicketKeys() (err error) {
+	var key [32]byte
+	if key, err = newTicketKey(); nil != err {
+		return
+	}
+	object.Lock()
+	object.ticketKeys = append([][32]byte{key}, object.ticketKeys...)
+	if ticketKeyHistory < len(object.ticketKeys) {
+		object.ticketKeys = object.ticketKeys[:ticketKeyHistory]
+	}
+	_, err = object.encodeTLS()
+	object.Unlock()
+	if nil != err {
+		return
+	}
+	err = object.pushTLS()
+	return
+}
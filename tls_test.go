@@ -0,0 +1,208 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// testCertificate 自签名证书
+func testCertificate(t *testing.T, commonName string) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if nil != err {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestDaemonTLS(t *testing.T) {
+	cert := testCertificate(t, "v1")
+	infos := []ListenerInfo{{ListenerSpec: ListenerSpec{Name: "web", Network: "tcp", TLS: true}}}
+	storeCh := make(chan *tlsStore, 1)
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		// 子进程构建侦听前读取证书
+		child := Default()
+		child.xCmdObj = xCmdObj
+		if err := child.receiveTLS(infos); nil != err {
+			return err
+		}
+		storeCh <- child.tlsStore
+		return fakeChild(xCmdObj, args)
+	})
+	object.SetTLS(func() (*tls.Certificate, error) { return cert, nil }, 0)
+	if _, err := object.loadTLS(); nil != err {
+		t.Fatal(err)
+	}
+	if ok, err := object.replaceChildProcess(nil); !ok || nil != err {
+		t.Fatal(ok, err)
+	}
+	store := <-storeCh
+	if got, _ := store.getCertificate(nil); "v1" != leafName(t, got) {
+		t.Fatal(leafName(t, got))
+	}
+
+	// 证书未变化时不下发
+	if changed, _ := object.loadTLS(); changed {
+		t.Fatal("unchanged certificate reloaded")
+	}
+	cert = testCertificate(t, "v2")
+	if changed, _ := object.loadTLS(); !changed {
+		t.Fatal("certificate not reloaded")
+	}
+	stopFakeDaemon(t, object)
+}
+
+// leafName 证书的CommonName
+func leafName(t *testing.T, cert *tls.Certificate) string {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if nil != err {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestRegistryTLSListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	f, _ := ln.(*net.TCPListener).File()
+	ln.Close()
+	fd, _ := syscall.Dup(int(f.Fd()))
+	f.Close()
+
+	store := newTLSStore()
+	raw, err := marshalTLSMaterial(testCertificate(t, "v1"), [][32]byte{{1}})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err = store.update(raw); nil != err {
+		t.Fatal(err)
+	}
+	registry := newRegistry([]ListenerInfo{{ListenerSpec: ListenerSpec{Name: "web", Network: "tcp", TLS: true}, Fd: fd}})
+	registry.tls = store
+	if ln, err = registry.Listener("web"); nil != err {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if nil != err {
+				return
+			}
+			conn.Write([]byte("ok"))
+			conn.Close()
+		}
+	}()
+
+	// 证书更新后新连接使用新证书，无需重建侦听
+	for _, name := range []string{"v1", "v2"} {
+		if "v2" == name {
+			raw, _ = marshalTLSMaterial(testCertificate(t, "v2"), [][32]byte{{1}})
+			store.update(raw)
+		}
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if nil != err {
+			t.Fatal(err)
+		}
+		io.ReadAll(conn)
+		if got := conn.ConnectionState().PeerCertificates[0].Subject.CommonName; name != got {
+			t.Fatal(name, got)
+		}
+		conn.Close()
+	}
+}
+
+// serveTLS 以store的配置提供TLS服务
+func serveTLS(t *testing.T, store *tlsStore) net.Listener {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", store.config())
+	if nil != err {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if nil != err {
+				return
+			}
+			conn.Write([]byte("ok"))
+			conn.Close()
+		}
+	}()
+	return ln
+}
+
+func TestTicketKeyRotation(t *testing.T) {
+	cert := testCertificate(t, "v1")
+	object := Default().
+		SetTLS(func() (*tls.Certificate, error) { return cert, nil }, 0).
+		SetTicketKeyRotation(time.Hour)
+	if _, err := object.loadTLS(); nil != err {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := object.RotateTicketKeys(); nil != err {
+			t.Fatal(err)
+		}
+	}
+	if ticketKeyHistory != len(object.ticketKeys) {
+		t.Fatal(len(object.ticketKeys))
+	}
+
+	// 两个子进程收到同一份密钥，会话可在子进程之间恢复
+	stores := []*tlsStore{newTLSStore(), newTLSStore()}
+	var lns []net.Listener
+	for _, store := range stores {
+		if err := store.update(object.tlsMaterial); nil != err {
+			t.Fatal(err)
+		}
+		ln := serveTLS(t, store)
+		defer ln.Close()
+		lns = append(lns, ln)
+	}
+	config := &tls.Config{InsecureSkipVerify: true, ClientSessionCache: tls.NewLRUClientSessionCache(8)}
+	dial := func(ln net.Listener) bool {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), config)
+		if nil != err {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		// TLS 1.3的票据在首次读取时到达
+		io.ReadAll(conn)
+		return conn.ConnectionState().DidResume
+	}
+	dial(lns[0])
+	if !dial(lns[1]) {
+		t.Fatal("session not resumed across children")
+	}
+
+	// 轮换后旧票据仍可解密
+	object.RotateTicketKeys()
+	stores[0].update(object.tlsMaterial)
+	if !dial(lns[0]) {
+		t.Fatal("session not resumed after rotation")
+	}
+}
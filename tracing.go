@@ -0,0 +1,64 @@
+package daemon
+
+import (
+	"context"
+)
+
+// 更新流程的追踪片段名
+const (
+	SpanUpgrade = "daemon.upgrade"  // 一次更新
+	SpanSpawn   = "daemon.spawn"    // 派生新子进程
+	SpanReady   = "daemon.ready"    // 等待新子进程准备好
+	SpanDrain   = "daemon.drain"    // 等待旧子进程排空
+	SpanOldExit = "daemon.old_exit" // 等待旧子进程退出
+)
+
+// 追踪片段属性
+const (
+	AttrPid        = "process.pid"       // 子进程ID
+	AttrGeneration = "daemon.generation" // 子进程代数
+	AttrWorker     = "daemon.worker"     // 子进程序号
+	AttrBinaryHash = "daemon.binary.sha256"
+	AttrTrigger    = "daemon.trigger" // 更新来源
+)
+
+// Span 追踪片段
+type Span interface {
+	SetAttribute(key string, value interface{}) // 设置属性
+	End(err error)                              // 结束，err非空时标记失败
+}
+
+// Tracer 追踪器，可适配OpenTelemetry，或使用daemonotel直接以OTLP导出
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span) // 开始片段，ctx携带父片段
+}
+
+// noopSpan 未设置追踪器时使用
+type noopSpan struct{}
+
+// SetAttribute 忽略
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+
+// End 忽略
+func (noopSpan) End(err error) {}
+
+// SetTracer 设置追踪器，追踪派生、准备好、排空与旧子进程退出
+func (object *Daemon) SetTracer(tracer Tracer) *Daemon {
+	object.tracer = tracer
+	return object
+}
+
+// startSpan 开始片段
+func (object *Daemon) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	if nil == object.tracer {
+		return ctx, noopSpan{}
+	}
+	return object.tracer.Start(ctx, name)
+}
+
+// setChildAttributes 子进程相关属性
+func setChildAttributes(span Span, xCmdObj *XCmd) {
+	span.SetAttribute(AttrPid, xCmdObj.Pid())
+	span.SetAttribute(AttrGeneration, xCmdObj.worker.Generation)
+	span.SetAttribute(AttrWorker, xCmdObj.worker.Index)
+}
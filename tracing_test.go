@@ -0,0 +1,64 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"context"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// recordTracer 记录结束的片段名
+type recordTracer struct {
+	sync.Mutex
+	ended []string
+}
+
+// recordSpan 记录片段
+type recordSpan struct {
+	tracer *recordTracer
+	name   string
+}
+
+func (object *recordTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, &recordSpan{tracer: object, name: name}
+}
+
+func (object *recordSpan) SetAttribute(key string, value interface{}) {}
+
+func (object *recordSpan) End(err error) {
+	object.tracer.Lock()
+	defer object.tracer.Unlock()
+	object.tracer.ended = append(object.tracer.ended, object.name)
+}
+
+func TestUpgradeTracing(t *testing.T) {
+	tracer := &recordTracer{}
+	object, signalCh, doneCh := startFakeParent(t, withSetup(func(object *Daemon) {
+		object.SetTracer(tracer)
+	}))
+	tracer.Lock()
+	tracer.ended = nil
+	tracer.Unlock()
+	if err := object.Upgrade(); nil != err {
+		t.Fatal(err)
+	}
+	signalCh <- syscall.SIGTERM
+	if err := <-doneCh; nil != err {
+		t.Fatal(err)
+	}
+
+	tracer.Lock()
+	defer tracer.Unlock()
+	expected := []string{SpanSpawn, SpanReady, SpanDrain, SpanOldExit, SpanUpgrade}
+	if len(expected) != len(tracer.ended) {
+		t.Fatal(tracer.ended)
+	}
+	for i := range expected {
+		if expected[i] != tracer.ended[i] {
+			t.Fatal(tracer.ended)
+		}
+	}
+}
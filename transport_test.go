@@ -0,0 +1,151 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSocketTransport(t *testing.T) {
+	parent, err := NewSocketXCmd("true")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer parent.Close()
+	if 3 != parent.NextFd() || !isSocket(int(parent.childConn.Fd())) {
+		t.Fatal(parent.NextFd())
+	}
+
+	// 模拟子进程继承的fd
+	fd, err := syscall.Dup(int(parent.childConn.Fd()))
+	if nil != err {
+		t.Fatal(err)
+	}
+	child, err := XCmdFromSocket(fd)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if err = child.ChildWrite([]byte(ReadyOK)); nil != err {
+		t.Fatal(err)
+	}
+	var got string
+	if err = parent.ParentRead(func(raw []byte) bool {
+		got = string(raw)
+		return false
+	}); nil != err || ReadyOK != got {
+		t.Fatal(err, got)
+	}
+
+	// 同一连接双向通信，读超时可用
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err = child.ChildReadContext(ctx, func(raw []byte) bool { return true }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+	if err = parent.ParentWrite([]byte(ExitRequest)); nil != err {
+		t.Fatal(err)
+	}
+	if err = child.ChildRead(func(raw []byte) bool {
+		got = string(raw)
+		return false
+	}); nil != err || ExitRequest != got {
+		t.Fatal(err, got)
+	}
+
+	// 子进程关闭后父进程读到对端退出
+	child.Close()
+	parent.childConn.Close()
+	parent.childConn = nil
+	got = "none"
+	if err = parent.ParentRead(func(raw []byte) bool {
+		got = string(raw)
+		return false
+	}); nil != err || "" != got {
+		t.Fatal(err, got)
+	}
+}
+
+// selfProcess 以当前进程充当子进程，用于凭证校验
+type selfProcess struct {
+	execProcess
+}
+
+// Pid 当前进程ID
+func (object *selfProcess) Pid() int {
+	return os.Getpid()
+}
+
+func TestVerifyPeer(t *testing.T) {
+	for _, transport := range []Transport{TransportPipe, TransportSocketpair} {
+		parent, err := execRunner{transport: transport}.Command("true")
+		if nil != err {
+			t.Fatal(err)
+		}
+		var child *XCmd
+		if TransportSocketpair == transport {
+			fd, _ := syscall.Dup(int(parent.childConn.Fd()))
+			child, err = XCmdFromSocket(fd)
+		} else {
+			// 子进程继承的写端
+			child = &XCmd{writePipe: (&XPipe{maxMessageSize: DefaultMaxMessageSize}).SetWritePipe(parent.childPipes[1])}
+		}
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		// 未启动的子进程pid不匹配
+		child.SendCredentials()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		if err = parent.VerifyPeer(ctx); !errors.Is(err, ErrPeerCredentials) {
+			t.Fatal(transport, err)
+		}
+
+		// 不携带内核凭证的传输即使pid匹配也不通过
+		parent.proc = &selfProcess{}
+		child.SendCredentials()
+		err = parent.VerifyPeer(ctx)
+		if kernel := TransportSocketpair == transport && socketCredentials; kernel && nil != err ||
+			!kernel && !errors.Is(err, ErrPeerCredentials) {
+			t.Fatal(transport, err)
+		}
+		cancel()
+		parent.Close()
+		if TransportSocketpair == transport {
+			child.Close()
+		}
+	}
+}
+
+func TestVerifyPeerConfig(t *testing.T) {
+	for _, transport := range []Transport{TransportPipe, TransportSocketpair} {
+		object := Default().SetTransport(transport).SetVerifyPeer(true)
+		object.pidFile = filepath.Join(t.TempDir(), "daemonPID")
+		object.origArgs = []string{"app"}
+		if !socketCredentials || TransportPipe == transport {
+			// 派生子进程前失败，不写PID
+			if err := object.runAsParent(make(chan os.Signal)); !errors.Is(err, ErrTransport) {
+				t.Fatal(transport, err)
+			}
+			if _, err := os.Stat(object.pidFile); !os.IsNotExist(err) {
+				t.Fatal(transport, err)
+			}
+		} else if err := object.checkVerifyPeer(); nil != err {
+			t.Fatal(transport, err)
+		}
+	}
+
+	// 自定义的运行器自行决定传输方式
+	object, _ := newFakeDaemon(fakeChild)
+	object.SetVerifyPeer(true)
+	if err := object.checkVerifyPeer(); socketCredentials && nil != err || !socketCredentials && !errors.Is(err, ErrTransport) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,110 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"syscall"
+)
+
+// sharedConn 读写两个XPipe共用的连接，两端都关闭后才关闭连接
+type sharedConn struct {
+	*net.UnixConn
+	refs int32 // 引用计数
+}
+
+// connEnd 连接的一端引用
+type connEnd struct {
+	*sharedConn
+	closed int32
+}
+
+// Close 释放引用
+func (object *connEnd) Close() error {
+	if !atomic.CompareAndSwapInt32(&object.closed, 0, 1) {
+		return nil
+	}
+	if 0 == atomic.AddInt32(&object.refs, -1) {
+		return object.UnixConn.Close()
+	}
+	return nil
+}
+
+// socketXPipes 由连接构建读写两个XPipe
+func socketXPipes(conn *net.UnixConn) (readPipe, writePipe *XPipe) {
+	shared := &sharedConn{UnixConn: conn, refs: 2}
+	readPipe = &XPipe{reader: &connEnd{sharedConn: shared}, maxMessageSize: DefaultMaxMessageSize}
+	writePipe = &XPipe{writer: &connEnd{sharedConn: shared}, maxMessageSize: DefaultMaxMessageSize}
+	return
+}
+
+// fileUnixConn 由文件构建unix连接，文件随即关闭
+func fileUnixConn(f *os.File) (conn *net.UnixConn, err error) {
+	defer f.Close()
+	var c net.Conn
+	if c, err = net.FileConn(f); nil != err {
+		return
+	}
+	conn, ok := c.(*net.UnixConn)
+	if !ok {
+		c.Close()
+		err = ErrTransport
+	}
+	return
+}
+
+// NewSocketXCmd 工厂方法，父子进程通过socketpair通信，子进程端固定为fd 3
+func NewSocketXCmd(name string, arg ...string) (object *XCmd, err error) {
+	syscall.ForkLock.RLock()
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if nil == err {
+		syscall.CloseOnExec(fds[0])
+		syscall.CloseOnExec(fds[1])
+	}
+	syscall.ForkLock.RUnlock()
+	if nil != err {
+		err = os.NewSyscallError("socketpair", err)
+		return
+	}
+
+	object = &XCmd{Cmd: exec.Command(name, arg...)}
+	object.proc = &execProcess{cmd: object.Cmd}
+	object.childConn = os.NewFile(uintptr(fds[1]), "childSocket")
+	if object.conn, err = fileUnixConn(os.NewFile(uintptr(fds[0]), "parentSocket")); nil != err {
+		object.childConn.Close()
+		return
+	}
+	if err = setPassCred(object.conn); nil != err {
+		object.conn.Close()
+		object.childConn.Close()
+		return
+	}
+	object.readPipe, object.writePipe = socketXPipes(object.conn)
+	object.ExtraFiles = []*os.File{object.childConn}
+	object.nextFd = 2 + len(object.ExtraFiles)
+	return
+}
+
+// XCmdFromSocket 子进程由继承的socket构建
+func XCmdFromSocket(fd int) (object *XCmd, err error) {
+	object = &XCmd{}
+	if object.conn, err = fileUnixConn(os.NewFile(uintptr(fd), "socket")); nil != err {
+		return
+	}
+	object.readPipe, object.writePipe = socketXPipes(object.conn)
+	object.nextFd = 5
+	return
+}
+
+// isSocket fd是否为socket
+func isSocket(fd int) bool {
+	var stat syscall.Stat_t
+	if err := syscall.Fstat(fd, &stat); nil != err {
+		return false
+	}
+	return syscall.S_IFSOCK == stat.Mode&syscall.S_IFMT
+}
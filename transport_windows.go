@@ -0,0 +1,8 @@
+package daemon
+
+import "fmt"
+
+// NewSocketXCmd Windows不支持socketpair传输
+func NewSocketXCmd(name string, arg ...string) (*XCmd, error) {
+	return nil, fmt.Errorf("%w: socketpair on windows", ErrTransport)
+}
@@ -0,0 +1,13 @@
+package daemon
+
+import (
+	"os"
+)
+
+// removeSocketFile 删除unix socket文件，网络侦听与抽象命名空间的socket没有文件
+func removeSocketFile(network, address string) {
+	if !isUnixNetwork(network) || 0 >= len(address) || isAbstractSocket(address) {
+		return
+	}
+	os.Remove(address)
+}
@@ -0,0 +1,109 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Webhook 生命周期事件的HTTP回调，事件以JSON POST到URL
+type Webhook struct {
+	URL     string            // 回调地址
+	Headers map[string]string // 附加请求头，如Authorization
+	Events  []string          // 关注的事件类型，为空时使用DefaultWebhookEvents
+	Retries int               // 失败后的重试次数
+	Backoff time.Duration     // 首次重试间隔，之后每次翻倍
+	Timeout time.Duration     // 单次请求超时
+}
+
+// DefaultWebhookEvents 默认关注的事件
+var DefaultWebhookEvents = []string{
+	EventChildCrashed,
+	EventUpgradeFailed,
+	EventRestartBudgetExhausted,
+	EventFdLeak,
+}
+
+// webhooks 进行中的回调，退出前等待发送完成
+type webhooks struct {
+	sync.WaitGroup
+}
+
+// AddWebhook 添加事件回调，在协程中发送，不阻塞守护进程
+func (object *Daemon) AddWebhook(hook Webhook) *Daemon {
+	if 0 >= len(hook.Events) {
+		hook.Events = DefaultWebhookEvents
+	}
+	if 0 >= hook.Timeout {
+		hook.Timeout = 5 * time.Second
+	}
+	if 0 >= hook.Backoff {
+		hook.Backoff = time.Second
+	}
+	client := &http.Client{Timeout: hook.Timeout}
+	pending := object.webhooks
+	return object.OnEvent(func(event Event) {
+		if !hook.wants(event.Type) {
+			return
+		}
+		pending.Add(1)
+		go func() {
+			defer pending.Done()
+			if err := hook.send(client, event); nil != err {
+				glog.Error(err)
+			}
+		}()
+	})
+}
+
+// wants 是否关注该事件
+func (object *Webhook) wants(eventType string) bool {
+	for _, t := range object.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// send 发送事件，失败时按退避间隔重试
+func (object *Webhook) send(client *http.Client, event Event) (err error) {
+	var body []byte
+	if body, err = json.Marshal(event); nil != err {
+		return
+	}
+	backoff := object.Backoff
+	for attempt := 0; ; attempt++ {
+		if err = object.post(client, body); nil == err || attempt >= object.Retries {
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post 发送一次
+func (object *Webhook) post(client *http.Client, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, object.URL, bytes.NewReader(body))
+	if nil != err {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range object.Headers {
+		req.Header.Set(key, value)
+	}
+	var rsp *http.Response
+	if rsp, err = client.Do(req); nil != err {
+		return err
+	}
+	rsp.Body.Close()
+	if http.StatusOK > rsp.StatusCode || http.StatusMultipleChoices <= rsp.StatusCode {
+		return fmt.Errorf("daemon: webhook %s: %s", object.URL, rsp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhook(t *testing.T) {
+	var lock sync.Mutex
+	var events []Event
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		attempts++
+		if 1 == attempts {
+			// 首次失败，触发重试
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if "secret" != r.Header.Get("X-Token") {
+			t.Error("header missing")
+		}
+		var event Event
+		if err := json.NewDecoder(r.Body).Decode(&event); nil != err {
+			t.Error(err)
+		}
+		events = append(events, event)
+	}))
+	defer srv.Close()
+
+	object := New("child", "upgrade", "bootstrap_args", "", "").AddWebhook(Webhook{
+		URL:     srv.URL,
+		Headers: map[string]string{"X-Token": "secret"},
+		Retries: 2,
+		Backoff: 10 * time.Millisecond,
+	})
+	object.emit(Event{Type: EventChildExited, Pid: 1})
+	object.emit(Event{Type: EventChildCrashed, Pid: 2, Reason: ExitCrash})
+	object.webhooks.Wait()
+
+	lock.Lock()
+	defer lock.Unlock()
+	if 2 != attempts || 1 != len(events) || EventChildCrashed != events[0].Type || 2 != events[0].Pid {
+		t.Fatal(attempts, events)
+	}
+}
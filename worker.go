@@ -0,0 +1,68 @@
+package daemon
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 子进程身份的环境变量
+const (
+	EnvWorkerIndex      = "DAEMON_WORKER_INDEX"      // 工作进程序号
+	EnvWorkerGeneration = "DAEMON_WORKER_GENERATION" // 代数
+)
+
+// WorkerInfo 子进程身份，可用于分片、命名指标与日志上下文
+type WorkerInfo struct {
+	Index      int    `json:"index"`      // 工作进程序号，从0开始，更新与重启后不变
+	Generation uint64 `json:"generation"` // 代数，父进程每派生一次子进程加一，前台运行时为0
+}
+
+// env 写入环境变量
+func (object WorkerInfo) env(env []string) []string {
+	if nil == env {
+		env = os.Environ()
+	}
+	env = setEnv(env, EnvWorkerIndex, strconv.Itoa(object.Index))
+	return setEnv(env, EnvWorkerGeneration, strconv.FormatUint(object.Generation, 10))
+}
+
+// bootstrapMeta 引导参数
+type bootstrapMeta struct {
+	Listeners  []ListenerInfo `json:"listeners"`             // 继承的侦听
+	Worker     WorkerInfo     `json:"worker"`                // 子进程身份
+	Handoff    int            `json:"handoff,omitempty"`     // 接收父进程分发连接的fd，0表示没有
+	Heartbeat  time.Duration  `json:"heartbeat,omitempty"`   // 准备好之前发送心跳的间隔，0表示不发送
+	Liveness   time.Duration  `json:"liveness,omitempty"`    // 准备好之后发送心跳的间隔，0表示不发送
+	PrivateTmp bool           `json:"private_tmp,omitempty"` // 在新建的挂载空间中为/tmp挂载私有的tmpfs
+	CPUs       []int          `json:"cpus,omitempty"`        // 绑定的CPU，为空时不绑定
+	Secrets    bool           `json:"secrets,omitempty"`     // 启动后经管道下发机密
+	Key        int            `json:"key,omitempty"`         // 读取通信密钥的fd，0表示不加密
+	DryRun     bool           `json:"dry_run,omitempty"`     // 更新前的启动校验
+	Fds        map[string]int `json:"fds,omitempty"`         // 命名的fd槽位，优先于按位置的fd
+	Deploy     *Deploy        `json:"deploy,omitempty"`      // 所属的部署
+	Umask      *int           `json:"umask,omitempty"`       // 子进程的umask，nil时继承父进程的
+}
+
+// parseBootstrapMeta 解析引导参数，兼容旧版父进程只传侦听的格式
+func parseBootstrapMeta(raw string) (meta bootstrapMeta, err error) {
+	if strings.HasPrefix(strings.TrimSpace(raw), "{") {
+		fields := make(map[string]json.RawMessage)
+		if err = json.Unmarshal([]byte(raw), &fields); nil != err {
+			return
+		}
+		if listeners, ok := fields["listeners"]; ok && strings.HasPrefix(string(listeners), "[") {
+			err = json.Unmarshal([]byte(raw), &meta)
+			return
+		}
+	}
+	meta.Listeners, err = parseBootstrapArgs(raw)
+	return
+}
+
+// Worker 子进程身份
+func (object *Registry) Worker() WorkerInfo {
+	return object.worker
+}
@@ -0,0 +1,39 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWorkerInfo(t *testing.T) {
+	workers := make(chan WorkerInfo, 2)
+	object, _ := newFakeDaemon(func(xCmdObj *XCmd, args []string) error {
+		meta, err := parseBootstrapMeta(strings.TrimPrefix(args[len(args)-1], "--bootstrap_args="))
+		if nil != err {
+			return xCmdObj.ChildWrite([]byte(ReadyError))
+		}
+		workers <- meta.Worker
+		return fakeChild(xCmdObj, args)
+	})
+	for i := 0; i < 2; i++ {
+		if ok, err := object.replaceChildProcess(nil); !ok || nil != err {
+			t.Fatal(ok, err)
+		}
+	}
+	if first, second := <-workers, <-workers; 1 != first.Generation || 2 != second.Generation || 0 != second.Index {
+		t.Fatal(first, second)
+	}
+	env := strings.Join(object.xCmdObj.Env, "\n")
+	if !strings.Contains(env, EnvWorkerIndex+"=0") || !strings.Contains(env, EnvWorkerGeneration+"=2") {
+		t.Fatal("worker env missing")
+	}
+	stopFakeDaemon(t, object)
+
+	// 旧版父进程只传侦听
+	if meta, err := parseBootstrapMeta(`[{"name":"web","fd":5}]`); nil != err || 5 != meta.Listeners[0].Fd {
+		t.Fatal(meta, err)
+	}
+}
@@ -1,6 +1,9 @@
 package daemon
 
 import (
+	"context"
+	"io"
+	"net"
 	"os"
 	"os/exec"
 )
@@ -8,35 +11,78 @@ import (
 // XCmd 扩展Cmd
 type XCmd struct {
 	*exec.Cmd
-	nextFd    int
-	readPipe  *XPipe
-	writePipe *XPipe
+	proc         Process
+	startErr     error // 启动前准备失败的错误，如继承文件、新建命名空间，Start时返回
+	nextFd       int
+	readPipe     *XPipe
+	writePipe    *XPipe
+	conn         *net.UnixConn      // socketpair传输时本端的连接
+	childConn    *os.File           // socketpair传输时子进程端，启动后关闭
+	childPipes   []*os.File         // 管道传输时子进程继承的一端，启动后关闭
+	handoff      *net.UnixConn      // 父进程分发连接的socket，父进程端有效
+	handoffChild *os.File           // 分发连接socket的子进程端，启动后关闭
+	worker       WorkerInfo         // 子进程身份，父进程端有效
+	events       chan streamMessage // 子进程发来的控制与排空消息，父进程端有效
+	eventReaders int32              // 正在读取events的数量，父进程端有效
+	load         uint64             // 子进程最近上报的负载(math.Float64bits)，父进程端有效
+	loadSet      int32              // 子进程是否上报过负载
+	build        *BuildInfo         // 子进程上报的构建信息，父进程端有效
+	gates        *readiness         // 子进程上报的准备好条件，父进程端有效
+	replaced     int32              // 已被新子进程替换，退出属于正常更新，父进程端有效
+	lastBeat     int64              // 最近一次收到心跳的时间(UnixNano)，父进程端有效
+	fdSlots      map[string]int     // 命名的fd槽位，经引导参数告知子进程
+	deploy       *Deploy            // 所属的部署，父进程端有效
+	ipcLost      int32              // 通信管道已断开而进程仍在运行，只能以信号控制，父进程端有效
+	exited       chan struct{}      // 子进程退出并回收后关闭，父进程端有效
 }
 
 // XCmdFromFd 从FD构建
 func XCmdFromFd(readFd, writeFd int) *XCmd {
 	object := &XCmd{
-		readPipe:  &XPipe{},
-		writePipe: &XPipe{},
+		readPipe:  &XPipe{maxMessageSize: DefaultMaxMessageSize},
+		writePipe: &XPipe{maxMessageSize: DefaultMaxMessageSize},
 	}
-	object.readPipe.SetReadPipe(os.NewFile(uintptr(readFd), "readPipe"))
-	object.writePipe.SetWritePipe(os.NewFile(uintptr(writeFd), "writePipe"))
+	object.readPipe.SetReadPipe(newPipeFile(readFd, "readPipe"))
+	object.writePipe.SetWritePipe(newPipeFile(writeFd, "writePipe"))
 	object.nextFd = 5
 	return object
 }
 
 // NewXCmd 工厂方法
-func NewXCmd(name string, arg ...string) *XCmd {
-	object := &XCmd{Cmd: exec.Command(name, arg...)}
-	object.readPipe = NewXPipe()
-	object.writePipe = NewXPipe()
-	object.ExtraFiles = []*os.File{object.writePipe.GetReadPipe(), object.readPipe.GetWritePipe()}
-	object.nextFd = 2 + len(object.ExtraFiles)
-	return object
+func NewXCmd(name string, arg ...string) (object *XCmd, err error) {
+	object = &XCmd{Cmd: exec.Command(name, arg...)}
+	object.proc = &execProcess{cmd: object.Cmd}
+	if object.readPipe, err = NewXPipe(); nil != err {
+		return
+	}
+	if object.writePipe, err = NewXPipe(); nil != err {
+		object.readPipe.Close()
+		return
+	}
+	if err = object.inheritPipes(); nil != err {
+		object.Close()
+		return
+	}
+	// 父进程只保留各自的一端，子进程继承的一端启动后关闭
+	object.childPipes = []*os.File{object.writePipe.GetReadPipe(), object.readPipe.GetWritePipe()}
+	object.readPipe, object.writePipe = object.readPipe.ReadEnd(), object.writePipe.WriteEnd()
+	return
 }
 
 // Close 关闭
 func (object *XCmd) Close() (err error) {
+	object.closeChildPipes()
+	if nil != object.childConn {
+		object.childConn.Close()
+		object.childConn = nil
+	}
+	if nil != object.handoffChild {
+		object.handoffChild.Close()
+		object.handoffChild = nil
+	}
+	if nil != object.handoff {
+		object.handoff.Close()
+	}
 	if nil != object.readPipe {
 		err = object.readPipe.Close()
 	}
@@ -49,18 +95,93 @@ func (object *XCmd) Close() (err error) {
 	return
 }
 
-// NextFd 进程下一个可用的Fd
-func (object *XCmd) NextFd() int {
-	return object.nextFd
+// Start 启动进程
+func (object *XCmd) Start() error {
+	if nil != object.startErr {
+		return object.startErr
+	}
+	if err := object.proc.Start(); nil != err {
+		return err
+	}
+	object.closeChildPipes()
+	if nil != object.childConn {
+		// 子进程已继承，关闭本端副本以便感知对端退出
+		object.childConn.Close()
+		object.childConn = nil
+	}
+	if nil != object.handoffChild {
+		object.handoffChild.Close()
+		object.handoffChild = nil
+	}
+	return nil
+}
+
+// closeChildPipes 关闭子进程继承的管道端
+func (object *XCmd) closeChildPipes() {
+	for _, f := range object.childPipes {
+		f.Close()
+	}
+	object.childPipes = nil
+}
+
+// Wait 等待进程退出
+func (object *XCmd) Wait() error {
+	return object.proc.Wait()
+}
+
+// Kill 强杀进程
+func (object *XCmd) Kill() error {
+	return object.proc.Kill()
+}
+
+// Signal 发送信号
+func (object *XCmd) Signal(sig os.Signal) error {
+	return object.proc.Signal(sig)
+}
+
+// Release 释放进程资源
+func (object *XCmd) Release() error {
+	return object.proc.Release()
+}
+
+// Pid 进程ID
+func (object *XCmd) Pid() int {
+	return object.proc.Pid()
+}
+
+// SetMaxMessageSize 设置收发消息的最大长度
+func (object *XCmd) SetMaxMessageSize(maxMessageSize int) *XCmd {
+	object.readPipe.SetMaxMessageSize(maxMessageSize)
+	object.writePipe.SetMaxMessageSize(maxMessageSize)
+	return object
+}
+
+// SetChecksum 设置写入时是否附带校验和
+func (object *XCmd) SetChecksum(checksum bool) *XCmd {
+	object.readPipe.SetChecksum(checksum)
+	object.writePipe.SetChecksum(checksum)
+	return object
+}
+
+// SetGeneration 设置父子进程通信附带的子进程代数
+func (object *XCmd) SetGeneration(generation uint64) *XCmd {
+	object.readPipe.SetGeneration(generation)
+	object.writePipe.SetGeneration(generation)
+	return object
 }
 
-// AddFile 添加文件
-func (object *XCmd) AddFile(f *os.File) *XCmd {
-	object.ExtraFiles = append(object.ExtraFiles, f)
-	object.nextFd++
+// SetCompression 设置写入时的压缩
+func (object *XCmd) SetCompression(codecID byte, threshold int) *XCmd {
+	object.readPipe.SetCompression(codecID, threshold)
+	object.writePipe.SetCompression(codecID, threshold)
 	return object
 }
 
+// NextFd 进程下一个可用的Fd
+func (object *XCmd) NextFd() int {
+	return object.nextFd
+}
+
 // ParentWrite 父进程写
 func (object *XCmd) ParentWrite(raw []byte) (err error) {
 	err = object.writePipe.Write(raw)
@@ -84,3 +205,58 @@ func (object *XCmd) ChildRead(callback func(raw []byte) bool) (err error) {
 	err = object.readPipe.Read(callback)
 	return
 }
+
+// ParentWriteContext 父进程可取消的写
+func (object *XCmd) ParentWriteContext(ctx context.Context, raw []byte) error {
+	return object.writePipe.WriteContext(ctx, raw)
+}
+
+// ParentReadContext 父进程可取消的读
+func (object *XCmd) ParentReadContext(ctx context.Context, callback func(raw []byte) bool) error {
+	return object.readPipe.ReadContext(ctx, callback)
+}
+
+// ChildWriteContext 子进程可取消的写
+func (object *XCmd) ChildWriteContext(ctx context.Context, raw []byte) error {
+	return object.writePipe.WriteContext(ctx, raw)
+}
+
+// ChildReadContext 子进程可取消的读
+func (object *XCmd) ChildReadContext(ctx context.Context, callback func(raw []byte) bool) error {
+	return object.readPipe.ReadContext(ctx, callback)
+}
+
+// ParentWriteStream 父进程写指定通道
+func (object *XCmd) ParentWriteStream(stream uint32, raw []byte) error {
+	return object.writePipe.WriteStream(stream, raw)
+}
+
+// ParentWriteStreamContext 父进程可取消的写指定通道
+func (object *XCmd) ParentWriteStreamContext(ctx context.Context, stream uint32, raw []byte) error {
+	return object.writePipe.WriteStreamContext(ctx, stream, raw)
+}
+
+// ParentReadStreams 父进程读所有通道
+func (object *XCmd) ParentReadStreams(callback func(stream uint32, raw []byte) bool) error {
+	return object.readPipe.ReadStreams(callback)
+}
+
+// ParentReadStreamsContext 父进程可取消的读所有通道
+func (object *XCmd) ParentReadStreamsContext(ctx context.Context, callback func(stream uint32, raw []byte) bool) error {
+	return object.readPipe.ReadStreamsContext(ctx, callback)
+}
+
+// ChildWriteStream 子进程写指定通道
+func (object *XCmd) ChildWriteStream(stream uint32, raw []byte) error {
+	return object.writePipe.WriteStream(stream, raw)
+}
+
+// ChildReadStreams 子进程读所有通道
+func (object *XCmd) ChildReadStreams(callback func(stream uint32, raw []byte) bool) error {
+	return object.readPipe.ReadStreams(callback)
+}
+
+// OpenStream 打开与对端之间名为name的逻辑通道，父子进程均可调用
+func (object *XCmd) OpenStream(name string) (io.ReadWriteCloser, error) {
+	return object.readPipe.openStream(name, object.writePipe)
+}
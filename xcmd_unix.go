@@ -0,0 +1,29 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"os"
+	"syscall"
+)
+
+// newPipeFile 由继承的fd构建管道文件，设为非阻塞以支持读写超时
+func newPipeFile(fd int, name string) *os.File {
+	syscall.SetNonblock(fd, true)
+	return os.NewFile(uintptr(fd), name)
+}
+
+// inheritPipes 子进程通过ExtraFiles继承管道，固定为fd 3、4
+func (object *XCmd) inheritPipes() error {
+	object.ExtraFiles = []*os.File{object.writePipe.GetReadPipe(), object.readPipe.GetWritePipe()}
+	object.nextFd = 2 + len(object.ExtraFiles)
+	return nil
+}
+
+// AddFile 添加文件
+func (object *XCmd) AddFile(f *os.File) *XCmd {
+	object.ExtraFiles = append(object.ExtraFiles, f)
+	object.nextFd++
+	return object
+}
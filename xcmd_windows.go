@@ -0,0 +1,54 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// PipeHandlesEnv 子进程通信管道句柄环境变量，Windows不支持ExtraFiles
+const PipeHandlesEnv = "DAEMON_PIPE_HANDLES"
+
+// newPipeFile 由继承的句柄构建管道文件
+func newPipeFile(fd int, name string) *os.File {
+	return os.NewFile(uintptr(fd), name)
+}
+
+// inheritHandle 继承句柄
+func (object *XCmd) inheritHandle(f *os.File) (err error) {
+	if nil == object.SysProcAttr {
+		object.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	h := syscall.Handle(f.Fd())
+	if err = syscall.SetHandleInformation(h,
+		syscall.HANDLE_FLAG_INHERIT,
+		syscall.HANDLE_FLAG_INHERIT); nil != err {
+		return
+	}
+	object.SysProcAttr.AdditionalInheritedHandles = append(object.SysProcAttr.AdditionalInheritedHandles, h)
+	return
+}
+
+// inheritPipes 子进程通过句柄列表继承管道，句柄值经环境变量传递
+func (object *XCmd) inheritPipes() (err error) {
+	readPipe := object.writePipe.GetReadPipe()
+	writePipe := object.readPipe.GetWritePipe()
+	if err = object.inheritHandle(readPipe); nil != err {
+		return
+	}
+	if err = object.inheritHandle(writePipe); nil != err {
+		return
+	}
+	object.Env = append(os.Environ(),
+		fmt.Sprintf("%s=%d,%d", PipeHandlesEnv, readPipe.Fd(), writePipe.Fd()))
+	return
+}
+
+// AddFile 添加文件，NextFd返回该文件的句柄值，继承失败时由Start返回错误
+func (object *XCmd) AddFile(f *os.File) *XCmd {
+	if err := object.inheritHandle(f); nil != err && nil == object.startErr {
+		object.startErr = err
+	}
+	object.nextFd = int(f.Fd())
+	return object
+}